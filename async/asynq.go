@@ -9,6 +9,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/wfusion/gofusion/log"
+	"go.uber.org/atomic"
 	"go.uber.org/multierr"
 
 	"github.com/wfusion/gofusion/common/infra/asynq"
@@ -26,6 +27,8 @@ import (
 
 const (
 	asyncqTaskTypenameField = "typename"
+
+	asynqHealthCheckInterval = 15 * time.Second
 )
 
 var (
@@ -42,15 +45,27 @@ type asynqConsumer struct {
 	mws      []asynq.MiddlewareFunc
 	logger   asynq.Logger
 	consumer *asynq.Server
+	rdsCli   rdsDrv.UniversalClient
+
+	// heartbeat is the latest health check result of the asynq server
+	heartbeatAt  *atomic.Time
+	heartbeatErr *atomic.Error
 }
 
 func newAsynqConsumer(ctx context.Context, appName, name string, conf *Conf) Consumable {
-	consumer := &asynqConsumer{appName: appName, n: name, c: conf}
+	consumer := &asynqConsumer{
+		appName:      appName,
+		n:            name,
+		c:            conf,
+		heartbeatAt:  atomic.NewTime(time.Time{}),
+		heartbeatErr: atomic.NewError(nil),
+	}
 
 	var rdsCli rdsDrv.UniversalClient
 	switch conf.InstanceType {
 	case instanceTypeRedis:
 		rdsCli = redis.Use(ctx, conf.Instance, redis.AppName(appName))
+		consumer.rdsCli = rdsCli
 	case instanceTypeDB:
 		fallthrough
 	default:
@@ -88,8 +103,8 @@ func newAsynqConsumer(ctx context.Context, appName, name string, conf *Conf) Con
 		Logger:                   consumer.logger,
 		LogLevel:                 logLevel,
 		ShutdownTimeout:          8 * time.Second,
-		HealthCheckFunc:          func(err error) { consumer.warn(ctx, "health check check failed: %s", err) },
-		HealthCheckInterval:      15 * time.Second,
+		HealthCheckFunc:          consumer.heartbeat,
+		HealthCheckInterval:      asynqHealthCheckInterval,
 		DelayedTaskCheckInterval: 5 * time.Second,
 		GroupGracePeriod:         1 * time.Minute,
 		GroupMaxDelay:            0,
@@ -208,6 +223,26 @@ func (a *asynqConsumer) shutdown() (err error) {
 	return
 }
 
+func (a *asynqConsumer) heartbeat(err error) {
+	if err != nil {
+		a.warn(context.Background(), "health check check failed: %s", err)
+	}
+	a.heartbeatErr.Store(err)
+	a.heartbeatAt.Store(time.Now())
+}
+
+// ping reports the latest heartbeat of the asynq server, or pings the broker if the server is not started yet
+func (a *asynqConsumer) ping(ctx context.Context) (err error) {
+	heartbeatAt := a.heartbeatAt.Load()
+	if heartbeatAt.IsZero() {
+		return a.rdsCli.Ping(ctx).Err()
+	}
+	if elapsed := time.Since(heartbeatAt); elapsed > 3*asynqHealthCheckInterval {
+		return errors.Errorf("asynq server heartbeat is stale for %s", elapsed)
+	}
+	return a.heartbeatErr.Load()
+}
+
 func (a *asynqConsumer) gatewayMiddleware(next asynq.Handler) asynq.Handler {
 	return asynq.HandlerFunc(func(ctx context.Context, raw *asynq.Task) (err error) {
 		taskName := a.unformatTaskName(raw.Type())
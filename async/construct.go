@@ -11,6 +11,7 @@ import (
 	"github.com/wfusion/gofusion/common/di"
 	"github.com/wfusion/gofusion/common/utils"
 	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/health"
 
 	_ "github.com/wfusion/gofusion/log/customlogger"
 )
@@ -39,6 +40,7 @@ func Construct(ctx context.Context, confs map[string]*Conf, opts ...utils.Option
 		app := config.Use(opt.AppName).AppName()
 		if consumers != nil {
 			for name, router := range consumers[opt.AppName] {
+				health.Unregister(config.ComponentAsync, name, health.AppName(opt.AppName))
 				log.Printf("%v [Gofusion] %s %s %s exiting...", pid, app, config.ComponentAsync, name)
 				if err := router.shutdown(); err == nil {
 					log.Printf("%v [Gofusion] %s %s %s exited", pid, app, config.ComponentAsync, name)
@@ -87,6 +89,7 @@ func addInstance(ctx context.Context, name string, conf *Conf, opt *config.InitO
 			panic(ErrDuplicatedInstanceName)
 		}
 		consumers[opt.AppName][name] = consumer
+		health.Register(config.ComponentAsync, name, consumer.ping, health.AppName(opt.AppName))
 
 		// ioc
 		if opt.DI != nil {
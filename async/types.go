@@ -39,6 +39,7 @@ type Consumable interface {
 	HandleFunc(fn any, opts ...utils.OptionExtender)
 	Serve() error
 	Start() error
+	ping(ctx context.Context) error
 	shutdown() error
 }
 
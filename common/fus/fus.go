@@ -12,7 +12,9 @@ import (
 	"github.com/wfusion/gofusion/common/fus/debug"
 	"github.com/wfusion/gofusion/common/fus/encode"
 	"github.com/wfusion/gofusion/common/fus/gorm"
+	"github.com/wfusion/gofusion/common/fus/migrate"
 	"github.com/wfusion/gofusion/common/fus/mill"
+	"github.com/wfusion/gofusion/common/fus/reshard"
 	"github.com/wfusion/gofusion/common/fus/rnd"
 )
 
@@ -41,6 +43,8 @@ Capability:
   asynq client integrated
   watermill client with pubsub kafka, ampq, and io enabled integerate
   gorm gentool integerate
+  db versioned sql migrations
+  db online resharding of table sharded models
   encoder&decoder with cipher, compress, and print encoding
   random bytes generater
 `,
@@ -64,6 +68,12 @@ Capability:
 	// gorm gen-tool
 	rootCmd.AddCommand(gorm.Command())
 
+	// db migrations
+	rootCmd.AddCommand(migrate.Command())
+
+	// db resharding
+	rootCmd.AddCommand(reshard.Command())
+
 	// encode, decode
 	rootCmd.AddCommand(encode.EncCommand(), encode.DecCommand())
 
@@ -0,0 +1,173 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm/migrate"
+)
+
+var (
+	dsn      string
+	dbType   string
+	dir      string
+	table    string
+	sharding []string
+
+	upSteps   int
+	downSteps int
+)
+
+func Command() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "A CLI for db versioned sql migrations",
+		Long: `A CLI for db versioned sql migrations, go migrations registered by db.AddMigration can only be
+applied by the application itself`,
+	}
+	rootCmd.PersistentFlags().StringVar(&dsn, "dsn", "",
+		"consult[https://gorm.io/docs/connecting_to_the_database.html]")
+	rootCmd.PersistentFlags().StringVar(&dbType, "db", "mysql", "input mysql|postgres|sqlite|sqlserver")
+	rootCmd.PersistentFlags().StringVar(&dir, "dir", "migrations", "directory of sql migrations")
+	rootCmd.PersistentFlags().StringVar(&table, "table", migrate.DefaultTable, "migration history table")
+	rootCmd.PersistentFlags().StringArrayVar(&sharding, "sharding", nil,
+		"physical tables of a sharded table, e.g. user=user_0,user_1")
+
+	upCmd := &cobra.Command{
+		Use:     "up",
+		Short:   "Apply pending migrations",
+		Example: "  fus migrate up --db mysql --dsn 'root:pwd@tcp(127.0.0.1:3306)/db' --sharding user=user_0,user_1",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			m, err := newMigrator()
+			if err != nil {
+				return
+			}
+			applied, err := m.Up(cmd.Context(), upSteps)
+			for _, mig := range applied {
+				fmt.Printf("migrated up %v %s\n", mig.Version, mig.Name)
+			}
+			return
+		},
+	}
+	upCmd.Flags().IntVar(&upSteps, "steps", 0, "number of migrations to apply, all pending if not positive")
+
+	downCmd := &cobra.Command{
+		Use:   "down",
+		Short: "Roll back applied migrations",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			m, err := newMigrator()
+			if err != nil {
+				return
+			}
+			rolledBack, err := m.Down(cmd.Context(), downSteps)
+			for _, mig := range rolledBack {
+				fmt.Printf("migrated down %v %s\n", mig.Version, mig.Name)
+			}
+			return
+		},
+	}
+	downCmd.Flags().IntVar(&downSteps, "steps", 1, "number of migrations to roll back")
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "List migrations with their applying status",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			m, err := newMigrator()
+			if err != nil {
+				return
+			}
+			status, err := m.Status(cmd.Context())
+			if err != nil {
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+			for _, s := range status {
+				state, appliedAt := "pending", ""
+				if s.Applied {
+					state, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+				}
+				if s.Missing {
+					state = "missing"
+				}
+				_, _ = fmt.Fprintf(w, "%v\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+			}
+			return w.Flush()
+		},
+	}
+
+	createCmd := &cobra.Command{
+		Use:     "create [flags] [name]",
+		Short:   "Create up and down sql files of a new migration",
+		Example: "  fus migrate create --dir migrations add_user_email",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			files, err := migrate.Create(dir, args[0], time.Now())
+			for _, file := range files {
+				fmt.Printf("created %s\n", file)
+			}
+			return
+		},
+	}
+
+	rootCmd.AddCommand(upCmd, downCmd, statusCmd, createCmd)
+	return rootCmd
+}
+
+func newMigrator() (m *migrate.Migrator, err error) {
+	db, err := connectDB(dbType, dsn)
+	if err != nil {
+		return
+	}
+	migrations, err := migrate.Load(dir)
+	if err != nil {
+		return
+	}
+
+	shards := make(map[string][]string, len(sharding))
+	for _, s := range sharding {
+		logical, physical, ok := strings.Cut(s, "=")
+		if !ok || logical == "" || physical == "" {
+			return nil, fmt.Errorf("invalid sharding %q, it should be like user=user_0,user_1", s)
+		}
+		shards[logical] = strings.Split(physical, ",")
+	}
+	return migrate.New(db, migrations,
+		migrate.Table(table),
+		migrate.ShardingTables(func(table string) ([]string, error) {
+			if tables, ok := shards[table]; ok {
+				return tables, nil
+			}
+			return []string{table}, nil
+		}),
+	)
+}
+
+func connectDB(t, dsn string) (*gorm.DB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("dsn cannot be empty")
+	}
+
+	switch t {
+	case "mysql":
+		return gorm.Open(mysql.Open(dsn))
+	case "postgres":
+		return gorm.Open(postgres.Open(dsn))
+	case "sqlite":
+		return gorm.Open(sqlite.Open(dsn))
+	case "sqlserver":
+		return gorm.Open(sqlserver.Open(dsn))
+	default:
+		return nil, fmt.Errorf("unknow db %q (support mysql || postgres || sqlite || sqlserver for now)", t)
+	}
+}
@@ -0,0 +1,204 @@
+package reshard
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PaesslerAG/gval"
+	"github.com/spf13/cobra"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm/reshard"
+	"github.com/wfusion/gofusion/db/plugins"
+)
+
+var (
+	dsn        string
+	dbType     string
+	jobTable   string
+	table      string
+	columns    []string
+	expr       string
+	fromShards uint
+	fromSuffix string
+	toShards   uint
+	toSuffix   string
+	primaryKey string
+	batch      int
+	settle     time.Duration
+)
+
+func Command() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:   "reshard",
+		Short: "A CLI for changing the number of shards of table sharded models",
+		Long: `A CLI for changing the number of shards of table sharded models, rows are copied into new shard tables
+batch by batch and verified by checksums, the progress is persisted so that a crashed job is resumed by running
+it again. Applications with the db component watch the job table, they dual write while the job is running, route
+rows into new shard tables and dual write them back while it is cutting, and cut over once it is done,
+number_of_shards and suffix of the sharding config should be updated after that.`,
+	}
+	rootCmd.PersistentFlags().StringVar(&dsn, "dsn", "",
+		"consult[https://gorm.io/docs/connecting_to_the_database.html]")
+	rootCmd.PersistentFlags().StringVar(&dbType, "db", "mysql", "input mysql|postgres|sqlite|sqlserver")
+	rootCmd.PersistentFlags().StringVar(&jobTable, "jobs", reshard.DefaultTable, "resharding job table")
+	rootCmd.PersistentFlags().StringVar(&table, "table", "", "logical table name of the sharded table")
+
+	runCmd := &cobra.Command{
+		Use:   "run",
+		Short: "Run or resume resharding the table",
+		Example: "  fus reshard run --db mysql --dsn 'root:pwd@tcp(127.0.0.1:3306)/db' --table user " +
+			"--columns user_id --from 2 --to 8 --to-suffix v2_%02d",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			r, plan, err := newResharder(cmd.Context())
+			if err != nil {
+				return
+			}
+			job, err := r.Run(cmd.Context(), plan)
+			if job != nil {
+				printJob(job)
+			}
+			return
+		},
+	}
+	runCmd.Flags().StringSliceVar(&columns, "columns", nil, "sharding columns")
+	runCmd.Flags().StringVar(&expr, "expr", "", "sharding key expression, e.g. tenant_id << 16 | user_id")
+	runCmd.Flags().UintVar(&fromShards, "from", 0, "current number of shards")
+	runCmd.Flags().StringVar(&fromSuffix, "suffix", "", "current custom suffix of shard tables")
+	runCmd.Flags().UintVar(&toShards, "to", 0, "new number of shards")
+	runCmd.Flags().StringVar(&toSuffix, "to-suffix", "",
+		"custom suffix of new shard tables, required if new shard tables have the same names as current ones")
+	runCmd.Flags().StringVar(&primaryKey, "pk", "id", "primary key column")
+	runCmd.Flags().IntVar(&batch, "batch", 500, "number of rows copied in one batch")
+	runCmd.Flags().DurationVar(&settle, "settle", 15*time.Second,
+		"how long to wait for applications to start dual writing before copying and to cut over before done")
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the latest resharding job of the table",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			db, err := connectDB(dbType, dsn)
+			if err != nil {
+				return
+			}
+			jobs, err := reshard.New(db, reshard.Table(jobTable)).Latest(cmd.Context(), table)
+			if err != nil {
+				return
+			}
+			job, ok := jobs[table]
+			if !ok {
+				return fmt.Errorf("resharding job of %s not found", table)
+			}
+			printJob(job)
+			return
+		},
+	}
+
+	abortCmd := &cobra.Command{
+		Use:   "abort",
+		Short: "Abort the unfinished resharding job of the table, new shard tables are left as they are",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			db, err := connectDB(dbType, dsn)
+			if err != nil {
+				return
+			}
+			job, err := reshard.New(db, reshard.Table(jobTable)).Abort(cmd.Context(), table)
+			if err != nil {
+				return
+			}
+			printJob(job)
+			return
+		},
+	}
+
+	rootCmd.AddCommand(runCmd, statusCmd, abortCmd)
+	return rootCmd
+}
+
+func newResharder(ctx context.Context) (r *reshard.Resharder, plan *reshard.Plan, err error) {
+	if table == "" || len(columns) == 0 || fromShards == 0 || toShards == 0 {
+		return nil, nil, fmt.Errorf("table, columns, from and to are required")
+	}
+	db, err := connectDB(dbType, dsn)
+	if err != nil {
+		return
+	}
+
+	var expression gval.Evaluable
+	if strings.TrimSpace(expr) != "" {
+		if expression, err = gval.Full().NewEvaluable(expr); err != nil {
+			return
+		}
+	}
+	sharding := plugins.DefaultTableSharding(plugins.TableShardingConfig{
+		Table:           table,
+		ShardingKeys:    columns,
+		ShardingKeyExpr: expression,
+		NumberOfShards:  fromShards,
+		CustomSuffix:    fromSuffix,
+	})
+	if err = db.Use(sharding); err != nil {
+		return
+	}
+	plugin := sharding.(plugins.TableResharding)
+
+	layout := plugins.ShardingLayout{NumberOfShards: toShards, Suffix: toSuffix}
+	sources, err := sharding.ShardingTables(ctx)
+	if err != nil {
+		return
+	}
+	targets, err := plugin.ReshardingTables(ctx, layout)
+	if err != nil {
+		return
+	}
+	plan = &reshard.Plan{
+		Table:      table,
+		Sources:    sources,
+		Targets:    targets,
+		FromShards: fromShards,
+		ToShards:   toShards,
+		FromSuffix: fromSuffix,
+		Suffix:     toSuffix,
+		Route: func(ctx context.Context, row map[string]any) (string, error) {
+			return plugin.ReshardingTable(ctx, layout, row)
+		},
+	}
+	r = reshard.New(db,
+		reshard.Table(jobTable),
+		reshard.Batch(batch),
+		reshard.PrimaryKey(primaryKey),
+		reshard.Settle(settle),
+	)
+	return
+}
+
+func printJob(job *reshard.Job) {
+	fmt.Printf("job %v %s %v -> %v shards: %s, copied %v, verified %v, repaired %v, updated at %s\n",
+		job.ID, job.Table, job.FromShards, job.ToShards, job.Phase, job.Copied, job.Verified, job.Repaired,
+		job.UpdatedAt.Format(time.RFC3339))
+}
+
+func connectDB(t, dsn string) (*gorm.DB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("dsn cannot be empty")
+	}
+
+	switch t {
+	case "mysql":
+		return gorm.Open(mysql.Open(dsn))
+	case "postgres":
+		return gorm.Open(postgres.Open(dsn))
+	case "sqlite":
+		return gorm.Open(sqlite.Open(dsn))
+	case "sqlserver":
+		return gorm.Open(sqlserver.Open(dsn))
+	default:
+		return nil, fmt.Errorf("unknow db %q (support mysql || postgres || sqlite || sqlserver for now)", t)
+	}
+}
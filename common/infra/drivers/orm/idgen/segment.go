@@ -0,0 +1,205 @@
+package idgen
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/wfusion/gofusion/common/utils"
+)
+
+const (
+	DefaultSegmentTable = "gofusion_idgen_segments"
+
+	defaultSegmentStep    = 1000
+	segmentAllocRetries   = 10
+	segmentPrefetchFactor = 5
+	// segmentPrefetchBackoff is how long prefetching waits after a failed one
+	segmentPrefetchBackoff = time.Second
+)
+
+var (
+	// NewSegmentForShardingType FIXME: should not be deleted to avoid compiler optimized
+	NewSegmentForShardingType = reflect.TypeOf(NewSegmentForSharding)
+
+	ErrSegmentNotBound = errors.New("segment generator is not bound to a db")
+)
+
+// GormBinder is implemented by generators allocating ids from a db, generators resolved by name from configs are
+// bound to the db instance and the table using them before generating
+type GormBinder interface {
+	BindGorm(db *gorm.DB, key string)
+}
+
+// Segment is a row of the segment table, MaxID is the max id allocated of the key
+type Segment struct {
+	Key       string    `gorm:"column:biz_key;type:varchar(255);primaryKey"`
+	MaxID     uint64    `gorm:"column:max_id"`
+	Step      int       `gorm:"column:step"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
+
+type segmentOption struct {
+	table string
+	step  int
+}
+
+// SegmentTable sets the segment table, DefaultSegmentTable by default
+func SegmentTable(table string) utils.OptionFunc[segmentOption] {
+	return func(o *segmentOption) {
+		o.table = table
+	}
+}
+
+// SegmentStep sets how many ids are allocated once, 1000 by default
+func SegmentStep(step int) utils.OptionFunc[segmentOption] {
+	return func(o *segmentOption) {
+		o.step = step
+	}
+}
+
+type segmentRange struct {
+	next, max uint64
+}
+
+type segment struct {
+	mutex   sync.Mutex
+	db      *gorm.DB
+	key     string
+	table   string
+	step    int
+	current segmentRange
+	// prefetched is the next range allocated in background before the current one runs out
+	prefetched *segmentRange
+	prefetchCh chan struct{}
+	// prefetchAfter delays the next prefetch after a failed one
+	prefetchAfter time.Time
+	migrated      bool
+}
+
+// NewSegment allocates ids by ranges of the key from the segment table, ranges are allocated in their own
+// sessions rather than the transaction passed by GormTx, so that ids are never reused after rolling back
+func NewSegment(db *gorm.DB, key string, opts ...utils.OptionExtender) Generator {
+	opt := utils.ApplyOptions[segmentOption](opts...)
+	s := &segment{table: opt.table, step: opt.step, current: segmentRange{next: 1, max: 0}}
+	if s.table == "" {
+		s.table = DefaultSegmentTable
+	}
+	if s.step <= 0 {
+		s.step = defaultSegmentStep
+	}
+	if db != nil {
+		s.BindGorm(db, key)
+	}
+	return s
+}
+
+// NewSegmentForSharding is the segment generator used as the idgen of db sharding configs, the db component
+// binds it to the db instance and the sharded table
+func NewSegmentForSharding() Generator {
+	return NewSegment(nil, "")
+}
+
+func (s *segment) BindGorm(db *gorm.DB, key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.db, s.key = db, key
+}
+
+func (s *segment) Next(opts ...utils.OptionExtender) (id uint64, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return 0, ErrSegmentNotBound
+	}
+
+	if s.current.next > s.current.max {
+		if err = s.switchRange(); err != nil {
+			return
+		}
+	}
+	id = s.current.next
+	s.current.next++
+
+	if s.prefetched == nil && s.prefetchCh == nil && !time.Now().Before(s.prefetchAfter) &&
+		s.current.next+uint64(s.step/segmentPrefetchFactor) > s.current.max {
+		s.prefetch()
+	}
+	return
+}
+
+// switchRange switches to the prefetched range, or allocates one synchronously
+func (s *segment) switchRange() (err error) {
+	if s.prefetchCh != nil {
+		ch := s.prefetchCh
+		s.mutex.Unlock()
+		<-ch
+		s.mutex.Lock()
+	}
+	if s.prefetched != nil {
+		s.current, s.prefetched = *s.prefetched, nil
+		return
+	}
+	r, err := s.alloc(context.Background())
+	if err != nil {
+		return
+	}
+	s.current = *r
+	return
+}
+
+func (s *segment) prefetch() {
+	ch := make(chan struct{})
+	s.prefetchCh = ch
+	go func() {
+		defer close(ch)
+		// the range is allocated again synchronously once the current one runs out if it failed
+		r, err := s.alloc(context.Background())
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.prefetched, s.prefetchCh = r, nil
+		if err != nil {
+			s.prefetchAfter = time.Now().Add(segmentPrefetchBackoff)
+		}
+	}()
+}
+
+func (s *segment) alloc(ctx context.Context) (r *segmentRange, err error) {
+	db := s.db.WithContext(ctx).Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	if !s.migrated {
+		if err = db.Table(s.table).AutoMigrate(new(Segment)); err != nil {
+			return
+		}
+		s.migrated = true
+	}
+	tx := func() *gorm.DB { return db.Table(s.table).Model(new(Segment)).Session(&gorm.Session{}) }
+	err = tx().Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Segment{Key: s.key, MaxID: 0, Step: s.step, UpdatedAt: time.Now()}).Error
+	if err != nil {
+		return
+	}
+
+	// compare and swap the max id
+	for i := 0; i < segmentAllocRetries; i++ {
+		seg := new(Segment)
+		if err = tx().Where("biz_key = ?", s.key).Take(seg).Error; err != nil {
+			return
+		}
+		maxID := seg.MaxID + uint64(s.step)
+		result := tx().
+			Where("biz_key = ? AND max_id = ?", s.key, seg.MaxID).
+			Updates(map[string]any{"max_id": maxID, "step": s.step, "updated_at": time.Now()})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return &segmentRange{next: seg.MaxID + 1, max: maxID}, nil
+		}
+	}
+	return nil, errors.Errorf("segment allocate range of %s conflicts too many times", s.key)
+}
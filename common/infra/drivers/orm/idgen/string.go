@@ -0,0 +1,40 @@
+package idgen
+
+import (
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/wfusion/gofusion/common/utils"
+)
+
+// StringGenerator generates time sortable ids which do not fit in uint64, they are not Generator so could not be
+// configured as the idgen of sharding configs, generate string primary keys by them in BeforeCreate hooks instead
+type StringGenerator interface {
+	NextString(opts ...utils.OptionExtender) (id string, err error)
+}
+
+type uuidV7 struct{}
+
+// NewUUIDv7 generates RFC 9562 version 7 uuids
+func NewUUIDv7() StringGenerator {
+	return uuidV7{}
+}
+
+func (uuidV7) NextString(opts ...utils.OptionExtender) (id string, err error) {
+	u, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	return u.String(), nil
+}
+
+type ulidGenerator struct{}
+
+// NewULID generates ulids monotonic in the process
+func NewULID() StringGenerator {
+	return ulidGenerator{}
+}
+
+func (ulidGenerator) NextString(opts ...utils.OptionExtender) (id string, err error) {
+	return ulid.Make().String(), nil
+}
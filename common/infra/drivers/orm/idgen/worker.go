@@ -0,0 +1,184 @@
+package idgen
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sony/sonyflake"
+
+	"github.com/wfusion/gofusion/common/utils"
+)
+
+const (
+	defaultWorkerTTL      = 30 * time.Second
+	defaultWorkerPoolSize = 1024
+	maxWorkerPoolSize     = 1 << 16
+)
+
+var (
+	ErrWorkerIDExhausted = errors.New("worker id pool exhausted")
+	ErrWorkerIDLost      = errors.New("worker id lease lost")
+)
+
+// WorkerLeaser leases unique worker ids in [0, size) to owners, a worker id is held by its owner until released
+// or not renewed within the ttl
+type WorkerLeaser interface {
+	// Lease returns a worker id not held by others, or ErrWorkerIDExhausted if all of them are held
+	Lease(ctx context.Context, owner string, size int, ttl time.Duration) (workerID uint16, err error)
+	// Renew extends the lease, or returns ErrWorkerIDLost if the worker id is not held by the owner anymore
+	Renew(ctx context.Context, owner string, workerID uint16, ttl time.Duration) error
+	// Release gives the worker id back if it is still held by the owner
+	Release(ctx context.Context, owner string, workerID uint16) error
+}
+
+type workerOption struct {
+	ttl      time.Duration
+	poolSize int
+	owner    string
+}
+
+// WorkerTTL sets how long a worker id is held without renewing, 30s by default, it is renewed every third of it
+func WorkerTTL(ttl time.Duration) utils.OptionFunc[workerOption] {
+	return func(o *workerOption) {
+		o.ttl = ttl
+	}
+}
+
+// WorkerPoolSize sets the number of worker ids could be leased, 1024 by default and 65536 at most
+func WorkerPoolSize(size int) utils.OptionFunc[workerOption] {
+	return func(o *workerOption) {
+		o.poolSize = size
+	}
+}
+
+// WorkerOwner sets the owner of the lease, hostname-pid-uuid by default
+func WorkerOwner(owner string) utils.OptionFunc[workerOption] {
+	return func(o *workerOption) {
+		o.owner = owner
+	}
+}
+
+// LeasedSnowflake is a snowflake generator whose machine id is a worker id leased by a WorkerLeaser, so that
+// running instances never share the same machine id
+type LeasedSnowflake struct {
+	instance *sonyflake.Sonyflake
+	leaser   WorkerLeaser
+	owner    string
+	workerID uint16
+	ttl      time.Duration
+	// expiredAt is the unix nano after which the lease may be held by others
+	expiredAt atomic.Int64
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLeasedSnowflake leases a worker id as the machine id, and renews the lease every third of the ttl until
+// closed. It fails if the pool is exhausted, and the generator refuses to generate once the lease is lost.
+func NewLeasedSnowflake(ctx context.Context, leaser WorkerLeaser, opts ...utils.OptionExtender) (
+	s *LeasedSnowflake, err error) {
+	opt := utils.ApplyOptions[workerOption](opts...)
+	if opt.ttl <= 0 {
+		opt.ttl = defaultWorkerTTL
+	}
+	if opt.poolSize <= 0 {
+		opt.poolSize = defaultWorkerPoolSize
+	}
+	if opt.poolSize > maxWorkerPoolSize {
+		return nil, errors.Errorf("worker pool size %v exceeds %v", opt.poolSize, maxWorkerPoolSize)
+	}
+	if utils.IsStrBlank(opt.owner) {
+		hostname, _ := os.Hostname()
+		opt.owner = fmt.Sprintf("%s-%v-%s", hostname, os.Getpid(), uuid.NewString())
+	}
+
+	leasedAt := time.Now()
+	workerID, err := leaser.Lease(ctx, opt.owner, opt.poolSize, opt.ttl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "snowflake lease worker id failed")
+	}
+	log.Printf("[Common] snowflake leased worker id [%X] by [%s]", workerID, opt.owner)
+
+	flake := sonyflake.NewSonyflake(sonyflake.Settings{
+		StartTime: time.Time{},
+		MachineID: func() (uint16, error) { return workerID, nil },
+	})
+	if flake == nil {
+		_ = leaser.Release(ctx, opt.owner, workerID)
+		return nil, ErrNewGenerator
+	}
+
+	s = &LeasedSnowflake{
+		instance: flake,
+		leaser:   leaser,
+		owner:    opt.owner,
+		workerID: workerID,
+		ttl:      opt.ttl,
+		closed:   make(chan struct{}),
+	}
+	s.expiredAt.Store(leasedAt.Add(opt.ttl).UnixNano())
+	go s.renew()
+	return
+}
+
+// Next returns ErrWorkerIDLost if the lease is not renewed in time, ids would be duplicated otherwise
+func (s *LeasedSnowflake) Next(opts ...utils.OptionExtender) (id uint64, err error) {
+	if time.Now().UnixNano() >= s.expiredAt.Load() {
+		return 0, errors.Wrapf(ErrWorkerIDLost, "worker id %v", s.workerID)
+	}
+	return s.instance.NextID()
+}
+
+// WorkerID returns the leased worker id
+func (s *LeasedSnowflake) WorkerID() uint16 {
+	return s.workerID
+}
+
+// Close stops renewing and releases the worker id
+func (s *LeasedSnowflake) Close() (err error) {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.expiredAt.Store(0)
+		ctx, cancel := context.WithTimeout(context.Background(), s.ttl)
+		defer cancel()
+		err = s.leaser.Release(ctx, s.owner, s.workerID)
+	})
+	return
+}
+
+func (s *LeasedSnowflake) renew() {
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			renewedAt := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), s.ttl/3)
+			err := s.leaser.Renew(ctx, s.owner, s.workerID, s.ttl)
+			cancel()
+			switch {
+			case err == nil:
+				select {
+				case <-s.closed:
+				default:
+					s.expiredAt.Store(renewedAt.Add(s.ttl).UnixNano())
+				}
+			case errors.Is(err, ErrWorkerIDLost):
+				s.expiredAt.Store(0)
+				log.Printf("[Common] snowflake worker id [%X] lost by [%s]", s.workerID, s.owner)
+				return
+			default:
+				log.Printf("[Common] snowflake renew worker id [%X] failed: %s", s.workerID, err)
+			}
+		}
+	}
+}
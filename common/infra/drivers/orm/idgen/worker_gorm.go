@@ -0,0 +1,110 @@
+package idgen
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultGormWorkerTable = "gofusion_idgen_workers"
+)
+
+// Worker is a row of the worker id lease table
+type Worker struct {
+	WorkerID uint16 `gorm:"column:worker_id;primaryKey;autoIncrement:false"`
+	Owner    string `gorm:"column:owner;type:varchar(255)"`
+	// ExpiredAt unix milliseconds, clocks of instances leasing from the same table should be synchronized
+	ExpiredAt int64 `gorm:"column:expired_at"`
+}
+
+type gormWorkerLeaser struct {
+	db    *gorm.DB
+	table string
+}
+
+// NewGormWorkerLeaser leases worker ids from rows of the table, the table is DefaultGormWorkerTable if empty and
+// created when leasing
+func NewGormWorkerLeaser(db *gorm.DB, table string) WorkerLeaser {
+	if table == "" {
+		table = DefaultGormWorkerTable
+	}
+	return &gormWorkerLeaser{db: db, table: table}
+}
+
+func (g *gormWorkerLeaser) Lease(ctx context.Context, owner string, size int, ttl time.Duration) (
+	workerID uint16, err error) {
+	db := g.db.WithContext(ctx)
+	if err = db.Table(g.table).AutoMigrate(new(Worker)); err != nil {
+		return
+	}
+	workers := make([]*Worker, 0, size)
+	if err = g.tx(ctx).Where("worker_id < ?", size).Find(&workers).Error; err != nil {
+		return
+	}
+
+	now := time.Now()
+	leased := make(map[uint16]bool, len(workers))
+	expired := make([]*Worker, 0, len(workers))
+	for _, w := range workers {
+		leased[w.WorkerID] = true
+		if w.ExpiredAt <= now.UnixMilli() {
+			expired = append(expired, w)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].WorkerID < expired[j].WorkerID })
+
+	// take over expired worker ids by comparing expirations, and then insert unused ones
+	expiredAt := now.Add(ttl).UnixMilli()
+	for _, w := range expired {
+		result := g.tx(ctx).
+			Where("worker_id = ? AND expired_at = ?", w.WorkerID, w.ExpiredAt).
+			Updates(map[string]any{"owner": owner, "expired_at": expiredAt})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return w.WorkerID, nil
+		}
+	}
+	for id := 0; id < size; id++ {
+		if leased[uint16(id)] {
+			continue
+		}
+		result := g.tx(ctx).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&Worker{WorkerID: uint16(id), Owner: owner, ExpiredAt: expiredAt})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return uint16(id), nil
+		}
+	}
+	return 0, errors.Wrapf(ErrWorkerIDExhausted, "all of %v worker ids are leased in %s", size, g.table)
+}
+
+func (g *gormWorkerLeaser) Renew(ctx context.Context, owner string, workerID uint16, ttl time.Duration) error {
+	result := g.tx(ctx).
+		Where("worker_id = ? AND owner = ?", workerID, owner).
+		Update("expired_at", time.Now().Add(ttl).UnixMilli())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.Wrapf(ErrWorkerIDLost, "worker id %v", workerID)
+	}
+	return nil
+}
+
+func (g *gormWorkerLeaser) Release(ctx context.Context, owner string, workerID uint16) error {
+	return g.tx(ctx).Where("worker_id = ? AND owner = ?", workerID, owner).Delete(new(Worker)).Error
+}
+
+func (g *gormWorkerLeaser) tx(ctx context.Context) *gorm.DB {
+	return g.db.WithContext(ctx).Table(g.table).Model(new(Worker)).Session(&gorm.Session{})
+}
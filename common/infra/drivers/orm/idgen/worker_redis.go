@@ -0,0 +1,96 @@
+package idgen
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultRedisWorkerKey is braced as a hash tag so that keys of the pool are in the same slot of a cluster
+	DefaultRedisWorkerKey = "{gofusion:idgen:workers}"
+)
+
+var (
+	// redisWorkerLeaseScript KEYS[1] owners hash, KEYS[2] expiration zset, ARGV[1] owner, ARGV[2] size,
+	// ARGV[3] ttl in milliseconds
+	redisWorkerLeaseScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+for i = 0, tonumber(ARGV[2]) - 1 do
+	local expiredAt = redis.call('ZSCORE', KEYS[2], i)
+	if not expiredAt or tonumber(expiredAt) <= now then
+		redis.call('ZADD', KEYS[2], now + tonumber(ARGV[3]), i)
+		redis.call('HSET', KEYS[1], i, ARGV[1])
+		return i
+	end
+end
+return -1
+`)
+
+	// redisWorkerRenewScript KEYS[1] owners hash, KEYS[2] expiration zset, ARGV[1] owner, ARGV[2] worker id,
+	// ARGV[3] ttl in milliseconds
+	redisWorkerRenewScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[2]) ~= ARGV[1] then
+	return 0
+end
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+redis.call('ZADD', KEYS[2], now + tonumber(ARGV[3]), ARGV[2])
+return 1
+`)
+
+	// redisWorkerReleaseScript KEYS[1] owners hash, KEYS[2] expiration zset, ARGV[1] owner, ARGV[2] worker id
+	redisWorkerReleaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[2]) ~= ARGV[1] then
+	return 0
+end
+redis.call('HDEL', KEYS[1], ARGV[2])
+redis.call('ZREM', KEYS[2], ARGV[2])
+return 1
+`)
+)
+
+type redisWorkerLeaser struct {
+	cli  redis.UniversalClient
+	keys []string
+}
+
+// NewRedisWorkerLeaser leases worker ids from a hash of owners and a sorted set of expirations under the key,
+// the key is DefaultRedisWorkerKey if empty
+func NewRedisWorkerLeaser(cli redis.UniversalClient, key string) WorkerLeaser {
+	if key == "" {
+		key = DefaultRedisWorkerKey
+	}
+	return &redisWorkerLeaser{cli: cli, keys: []string{key + ":owners", key + ":expires"}}
+}
+
+func (r *redisWorkerLeaser) Lease(ctx context.Context, owner string, size int, ttl time.Duration) (
+	workerID uint16, err error) {
+	id, err := redisWorkerLeaseScript.Run(ctx, r.cli, r.keys, owner, size, ttl.Milliseconds()).Int()
+	if err != nil {
+		return
+	}
+	if id < 0 {
+		return 0, errors.Wrapf(ErrWorkerIDExhausted, "all of %v worker ids are leased", size)
+	}
+	return uint16(id), nil
+}
+
+func (r *redisWorkerLeaser) Renew(ctx context.Context, owner string, workerID uint16, ttl time.Duration) (
+	err error) {
+	ok, err := redisWorkerRenewScript.Run(ctx, r.cli, r.keys, owner, workerID, ttl.Milliseconds()).Bool()
+	if err != nil {
+		return
+	}
+	if !ok {
+		return errors.Wrapf(ErrWorkerIDLost, "worker id %v", workerID)
+	}
+	return
+}
+
+func (r *redisWorkerLeaser) Release(ctx context.Context, owner string, workerID uint16) error {
+	return redisWorkerReleaseScript.Run(ctx, r.cli, r.keys, owner, workerID).Err()
+}
@@ -0,0 +1,170 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/wfusion/gofusion/common/utils"
+)
+
+const (
+	upFileSuffix   = ".up.sql"
+	downFileSuffix = ".down.sql"
+
+	// VersionLayout is the layout of versions of created migrations
+	VersionLayout = "20060102150405"
+
+	statementBegin = "-- +gofusion StatementBegin"
+	statementEnd   = "-- +gofusion StatementEnd"
+)
+
+var (
+	// fileNamePattern matches <version>_<name>.up.sql and <version>_<name>.down.sql
+	fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+	namePattern     = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+)
+
+// Load loads sql migrations from the directory, a migration consists of <version>_<name>.up.sql and an
+// optional <version>_<name>.down.sql, other files are ignored
+func Load(dir string) (migrations []*Migration, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	versions := make(map[int64]*Migration, len(entries))
+	for _, entry := range entries {
+		matches := fileNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidVersion, "%s", entry.Name())
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := versions[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: matches[2]}
+			versions[version] = mig
+		}
+		if mig.Name != matches[2] {
+			return nil, errors.Wrapf(ErrDuplicatedVersion, "%v %s %s", version, mig.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			mig.UpSQL = string(content)
+		} else {
+			mig.DownSQL = string(content)
+		}
+	}
+
+	for _, mig := range versions {
+		if utils.IsStrBlank(mig.UpSQL) {
+			return nil, errors.Errorf("migration %v %s missing %s file", mig.Version, mig.Name, upFileSuffix)
+		}
+		migrations = append(migrations, mig)
+	}
+	return
+}
+
+// Create creates empty up and down sql files of a new migration versioned by the time
+func Create(dir, name string, now time.Time) (files []string, err error) {
+	name = strings.Trim(namePattern.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if utils.IsStrBlank(name) {
+		return nil, errors.New("migration name is blank")
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+
+	prefix := filepath.Join(dir, now.Format(VersionLayout)+"_"+name)
+	for _, suffix := range []string{upFileSuffix, downFileSuffix} {
+		file := prefix + suffix
+		content := "-- statements referencing sharded tables by the table template function run once per shard\n"
+		if err = os.WriteFile(file, []byte(content), 0o644); err != nil {
+			return
+		}
+		files = append(files, file)
+	}
+	return
+}
+
+// splitStatements splits the sql by semicolons at the end of lines, statements containing semicolons like
+// stored procedures should be wrapped by StatementBegin and StatementEnd annotations
+func splitStatements(sql string) (statements []string) {
+	var (
+		buf     strings.Builder
+		inBlock bool
+	)
+	flush := func() {
+		if stmt := strings.TrimSpace(buf.String()); !isCommentOnly(stmt) {
+			statements = append(statements, stmt)
+		}
+		buf.Reset()
+	}
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, statementBegin):
+			flush()
+			inBlock = true
+			continue
+		case strings.HasPrefix(trimmed, statementEnd):
+			inBlock = false
+			flush()
+			continue
+		}
+
+		buf.WriteString(line)
+		buf.WriteString("\n")
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	flush()
+	return
+}
+
+func isCommentOnly(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+func referencedTables(stmt string) (tables []string, err error) {
+	seen := utils.NewSet[string]()
+	_, err = renderStatement(stmt, func(table string) string {
+		if !seen.Contains(table) {
+			seen.Insert(table)
+			tables = append(tables, table)
+		}
+		return table
+	})
+	return
+}
+
+func renderStatement(stmt string, table func(table string) string) (rendered string, err error) {
+	tpl, err := template.New("migration").Funcs(template.FuncMap{"table": table}).Parse(stmt)
+	if err != nil {
+		return
+	}
+	var buf strings.Builder
+	if err = tpl.Execute(&buf, nil); err != nil {
+		return
+	}
+	return buf.String(), nil
+}
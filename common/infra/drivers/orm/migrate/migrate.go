@@ -0,0 +1,329 @@
+package migrate
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"github.com/wfusion/gofusion/common/utils"
+)
+
+const (
+	// DefaultTable is the default migration history table
+	DefaultTable = "gofusion_migrations"
+)
+
+var (
+	ErrDuplicatedVersion = errors.New("duplicated migration version")
+	ErrInvalidVersion    = errors.New("invalid migration version")
+	ErrIrreversible      = errors.New("migration is irreversible")
+	ErrShardsMismatch    = errors.New("sharding tables in one statement have different number of shards")
+)
+
+// Func is a go migration, it runs in the transaction of the migration
+type Func func(ctx context.Context, s *Scope) error
+
+// Migration is a versioned migration written in sql or go, sql migrations run before go migrations if both
+// of them are set
+type Migration struct {
+	Version int64
+	Name    string
+	UpSQL   string
+	DownSQL string
+	Up      Func
+	Down    Func
+}
+
+func (m *Migration) reversible() bool {
+	return m.Down != nil || utils.IsStrNotBlank(m.DownSQL)
+}
+
+// Status is the applying status of a migration
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Missing the migration is applied but its sql file or go function is not found now
+	Missing bool
+}
+
+// Scope is passed to go migrations
+type Scope struct {
+	*gorm.DB
+	tables func(table string) ([]string, error)
+}
+
+// Tables returns physical tables of the table, it is the table itself if the table is not sharded
+func (s *Scope) Tables(table string) ([]string, error) {
+	if s.tables == nil {
+		return []string{table}, nil
+	}
+	return s.tables(table)
+}
+
+type history struct {
+	Version   int64     `gorm:"column:version;primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"column:name;type:varchar(255)"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+type option struct {
+	table  string
+	tables func(table string) ([]string, error)
+	guard  func(ctx context.Context, cb func() error) error
+}
+
+// Table sets the migration history table
+func Table(name string) utils.OptionFunc[option] {
+	return func(o *option) {
+		o.table = name
+	}
+}
+
+// ShardingTables sets the resolver of physical tables of sharded tables
+func ShardingTables(fn func(table string) ([]string, error)) utils.OptionFunc[option] {
+	return func(o *option) {
+		o.tables = fn
+	}
+}
+
+// Guard runs migrating exclusively, e.g. within a distributed lock, so that only one replica migrates
+func Guard(fn func(ctx context.Context, cb func() error) error) utils.OptionFunc[option] {
+	return func(o *option) {
+		o.guard = fn
+	}
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	table      string
+	tables     func(table string) ([]string, error)
+	guard      func(ctx context.Context, cb func() error) error
+	migrations []*Migration
+}
+
+// New creates a migrator of migrations, migrations with the same version are merged if one of them is written
+// in sql and the other one is written in go
+func New(db *gorm.DB, migrations []*Migration, opts ...utils.OptionExtender) (m *Migrator, err error) {
+	opt := utils.ApplyOptions[option](opts...)
+	if utils.IsStrBlank(opt.table) {
+		opt.table = DefaultTable
+	}
+	if opt.guard == nil {
+		opt.guard = func(ctx context.Context, cb func() error) error { return cb() }
+	}
+
+	merged := make(map[int64]*Migration, len(migrations))
+	for _, mig := range migrations {
+		if mig.Version <= 0 {
+			return nil, errors.Wrapf(ErrInvalidVersion, "%v %s", mig.Version, mig.Name)
+		}
+		exist, ok := merged[mig.Version]
+		if !ok {
+			cloned := *mig
+			merged[mig.Version] = &cloned
+			continue
+		}
+		if (utils.IsStrNotBlank(exist.UpSQL) && utils.IsStrNotBlank(mig.UpSQL)) ||
+			(exist.Up != nil && mig.Up != nil) {
+			return nil, errors.Wrapf(ErrDuplicatedVersion, "%v %s %s", mig.Version, exist.Name, mig.Name)
+		}
+		if utils.IsStrBlank(exist.UpSQL) {
+			exist.UpSQL, exist.DownSQL = mig.UpSQL, mig.DownSQL
+		}
+		if exist.Up == nil {
+			exist.Up, exist.Down = mig.Up, mig.Down
+		}
+	}
+
+	m = &Migrator{
+		db:         db,
+		table:      opt.table,
+		tables:     opt.tables,
+		guard:      opt.guard,
+		migrations: make([]*Migration, 0, len(merged)),
+	}
+	for _, mig := range merged {
+		m.migrations = append(m.migrations, mig)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool { return m.migrations[i].Version < m.migrations[j].Version })
+	return
+}
+
+// Up applies at most steps pending migrations in version order, all pending migrations are applied if steps
+// is not positive
+func (m *Migrator) Up(ctx context.Context, steps int) (applied []*Migration, err error) {
+	err = m.guard(ctx, func() (err error) {
+		histories, err := m.histories(ctx)
+		if err != nil {
+			return
+		}
+		for _, mig := range m.migrations {
+			if steps > 0 && len(applied) >= steps {
+				break
+			}
+			if _, ok := histories[mig.Version]; ok {
+				continue
+			}
+			if err = m.run(ctx, mig, true); err != nil {
+				return errors.Wrapf(err, "migrate up %v %s failed", mig.Version, mig.Name)
+			}
+			applied = append(applied, mig)
+		}
+		return
+	})
+	return
+}
+
+// Down rolls back at most steps applied migrations in reverse version order, only the last one is rolled back
+// if steps is not positive
+func (m *Migrator) Down(ctx context.Context, steps int) (rolledBack []*Migration, err error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	err = m.guard(ctx, func() (err error) {
+		histories, err := m.histories(ctx)
+		if err != nil {
+			return
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := histories[mig.Version]; !ok {
+				continue
+			}
+			if !mig.reversible() {
+				return errors.Wrapf(ErrIrreversible, "%v %s", mig.Version, mig.Name)
+			}
+			if err = m.run(ctx, mig, false); err != nil {
+				return errors.Wrapf(err, "migrate down %v %s failed", mig.Version, mig.Name)
+			}
+			rolledBack = append(rolledBack, mig)
+		}
+		return
+	})
+	return
+}
+
+// Status lists all migrations with their applying status in version order
+func (m *Migrator) Status(ctx context.Context) (status []*Status, err error) {
+	histories, err := m.histories(ctx)
+	if err != nil {
+		return
+	}
+	for _, mig := range m.migrations {
+		s := &Status{Version: mig.Version, Name: mig.Name}
+		if h, ok := histories[mig.Version]; ok {
+			s.Applied, s.AppliedAt = true, h.AppliedAt
+			delete(histories, mig.Version)
+		}
+		status = append(status, s)
+	}
+	for _, h := range histories {
+		status = append(status, &Status{
+			Version: h.Version, Name: h.Name, Applied: true, AppliedAt: h.AppliedAt, Missing: true})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+	return
+}
+
+func (m *Migrator) histories(ctx context.Context) (histories map[int64]*history, err error) {
+	db := m.db.WithContext(ctx)
+	if err = db.Table(m.table).AutoMigrate(new(history)); err != nil {
+		return
+	}
+	var list []*history
+	if err = db.Table(m.table).Find(&list).Error; err != nil {
+		return
+	}
+	histories = make(map[int64]*history, len(list))
+	for _, h := range list {
+		histories[h.Version] = h
+	}
+	return
+}
+
+// run runs the migration and records it in one transaction, note that some databases like mysql commit ddl
+// implicitly, so a failed migration with ddl should be fixed by hand
+func (m *Migrator) run(ctx context.Context, mig *Migration, up bool) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) (err error) {
+		sql, fn := mig.UpSQL, mig.Up
+		if !up {
+			sql, fn = mig.DownSQL, mig.Down
+		}
+		if err = m.exec(tx, sql); err != nil {
+			return
+		}
+		if fn != nil {
+			if err = fn(ctx, &Scope{DB: tx, tables: m.tables}); err != nil {
+				return
+			}
+		}
+
+		if !up {
+			return tx.Table(m.table).Where("version = ?", mig.Version).Delete(new(history)).Error
+		}
+		return tx.Table(m.table).Create(&history{
+			Version:   mig.Version,
+			Name:      mig.Name,
+			AppliedAt: time.Now(),
+		}).Error
+	})
+}
+
+// exec executes statements of the sql, a statement referencing sharded tables by {{ table "name" }} is
+// executed once per shard
+func (m *Migrator) exec(tx *gorm.DB, sql string) (err error) {
+	for _, stmt := range splitStatements(sql) {
+		if !strings.Contains(stmt, "{{") {
+			if err = tx.Exec(stmt).Error; err != nil {
+				return
+			}
+			continue
+		}
+
+		referenced, err := referencedTables(stmt)
+		if err != nil {
+			return err
+		}
+		shards := 1
+		physical := make(map[string][]string, len(referenced))
+		for _, table := range referenced {
+			tables := []string{table}
+			if m.tables != nil {
+				if tables, err = m.tables(table); err != nil {
+					return err
+				}
+			}
+			if len(tables) == 1 {
+				physical[table] = tables
+				continue
+			}
+			if shards != 1 && shards != len(tables) {
+				return errors.Wrapf(ErrShardsMismatch, "%s", stmt)
+			}
+			shards = len(tables)
+			physical[table] = tables
+		}
+
+		for i := 0; i < shards; i++ {
+			rendered, err := renderStatement(stmt, func(table string) string {
+				if tables := physical[table]; len(tables) > 1 {
+					return tables[i]
+				}
+				return physical[table][0]
+			})
+			if err != nil {
+				return err
+			}
+			if err = tx.Exec(rendered).Error; err != nil {
+				return errors.Wrapf(err, "shard %v", i)
+			}
+		}
+	}
+	return
+}
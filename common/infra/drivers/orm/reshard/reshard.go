@@ -0,0 +1,623 @@
+package reshard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/wfusion/gofusion/common/constant"
+	"github.com/wfusion/gofusion/common/utils"
+)
+
+const (
+	// DefaultTable is the default resharding job table
+	DefaultTable = "gofusion_reshard_jobs"
+
+	PhaseCopying   = "copying"
+	PhaseVerifying = "verifying"
+	PhaseCutting   = "cutting"
+	PhaseDone      = "done"
+	PhaseAborted   = "aborted"
+
+	defaultBatch      = 500
+	defaultPrimaryKey = "id"
+)
+
+var (
+	ErrJobConflict            = errors.New("another resharding job of the table is unfinished")
+	ErrJobNotFound            = errors.New("unfinished resharding job not found")
+	ErrJobCutting             = errors.New("resharding job cutting over could not be aborted")
+	ErrChecksumMismatch       = errors.New("resharding checksum mismatch")
+	ErrCreateTableUnsupported = errors.New("creating resharding tables is not supported by the dialect")
+)
+
+// Job is the persisted progress of resharding a table, a job is resumed from the cursor of the source table
+// being processed after crashed
+type Job struct {
+	ID         uint64    `gorm:"column:id;primaryKey;autoIncrement"`
+	Table      string    `gorm:"column:sharded_table;type:varchar(255);index"`
+	FromShards uint      `gorm:"column:from_shards"`
+	ToShards   uint      `gorm:"column:to_shards"`
+	FromSuffix string    `gorm:"column:from_suffix;type:varchar(255)"`
+	Suffix     string    `gorm:"column:suffix;type:varchar(255)"`
+	Phase      string    `gorm:"column:phase;type:varchar(32)"`
+	Source     int       `gorm:"column:source"`
+	Position   string    `gorm:"column:position;type:varchar(255)"`
+	Copied     int64     `gorm:"column:copied"`
+	Verified   int64     `gorm:"column:verified"`
+	Repaired   int64     `gorm:"column:repaired"`
+	CreatedAt  time.Time `gorm:"column:created_at"`
+	UpdatedAt  time.Time `gorm:"column:updated_at"`
+}
+
+// Finished the job is done or aborted
+func (j *Job) Finished() bool {
+	return j.Phase == PhaseDone || j.Phase == PhaseAborted
+}
+
+// ScanFunc scans rows of the table after the cursor in primary key order batch by batch, the cursor is nil
+// at the beginning, and the scan should stop once cb returns an error
+type ScanFunc func(ctx context.Context, table string, cursor any, batch int,
+	cb func(rows []map[string]any) error) error
+
+// Plan describes how rows of a sharded table move from the source tables to the target tables
+type Plan struct {
+	Table      string
+	Sources    []string
+	Targets    []string
+	FromShards uint
+	ToShards   uint
+	FromSuffix string
+	Suffix     string
+
+	// Route required, returns the target table which the row belongs to
+	Route func(ctx context.Context, row map[string]any) (table string, err error)
+
+	// CreateTable optional, creates the target table like the source table if it does not exist,
+	// CREATE TABLE ... LIKE is used for mysql and postgres by default
+	CreateTable func(ctx context.Context, db *gorm.DB, source, target string) error
+
+	// Follow optional, makes writers of the caller follow the job once its phase changes, the same as other
+	// writers watching the job table do, e.g. dual writing while copying or cutting over once done
+	Follow func(ctx context.Context, job *Job) error
+}
+
+type option struct {
+	table      string
+	batch      int
+	primaryKey string
+	scan       ScanFunc
+	settle     time.Duration
+}
+
+// Table sets the resharding job table
+func Table(name string) utils.OptionFunc[option] {
+	return func(o *option) {
+		o.table = name
+	}
+}
+
+// Batch sets the number of rows copied or verified in one batch
+func Batch(batch int) utils.OptionFunc[option] {
+	return func(o *option) {
+		o.batch = batch
+	}
+}
+
+// PrimaryKey sets the primary key column which rows are scanned and copied by, id by default
+func PrimaryKey(column string) utils.OptionFunc[option] {
+	return func(o *option) {
+		o.primaryKey = column
+	}
+}
+
+// Scan sets how rows of source tables are scanned when copying, keyset pagination on the primary key by default
+func Scan(fn ScanFunc) utils.OptionFunc[option] {
+	return func(o *option) {
+		o.scan = fn
+	}
+}
+
+// Settle waits a while after a job created before copying and after a job cutting before done, so that writers
+// watching the job table start dual writing and cut over in time
+func Settle(d time.Duration) utils.OptionFunc[option] {
+	return func(o *option) {
+		o.settle = d
+	}
+}
+
+type Resharder struct {
+	db         *gorm.DB
+	table      string
+	batch      int
+	primaryKey string
+	scan       ScanFunc
+	settle     time.Duration
+}
+
+func New(db *gorm.DB, opts ...utils.OptionExtender) (r *Resharder) {
+	opt := utils.ApplyOptions[option](opts...)
+	r = &Resharder{
+		db:         db,
+		table:      opt.table,
+		batch:      opt.batch,
+		primaryKey: opt.primaryKey,
+		scan:       opt.scan,
+		settle:     opt.settle,
+	}
+	if utils.IsStrBlank(r.table) {
+		r.table = DefaultTable
+	}
+	if r.batch <= 0 {
+		r.batch = defaultBatch
+	}
+	if utils.IsStrBlank(r.primaryKey) {
+		r.primaryKey = defaultPrimaryKey
+	}
+	if r.scan == nil {
+		r.scan = r.scanTable
+	}
+	return
+}
+
+// Run copies rows of the plan into target tables, verifies them by checksums, and then cuts over, an unfinished
+// job of the same plan is resumed rather than started over. Writers route rows into target tables and dual write
+// them back into source tables while cutting, the job is done once all of them have cut over after settling.
+func (r *Resharder) Run(ctx context.Context, plan *Plan) (job *Job, err error) {
+	if plan.Route == nil || len(plan.Sources) == 0 || len(plan.Targets) == 0 {
+		return nil, errors.Errorf("invalid resharding plan of table %s", plan.Table)
+	}
+	job, created, err := r.prepare(ctx, plan)
+	if err != nil {
+		return
+	}
+	if err = r.follow(ctx, plan, job); err != nil {
+		return
+	}
+	if created {
+		if err = r.wait(ctx); err != nil {
+			return
+		}
+	}
+
+	for !job.Finished() {
+		switch job.Phase {
+		case PhaseCopying:
+			if err = r.copy(ctx, plan, job); err != nil {
+				return
+			}
+			job.Phase, job.Source, job.Position = PhaseVerifying, 0, ""
+		case PhaseVerifying:
+			if err = r.verify(ctx, plan, job); err != nil {
+				return
+			}
+			job.Phase = PhaseCutting
+		case PhaseCutting:
+			// waits again when resumed since writers may not follow the job saved right before crashing
+			if err = r.wait(ctx); err != nil {
+				return
+			}
+			job.Phase = PhaseDone
+		default:
+			return job, errors.Errorf("unknown resharding phase %s", job.Phase)
+		}
+		if err = r.save(ctx, job); err != nil {
+			return
+		}
+		if err = r.follow(ctx, plan, job); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Latest returns the latest job of each table, tables without any job are absent
+func (r *Resharder) Latest(ctx context.Context, tables ...string) (jobs map[string]*Job, err error) {
+	db := r.db.WithContext(ctx)
+	if !db.Migrator().HasTable(r.table) {
+		return
+	}
+	var list []*Job
+	if err = db.Table(r.table).Where("sharded_table IN ?", tables).Order("id").Find(&list).Error; err != nil {
+		return
+	}
+	jobs = make(map[string]*Job, len(tables))
+	for _, job := range list {
+		jobs[job.Table] = job
+	}
+	return
+}
+
+// Abort aborts the unfinished job of the table, writers watching the job table stop dual writing, and target
+// tables are left as they are
+func (r *Resharder) Abort(ctx context.Context, table string) (job *Job, err error) {
+	jobs, err := r.Latest(ctx, table)
+	if err != nil {
+		return
+	}
+	if job = jobs[table]; job == nil || job.Finished() {
+		return nil, errors.Wrapf(ErrJobNotFound, "%s", table)
+	}
+	// some writers may have routed rows into target tables
+	if job.Phase == PhaseCutting {
+		return nil, errors.Wrapf(ErrJobCutting, "%s", table)
+	}
+	job.Phase = PhaseAborted
+	return job, r.save(ctx, job)
+}
+
+// prepare resumes the unfinished job of the plan or creates a new one, target tables are created before writers
+// start dual writing into them
+func (r *Resharder) prepare(ctx context.Context, plan *Plan) (job *Job, created bool, err error) {
+	db := r.db.WithContext(ctx)
+	if err = db.Table(r.table).AutoMigrate(new(Job)); err != nil {
+		return
+	}
+	jobs, err := r.Latest(ctx, plan.Table)
+	if err != nil {
+		return
+	}
+	if job = jobs[plan.Table]; job != nil && !job.Finished() {
+		if job.ToShards != plan.ToShards || job.Suffix != plan.Suffix {
+			return nil, false, errors.Wrapf(ErrJobConflict, "%s %v -> %v", job.Table, job.FromShards, job.ToShards)
+		}
+		return
+	}
+	for _, target := range plan.Targets {
+		if err = r.createTable(ctx, plan, plan.Sources[0], target); err != nil {
+			return
+		}
+	}
+
+	job = &Job{
+		Table:      plan.Table,
+		FromShards: plan.FromShards,
+		ToShards:   plan.ToShards,
+		FromSuffix: plan.FromSuffix,
+		Suffix:     plan.Suffix,
+		Phase:      PhaseCopying,
+	}
+	if err = db.Table(r.table).Create(job).Error; err != nil {
+		return
+	}
+	return job, true, nil
+}
+
+func (r *Resharder) follow(ctx context.Context, plan *Plan, job *Job) (err error) {
+	if plan.Follow == nil {
+		return
+	}
+	if err = plan.Follow(ctx, job); err != nil {
+		return errors.Wrapf(err, "follow resharding job %v of %s failed", job.ID, job.Table)
+	}
+	return
+}
+
+// wait settles for writers watching the job table
+func (r *Resharder) wait(ctx context.Context) (err error) {
+	if r.settle <= 0 {
+		return
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(r.settle):
+		return
+	}
+}
+
+func (r *Resharder) createTable(ctx context.Context, plan *Plan, source, target string) (err error) {
+	db := r.db.WithContext(ctx)
+	if db.Migrator().HasTable(target) {
+		return
+	}
+	if plan.CreateTable != nil {
+		return plan.CreateTable(ctx, db, source, target)
+	}
+
+	quotedSource, quotedTarget := db.Statement.Quote(clause.Table{Name: source}),
+		db.Statement.Quote(clause.Table{Name: target})
+	switch db.Dialector.Name() {
+	case "mysql":
+		return db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE %s", quotedTarget, quotedSource)).Error
+	case "postgres":
+		return db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING ALL)",
+			quotedTarget, quotedSource)).Error
+	default:
+		return errors.Wrapf(ErrCreateTableUnsupported, "%s", db.Dialector.Name())
+	}
+}
+
+// copy inserts rows absent from target tables, rows present are dual written ones which are newer
+func (r *Resharder) copy(ctx context.Context, plan *Plan, job *Job) (err error) {
+	for ; job.Source < len(plan.Sources); job.Source, job.Position = job.Source+1, "" {
+		source := plan.Sources[job.Source]
+		cursor, err := r.decodeCursor(job.Position)
+		if err != nil {
+			return err
+		}
+		columns, err := r.columns(ctx, source)
+		if err != nil {
+			return err
+		}
+		err = r.scan(ctx, source, cursor, r.batch, func(rows []map[string]any) (err error) {
+			if err = r.copyRows(ctx, plan, source, columns, rows); err != nil {
+				return
+			}
+			if job.Position, err = r.encodeCursor(rows[len(rows)-1][r.primaryKey]); err != nil {
+				return
+			}
+			job.Copied += int64(len(rows))
+			return r.save(ctx, job)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "copy rows from %s failed", source)
+		}
+	}
+	return
+}
+
+func (r *Resharder) copyRows(ctx context.Context, plan *Plan, source, columns string,
+	rows []map[string]any) (err error) {
+	routed, err := r.route(ctx, plan, rows)
+	if err != nil {
+		return
+	}
+	db := r.db.WithContext(ctx)
+	for target, pks := range routed {
+		// retry once since dual writes may insert rows between querying and inserting
+		for retry := 0; retry < 2; retry++ {
+			var existing []map[string]any
+			if err = db.Table(target).Select(r.primaryKey).
+				Where(clause.IN{Column: clause.Column{Name: r.primaryKey}, Values: pks}).
+				Find(&existing).Error; err != nil {
+				return
+			}
+			existingSet := utils.NewSet(utils.SliceMapping(existing, func(row map[string]any) string {
+				return r.key(row[r.primaryKey])
+			})...)
+			missing := make([]any, 0, len(pks))
+			for _, pk := range pks {
+				if !existingSet.Contains(r.key(pk)) {
+					missing = append(missing, pk)
+				}
+			}
+			if len(missing) == 0 {
+				break
+			}
+			if err = r.insertSelect(db, source, target, columns, missing); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "copy rows into %s failed", target)
+		}
+	}
+	return
+}
+
+// verify compares checksums of rows in source tables and target tables, and repairs mismatched ones
+func (r *Resharder) verify(ctx context.Context, plan *Plan, job *Job) (err error) {
+	db := r.db.WithContext(ctx)
+	for ; job.Source < len(plan.Sources); job.Source, job.Position = job.Source+1, "" {
+		source := plan.Sources[job.Source]
+		cursor, err := r.decodeCursor(job.Position)
+		if err != nil {
+			return err
+		}
+		columns, err := r.columns(ctx, source)
+		if err != nil {
+			return err
+		}
+		err = r.scanTable(ctx, source, cursor, r.batch, func(rows []map[string]any) (err error) {
+			repaired, err := r.verifyRows(ctx, plan, source, columns, rows)
+			if err != nil {
+				return
+			}
+			if job.Position, err = r.encodeCursor(rows[len(rows)-1][r.primaryKey]); err != nil {
+				return
+			}
+			job.Verified += int64(len(rows))
+			job.Repaired += int64(repaired)
+			return r.save(ctx, job)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "verify rows from %s failed", source)
+		}
+	}
+
+	var sourceCount, targetCount int64
+	for _, source := range plan.Sources {
+		var count int64
+		if err = db.Table(source).Count(&count).Error; err != nil {
+			return
+		}
+		sourceCount += count
+	}
+	for _, target := range plan.Targets {
+		var count int64
+		if err = db.Table(target).Count(&count).Error; err != nil {
+			return
+		}
+		targetCount += count
+	}
+	if sourceCount != targetCount {
+		return errors.Wrapf(ErrChecksumMismatch, "%v rows in %s but %v rows in %s",
+			sourceCount, strings.Join(plan.Sources, constant.Comma),
+			targetCount, strings.Join(plan.Targets, constant.Comma))
+	}
+	return
+}
+
+func (r *Resharder) verifyRows(ctx context.Context, plan *Plan, source, columns string,
+	rows []map[string]any) (repaired int, err error) {
+	checksums := make(map[string]uint32, len(rows))
+	for _, row := range rows {
+		checksums[r.key(row[r.primaryKey])] = checksum(row)
+	}
+	routed, err := r.route(ctx, plan, rows)
+	if err != nil {
+		return
+	}
+
+	db := r.db.WithContext(ctx)
+	for target, pks := range routed {
+		var targetRows []map[string]any
+		if err = db.Table(target).Where(clause.IN{Column: clause.Column{Name: r.primaryKey}, Values: pks}).
+			Find(&targetRows).Error; err != nil {
+			return
+		}
+		matched := make(map[string]bool, len(targetRows))
+		for _, row := range targetRows {
+			key := r.key(row[r.primaryKey])
+			matched[key] = checksums[key] == checksum(row)
+		}
+		mismatched := make([]any, 0, len(pks))
+		for _, pk := range pks {
+			if !matched[r.key(pk)] {
+				mismatched = append(mismatched, pk)
+			}
+		}
+		if len(mismatched) == 0 {
+			continue
+		}
+		if err = db.Transaction(func(tx *gorm.DB) (err error) {
+			if err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s IN ?", tx.Statement.Quote(clause.Table{Name: target}),
+				tx.Statement.Quote(clause.Column{Name: r.primaryKey})), mismatched).Error; err != nil {
+				return
+			}
+			return r.insertSelect(tx, source, target, columns, mismatched)
+		}); err != nil {
+			return repaired, errors.Wrapf(err, "repair rows of %s failed", target)
+		}
+		repaired += len(mismatched)
+	}
+	return
+}
+
+func (r *Resharder) route(ctx context.Context, plan *Plan, rows []map[string]any) (
+	routed map[string][]any, err error) {
+	routed = make(map[string][]any, len(plan.Targets))
+	for _, row := range rows {
+		target, err := plan.Route(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		routed[target] = append(routed[target], row[r.primaryKey])
+	}
+	return
+}
+
+func (r *Resharder) insertSelect(db *gorm.DB, source, target, columns string, pks []any) error {
+	return db.Exec(fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s IN ?",
+		db.Statement.Quote(clause.Table{Name: target}), columns, columns,
+		db.Statement.Quote(clause.Table{Name: source}), db.Statement.Quote(clause.Column{Name: r.primaryKey})),
+		pks).Error
+}
+
+// columns returns quoted columns of the table joined by comma
+func (r *Resharder) columns(ctx context.Context, table string) (columns string, err error) {
+	db := r.db.WithContext(ctx)
+	columnTypes, err := db.Migrator().ColumnTypes(table)
+	if err != nil {
+		return
+	}
+	quoted := make([]string, 0, len(columnTypes))
+	for _, columnType := range columnTypes {
+		quoted = append(quoted, db.Statement.Quote(clause.Column{Name: columnType.Name()}))
+	}
+	return strings.Join(quoted, constant.Comma), nil
+}
+
+func (r *Resharder) scanTable(ctx context.Context, table string, cursor any, batch int,
+	cb func(rows []map[string]any) error) (err error) {
+	db := r.db.WithContext(ctx)
+	for {
+		rows := make([]map[string]any, 0, batch)
+		q := db.Table(table).Order(clause.OrderByColumn{Column: clause.Column{Name: r.primaryKey}}).Limit(batch)
+		if cursor != nil {
+			q = q.Where(clause.Gt{Column: clause.Column{Name: r.primaryKey}, Value: cursor})
+		}
+		if err = q.Find(&rows).Error; err != nil || len(rows) == 0 {
+			return
+		}
+		if err = cb(rows); err != nil || len(rows) < batch {
+			return
+		}
+		cursor = rows[len(rows)-1][r.primaryKey]
+	}
+}
+
+func (r *Resharder) save(ctx context.Context, job *Job) error {
+	return r.db.WithContext(ctx).Table(r.table).Save(job).Error
+}
+
+func (r *Resharder) key(pk any) string {
+	if b, ok := pk.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprintf("%v", pk)
+}
+
+func (r *Resharder) encodeCursor(cursor any) (position string, err error) {
+	if b, ok := cursor.([]byte); ok {
+		cursor = string(b)
+	}
+	data, err := json.Marshal(cursor)
+	return string(data), err
+}
+
+func (r *Resharder) decodeCursor(position string) (cursor any, err error) {
+	if utils.IsStrBlank(position) {
+		return
+	}
+	decoder := json.NewDecoder(strings.NewReader(position))
+	decoder.UseNumber()
+	if err = decoder.Decode(&cursor); err != nil {
+		return
+	}
+	if number, ok := cursor.(json.Number); ok {
+		if i, err := number.Int64(); err == nil {
+			return i, nil
+		}
+		return number.Float64()
+	}
+	return
+}
+
+// checksum returns the crc32 checksum of the row in column order
+func checksum(row map[string]any) uint32 {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	buf := new(bytes.Buffer)
+	for _, column := range columns {
+		var value any
+		switch v := row[column].(type) {
+		case []byte:
+			value = string(v)
+		case time.Time:
+			value = v.UTC().Format(time.RFC3339Nano)
+		case *time.Time:
+			if v != nil {
+				value = v.UTC().Format(time.RFC3339Nano)
+			}
+		default:
+			value = v
+		}
+		_, _ = fmt.Fprintf(buf, "%s=%v;", column, value)
+	}
+	return crc32.ChecksumIEEE(buf.Bytes())
+}
@@ -29,7 +29,11 @@ func TravelCtx(child context.Context, fn func(ctx context.Context) bool) {
 		if !ok || parent == nil || fn(parent) {
 			break
 		}
-		if p = reflect.Indirect(p); p.Kind() != reflect.Struct {
+		// parents are stored in interface fields, e.g. context.valueCtx
+		for p.Kind() == reflect.Interface || p.Kind() == reflect.Ptr {
+			p = p.Elem()
+		}
+		if p.Kind() != reflect.Struct {
 			break
 		}
 	}
@@ -54,9 +54,21 @@ func (r *registry) cryptoConfig() (conf *CryptoConf) {
 
 	if conf != nil {
 		parseCfgFunc(conf.Config)
-		conf.Custom = make(map[string]*cryptoConf)
+		if conf.Config != nil {
+			for _, rotated := range conf.Config.RotatedKeys {
+				parseCfgFunc(rotated)
+			}
+		}
+		if conf.Custom == nil {
+			conf.Custom = make(map[string]*cryptoConf)
+		}
 		for _, c := range conf.Custom {
 			parseCfgFunc(c)
+			if c != nil {
+				for _, rotated := range c.RotatedKeys {
+					parseCfgFunc(rotated)
+				}
+			}
 		}
 	}
 
@@ -64,6 +64,8 @@ var (
 
 	componentLocker sync.RWMutex
 	components      []*componentItem
+	// constructedHooks component name -> hooks called once the component is constructed
+	constructedHooks = map[string][]func(ctx context.Context, appName string){}
 )
 
 func indexComponent(name string) (idx int) {
@@ -141,6 +143,20 @@ func AddComponent(name string, constructor any, opts ...ComponentOption) {
 	components = append(components, &componentItem{name, constructor, opts})
 }
 
+// OnConstructed registers fn called once the component of an app is constructed, components constructed before
+// it defer their startup work depending on it by this, it should be called in init functions
+func OnConstructed(name string, fn func(ctx context.Context, appName string)) {
+	componentLocker.Lock()
+	defer componentLocker.Unlock()
+	constructedHooks[name] = append(constructedHooks[name], fn)
+}
+
+func getConstructedHooks(name string) []func(ctx context.Context, appName string) {
+	componentLocker.RLock()
+	defer componentLocker.RUnlock()
+	return append([]func(ctx context.Context, appName string){}, constructedHooks[name]...)
+}
+
 func getComponents() []*componentItem {
 	componentLocker.RLock()
 	defer componentLocker.RUnlock()
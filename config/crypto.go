@@ -1,9 +1,14 @@
 package config
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"reflect"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cast"
@@ -16,11 +21,19 @@ import (
 )
 
 const (
-	cryptoTagKey = "encrypted"
+	cryptoTagKey   = "encrypted"
+	cryptoRedacted = "******"
+
+	// cryptoKeyIDSeparator separates the key id and the ciphertext, it is not in any printable encoding
+	cryptoKeyIDSeparator = "$"
 )
 
 var (
 	cryptoFlagString string
+
+	// cryptoRedactedKeys are config keys of secrets which are redacted whether they are tagged as encrypted or not
+	cryptoRedactedKeys = utils.NewSet(
+		"secret", "password", "api_keys", "hmac_keys", "key_base64", "iv_base64", "blind_index_key_base64")
 )
 
 func CryptoConstruct(ctx context.Context, c CryptoConf, _ ...utils.OptionExtender) func() {
@@ -71,6 +84,32 @@ func checkCryptoConf(name string, c *cryptoConf) {
 			panic(errors.Errorf("unknown config %s output algorithm: %s", name, *c.OutputAlgorithmString))
 		}
 	}
+
+	// key rotation
+	if strings.Contains(c.KeyID, cryptoKeyIDSeparator) {
+		panic(errors.Errorf("config %s key id %s contains %s", name, c.KeyID, cryptoKeyIDSeparator))
+	}
+	if len(c.RotatedKeys) > 0 && utils.IsStrBlank(c.KeyID) {
+		panic(errors.Errorf("config %s has rotated keys but no key id", name))
+	}
+	keyIDs := utils.NewSet(c.KeyID)
+	for _, rotated := range c.RotatedKeys {
+		if rotated == nil || utils.IsStrBlank(rotated.KeyID) || keyIDs.Contains(rotated.KeyID) {
+			panic(errors.Errorf("config %s rotated keys should have unique key ids", name))
+		}
+		if len(rotated.RotatedKeys) > 0 {
+			panic(errors.Errorf("config %s rotated key %s should not have rotated keys", name, rotated.KeyID))
+		}
+		keyIDs.Insert(rotated.KeyID)
+		checkCryptoConf(name+"/"+rotated.KeyID, rotated)
+	}
+	// blind indexes should not change with the cipher key, so rotated configs have to configure their own key
+	if len(c.RotatedKeys) > 0 && utils.IsStrBlank(c.BlindIndexKeyBase64) {
+		panic(errors.Errorf("config %s has rotated keys but no blind index key", name))
+	}
+	if utils.IsStrNotBlank(c.BlindIndexKeyBase64) {
+		utils.Must(base64.StdEncoding.DecodeString(c.BlindIndexKeyBase64))
+	}
 }
 
 func CryptoEncryptFunc[T ~[]byte | ~string](opts ...utils.OptionExtender) func(src T) (dst T) {
@@ -96,6 +135,116 @@ func CryptoDecryptFunc[T ~[]byte | ~string](opts ...utils.OptionExtender) func(s
 	}
 }
 
+// CryptoEncryptWithKeyIDFunc encrypts by the named config and prefixes ciphertexts with its key_id, ciphertexts are
+// still decrypted by CryptoDecryptWithKeyIDFunc after the config is rotated into rotated_keys of a new one
+func CryptoEncryptWithKeyIDFunc(opts ...utils.OptionExtender) func(src []byte) (dst []byte, err error) {
+	o := utils.ApplyOptions[InitOption](opts...)
+	opt := utils.ApplyOptions[cryptoConfigOption](opts...)
+	conf, ok := Use(o.AppName).(*registry).cryptoConfig().named(opt.name)
+	if !ok {
+		return func([]byte) ([]byte, error) { return nil, errors.Errorf("crypto config %s not found", opt.name) }
+	}
+	return cryptoEncryptWithKeyID(conf)
+}
+
+// CryptoDecryptWithKeyIDFunc decrypts ciphertexts by the config or the rotated one whose key_id prefixes them,
+// ciphertexts without key ids are decrypted by the named config
+func CryptoDecryptWithKeyIDFunc(opts ...utils.OptionExtender) func(src []byte) (dst []byte, err error) {
+	o := utils.ApplyOptions[InitOption](opts...)
+	opt := utils.ApplyOptions[cryptoConfigOption](opts...)
+	conf, ok := Use(o.AppName).(*registry).cryptoConfig().named(opt.name)
+	if !ok {
+		return func([]byte) ([]byte, error) { return nil, errors.Errorf("crypto config %s not found", opt.name) }
+	}
+	return cryptoDecryptWithKeyID(conf)
+}
+
+// CryptoBlindIndexFunc returns the hex hmac-sha256 of sources by blind_index_key_base64 of the named config, it
+// returns errors if the blind index key is not configured
+func CryptoBlindIndexFunc(opts ...utils.OptionExtender) func(src []byte) (dst string, err error) {
+	o := utils.ApplyOptions[InitOption](opts...)
+	opt := utils.ApplyOptions[cryptoConfigOption](opts...)
+	conf, ok := Use(o.AppName).(*registry).cryptoConfig().named(opt.name)
+	if !ok {
+		return func([]byte) (string, error) { return "", errors.Errorf("crypto config %s not found", opt.name) }
+	}
+	if utils.IsStrBlank(conf.BlindIndexKeyBase64) {
+		return func([]byte) (string, error) {
+			return "", errors.Errorf("crypto config %s has no blind index key", opt.name)
+		}
+	}
+	return cryptoBlindIndex(conf)
+}
+
+// CryptoConfigFound reports whether the named crypto config exists
+func CryptoConfigFound(opts ...utils.OptionExtender) (found bool) {
+	o := utils.ApplyOptions[InitOption](opts...)
+	opt := utils.ApplyOptions[cryptoConfigOption](opts...)
+	_, found = Use(o.AppName).(*registry).cryptoConfig().named(opt.name)
+	return
+}
+
+// CryptoConfigRevision returns the revision of loaded configs, it changes once configs are reloaded or patched so
+// that funcs built by crypto configs could be cached until then
+func CryptoConfigRevision(opts ...utils.OptionExtender) (revision any) {
+	o := utils.ApplyOptions[InitOption](opts...)
+	r := Use(o.AppName).(*registry)
+	if r.componentConfigValue == nil {
+		return
+	}
+	return r.componentConfigValue.Load()
+}
+
+func cryptoEncryptWithKeyID(conf *cryptoConf) func(src []byte) (dst []byte, err error) {
+	encOpts := conf.ToOptions()
+	prefix := []byte(nil)
+	if utils.IsStrNotBlank(conf.KeyID) {
+		prefix = []byte(conf.KeyID + cryptoKeyIDSeparator)
+	}
+	return func(src []byte) (dst []byte, err error) {
+		if dst, err = encode.From(src).Encode(encOpts...).ToBytes(); err != nil {
+			return
+		}
+		return append(append(make([]byte, 0, len(prefix)+len(dst)), prefix...), dst...), nil
+	}
+}
+
+func cryptoDecryptWithKeyID(conf *cryptoConf) func(src []byte) (dst []byte, err error) {
+	decOptsFunc := func(c *cryptoConf) []utils.OptionExtender {
+		decOpts := c.ToOptions()
+		utils.SliceReverse(decOpts)
+		return decOpts
+	}
+	current := decOptsFunc(conf)
+	keys := make(map[string][]utils.OptionExtender, len(conf.RotatedKeys)+1)
+	if utils.IsStrNotBlank(conf.KeyID) {
+		keys[conf.KeyID] = current
+	}
+	for _, rotated := range conf.RotatedKeys {
+		keys[rotated.KeyID] = decOptsFunc(rotated)
+	}
+	return func(src []byte) (dst []byte, err error) {
+		decOpts := current
+		if idx := bytes.Index(src, []byte(cryptoKeyIDSeparator)); idx > 0 {
+			if keyOpts, ok := keys[string(src[:idx])]; ok {
+				decOpts, src = keyOpts, src[idx+len(cryptoKeyIDSeparator):]
+			}
+		}
+		return encode.From(src).Decode(decOpts...).ToBytes()
+	}
+}
+
+func cryptoBlindIndex(conf *cryptoConf) func(src []byte) (dst string, err error) {
+	key := utils.Must(base64.StdEncoding.DecodeString(conf.BlindIndexKeyBase64))
+	return func(src []byte) (dst string, err error) {
+		mac := hmac.New(sha256.New, key)
+		if _, err = mac.Write(src); err != nil {
+			return
+		}
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}
+}
+
 type cryptoOption struct {
 	tag string
 }
@@ -186,6 +335,61 @@ func CryptoDecryptByTag(data any, opts ...utils.OptionExtender) {
 	})
 }
 
+// CryptoRedactByTag masks non-blank string fields tagged as encrypted, and secret fields like secret, api_keys,
+// hmac_keys, key_base64, iv_base64 and blind_index_key_base64 whatever they are tagged, it is used before exposing configs
+func CryptoRedactByTag(data any, opts ...utils.OptionExtender) {
+	co := utils.ApplyOptions[cryptoOption](opts...)
+	tag := cryptoTagKey
+	if co.tag != "" {
+		tag = co.tag
+	}
+
+	supportedFields := utils.NewSet(reflect.Struct, reflect.Array, reflect.Slice, reflect.Map)
+	utils.TraverseValue(data, false, func(field reflect.StructField, value reflect.Value) (end, stepIn bool) {
+		if !value.IsValid() || !value.CanInterface() || !value.CanSet() {
+			return
+		}
+
+		vk := value.Kind()
+		stepIn = supportedFields.Contains(vk) ||
+			(vk == reflect.Ptr && value.Elem().IsValid() && value.Elem().Kind() == reflect.Struct)
+
+		if cryptoRedactedKeys.Contains(strings.Split(field.Tag.Get("yaml"), ",")[0]) && redactSecret(value) {
+			stepIn = false
+			return
+		}
+		if _, ok := field.Tag.Lookup(tag); !ok || vk != reflect.String || utils.IsStrBlank(value.String()) {
+			return
+		}
+		value.SetString(cryptoRedacted)
+		return
+	})
+}
+
+// redactSecret masks a non-blank secret string, or replaces a non-empty secret map with a masked one since keys of
+// maps like api_keys are secrets as well
+func redactSecret(value reflect.Value) (redacted bool) {
+	switch value.Kind() {
+	case reflect.String:
+		if utils.IsStrBlank(value.String()) {
+			return
+		}
+		value.SetString(cryptoRedacted)
+		return true
+	case reflect.Map:
+		if value.Len() == 0 || value.Type().Key().Kind() != reflect.String || value.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		masked := reflect.MakeMapWithSize(value.Type(), 1)
+		masked.SetMapIndex(reflect.ValueOf(cryptoRedacted).Convert(value.Type().Key()),
+			reflect.ValueOf(cryptoRedacted).Convert(value.Type().Elem()))
+		value.Set(masked)
+		return true
+	default:
+		return
+	}
+}
+
 func init() {
 	pflag.StringVarP(&cryptoFlagString, "crypto", "", "", "json string for crypto config")
 }
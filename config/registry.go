@@ -88,6 +88,7 @@ type registry struct {
 	businessConfigValue  *atomic.Value
 	businessConfigType   reflect.Type
 	componentConfigValue *atomic.Value
+	patchLocker          sync.Mutex
 }
 
 type initOption struct {
@@ -281,6 +282,61 @@ func (r *registry) GetAllConfigs() any {
 	return clone.Clone(val.Interface())
 }
 
+// PatchComponentConfig merges the patch into the component config on the fly, e.g. patching DB with
+// {"default": {"enable_logger": true}}, components reloading their config on use take effect immediately
+func (r *registry) PatchComponentConfig(name string, patch map[string]any) (err error) {
+	var found bool
+	for _, com := range r.componentList {
+		if com.name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.Errorf("no such component [%s]", name)
+	}
+
+	r.patchLocker.Lock()
+	defer r.patchLocker.Unlock()
+	configVal := r.componentConfigValue.Load()
+	if configVal == nil {
+		return errors.Errorf("component appConfigs not initialize now [%s]", name)
+	}
+	configClone := clone.Clone(configVal)
+	componentConfigValue := utils.IndirectValue(reflect.ValueOf(configClone)).
+		FieldByName(componentConfigFieldName).FieldByName(name)
+
+	origin := make(map[string]any)
+	if componentConfigValue.Kind() != reflect.Ptr || !componentConfigValue.IsNil() {
+		originBytes, err := utils.Marshal(componentConfigValue.Interface(), utils.MarshalTypeYaml)
+		if err != nil {
+			return err
+		}
+		if err = utils.Unmarshal(originBytes, &origin, utils.MarshalTypeYaml); err != nil {
+			return err
+		}
+	}
+	mergedBytes, err := utils.Marshal(mergeConfigMap(origin, patch), utils.MarshalTypeYaml)
+	if err != nil {
+		return
+	}
+
+	patched := reflect.New(componentConfigValue.Type())
+	if err = utils.Unmarshal(mergedBytes, patched.Interface(), utils.MarshalTypeYaml); err != nil {
+		return errors.Wrapf(err, "patch component config failed [%s]", name)
+	}
+	if err = utils.ParseTag(
+		patched.Interface(),
+		utils.ParseTagName("default"),
+		utils.ParseTagUnmarshalType(utils.MarshalTypeYaml),
+	); err != nil {
+		return
+	}
+	componentConfigValue.Set(patched.Elem())
+	r.componentConfigValue.Store(configClone)
+	return
+}
+
 // initAllConfig
 // configuration priority:
 // 1. configurations from remote
@@ -597,6 +653,9 @@ func (r *registry) initComponents(parent context.Context,
 			destructors = append(destructors, out[0])
 			gracefullyComponentNames = append(gracefullyComponentNames, com.name)
 		}
+		for _, hook := range getConstructedHooks(com.name) {
+			hook(ctx, r.appName)
+		}
 	}
 
 	/* print summary to stdout */
@@ -728,3 +787,17 @@ func (r *registry) checkBusinessConfig(businessConfig any) {
 		panic(errors.New("businessConfig should be a **struct"))
 	}
 }
+
+// mergeConfigMap merges src into dst recursively, maps are merged and other values are replaced
+func mergeConfigMap(dst, src map[string]any) map[string]any {
+	for k, v := range src {
+		srcMap, ok1 := v.(map[string]any)
+		dstMap, ok2 := dst[k].(map[string]any)
+		if ok1 && ok2 {
+			dst[k] = mergeConfigMap(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
@@ -47,6 +47,21 @@ type cryptoConf struct {
 
 	OutputAlgorithm       encode.Algorithm `yaml:"-" json:"-" toml:"-"`
 	OutputAlgorithmString *string          `yaml:"output_algorithm" json:"output_algorithm" toml:"output_algorithm"`
+
+	// KeyID prefixes ciphertexts encrypted with key ids, so that they are decrypted by rotated keys
+	KeyID string `yaml:"key_id" json:"key_id" toml:"key_id"`
+	// RotatedKeys are previous configs with key ids, they are only used to decrypt
+	RotatedKeys []*cryptoConf `yaml:"rotated_keys" json:"rotated_keys" toml:"rotated_keys"`
+	// BlindIndexKeyBase64 is the hmac key of blind indexes, which is not rotated with the cipher key
+	BlindIndexKeyBase64 string `yaml:"blind_index_key_base64" json:"blind_index_key_base64" toml:"blind_index_key_base64"`
+}
+
+func (c *CryptoConf) named(name string) (conf *cryptoConf, ok bool) {
+	if name == "" {
+		return c.Config, c.Config != nil
+	}
+	conf, ok = c.Custom[name]
+	return conf, ok && conf != nil
 }
 
 func (c *cryptoConf) ToOptions() (opts []utils.OptionExtender) {
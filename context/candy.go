@@ -14,6 +14,22 @@ func SetUserID(ctx context.Context, val string) context.Context {
 	return utils.SetCtxAny(ctx, KeyUserID, val)
 }
 
+func GetTenantID(ctx context.Context, args ...string) (tenantID string) {
+	return utils.GetCtxAny(ctx, KeyTenantID, args...)
+}
+
+func SetTenantID(ctx context.Context, val string) context.Context {
+	return utils.SetCtxAny(ctx, KeyTenantID, val)
+}
+
+func GetClaims(ctx context.Context, args ...map[string]any) (claims map[string]any) {
+	return utils.GetCtxAny(ctx, KeyClaims, args...)
+}
+
+func SetClaims(ctx context.Context, val map[string]any) context.Context {
+	return utils.SetCtxAny(ctx, KeyClaims, val)
+}
+
 func GetTraceID(ctx context.Context, args ...string) (traceID string) {
 	return utils.GetCtxAny(ctx, KeyTraceID, args...)
 }
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/wfusion/gofusion/common/infra/watermill"
 
 	"github.com/wfusion/gofusion/common/infra/watermill/message"
@@ -18,6 +20,7 @@ import (
 type _context struct {
 	Langs            []string `json:"langs" yaml:"langs" toml:"langs" mapstructure:"langs"`
 	UserID           *string  `json:"user_id" yaml:"user_id" toml:"user_id" mapstructure:"user_id"`
+	TenantID         *string  `json:"tenant_id" yaml:"tenant_id" toml:"tenant_id" mapstructure:"tenant_id"`
 	TraceID          *string  `json:"trace_id" yaml:"trace_id" toml:"trace_id" mapstructure:"trace_id"`
 	CronTaskID       *string  `json:"cron_task_id" yaml:"cron_task_id" toml:"cron_task_id" mapstructure:"cron_task_id"`
 	CronTaskName     *string  `json:"cron_task_name" yaml:"cron_task_name" toml:"cron_task_name" mapstructure:"cron_task_name"`
@@ -37,6 +40,9 @@ func (c *_context) unmarshal() (ctx context.Context) {
 	if c.UserID != nil {
 		ctx = SetUserID(ctx, *c.UserID)
 	}
+	if c.TenantID != nil {
+		ctx = SetTenantID(ctx, *c.TenantID)
+	}
 	if c.TraceID != nil {
 		ctx = SetTraceID(ctx, *c.TraceID)
 	}
@@ -73,6 +79,9 @@ func Flatten(ctx context.Context) (c *_context) {
 	if userID := GetUserID(ctx); utils.IsStrNotBlank(userID) {
 		c.UserID = utils.AnyPtr(userID)
 	}
+	if tenantID := GetTenantID(ctx); utils.IsStrNotBlank(tenantID) {
+		c.TenantID = utils.AnyPtr(tenantID)
+	}
 	if traceID := GetTraceID(ctx); utils.IsStrNotBlank(traceID) {
 		c.TraceID = utils.AnyPtr(traceID)
 	}
@@ -98,6 +107,9 @@ func WatermillMetadata(ctx context.Context) (metadata message.Metadata) {
 	if userID := GetUserID(ctx); utils.IsStrNotBlank(userID) {
 		metadata["user_id"] = userID
 	}
+	if tenantID := GetTenantID(ctx); utils.IsStrNotBlank(tenantID) {
+		metadata["tenant_id"] = tenantID
+	}
 	if traceID := GetTraceID(ctx); utils.IsStrNotBlank(traceID) {
 		metadata["trace_id"] = traceID
 	}
@@ -125,9 +137,23 @@ func (o *newOption) ginUnmarshal() (ctx context.Context) {
 	if userID := o.g.GetString(KeyUserID); utils.IsStrNotBlank(userID) {
 		ctx = SetUserID(ctx, userID)
 	}
+	if tenantID := o.g.GetString(KeyTenantID); utils.IsStrNotBlank(tenantID) {
+		ctx = SetTenantID(ctx, tenantID)
+	}
+	if claims, ok := o.g.Get(KeyClaims); ok {
+		if m, ok := claims.(map[string]any); ok {
+			ctx = SetClaims(ctx, m)
+		}
+	}
 	if traceID := o.g.GetString(KeyTraceID); utils.IsStrNotBlank(traceID) {
 		ctx = SetTraceID(ctx, traceID)
 	}
+	if fields, ok := o.g.Get(KeyLogFields); ok {
+		ctx = utils.SetCtxAny(ctx, KeyLogFields, fields)
+	}
+	if span := trace.SpanFromContext(o.g.Request.Context()); span.SpanContext().IsValid() {
+		ctx = trace.ContextWithSpan(ctx, span)
+	}
 	langs := o.g.Request.Header.Values("Accept-Language")
 	if lang := o.g.GetString("lang"); utils.IsStrNotBlank(lang) {
 		langs = append(langs, lang)
@@ -147,6 +173,9 @@ func (o *newOption) messageUnmarshal() (ctx context.Context) {
 	if userID := utils.LookupByFuzzyKeyword[string](mapGetFn, "user_id"); utils.IsStrNotBlank(userID) {
 		ctx = SetUserID(ctx, userID)
 	}
+	if tenantID := utils.LookupByFuzzyKeyword[string](mapGetFn, "tenant_id"); utils.IsStrNotBlank(tenantID) {
+		ctx = SetTenantID(ctx, tenantID)
+	}
 	if traceID := utils.LookupByFuzzyKeyword[string](mapGetFn, "trace_id"); utils.IsStrNotBlank(traceID) {
 		ctx = SetTraceID(ctx, traceID)
 	}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/db/plugins"
+
+	fusLog "github.com/wfusion/gofusion/log"
+)
+
+const (
+	auditSinkTable = "table"
+	auditSinkLog   = "log"
+	auditSinkMQ    = "mq"
+)
+
+var (
+	auditLocker sync.RWMutex
+	// appAuditPublishers app name -> publisher
+	appAuditPublishers = map[string]AuditPublisher{}
+)
+
+// AuditPublisher publishes audit records to the mq instance, it is set by the mq component at startup
+type AuditPublisher func(ctx context.Context, mqInstance string, records []*plugins.AuditRecord) error
+
+// SetAuditPublisher sets the publisher of audit records sunk into mq, the mq component is constructed after
+// the db component, so it calls this once its instances are ready
+func SetAuditPublisher(publisher AuditPublisher, opts ...utils.OptionExtender) {
+	opt := utils.ApplyOptions[useOption](opts...)
+
+	auditLocker.Lock()
+	defer auditLocker.Unlock()
+	if publisher == nil {
+		delete(appAuditPublishers, opt.appName)
+		return
+	}
+	appAuditPublishers[opt.appName] = publisher
+}
+
+func newAuditPlugin(appName, name string, conf *Conf, db *gorm.DB) plugins.Audit {
+	var sink plugins.AuditSink
+	switch conf.Audit.Sink {
+	case auditSinkTable:
+		utils.MustSuccess(db.Table(conf.Audit.Table).AutoMigrate(new(plugins.AuditRecord)))
+		sink = plugins.AuditTableSink(conf.Audit.Table)
+	case auditSinkLog:
+		logger := fusLog.Use(conf.Audit.LogInstance, fusLog.AppName(appName))
+		sink = func(ctx context.Context, _ *gorm.DB, records []*plugins.AuditRecord) error {
+			for _, r := range records {
+				logger.Info(ctx, "db %s audit %s %s [primary_key[%s] actor[%s]]",
+					r.Database, r.Action, r.Table, r.PrimaryKey, r.Actor, fusLog.Fields{"audit": r})
+			}
+			return nil
+		}
+	case auditSinkMQ:
+		if utils.IsStrBlank(conf.Audit.MQInstance) {
+			panic(errors.Errorf("db %s audit sink is mq but mq instance not found", name))
+		}
+		sink = func(ctx context.Context, _ *gorm.DB, records []*plugins.AuditRecord) error {
+			auditLocker.RLock()
+			publisher, ok := appAuditPublishers[appName]
+			auditLocker.RUnlock()
+			if !ok {
+				return errors.Errorf("db %s audit publisher of mq %s not ready", name, conf.Audit.MQInstance)
+			}
+			return publisher(ctx, conf.Audit.MQInstance, records)
+		}
+	default:
+		panic(errors.Errorf("unknown db %s audit sink: %s", name, conf.Audit.Sink))
+	}
+
+	return plugins.DefaultAudit(plugins.AuditConfig{
+		Database:   name,
+		Tables:     conf.Audit.Tables,
+		Sink:       sink,
+		MaskConfig: conf.Audit.MaskConfig,
+	})
+}
@@ -16,6 +16,10 @@ func BuildQuerySQL(db *gorm.DB) {
 	callbacks.BuildQuerySQL(db)
 }
 
+func ConvertToAssignments(stmt *gorm.Statement) clause.Set {
+	return callbacks.ConvertToAssignments(stmt)
+}
+
 func BuildCreateSQL(db *gorm.DB) {
 	supportReturning := utils.Contains(db.Callback().Create().Clauses, "RETURNING")
 	if db.Statement.Schema != nil {
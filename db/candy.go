@@ -16,7 +16,9 @@ import (
 )
 
 type scanOption struct {
-	dbName string
+	dbName   string
+	table    string
+	unscoped bool
 
 	cursors       []any
 	cursorWhere   any
@@ -49,6 +51,20 @@ func ScanUse(dbName string) utils.OptionFunc[scanOption] {
 	}
 }
 
+// ScanTable scans the table rather than the table of the model, e.g. a physical table of a sharded table
+func ScanTable(table string) utils.OptionFunc[scanOption] {
+	return func(o *scanOption) {
+		o.table = table
+	}
+}
+
+// ScanUnscoped scans soft deleted rows as well
+func ScanUnscoped() utils.OptionFunc[scanOption] {
+	return func(o *scanOption) {
+		o.unscoped = true
+	}
+}
+
 func ScanWhere(where any, sqlAndArguments ...any) utils.OptionFunc[scanOption] {
 	return func(o *scanOption) {
 		o.where = where
@@ -130,6 +146,13 @@ func Scan[T any, TS ~[]*T](ctx context.Context, cb func(TS) bool, opts ...utils.
 
 	count := 0
 	tx = tx.WithContext(ctx)
+	if opt.table != "" {
+		tx = tx.Table(opt.table)
+	}
+	if opt.unscoped {
+		tx = tx.Unscoped()
+	}
+	tx = tx.Session(&gorm.Session{})
 	if opt.log != nil {
 		opt.log.Info(ctx, "scan begin [where[%s][%+v] cursor[%s][%+v] order[%s] limit[%v] batch[%v]]",
 			opt.where, opt.sqlAndArguments, opt.cursorWhere, opt.cursors, opt.order, opt.limit, opt.batch)
@@ -14,7 +14,6 @@ import (
 
 	"github.com/wfusion/gofusion/common/di"
 	"github.com/wfusion/gofusion/common/infra/drivers/orm"
-	"github.com/wfusion/gofusion/common/infra/drivers/orm/idgen"
 	"github.com/wfusion/gofusion/common/utils"
 	"github.com/wfusion/gofusion/common/utils/gomonkey"
 	"github.com/wfusion/gofusion/common/utils/inspect"
@@ -22,6 +21,7 @@ import (
 	"github.com/wfusion/gofusion/db/callbacks"
 	"github.com/wfusion/gofusion/db/plugins"
 	"github.com/wfusion/gofusion/db/softdelete"
+	"github.com/wfusion/gofusion/health"
 
 	fusLog "github.com/wfusion/gofusion/log"
 
@@ -36,8 +36,35 @@ func Construct(ctx context.Context, confs map[string]*Conf, opts ...utils.Option
 	}
 
 	for name, conf := range confs {
+		// shard groups are logical dbs routing to the instances
+		if len(conf.ShardGroup.Instances) > 0 {
+			continue
+		}
 		addInstance(ctx, name, conf, opt)
 	}
+	for name, conf := range confs {
+		if len(conf.ShardGroup.Instances) > 0 {
+			addShardGroup(opt.AppName, name, conf)
+		}
+	}
+	for name, conf := range confs {
+		if !conf.Migration.Enable || len(conf.ShardGroup.Instances) > 0 {
+			continue
+		}
+		// migrations locked are applied once the lock component is constructed
+		if utils.IsStrNotBlank(conf.Migration.LockInstance) {
+			migrationLocker.Lock()
+			if migrationGuardOf == nil {
+				migrationLocker.Unlock()
+				panic(errors.Errorf("db %s migration is locked by %s but the lock component is not imported",
+					name, conf.Migration.LockInstance))
+			}
+			appPendingMigrations[opt.AppName] = append(appPendingMigrations[opt.AppName], name)
+			migrationLocker.Unlock()
+			continue
+		}
+		migrateOnStartup(ctx, opt.AppName, name)
+	}
 	// patch delete at
 	patches := make([]*gomonkey.Patches, 0, len(confs))
 	patches = append(patches, softdelete.PatchGormDeleteAt())
@@ -48,8 +75,14 @@ func Construct(ctx context.Context, confs map[string]*Conf, opts ...utils.Option
 
 		pid := syscall.Getpid()
 		app := config.Use(opt.AppName).AppName()
+		releaseIDGenWorkers(opt.AppName)
+		releaseCryptoKeyrings(opt.AppName)
 		if appInstances != nil {
-			for _, instance := range appInstances[opt.AppName] {
+			for name, instance := range appInstances[opt.AppName] {
+				health.Unregister(config.ComponentDB, name, health.AppName(opt.AppName))
+				if instance.replicas != nil {
+					instance.replicas.close()
+				}
 				if sqlDB, err := instance.GetProxy().DB(); err == nil {
 					if err := sqlDB.Close(); err != nil {
 						log.Printf("%v [Gofusion] %s %s close error: %s", pid, app, config.ComponentDB, err)
@@ -58,6 +91,14 @@ func Construct(ctx context.Context, confs map[string]*Conf, opts ...utils.Option
 			}
 			delete(appInstances, opt.AppName)
 		}
+
+		migrationLocker.Lock()
+		delete(appPendingMigrations, opt.AppName)
+		migrationLocker.Unlock()
+
+		shardGroupLocker.Lock()
+		delete(appShardGroups, opt.AppName)
+		shardGroupLocker.Unlock()
 		if len(appInstances) == 0 {
 			for _, patch := range patches {
 				if patch != nil {
@@ -89,17 +130,25 @@ func addInstance(ctx context.Context, name string, conf *Conf, opt *config.InitO
 
 	adaptMysqlAutoIncrementIncrement(db, conf)
 	mysqlSoftDelete(db, conf)
+	registerOptimisticLock(db.GetProxy())
+	registerTenant(db.GetProxy())
+	registerCrypto(db.GetProxy(), opt.AppName)
+	registerQueryCache(db.GetProxy(), opt.AppName, conf)
 	if config.Use(opt.AppName).Debug() {
 		db.DB = db.Debug()
 	}
 
+	// read replicas
+	var replicas *replicaPool
+	if len(conf.Replicas.Instances) > 0 {
+		replicas = newReplicaPool(ctx, opt.AppName, name, conf, logObj)
+		replicas.register(db.GetProxy())
+	}
+
 	// sharding
 	tablePluginMap := make(map[string]plugins.TableSharding, len(conf.Sharding))
 	for _, shardConf := range conf.Sharding {
-		var generator idgen.Generator
-		if utils.IsStrNotBlank(shardConf.IDGen) {
-			generator = (*(*func() idgen.Generator)(inspect.FuncOf(shardConf.IDGen)))()
-		}
+		generator := newShardingIDGen(ctx, opt.AppName, name, db, &shardConf)
 
 		var expression gval.Evaluable
 		if utils.IsStrNotBlank(shardConf.ShardingKeyExpr) {
@@ -122,6 +171,11 @@ func addInstance(ctx context.Context, name string, conf *Conf, opt *config.InitO
 		tablePluginMap[shardConf.Table] = tableShardingPlugin
 	}
 
+	// audit
+	if conf.Audit.Enable {
+		utils.MustSuccess(db.Use(newAuditPlugin(opt.AppName, name, conf, db.GetProxy())))
+	}
+
 	rwlock.Lock()
 	defer rwlock.Unlock()
 	if appInstances == nil {
@@ -133,7 +187,14 @@ func addInstance(ctx context.Context, name string, conf *Conf, opt *config.InitO
 	if _, ok := appInstances[opt.AppName][name]; ok {
 		panic(ErrDuplicatedName)
 	}
-	appInstances[opt.AppName][name] = &Instance{db: db, name: name, tableShardingPlugins: tablePluginMap}
+	appInstances[opt.AppName][name] = &Instance{
+		db:                   db,
+		name:                 name,
+		tableShardingPlugins: tablePluginMap,
+		migration:            conf.Migration,
+		replicas:             replicas,
+	}
+	health.Register(config.ComponentDB, name, appInstances[opt.AppName][name].ping, health.AppName(opt.AppName))
 
 	// ioc
 	if opt.DI != nil {
@@ -158,6 +219,19 @@ func addInstance(ctx context.Context, name string, conf *Conf, opt *config.InitO
 	}
 
 	go startDaemonRoutines(ctx, opt.AppName, name, conf)
+	if len(tablePluginMap) > 0 {
+		instance := appInstances[opt.AppName][name]
+		// writes are not refused if the first sync fails since no job is known yet, and writes of the instance
+		// probably fail as well if the job table on the primary is not readable
+		if err := instance.syncResharding(ctx); err != nil {
+			log.Printf("%v [Gofusion] %s %s %s %s", syscall.Getpid(), config.Use(opt.AppName).AppName(),
+				config.ComponentDB, name, err)
+		}
+		go startReshardingSync(ctx, opt.AppName, name, instance)
+	}
+	if replicas != nil {
+		go replicas.startChecking(ctx)
+	}
 }
 
 // adaptAutoIncrementIncrement patch gorm schema parse method to enable changing autoIncrementIncrement in runtime
@@ -191,4 +265,6 @@ func mysqlSoftDelete(db *orm.DB, conf *Conf) {
 
 func init() {
 	config.AddComponent(config.ComponentDB, Construct, config.WithFlag(&flagString))
+	// db migrations locked by lock instances are waiting for the lock component
+	config.OnConstructed(config.ComponentLock, migratePendingOnStartup)
 }
@@ -0,0 +1,307 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/common/utils/serialize/json"
+	"github.com/wfusion/gofusion/config"
+)
+
+const (
+	// CryptoSerializer encrypts fields tagged like `gorm:"serializer:fus_crypto;crypto:<name>"` by the named
+	// crypto config on write and decrypts them on read, the default crypto config is used if the name is empty
+	CryptoSerializer = "fus_crypto"
+
+	cryptoTagSetting     = "CRYPTO"
+	blindIndexTagSetting = "BLIND_INDEX"
+	cryptoCallbackName   = "gofusion:crypto"
+)
+
+var (
+	cryptoKeyrings sync.Map
+)
+
+type cryptoAppKey struct{}
+
+type cryptoKeyring struct {
+	revision   any
+	encrypt    func(src []byte) ([]byte, error)
+	decrypt    func(src []byte) ([]byte, error)
+	blindIndex func(src []byte) (string, error)
+}
+
+// getCryptoKeyring returns the cached keyring of the named crypto config, keyrings are rebuilt once configs are
+// reloaded or patched, and not cached if the config is not found
+func getCryptoKeyring(appName, name string) *cryptoKeyring {
+	key := fmt.Sprintf("%s:%s", appName, name)
+	revision := config.CryptoConfigRevision(config.AppName(appName))
+	if keyring, ok := cryptoKeyrings.Load(key); ok && keyring.(*cryptoKeyring).revision == revision {
+		return keyring.(*cryptoKeyring)
+	}
+	opts := []utils.OptionExtender{config.AppName(appName), config.CryptoConfigName(name)}
+	keyring := &cryptoKeyring{
+		revision:   revision,
+		encrypt:    config.CryptoEncryptWithKeyIDFunc(opts...),
+		decrypt:    config.CryptoDecryptWithKeyIDFunc(opts...),
+		blindIndex: config.CryptoBlindIndexFunc(opts...),
+	}
+	if config.CryptoConfigFound(opts...) {
+		cryptoKeyrings.Store(key, keyring)
+	}
+	return keyring
+}
+
+func releaseCryptoKeyrings(appName string) {
+	cryptoKeyrings.Range(func(key, _ any) bool {
+		if strings.HasPrefix(key.(string), appName+":") {
+			cryptoKeyrings.Delete(key)
+		}
+		return true
+	})
+}
+
+func fieldCryptoKeyring(ctx context.Context, field *schema.Field) *cryptoKeyring {
+	appName, _ := ctx.Value(cryptoAppKey{}).(string)
+	return getCryptoKeyring(appName, field.TagSettings[cryptoTagSetting])
+}
+
+// BlindIndex returns the blind index of the value by the named crypto config, it is used for equality lookups on
+// encrypted fields, e.g. Where("phone_index = ?", db.BlindIndex("pii", phone))
+func BlindIndex(cryptoName, value string, opts ...utils.OptionExtender) (index string, err error) {
+	opt := utils.ApplyOptions[useOption](opts...)
+	if value == "" {
+		return
+	}
+	return getCryptoKeyring(opt.appName, cryptoName).blindIndex([]byte(value))
+}
+
+// cryptoSerializer encrypts strings and bytes as they are and others in json, blank values are not encrypted
+type cryptoSerializer struct{}
+
+func (cryptoSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) (err error) {
+	fieldValue := reflect.New(field.FieldType)
+	if dbValue != nil {
+		var src []byte
+		switch v := dbValue.(type) {
+		case []byte:
+			src = v
+		case string:
+			src = []byte(v)
+		default:
+			return errors.Errorf("unsupported encrypted value type %T of field %s", dbValue, field.Name)
+		}
+		if len(src) > 0 {
+			plaintext, err := fieldCryptoKeyring(ctx, field).decrypt(src)
+			if err != nil {
+				return errors.Wrapf(err, "decrypt field %s failed", field.Name)
+			}
+			if err = setCryptoPlaintext(fieldValue, plaintext); err != nil {
+				return errors.Wrapf(err, "unmarshal field %s failed", field.Name)
+			}
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return
+}
+
+func (cryptoSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue any) (
+	val any, err error) {
+	plaintext, err := cryptoPlaintext(fieldValue)
+	if err != nil || len(plaintext) == 0 {
+		if field.TagSettings["NOT NULL"] != "" {
+			return "", err
+		}
+		return nil, err
+	}
+	ciphertext, err := fieldCryptoKeyring(ctx, field).encrypt(plaintext)
+	if err != nil {
+		return nil, errors.Wrapf(err, "encrypt field %s failed", field.Name)
+	}
+	if reflect.Indirect(reflect.ValueOf(fieldValue)).Kind() == reflect.Slice {
+		return ciphertext, nil
+	}
+	return string(ciphertext), nil
+}
+
+func cryptoPlaintext(fieldValue any) (plaintext []byte, err error) {
+	rv := reflect.ValueOf(fieldValue)
+	if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return
+	}
+	switch rv = reflect.Indirect(rv); {
+	case rv.Kind() == reflect.String:
+		return []byte(rv.String()), nil
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		return rv.Bytes(), nil
+	default:
+		return json.Marshal(rv.Interface())
+	}
+}
+
+func setCryptoPlaintext(fieldValue reflect.Value, plaintext []byte) (err error) {
+	rv := fieldValue.Elem()
+	if rv.Kind() == reflect.Ptr {
+		rv.Set(reflect.New(rv.Type().Elem()))
+		rv = rv.Elem()
+	}
+	switch {
+	case rv.Kind() == reflect.String:
+		rv.SetString(string(plaintext))
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		rv.SetBytes(append([]byte(nil), plaintext...))
+	default:
+		err = json.Unmarshal(plaintext, rv.Addr().Interface())
+	}
+	return
+}
+
+// registerCrypto puts the app name into statement contexts for the crypto serializer, and fills blind indexes
+// tagged like `gorm:"blind_index:<encrypted field name>"` before creating and updating
+func registerCrypto(db *gorm.DB, appName string) {
+	withApp := func(db *gorm.DB) {
+		if db.Statement.Context != nil && db.Statement.Context.Value(cryptoAppKey{}) == nil {
+			db.Statement.Context = context.WithValue(db.Statement.Context, cryptoAppKey{}, appName)
+		}
+	}
+	cb := db.Callback()
+	utils.MustSuccess(cb.Query().Before("gorm:query").Register(cryptoCallbackName, withApp))
+	utils.MustSuccess(cb.Row().Before("gorm:row").Register(cryptoCallbackName, withApp))
+	utils.MustSuccess(cb.Raw().Before("gorm:raw").Register(cryptoCallbackName, withApp))
+	utils.MustSuccess(cb.Create().Before("gorm:create").Register(cryptoCallbackName, func(db *gorm.DB) {
+		withApp(db)
+		fillBlindIndexes(db)
+	}))
+	utils.MustSuccess(cb.Update().Before("gorm:update").Register(cryptoCallbackName, func(db *gorm.DB) {
+		withApp(db)
+		fillBlindIndexes(db)
+	}))
+}
+
+func encryptedField(field *schema.Field) bool {
+	return strings.EqualFold(field.TagSettings["SERIALIZER"], CryptoSerializer)
+}
+
+func fillBlindIndexes(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return
+	}
+	type blindIndex struct{ index, source *schema.Field }
+	indexes := make([]blindIndex, 0)
+	for _, field := range stmt.Schema.Fields {
+		name, ok := field.TagSettings[blindIndexTagSetting]
+		if !ok {
+			continue
+		}
+		source := stmt.Schema.LookUpField(name)
+		if source == nil || !encryptedField(source) {
+			_ = db.AddError(errors.Errorf("blind index %s source field %s is not encrypted", field.Name, name))
+			return
+		}
+		indexes = append(indexes, blindIndex{index: field, source: source})
+	}
+
+	// blind indexes of blank values are blank as well, so check the blind index key of every index here
+	for _, idx := range indexes {
+		if _, err := fieldCryptoKeyring(stmt.Context, idx.source).blindIndex(nil); err != nil {
+			_ = db.AddError(errors.Wrapf(err, "blind index %s unavailable", idx.index.Name))
+			return
+		}
+	}
+
+	// updates with maps are assigned by raw values, so encrypted fields are serialized into a copy of the map to
+	// leave the caller's one untouched, otherwise reusing it would encrypt values twice
+	if values, ok := stmt.Dest.(map[string]any); ok {
+		assigned := make(map[string]any, len(values))
+		for k, v := range values {
+			assigned[k] = v
+		}
+		for k, v := range values {
+			field := stmt.Schema.LookUpField(k)
+			if field == nil || !encryptedField(field) {
+				continue
+			}
+			for _, idx := range indexes {
+				if idx.source == field {
+					plaintext, err := cryptoPlaintext(v)
+					if err != nil {
+						_ = db.AddError(err)
+						return
+					}
+					index := ""
+					if len(plaintext) > 0 {
+						if index, err = fieldCryptoKeyring(stmt.Context, field).blindIndex(plaintext); err != nil {
+							_ = db.AddError(err)
+							return
+						}
+					}
+					assigned[idx.index.DBName] = index
+				}
+			}
+			val, err := cryptoSerializer{}.Value(stmt.Context, field, stmt.ReflectValue, v)
+			if err != nil {
+				_ = db.AddError(err)
+				return
+			}
+			assigned[k] = val
+		}
+		stmt.Dest = assigned
+		return
+	}
+	if len(indexes) == 0 {
+		return
+	}
+
+	fill := func(rv reflect.Value) {
+		rv = reflect.Indirect(rv)
+		if rv.Kind() != reflect.Struct || rv.Type() != stmt.Schema.ModelType {
+			return
+		}
+		for _, idx := range indexes {
+			// ValueOf of serialized fields returns serializers rather than the values
+			value := idx.source.ReflectValueOf(stmt.Context, rv)
+			index := ""
+			if !value.IsZero() {
+				plaintext, err := cryptoPlaintext(value.Interface())
+				if err == nil && len(plaintext) > 0 {
+					index, err = fieldCryptoKeyring(stmt.Context, idx.source).blindIndex(plaintext)
+				}
+				if err != nil {
+					_ = db.AddError(err)
+					return
+				}
+			}
+			if err := idx.index.Set(stmt.Context, rv, index); err != nil {
+				_ = db.AddError(err)
+				return
+			}
+		}
+	}
+	dest := stmt.ReflectValue
+	if stmt.Dest != stmt.Model {
+		if rv := reflect.Indirect(reflect.ValueOf(stmt.Dest)); rv.IsValid() {
+			dest = rv
+		}
+	}
+	switch dest.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < dest.Len(); i++ {
+			fill(dest.Index(i))
+		}
+	default:
+		fill(dest)
+	}
+}
+
+func init() {
+	schema.RegisterSerializer(CryptoSerializer, cryptoSerializer{})
+}
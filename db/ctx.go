@@ -14,8 +14,11 @@ func GetCtxGormDB(ctx context.Context) *DB {
 
 func GetCtxGormDBByName(ctx context.Context, name string) (db *DB) {
 	utils.TravelCtx(ctx, func(ctx context.Context) bool {
-		db = utils.GetCtxAny(ctx, fusCtx.KeyGormDB, (*DB)(nil))
-		return db != nil && db.Name == name
+		if found := utils.GetCtxAny(ctx, fusCtx.KeyGormDB, (*DB)(nil)); found != nil && found.Name == name {
+			db = found
+			return true
+		}
+		return false
 	})
 	return
 }
@@ -23,8 +26,11 @@ func GetCtxGormDBByName(ctx context.Context, name string) (db *DB) {
 func GetCtxGormDBByNameList(ctx context.Context, nameList []string) (db *DB) {
 	names := utils.NewSet(nameList...)
 	utils.TravelCtx(ctx, func(ctx context.Context) bool {
-		db = utils.GetCtxAny(ctx, fusCtx.KeyGormDB, (*DB)(nil))
-		return db != nil && names.Contains(db.Name)
+		if found := utils.GetCtxAny(ctx, fusCtx.KeyGormDB, (*DB)(nil)); found != nil && names.Contains(found.Name) {
+			db = found
+			return true
+		}
+		return false
 	})
 	return
 }
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"reflect"
+	"time"
 
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
@@ -32,6 +33,7 @@ type DalInterface[T any, TS ~[]*T] interface {
 	Save(ctx context.Context, mod any, opts ...utils.OptionExtender) error
 	Update(ctx context.Context, column string, value any, query any, args ...any) (int64, error)
 	Updates(ctx context.Context, updates, query any, args ...any) (int64, error)
+	UpdateWithRetry(ctx context.Context, id any, mutateFn func(mod *T) error, conds ...any) (*T, error)
 	Delete(ctx context.Context, query any, args ...any) (int64, error)
 	FirstOrCreate(ctx context.Context, mod *T, conds ...any) (int64, error)
 	Transaction(ctx context.Context, fc func(tx context.Context) error, opts ...utils.OptionExtender) error
@@ -74,11 +76,12 @@ func (d *dal[T, TS]) Query(ctx context.Context, query any, args ...any) (TS, err
 	ctx = context.WithValue(ctx, fusCtx.KeyDALOption, o)
 
 	found := d.ModelSlice()
-	result := d.ReadDB(ctx).Clauses(o.clauses...).Where(query, args...).Find(&found)
-	if d.CanIgnore(result.Error) {
+	err := queryWithCache(ctx, d.appName, d.readDBNameOf(o), o, func() *gorm.DB { return d.ReadDB(ctx) }, &found,
+		func(tx *gorm.DB) *gorm.DB { return tx.Clauses(o.clauses...).Where(query, args...).Find(&found) })
+	if d.CanIgnore(err) {
 		return nil, nil
 	}
-	return found, d.IgnoreErr(result.Error)
+	return found, d.IgnoreErr(err)
 }
 
 func (d *dal[T, TS]) QueryLast(ctx context.Context, query any, args ...any) (*T, error) {
@@ -98,11 +101,12 @@ func (d *dal[T, TS]) QueryFirst(ctx context.Context, query any, args ...any) (*T
 	ctx = context.WithValue(ctx, fusCtx.KeyDALOption, o)
 
 	found := d.Model()
-	result := d.ReadDB(ctx).Clauses(o.clauses...).Where(query, args...).First(found)
-	if d.CanIgnore(result.Error) {
+	err := queryWithCache(ctx, d.appName, d.readDBNameOf(o), o, func() *gorm.DB { return d.ReadDB(ctx) }, &found,
+		func(tx *gorm.DB) *gorm.DB { return tx.Clauses(o.clauses...).Where(query, args...).First(found) })
+	if d.CanIgnore(err) {
 		return nil, nil
 	}
-	return found, d.IgnoreErr(result.Error)
+	return found, d.IgnoreErr(err)
 }
 
 func (d *dal[T, TS]) QueryInBatches(ctx context.Context, batchSize int,
@@ -134,11 +138,12 @@ func (d *dal[T, TS]) Count(ctx context.Context, query any, args ...any) (int64,
 	o, args := d.parseOptionFromArgs(args...)
 	ctx = context.WithValue(ctx, fusCtx.KeyDALOption, o)
 
-	result := d.ReadDB(ctx).Clauses(o.clauses...).Where(query, args...).Count(&count)
-	if d.CanIgnore(result.Error) {
+	err := queryWithCache(ctx, d.appName, d.readDBNameOf(o), o, func() *gorm.DB { return d.ReadDB(ctx) }, &count,
+		func(tx *gorm.DB) *gorm.DB { return tx.Clauses(o.clauses...).Where(query, args...).Count(&count) })
+	if d.CanIgnore(err) {
 		return 0, nil
 	}
-	return count, d.IgnoreErr(result.Error)
+	return count, d.IgnoreErr(err)
 }
 
 func (d *dal[T, TS]) Pluck(ctx context.Context, column string, dest any,
@@ -209,9 +214,20 @@ func (d *dal[T, TS]) Save(ctx context.Context, mod any, opts ...utils.OptionExte
 	if err != nil {
 		return err
 	}
+	saveOneByOne := versioned(d.WriteDB(ctx), d.Model()) || tenanted(d.WriteDB(ctx), d.Model())
 	for _, mList := range sharded {
-		if err = d.WriteDB(ctx).Clauses(o.clauses...).Save(mList).Error; err != nil {
-			return err
+		if !saveOneByOne {
+			if err = d.WriteDB(ctx).Clauses(o.clauses...).Save(mList).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		// upsert would skip the version check and overwrite rows of other tenants, so models with the version
+		// or tenant field are updated one by one and inserted if not found
+		for _, m := range mList {
+			if err = d.WriteDB(ctx).Model(m).Clauses(o.clauses...).Save(m).Error; err != nil {
+				return err
+			}
 		}
 	}
 
@@ -270,21 +286,20 @@ func (d *dal[T, TS]) Transaction(ctx context.Context, fc func(context.Context) e
 		}
 	}
 
-	return d.unscopedGormDB(orm.GetProxy().WithContext(ctx), o).Transaction(func(tx *gorm.DB) error {
-		return fc(SetCtxGormDB(ctx, &DB{
-			DB:                   &ormDrv.DB{DB: tx},
-			Name:                 orm.Name,
-			tableShardingPlugins: orm.tableShardingPlugins,
-		}))
+	return withQueryCacheTx(ctx, func(ctx context.Context) error {
+		return d.unscopedGormDB(orm.GetProxy().WithContext(ctx), o).Transaction(func(tx *gorm.DB) error {
+			return fc(SetCtxGormDB(ctx, &DB{
+				DB:                   &ormDrv.DB{DB: tx},
+				Name:                 orm.Name,
+				tableShardingPlugins: orm.tableShardingPlugins,
+			}))
+		})
 	})
 }
 
 func (d *dal[T, TS]) ReadDB(ctx context.Context) *gorm.DB {
 	o, _ := ctx.Value(fusCtx.KeyDALOption).(*mysqlDALOption)
-	dbName := d.readDBName
-	if o != nil && o.useWriteDB {
-		dbName = d.writeDBName
-	}
+	dbName := d.readDBNameOf(o)
 	if orm := GetCtxGormDBByName(ctx, dbName); orm != nil {
 		return d.unscopedGormDB(orm.Model(d.Model()), o).WithContext(ctx)
 	}
@@ -380,6 +395,12 @@ func (d *dal[T, TS]) ShardingByModelList(ctx context.Context, src TS) (dst map[s
 	return
 }
 
+func (d *dal[T, TS]) readDBNameOf(o *mysqlDALOption) string {
+	if o != nil && o.useWriteDB {
+		return d.writeDBName
+	}
+	return d.readDBName
+}
 func (d *dal[T, TS]) writeDB(ctx context.Context) *DB {
 	if orm := GetCtxGormDBByName(ctx, d.writeDBName); orm != nil {
 		return orm
@@ -442,16 +463,26 @@ func (d *dal[T, TS]) convertAnyToTS(query any) (mList TS, ok bool) {
 	return
 }
 func (d *dal[T, TS]) unscopedGormDB(src *gorm.DB, o *mysqlDALOption) (dst *gorm.DB) {
+	dst = src
+	if o != nil && o.bypassTenant {
+		dst = WithoutTenant(dst)
+	}
 	if o != nil && o.unscoped {
-		return src.Unscoped()
+		return dst.Unscoped()
 	}
-	return src
+	return
 }
 
 type mysqlDALOption struct {
-	unscoped   bool
-	useWriteDB bool
-	clauses    []clause.Expression
+	unscoped        bool
+	useWriteDB      bool
+	bypassTenant    bool
+	allowCrossShard bool
+	retries         int
+	shardingValues  []any
+	cacheName       string
+	cacheTTL        time.Duration
+	clauses         []clause.Expression
 }
 
 func Unscoped() utils.OptionFunc[mysqlDALOption] {
@@ -466,6 +497,44 @@ func Clauses(clauses ...clause.Expression) utils.OptionFunc[mysqlDALOption] {
 	}
 }
 
+// BypassTenant bypasses the tenant isolation of models embedding db.Tenant
+func BypassTenant() utils.OptionFunc[mysqlDALOption] {
+	return func(m *mysqlDALOption) {
+		m.bypassTenant = true
+	}
+}
+
+// Retries sets the retry times of UpdateWithRetry when the model is updated by others
+func Retries(n int) utils.OptionFunc[mysqlDALOption] {
+	return func(m *mysqlDALOption) {
+		m.retries = n
+	}
+}
+
+// ShardingKey routes the sharded dal to the shard of the sharding values, in the order of the shard group columns
+func ShardingKey(values ...any) utils.OptionFunc[mysqlDALOption] {
+	return func(m *mysqlDALOption) {
+		m.shardingValues = values
+	}
+}
+
+// AllowCrossShard allows the transaction of the sharded dal across all the shards, which is not atomic
+func AllowCrossShard() utils.OptionFunc[mysqlDALOption] {
+	return func(m *mysqlDALOption) {
+		m.allowCrossShard = true
+	}
+}
+
+// Cached caches results of Query, QueryFirst and Count in the cache instance for ttl, or the cache expiration if
+// ttl is not positive, results of a table are invalidated once the table is written, queries with joins or preloads
+// return ErrQueryCacheNotSupport since writes of other tables would not invalidate them
+func Cached(cacheName string, ttl time.Duration) utils.OptionFunc[mysqlDALOption] {
+	return func(m *mysqlDALOption) {
+		m.cacheName = cacheName
+		m.cacheTTL = ttl
+	}
+}
+
 func WriteDB() utils.OptionFunc[mysqlDALOption] {
 	return func(m *mysqlDALOption) {
 		m.useWriteDB = true
@@ -0,0 +1,720 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/db/plugins"
+	"github.com/wfusion/gofusion/routine"
+
+	fusCtx "github.com/wfusion/gofusion/context"
+)
+
+// shardedDAL routes to the instances of the shard group, statements with all the sharding keys compared by = go to
+// one shard, others are scattered to all the shards and gathered with the order by and limit merged
+type shardedDAL[T any, TS ~[]*T] struct {
+	appName   string
+	groupName string
+}
+
+// NewShardedDAL creates the dal of the shard group, which is the db configured with shard_group
+func NewShardedDAL[T any, TS ~[]*T](groupName string, opts ...utils.OptionExtender) DalInterface[T, TS] {
+	instance := new(T)
+	if _, ok := any(instance).(schema.Tabler); !ok {
+		panic(errors.Errorf("model unimplement schema.Tabler [model[%T] shard_group[%s]]", instance, groupName))
+	}
+	opt := utils.ApplyOptions[useOption](opts...)
+	return &shardedDAL[T, TS]{
+		appName:   opt.appName,
+		groupName: groupName,
+	}
+}
+
+func (d *shardedDAL[T, TS]) Query(ctx context.Context, query any, args ...any) (TS, error) {
+	o, args := d.parseOptionFromArgs(args...)
+	shards, err := d.route(ctx, false, o, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(shards) == 1 {
+		return d.shard(shards[0]).Query(ctx, query, shardArgs(o, args)...)
+	}
+
+	so, offset, limit := scatterOption(o)
+	found, err := scatter(d.appName, shards, func(shard string) (TS, error) {
+		return d.shard(shard).Query(ctx, query, shardArgs(so, args)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []*T
+	for _, shardRows := range found {
+		rows = append(rows, shardRows...)
+	}
+	return d.merge(ctx, rows, orderByColumns(o), offset, limit), nil
+}
+
+func (d *shardedDAL[T, TS]) QueryLast(ctx context.Context, query any, args ...any) (*T, error) {
+	return d.queryOne(ctx, true, query, args...)
+}
+
+func (d *shardedDAL[T, TS]) QueryFirst(ctx context.Context, query any, args ...any) (*T, error) {
+	return d.queryOne(ctx, false, query, args...)
+}
+
+func (d *shardedDAL[T, TS]) queryOne(ctx context.Context, last bool, query any, args ...any) (*T, error) {
+	o, args := d.parseOptionFromArgs(args...)
+	shards, err := d.route(ctx, false, o, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	queryFn := func(shard string) (*T, error) {
+		if last {
+			return d.shard(shard).QueryLast(ctx, query, shardArgs(o, args)...)
+		}
+		return d.shard(shard).QueryFirst(ctx, query, shardArgs(o, args)...)
+	}
+	if len(shards) == 1 {
+		return queryFn(shards[0])
+	}
+
+	found, err := scatter(d.appName, shards, queryFn)
+	if err != nil {
+		return nil, err
+	}
+	// first and last are ordered by the primary key after the order by
+	orders := orderByColumns(o)
+	if pk := d.schema(ctx).PrioritizedPrimaryField; pk != nil {
+		orders = append(orders, clause.OrderByColumn{Column: clause.Column{Name: pk.DBName}, Desc: last})
+	}
+	one := 1
+	merged := d.merge(ctx, utils.SliceRemove(found, func(t *T) bool { return t == nil }), orders, 0, &one)
+	if len(merged) == 0 {
+		return nil, nil
+	}
+	return merged[0], nil
+}
+
+func (d *shardedDAL[T, TS]) QueryInBatches(ctx context.Context, batchSize int,
+	fc func(tx *DB, batch int, found TS) error, query any, args ...any) (err error) {
+	o, args := d.parseOptionFromArgs(args...)
+	shards, err := d.route(ctx, false, o, query, args...)
+	if err != nil {
+		return
+	}
+	for _, shard := range shards {
+		if err = d.shard(shard).QueryInBatches(ctx, batchSize, fc, query, shardArgs(o, args)...); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (d *shardedDAL[T, TS]) Count(ctx context.Context, query any, args ...any) (int64, error) {
+	o, args := d.parseOptionFromArgs(args...)
+	shards, err := d.route(ctx, false, o, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	counts, err := scatter(d.appName, shards, func(shard string) (int64, error) {
+		return d.shard(shard).Count(ctx, query, shardArgs(o, args)...)
+	})
+	return sum(counts), err
+}
+
+// Pluck appends the values plucked from the shards into dest in the order of the shards
+func (d *shardedDAL[T, TS]) Pluck(ctx context.Context, column string, dest any, query any, args ...any) error {
+	o, args := d.parseOptionFromArgs(args...)
+	shards, err := d.route(ctx, false, o, query, args...)
+	if err != nil {
+		return err
+	}
+	if len(shards) == 1 {
+		return d.shard(shards[0]).Pluck(ctx, column, dest, query, shardArgs(o, args)...)
+	}
+
+	destType := reflect.TypeOf(dest)
+	if destType.Kind() != reflect.Ptr || destType.Elem().Kind() != reflect.Slice {
+		return errors.Errorf("pluck dest should be a pointer of slice but %T", dest)
+	}
+	plucked, err := scatter(d.appName, shards, func(shard string) (reflect.Value, error) {
+		shardDest := reflect.New(destType.Elem())
+		return shardDest, d.shard(shard).Pluck(ctx, column, shardDest.Interface(), query, shardArgs(o, args)...)
+	})
+	if err != nil {
+		return err
+	}
+	destValue := reflect.ValueOf(dest).Elem()
+	for _, shardDest := range plucked {
+		destValue.Set(reflect.AppendSlice(destValue, shardDest.Elem()))
+	}
+	return nil
+}
+
+func (d *shardedDAL[T, TS]) Take(ctx context.Context, dest any, conds ...any) error {
+	o, conds := d.parseOptionFromArgs(conds...)
+	var query any
+	var args []any
+	if len(conds) > 0 {
+		query, args = conds[0], conds[1:]
+	}
+	shards, err := d.route(ctx, false, o, query, args...)
+	if err != nil {
+		return err
+	}
+	if len(shards) == 1 {
+		return d.shard(shards[0]).Take(ctx, dest, shardArgs(o, conds)...)
+	}
+
+	ctx = context.WithValue(ctx, fusCtx.KeyDALOption, o)
+	for _, shard := range shards {
+		result := d.shard(shard).ReadDB(ctx).Clauses(o.clauses...).Take(dest, conds...)
+		if result.Error == nil && result.RowsAffected > 0 {
+			return nil
+		}
+		if err = d.IgnoreErr(result.Error); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *shardedDAL[T, TS]) InsertOne(ctx context.Context, mod *T, opts ...utils.OptionExtender) error {
+	o := utils.ApplyOptions[mysqlDALOption](opts...)
+	shard, err := d.locateModel(ctx, o, mod)
+	if err != nil {
+		return err
+	}
+	return d.shard(shard).InsertOne(ctx, mod, withOption(o))
+}
+
+func (d *shardedDAL[T, TS]) InsertInBatches(ctx context.Context,
+	modList TS, batchSize int, opts ...utils.OptionExtender) error {
+	o := utils.ApplyOptions[mysqlDALOption](opts...)
+	shards, sharded, err := d.groupModels(ctx, o, modList)
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards {
+		if err = d.shard(shard).InsertInBatches(ctx, sharded[shard], batchSize, withOption(o)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save create or update models in the shards of them, see also dal.Save
+func (d *shardedDAL[T, TS]) Save(ctx context.Context, mod any, opts ...utils.OptionExtender) error {
+	mList, ok := new(dal[T, TS]).convertAnyToTS(mod)
+	if !ok {
+		mList = utils.SliceConvert(mod, reflect.TypeOf(TS{})).(TS)
+	}
+	if len(mList) == 0 {
+		return nil
+	}
+	o := utils.ApplyOptions[mysqlDALOption](opts...)
+	shards, sharded, err := d.groupModels(ctx, o, mList)
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards {
+		if err = d.shard(shard).Save(ctx, sharded[shard], withOption(o)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *shardedDAL[T, TS]) Update(ctx context.Context, column string, value any,
+	query any, args ...any) (int64, error) {
+	o, args := d.parseOptionFromArgs(args...)
+	shards, err := d.route(ctx, true, o, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := scatter(d.appName, shards, func(shard string) (int64, error) {
+		return d.shard(shard).Update(ctx, column, value, query, shardArgs(o, args)...)
+	})
+	return sum(affected), err
+}
+
+func (d *shardedDAL[T, TS]) Updates(ctx context.Context, updates any,
+	query any, args ...any) (int64, error) {
+	o, args := d.parseOptionFromArgs(args...)
+	shards, err := d.route(ctx, true, o, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := scatter(d.appName, shards, func(shard string) (int64, error) {
+		return d.shard(shard).Updates(ctx, updates, query, shardArgs(o, args)...)
+	})
+	return sum(affected), err
+}
+
+// UpdateWithRetry updates the model in the shard located by the conds or the ShardingKey option, otherwise the
+// shards are tried one by one until the model is found if allowed by AllowCrossShard
+func (d *shardedDAL[T, TS]) UpdateWithRetry(ctx context.Context, id any, mutateFn func(mod *T) error,
+	conds ...any) (mod *T, err error) {
+	o, conds := d.parseOptionFromArgs(conds...)
+	var query any
+	var args []any
+	if len(conds) > 0 {
+		query, args = conds[0], conds[1:]
+	}
+	shards, err := d.route(ctx, true, o, query, args...)
+	if err != nil {
+		return
+	}
+	for _, shard := range shards {
+		mod, err = d.shard(shard).UpdateWithRetry(ctx, id, mutateFn, shardArgs(o, conds)...)
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return
+		}
+	}
+	return
+}
+
+func (d *shardedDAL[T, TS]) Delete(ctx context.Context, query any, args ...any) (int64, error) {
+	o, args := d.parseOptionFromArgs(args...)
+	if mList, ok := new(dal[T, TS]).convertAnyToTS(query); ok && len(mList) > 0 {
+		shards, sharded, err := d.groupModels(ctx, o, mList)
+		if err != nil {
+			return 0, err
+		}
+		var rowAffected int64
+		for _, shard := range shards {
+			deleted, err := d.shard(shard).Delete(ctx, sharded[shard], shardArgs(o, args)...)
+			if rowAffected += deleted; err != nil {
+				return rowAffected, err
+			}
+		}
+		return rowAffected, nil
+	}
+
+	shards, err := d.route(ctx, true, o, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := scatter(d.appName, shards, func(shard string) (int64, error) {
+		return d.shard(shard).Delete(ctx, query, shardArgs(o, args)...)
+	})
+	return sum(affected), err
+}
+
+func (d *shardedDAL[T, TS]) FirstOrCreate(ctx context.Context, mod *T, conds ...any) (int64, error) {
+	o, conds := d.parseOptionFromArgs(conds...)
+	var query any
+	var args []any
+	if len(conds) > 0 {
+		query, args = conds[0], conds[1:]
+	}
+	shards, err := d.route(ctx, false, o, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	shard := shards[0]
+	if len(shards) > 1 {
+		if shard, err = d.locateModel(ctx, o, mod); err != nil {
+			return 0, err
+		}
+	}
+	return d.shard(shard).FirstOrCreate(ctx, mod, shardArgs(o, conds)...)
+}
+
+// Transaction runs fc within the transaction of the shard located by the ShardingKey option, transactions across
+// all the shards are refused unless allowed by the AllowCrossShard option or allow_cross_shard_tx config, and they
+// are committed from the last shard to the first one, so that a commit failure does not roll back committed shards
+func (d *shardedDAL[T, TS]) Transaction(ctx context.Context, fc func(tx context.Context) error,
+	opts ...utils.OptionExtender) error {
+	o := utils.ApplyOptions[mysqlDALOption](opts...)
+	group := d.group()
+	shards := group.instances
+	if len(o.shardingValues) > 0 {
+		shard, err := group.locate(ctx, o.shardingValues...)
+		if err != nil {
+			return err
+		}
+		shards = []string{shard}
+	}
+	if len(shards) > 1 && !group.allowCrossShardTx && !o.allowCrossShard {
+		return ErrCrossShardTx
+	}
+
+	var transaction func(ctx context.Context, idx int) error
+	transaction = func(ctx context.Context, idx int) error {
+		if idx == len(shards) {
+			return fc(ctx)
+		}
+		return d.shard(shards[idx]).Transaction(ctx, func(ctx context.Context) error {
+			return transaction(ctx, idx+1)
+		}, withOption(o))
+	}
+	return transaction(ctx, 0)
+}
+
+// ReadDB returns the db of the shard located by the ShardingKey option in the context, or the only shard in
+// transaction, otherwise the db carries plugins.ErrMissingShardingKey
+func (d *shardedDAL[T, TS]) ReadDB(ctx context.Context) *gorm.DB {
+	shard, err := d.pinned(ctx)
+	if err != nil {
+		return d.errorDB(ctx, err)
+	}
+	return d.shard(shard).ReadDB(ctx)
+}
+func (d *shardedDAL[T, TS]) WriteDB(ctx context.Context) *gorm.DB {
+	shard, err := d.pinned(ctx)
+	if err != nil {
+		return d.errorDB(ctx, err)
+	}
+	return d.shard(shard).WriteDB(ctx)
+}
+func (d *shardedDAL[T, TS]) SetCtxReadDB(src context.Context) (dst context.Context) {
+	shard, err := d.pinned(src)
+	if err != nil {
+		return src
+	}
+	return d.shard(shard).SetCtxReadDB(src)
+}
+func (d *shardedDAL[T, TS]) SetCtxWriteDB(src context.Context) (dst context.Context) {
+	shard, err := d.pinned(src)
+	if err != nil {
+		return src
+	}
+	return d.shard(shard).SetCtxWriteDB(src)
+}
+
+func (d *shardedDAL[T, TS]) Model() *T                 { return new(T) }
+func (d *shardedDAL[T, TS]) ModelSlice() TS            { return make(TS, 0) }
+func (d *shardedDAL[T, TS]) IgnoreErr(err error) error { return new(dal[T, TS]).IgnoreErr(err) }
+func (d *shardedDAL[T, TS]) CanIgnore(err error) bool  { return new(dal[T, TS]).CanIgnore(err) }
+
+// ShardingByValues and others are the table sharding within the pinned shard or the first one
+func (d *shardedDAL[T, TS]) ShardingByValues(ctx context.Context, src []map[string]any) (
+	dst map[string][]map[string]any, err error) {
+	return d.shard(d.pinnedOrFirst(ctx)).ShardingByValues(ctx, src)
+}
+func (d *shardedDAL[T, TS]) ShardingIDGen(ctx context.Context) (id uint64, err error) {
+	return d.shard(d.pinnedOrFirst(ctx)).ShardingIDGen(ctx)
+}
+func (d *shardedDAL[T, TS]) ShardingIDListGen(ctx context.Context, amount int) (idList []uint64, err error) {
+	return d.shard(d.pinnedOrFirst(ctx)).ShardingIDListGen(ctx, amount)
+}
+func (d *shardedDAL[T, TS]) ShardingByModelList(ctx context.Context, src TS) (dst map[string]TS, err error) {
+	return d.shard(d.pinnedOrFirst(ctx)).ShardingByModelList(ctx, src)
+}
+
+func (d *shardedDAL[T, TS]) group() *shardGroup {
+	return getShardGroup(d.appName, d.groupName)
+}
+func (d *shardedDAL[T, TS]) shard(name string) *dal[T, TS] {
+	return &dal[T, TS]{appName: d.appName, readDBName: name, writeDBName: name}
+}
+func (d *shardedDAL[T, TS]) parseOptionFromArgs(args ...any) (o *mysqlDALOption, r []any) {
+	return new(dal[T, TS]).parseOptionFromArgs(args...)
+}
+func (d *shardedDAL[T, TS]) schema(ctx context.Context) *schema.Schema {
+	stmt := &gorm.Statement{DB: Use(ctx, d.group().instances[0], AppName(d.appName)).GetProxy()}
+	utils.MustSuccess(stmt.Parse(d.Model()))
+	return stmt.Schema
+}
+func (d *shardedDAL[T, TS]) errorDB(ctx context.Context, err error) *gorm.DB {
+	tx := Use(ctx, d.group().instances[0], AppName(d.appName)).WithContext(ctx).Model(d.Model())
+	_ = tx.AddError(err)
+	return tx
+}
+
+// route returns the shard located by the ShardingKey option or the condition, otherwise all the shards, writes
+// without the sharding key are refused by plugins.ErrMissingShardingKey unless allowed by AllowCrossShard
+func (d *shardedDAL[T, TS]) route(ctx context.Context, write bool, o *mysqlDALOption, query any, args ...any) (
+	shards []string, err error) {
+	group := d.group()
+	values := o.shardingValues
+	if len(values) == 0 {
+		values, err = d.shardingValuesByCondition(ctx, group, o, query, args...)
+		if err != nil && !errors.Is(err, plugins.ErrMissingShardingKey) {
+			return nil, err
+		}
+	}
+	if len(values) == 0 {
+		if write && !o.allowCrossShard {
+			return nil, plugins.ErrMissingShardingKey
+		}
+		shards = group.instances
+	} else {
+		shard, err := group.locate(ctx, values...)
+		if err != nil {
+			return nil, err
+		}
+		shards = []string{shard}
+	}
+	return shards, d.checkTx(ctx, group, shards...)
+}
+
+// shardingValuesByCondition builds the sql in dry run mode and finds the sharding keys compared by =
+func (d *shardedDAL[T, TS]) shardingValuesByCondition(ctx context.Context, group *shardGroup,
+	o *mysqlDALOption, query any, args ...any) (values []any, err error) {
+	if query == nil {
+		return nil, plugins.ErrMissingShardingKey
+	}
+	orm := Use(ctx, group.instances[0], AppName(d.appName)).Session(&gorm.Session{DryRun: true})
+	tx := d.shard(group.instances[0]).unscopedGormDB(orm.Model(d.Model()), o).
+		Clauses(o.clauses...).Where(query, args...).Find(d.ModelSlice())
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return plugins.ShardingValuesBySQL(tx.Statement.SQL.String(), tx.Statement.Table, group.columns,
+		tx.Statement.Vars...)
+}
+
+// locateModel returns the shard of the model by the ShardingKey option or the sharding key fields
+func (d *shardedDAL[T, TS]) locateModel(ctx context.Context, o *mysqlDALOption, mod *T) (shard string, err error) {
+	group := d.group()
+	values := o.shardingValues
+	if len(values) == 0 {
+		sch := d.schema(ctx)
+		rv := reflect.Indirect(reflect.ValueOf(mod))
+		for _, column := range group.columns {
+			field := sch.LookUpField(column)
+			if field == nil {
+				return "", plugins.ErrMissingShardingKey
+			}
+			value, _ := field.ValueOf(ctx, rv)
+			values = append(values, value)
+		}
+	}
+	if shard, err = group.locate(ctx, values...); err != nil {
+		return
+	}
+	return shard, d.checkTx(ctx, group, shard)
+}
+func (d *shardedDAL[T, TS]) groupModels(ctx context.Context, o *mysqlDALOption, mList TS) (
+	shards []string, sharded map[string]TS, err error) {
+	sharded = make(map[string]TS)
+	for _, mod := range mList {
+		shard, err := d.locateModel(ctx, o, mod)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := sharded[shard]; !ok {
+			shards = append(shards, shard)
+		}
+		sharded[shard] = append(sharded[shard], mod)
+	}
+	return
+}
+
+// checkTx refuses shards out of the transaction in the context if any shard is in transaction
+func (d *shardedDAL[T, TS]) checkTx(ctx context.Context, group *shardGroup, shards ...string) error {
+	inTx := shardsInTx(ctx, group)
+	if len(inTx) == 0 {
+		return nil
+	}
+	inTxSet := utils.NewSet(inTx...)
+	for _, shard := range shards {
+		if !inTxSet.Contains(shard) {
+			return ErrCrossShardTx
+		}
+	}
+	return nil
+}
+
+// pinned returns the shard located by the ShardingKey option in the context, or the only shard in transaction
+func (d *shardedDAL[T, TS]) pinned(ctx context.Context) (shard string, err error) {
+	group := d.group()
+	if o, _ := ctx.Value(fusCtx.KeyDALOption).(*mysqlDALOption); o != nil && len(o.shardingValues) > 0 {
+		return group.locate(ctx, o.shardingValues...)
+	}
+	inTx := shardsInTx(ctx, group)
+	if len(inTx) == 1 {
+		return inTx[0], nil
+	}
+	return "", plugins.ErrMissingShardingKey
+}
+func (d *shardedDAL[T, TS]) pinnedOrFirst(ctx context.Context) (shard string) {
+	if shard, err := d.pinned(ctx); err == nil {
+		return shard
+	}
+	return d.group().instances[0]
+}
+
+// merge sorts rows gathered from the shards by the order by columns and applies the offset and limit
+func (d *shardedDAL[T, TS]) merge(ctx context.Context, rows []*T, orders []clause.OrderByColumn,
+	offset int, limit *int) (merged TS) {
+	if len(orders) > 0 && len(rows) > 1 {
+		sch := d.schema(ctx)
+		fields := make([]*schema.Field, len(orders))
+		for i, order := range orders {
+			fields[i] = sch.LookUpField(order.Column.Name)
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			rvi, rvj := reflect.Indirect(reflect.ValueOf(rows[i])), reflect.Indirect(reflect.ValueOf(rows[j]))
+			for k, field := range fields {
+				if field == nil {
+					continue
+				}
+				vi, _ := field.ValueOf(ctx, rvi)
+				vj, _ := field.ValueOf(ctx, rvj)
+				if cmp := compareShardingValue(vi, vj); cmp != 0 {
+					return (cmp < 0) != orders[k].Desc
+				}
+			}
+			return false
+		})
+	}
+	if offset >= len(rows) {
+		return d.ModelSlice()
+	}
+	rows = rows[offset:]
+	if limit != nil && *limit >= 0 && *limit < len(rows) {
+		rows = rows[:*limit]
+	}
+	return TS(rows)
+}
+
+func shardsInTx(ctx context.Context, group *shardGroup) (shards []string) {
+	for _, instance := range group.instances {
+		orm := GetCtxGormDBByName(ctx, instance)
+		if orm == nil {
+			continue
+		}
+		if _, ok := orm.Statement.ConnPool.(gorm.TxCommitter); ok {
+			shards = append(shards, instance)
+		}
+	}
+	return
+}
+
+// scatter runs fn on the shards concurrently, results are in the order of the shards
+func scatter[R any](appName string, shards []string, fn func(shard string) (R, error)) (results []R, err error) {
+	results = make([]R, len(shards))
+	errs := make([]error, len(shards))
+	wg := new(sync.WaitGroup)
+	for i, shard := range shards {
+		wg.Add(1)
+		routine.Go(func(i int, shard string) {
+			_, errs[i] = utils.Catch(func() (err error) {
+				results[i], err = fn(shard)
+				return
+			})
+		}, routine.Args(i, shard), routine.WaitGroup(wg), routine.AppName(appName))
+	}
+	wg.Wait()
+	for i, e := range errs {
+		if e != nil {
+			return results, errors.Wrapf(e, "shard %s", shards[i])
+		}
+	}
+	return
+}
+
+// scatterOption queries offset + limit rows from each shard, and returns the offset and limit to merge
+func scatterOption(o *mysqlDALOption) (so *mysqlDALOption, offset int, limit *int) {
+	so = new(mysqlDALOption)
+	*so = *o
+	so.clauses = make([]clause.Expression, 0, len(o.clauses))
+	for _, c := range o.clauses {
+		l, ok := c.(clause.Limit)
+		if !ok {
+			so.clauses = append(so.clauses, c)
+			continue
+		}
+		offset, limit = l.Offset, l.Limit
+		if limit != nil {
+			shardLimit := offset + *limit
+			so.clauses = append(so.clauses, clause.Limit{Limit: &shardLimit})
+		}
+	}
+	return
+}
+
+func orderByColumns(o *mysqlDALOption) (columns []clause.OrderByColumn) {
+	for _, c := range o.clauses {
+		if orderBy, ok := c.(clause.OrderBy); ok {
+			for _, column := range orderBy.Columns {
+				if !column.Column.Raw {
+					columns = append(columns, column)
+				}
+			}
+		}
+	}
+	return
+}
+
+// shardArgs copies the args and appends the option, so that the args are safe to be used concurrently
+func shardArgs(o *mysqlDALOption, args []any) (r []any) {
+	r = make([]any, 0, len(args)+1)
+	r = append(r, args...)
+	return append(r, withOption(o))
+}
+
+func withOption(o *mysqlDALOption) utils.OptionFunc[mysqlDALOption] {
+	return func(m *mysqlDALOption) {
+		*m = *o
+	}
+}
+
+func sum(values []int64) (total int64) {
+	for _, v := range values {
+		total += v
+	}
+	return
+}
+
+// compareShardingValue compares values of the same column, nil goes first
+func compareShardingValue(a, b any) int {
+	a, b = normalizeShardingValue(a), normalizeShardingValue(b)
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	switch x := a.(type) {
+	case time.Time:
+		if y, ok := b.(time.Time); ok && x.Before(y) {
+			return -1
+		} else if ok && x.After(y) {
+			return 1
+		} else if ok {
+			return 0
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok && x != y && x {
+			return 1
+		} else if ok && x != y {
+			return -1
+		}
+		return 0
+	}
+	fa, errA := cast.ToFloat64E(a)
+	fb, errB := cast.ToFloat64E(b)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
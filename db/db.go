@@ -26,12 +26,22 @@ type Instance struct {
 	name                 string
 	db                   *orm.DB
 	tableShardingPlugins map[string]plugins.TableSharding
+	migration            migrationConf
+	replicas             *replicaPool
 }
 
 func (d *Instance) GetProxy() *gorm.DB {
 	return d.db.GetProxy()
 }
 
+func (d *Instance) ping(ctx context.Context) (err error) {
+	sqlDB, err := d.db.GetProxy().DB()
+	if err != nil {
+		return
+	}
+	return sqlDB.PingContext(ctx)
+}
+
 type DB struct {
 	*orm.DB
 	Name                 string
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm"
+	"github.com/wfusion/gofusion/common/infra/drivers/orm/idgen"
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/common/utils/inspect"
+	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/kv"
+	"github.com/wfusion/gofusion/redis"
+)
+
+const (
+	idgenWorkerTypeDB    = "db"
+	idgenWorkerTypeRedis = "redis"
+	idgenWorkerTypeKV    = "kv"
+)
+
+var (
+	idgenWorkerLocker sync.Mutex
+	// appIDGenWorkers app name -> leaser key -> leased snowflake shared by sharded tables
+	appIDGenWorkers = make(map[string]map[string]*idgen.LeasedSnowflake)
+)
+
+// newShardingIDGen resolves the idgen of the sharding config, it panics if the worker id pool is exhausted
+func newShardingIDGen(ctx context.Context, appName, name string, db *orm.DB,
+	conf *shardingConf) (generator idgen.Generator) {
+	if utils.IsStrNotBlank(conf.IDGenWorker.Type) {
+		return leaseIDGenWorker(ctx, appName, name, db, &conf.IDGenWorker)
+	}
+	if utils.IsStrBlank(conf.IDGen) {
+		return
+	}
+	// constructors should be kept linked by their reflect types, e.g. idgen.NewSnowflakeType
+	fn := inspect.FuncOf(conf.IDGen)
+	if fn == nil {
+		panic(errors.Errorf("db %s sharding table %s idgen %s not found", name, conf.Table, conf.IDGen))
+	}
+	generator = (*(*func() idgen.Generator)(fn))()
+	if binder, ok := generator.(idgen.GormBinder); ok {
+		binder.BindGorm(db.GetProxy(), fmt.Sprintf("%s:%s", name, conf.Table))
+	}
+	return
+}
+
+func leaseIDGenWorker(ctx context.Context, appName, name string, db *orm.DB,
+	conf *idgenWorkerConf) idgen.Generator {
+	var (
+		leaser   idgen.WorkerLeaser
+		instance = conf.Instance
+	)
+	switch conf.Type {
+	case idgenWorkerTypeDB:
+		instance = name
+		leaser = idgen.NewGormWorkerLeaser(db.GetProxy(), conf.Key)
+	case idgenWorkerTypeRedis:
+		leaser = idgen.NewRedisWorkerLeaser(redis.Use(ctx, instance, redis.AppName(appName)), conf.Key)
+	case idgenWorkerTypeKV:
+		leaser = kv.WorkerLeaser(ctx, instance, kv.AppName(appName), kv.WorkerPrefix(conf.Key))
+	default:
+		panic(errors.Errorf("db %s unknown idgen worker type %s", name, conf.Type))
+	}
+
+	key := fmt.Sprintf("%s:%s:%s", conf.Type, instance, conf.Key)
+	idgenWorkerLocker.Lock()
+	defer idgenWorkerLocker.Unlock()
+	if generator, ok := appIDGenWorkers[appName][key]; ok {
+		return generator
+	}
+
+	generator, err := idgen.NewLeasedSnowflake(ctx, leaser,
+		idgen.WorkerTTL(utils.Must(utils.ParseDuration(conf.TTL))),
+		idgen.WorkerPoolSize(conf.PoolSize),
+		idgen.WorkerOwner(fmt.Sprintf("%s-%s", config.Use(appName).AppName(), utils.NginxID())),
+	)
+	if err != nil {
+		panic(errors.Wrapf(err, "db %s lease idgen worker id from %s %s failed", name, conf.Type, instance))
+	}
+	log.Printf("%v [Gofusion] %s %s %s leased idgen worker id %v from %s %s", syscall.Getpid(),
+		config.Use(appName).AppName(), config.ComponentDB, name, generator.WorkerID(), conf.Type, instance)
+	if appIDGenWorkers[appName] == nil {
+		appIDGenWorkers[appName] = make(map[string]*idgen.LeasedSnowflake)
+	}
+	appIDGenWorkers[appName][key] = generator
+	return generator
+}
+
+// releaseIDGenWorkers releases worker ids leased by the app
+func releaseIDGenWorkers(appName string) {
+	idgenWorkerLocker.Lock()
+	defer idgenWorkerLocker.Unlock()
+	for key, generator := range appIDGenWorkers[appName] {
+		if err := generator.Close(); err != nil {
+			log.Printf("%v [Gofusion] %s %s release idgen worker id %v of %s failed: %s", syscall.Getpid(),
+				config.Use(appName).AppName(), config.ComponentDB, generator.WorkerID(), key, err)
+		}
+	}
+	delete(appIDGenWorkers, appName)
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm/migrate"
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+)
+
+var (
+	migrationLocker sync.RWMutex
+	// appMigrations go migrations, app name -> db name -> migrations
+	appMigrations = map[string]map[string][]*migrate.Migration{}
+	// appPendingMigrations db names migrating at startup but waiting for the lock component
+	appPendingMigrations = map[string][]string{}
+	// migrationGuardOf guard of the app set by the lock component
+	migrationGuardOf func(appName string) MigrationGuard
+)
+
+// MigrationGuard runs cb within the lock of the lock instance
+type MigrationGuard func(ctx context.Context, lockInstance, key string,
+	expired, timeout time.Duration, cb func() error) error
+
+type migrateOption struct {
+	steps int
+	guard MigrationGuard
+}
+
+// MigrateSteps limits the number of migrations applied or rolled back
+func MigrateSteps(steps int) utils.OptionFunc[migrateOption] {
+	return func(o *migrateOption) {
+		o.steps = steps
+	}
+}
+
+// MigrateGuard sets the guard used when the lock instance of migration is configured, the one set by the lock
+// component is used by default
+func MigrateGuard(guard MigrationGuard) utils.OptionFunc[migrateOption] {
+	return func(o *migrateOption) {
+		o.guard = guard
+	}
+}
+
+// AddMigration registers a go migration of the db instance, it should be called before the db component
+// constructed, e.g. in init functions
+func AddMigration(name string, version int64, desc string, up, down migrate.Func, opts ...utils.OptionExtender) {
+	opt := utils.ApplyOptions[useOption](opts...)
+
+	migrationLocker.Lock()
+	defer migrationLocker.Unlock()
+	if appMigrations[opt.appName] == nil {
+		appMigrations[opt.appName] = make(map[string][]*migrate.Migration)
+	}
+	appMigrations[opt.appName][name] = append(appMigrations[opt.appName][name],
+		&migrate.Migration{Version: version, Name: desc, Up: up, Down: down})
+}
+
+// Migrate applies pending migrations of the db instance
+func Migrate(ctx context.Context, name string, opts ...utils.OptionExtender) (
+	applied []*migrate.Migration, err error) {
+	opt := utils.ApplyOptions[useOption](opts...)
+	optM := utils.ApplyOptions[migrateOption](opts...)
+	m, err := newMigrator(opt.appName, name, optM, true)
+	if err != nil {
+		return
+	}
+	return m.Up(ctx, optM.steps)
+}
+
+// Rollback rolls back the last migration of the db instance, or the last n migrations with MigrateSteps(n)
+func Rollback(ctx context.Context, name string, opts ...utils.OptionExtender) (
+	rolledBack []*migrate.Migration, err error) {
+	opt := utils.ApplyOptions[useOption](opts...)
+	optM := utils.ApplyOptions[migrateOption](opts...)
+	m, err := newMigrator(opt.appName, name, optM, true)
+	if err != nil {
+		return
+	}
+	return m.Down(ctx, optM.steps)
+}
+
+// MigrationStatus lists migrations of the db instance with their applying status, it only reads so it is not locked
+func MigrationStatus(ctx context.Context, name string, opts ...utils.OptionExtender) (
+	status []*migrate.Status, err error) {
+	opt := utils.ApplyOptions[useOption](opts...)
+	m, err := newMigrator(opt.appName, name, new(migrateOption), false)
+	if err != nil {
+		return
+	}
+	return m.Status(ctx)
+}
+
+// SetMigrationGuard sets the guard of migrations locked by lock instances, the lock component sets it in its
+// init function so that db does not depend on lock
+func SetMigrationGuard(guardOf func(appName string) MigrationGuard) {
+	migrationLocker.Lock()
+	defer migrationLocker.Unlock()
+	migrationGuardOf = guardOf
+}
+
+// migratePendingOnStartup applies pending migrations of db instances guarded by lock instances, the lock
+// component is constructed after the db component, so it is called once the lock component is constructed
+func migratePendingOnStartup(ctx context.Context, appName string) {
+	migrationLocker.Lock()
+	names := appPendingMigrations[appName]
+	delete(appPendingMigrations, appName)
+	migrationLocker.Unlock()
+
+	// migrations are guarded by the guard set by the lock component
+	for _, name := range names {
+		migrateOnStartup(ctx, appName, name)
+	}
+}
+
+func migrateOnStartup(ctx context.Context, appName, name string) {
+	applied, err := Migrate(ctx, name, AppName(appName))
+	if err != nil {
+		panic(errors.Errorf("db %s migrate failed: %+v", name, err))
+	}
+	for _, mig := range applied {
+		log.Printf("%v [Gofusion] %s %s %s migrated %v %s", syscall.Getpid(),
+			config.Use(appName).AppName(), config.ComponentDB, name, mig.Version, mig.Name)
+	}
+}
+
+// newMigrator returns the migrator of the db instance, it is guarded by the lock instance configured if guarded
+func newMigrator(appName, name string, opt *migrateOption, guarded bool) (m *migrate.Migrator, err error) {
+	rwlock.RLock()
+	instance, ok := appInstances[appName][name]
+	rwlock.RUnlock()
+	if !ok {
+		return nil, errors.Wrapf(ErrDatabaseNotFound, "%s", name)
+	}
+
+	conf := instance.migration
+	migrationLocker.RLock()
+	migrations := append([]*migrate.Migration{}, appMigrations[appName][name]...)
+	migrationLocker.RUnlock()
+	if utils.IsStrNotBlank(conf.Dir) {
+		loaded, err := migrate.Load(conf.Dir)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, loaded...)
+	}
+
+	opts := []utils.OptionExtender{
+		migrate.Table(conf.Table),
+		migrate.ShardingTables(func(table string) ([]string, error) {
+			if plugin, ok := instance.tableShardingPlugins[table]; ok {
+				return plugin.ShardingTables(context.Background())
+			}
+			return []string{table}, nil
+		}),
+	}
+	if guarded && utils.IsStrNotBlank(conf.LockInstance) {
+		guard := opt.guard
+		if guard == nil {
+			migrationLocker.RLock()
+			if migrationGuardOf != nil {
+				guard = migrationGuardOf(appName)
+			}
+			migrationLocker.RUnlock()
+		}
+		if guard == nil {
+			return nil, errors.Errorf("db %s migration is locked by %s but no guard found", name, conf.LockInstance)
+		}
+		expired := utils.Must(utils.ParseDuration(conf.LockExpired))
+		timeout := utils.Must(utils.ParseDuration(conf.LockTimeout))
+		key := fmt.Sprintf("%s:db:%s:migration", config.Use(appName).AppName(), name)
+		opts = append(opts, migrate.Guard(func(ctx context.Context, cb func() error) error {
+			return guard(ctx, conf.LockInstance, key, expired, timeout, cb)
+		}))
+	}
+
+	return migrate.New(instance.GetProxy(), migrations, opts...)
+}
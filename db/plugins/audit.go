@@ -0,0 +1,383 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/common/utils/mask"
+
+	fusCtx "github.com/wfusion/gofusion/context"
+)
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+
+	// AuditTag excludes fields by `audit:"-"`, masks fields by `audit:"mask"` or `audit:"mask:<rule name>"`
+	AuditTag = "audit"
+
+	auditStateKey        = "gofusion:audit"
+	auditDefaultMaskRule = "ALL"
+	auditDefaultMaskConf = `
+Global:
+  ApiVersion: v2
+  Mode: release
+MaskRules:
+  - RuleName: ALL
+    MaskType: CHAR
+    Value: "*"
+`
+)
+
+// AuditRecord is the before and after images of a changed row, images only contain columns not excluded
+type AuditRecord struct {
+	ID         uint64         `gorm:"column:id;primaryKey;autoIncrement" json:"id,omitempty"`
+	Database   string         `gorm:"column:database_name;type:varchar(64)" json:"database"`
+	Table      string         `gorm:"column:table_name;type:varchar(128);index" json:"table"`
+	Action     string         `gorm:"column:action;type:varchar(16)" json:"action"`
+	PrimaryKey string         `gorm:"column:primary_key;type:varchar(255);index" json:"primary_key"`
+	Before     map[string]any `gorm:"column:before_image;serializer:json;type:text" json:"before,omitempty"`
+	After      map[string]any `gorm:"column:after_image;serializer:json;type:text" json:"after,omitempty"`
+	Actor      string         `gorm:"column:actor;type:varchar(128)" json:"actor"`
+	TraceID    string         `gorm:"column:trace_id;type:varchar(64)" json:"trace_id"`
+	CreatedAt  time.Time      `gorm:"column:created_at" json:"created_at"`
+}
+
+// AuditSink writes audit records, db is a new session of the audited statement sharing its transaction
+type AuditSink func(ctx context.Context, db *gorm.DB, records []*AuditRecord) error
+
+// AuditTableSink writes audit records into the table of the same database
+func AuditTableSink(table string) AuditSink {
+	return func(ctx context.Context, db *gorm.DB, records []*AuditRecord) error {
+		return db.Table(table).Create(records).Error
+	}
+}
+
+type AuditConfig struct {
+	// Database name
+	Database string
+
+	// Tables required, specifies audited tables, sharded tables are specified by the logical table name
+	Tables []string
+
+	// Sink required, specifies where audit records go
+	Sink AuditSink
+
+	// MaskConfig optional, specifies the mask rules config file of common/utils/mask, masked fields without
+	// a rule name or with a rule not found are masked by the rule ALL which replaces every character with *
+	MaskConfig string
+}
+
+type audit struct {
+	config AuditConfig
+	tables *utils.Set[string]
+	masker mask.EngineAPI
+}
+
+// auditState the logical table and before images captured before the statement executed
+type auditState struct {
+	table  string
+	before []map[string]any
+}
+
+func DefaultAudit(config AuditConfig) Audit {
+	if len(config.Tables) == 0 {
+		panic(errors.New("missing audit tables"))
+	}
+	if config.Sink == nil {
+		panic(errors.New("missing audit sink"))
+	}
+
+	masker := utils.Must(mask.NewEngine(config.Database))
+	if utils.IsStrNotBlank(config.MaskConfig) {
+		utils.MustSuccess(masker.ApplyConfigFile(config.MaskConfig))
+	} else {
+		utils.MustSuccess(masker.ApplyConfig(auditDefaultMaskConf))
+	}
+	return &audit{
+		config: config,
+		tables: utils.NewSet(config.Tables...),
+		masker: masker,
+	}
+}
+
+func (a *audit) Name() string {
+	return fmt.Sprintf("gorm:audit:%s", a.config.Database)
+}
+
+func (a *audit) Initialize(db *gorm.DB) (err error) {
+	utils.MustSuccess(db.Callback().Create().Before("gorm:before_create").Register(a.Name(), a.prepare(false)))
+	utils.MustSuccess(db.Callback().Create().After("gorm:create").Register(a.Name()+":after", a.afterCreate))
+	utils.MustSuccess(db.Callback().Update().Before("gorm:before_update").Register(a.Name(), a.prepare(true)))
+	utils.MustSuccess(db.Callback().Update().After("gorm:update").Register(a.Name()+":after", a.afterUpdate))
+	utils.MustSuccess(db.Callback().Delete().Before("gorm:before_delete").Register(a.Name(), a.prepare(true)))
+	utils.MustSuccess(db.Callback().Delete().After("gorm:delete").Register(a.Name()+":after", a.afterDelete))
+	return
+}
+
+func (a *audit) Audited(table string) bool {
+	return a.tables.Contains(table)
+}
+
+// prepare captures the logical table before it is dispatched to physical tables, and before images of rows
+// to be updated or deleted
+func (a *audit) prepare(withBefore bool) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		stmt := db.Statement
+		if db.Error != nil || db.DryRun || stmt.Schema == nil || !a.Audited(stmt.Table) {
+			return
+		}
+		state := &auditState{table: stmt.Table}
+		db.InstanceSet(auditStateKey, state)
+		if !withBefore || stmt.SQL.Len() > 0 {
+			return
+		}
+
+		exprs := make([]clause.Expression, 0, 2)
+		if c, ok := stmt.Clauses["WHERE"]; ok {
+			if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+				exprs = append(exprs, clause.And(where.Exprs...))
+			}
+		}
+		if pks := a.primaryKeyValues(stmt); len(pks) > 0 {
+			exprs = append(exprs, clause.IN{Column: clause.PrimaryColumn, Values: pks})
+		}
+		if len(exprs) == 0 && !db.AllowGlobalUpdate {
+			return
+		}
+
+		rows := make([]map[string]any, 0)
+		tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+			Set(SettingPrimaryOnly, true).
+			Model(stmt.Model).
+			Table(stmt.Table)
+		if stmt.Unscoped {
+			tx = tx.Unscoped()
+		}
+		if len(exprs) > 0 {
+			tx = tx.Clauses(clause.Where{Exprs: exprs})
+		}
+		if err := tx.Find(&rows).Error; err != nil {
+			_ = db.AddError(errors.Wrap(err, "audit query before images failed"))
+			return
+		}
+		state.before = rows
+	}
+}
+
+func (a *audit) afterCreate(db *gorm.DB) {
+	state, ok := a.state(db)
+	if !ok {
+		return
+	}
+	records := make([]*AuditRecord, 0, 1)
+	a.walkModels(db.Statement, func(rv reflect.Value) {
+		after := make(map[string]any, len(db.Statement.Schema.DBNames))
+		for _, field := range db.Statement.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			val, _ := field.ValueOf(db.Statement.Context, rv)
+			after[field.DBName] = val
+		}
+		records = append(records, a.newRecord(db, state, AuditActionCreate, nil, after))
+	})
+	a.write(db, records)
+}
+
+func (a *audit) afterUpdate(db *gorm.DB) {
+	state, ok := a.state(db)
+	if !ok || len(state.before) == 0 {
+		return
+	}
+
+	assignments := make(map[string]any)
+	if c, ok := db.Statement.Clauses["SET"]; ok {
+		if set, ok := c.Expression.(clause.Set); ok {
+			for _, assignment := range set {
+				switch v := assignment.Value.(type) {
+				case clause.Expr:
+					assignments[assignment.Column.Name] = db.Dialector.Explain(v.SQL, v.Vars...)
+				case clause.Expression:
+					assignments[assignment.Column.Name] = fmt.Sprintf("%v", v)
+				default:
+					assignments[assignment.Column.Name] = v
+				}
+			}
+		}
+	}
+
+	records := make([]*AuditRecord, 0, len(state.before))
+	for _, before := range state.before {
+		after := make(map[string]any, len(before))
+		for k, v := range before {
+			after[k] = v
+		}
+		for k, v := range assignments {
+			after[k] = v
+		}
+		records = append(records, a.newRecord(db, state, AuditActionUpdate, before, after))
+	}
+	a.write(db, records)
+}
+
+func (a *audit) afterDelete(db *gorm.DB) {
+	state, ok := a.state(db)
+	if !ok || len(state.before) == 0 {
+		return
+	}
+	records := make([]*AuditRecord, 0, len(state.before))
+	for _, before := range state.before {
+		records = append(records, a.newRecord(db, state, AuditActionDelete, before, nil))
+	}
+	a.write(db, records)
+}
+
+func (a *audit) state(db *gorm.DB) (state *auditState, ok bool) {
+	if db.Error != nil || db.DryRun || db.RowsAffected <= 0 {
+		return
+	}
+	v, ok := db.InstanceGet(auditStateKey)
+	if !ok {
+		return
+	}
+	state, ok = v.(*auditState)
+	return
+}
+
+func (a *audit) write(db *gorm.DB, records []*AuditRecord) {
+	if len(records) == 0 {
+		return
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sess := db.Session(&gorm.Session{NewDB: true, SkipHooks: true, Context: ctx})
+	if err := a.config.Sink(ctx, sess, records); err != nil {
+		_ = db.AddError(errors.Wrap(err, "audit write records failed"))
+	}
+}
+
+func (a *audit) newRecord(db *gorm.DB, state *auditState, action string, before, after map[string]any) (
+	r *AuditRecord) {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	image := after
+	if image == nil {
+		image = before
+	}
+	pks := make([]string, 0, len(db.Statement.Schema.PrimaryFieldDBNames))
+	for _, name := range db.Statement.Schema.PrimaryFieldDBNames {
+		pks = append(pks, a.stringify(image[name]))
+	}
+	return &AuditRecord{
+		Database:   a.config.Database,
+		Table:      state.table,
+		Action:     action,
+		PrimaryKey: strings.Join(pks, ","),
+		Before:     a.sanitize(db.Statement.Schema, before),
+		After:      a.sanitize(db.Statement.Schema, after),
+		Actor:      fusCtx.GetUserID(ctx),
+		TraceID:    fusCtx.GetTraceID(ctx),
+		CreatedAt:  time.Now(),
+	}
+}
+
+// sanitize drops excluded columns and masks masked columns
+func (a *audit) sanitize(s *schema.Schema, image map[string]any) (dst map[string]any) {
+	if image == nil {
+		return
+	}
+	dst = make(map[string]any, len(image))
+	for column, val := range image {
+		if bs, ok := val.([]byte); ok {
+			val = string(bs)
+		}
+		field := s.LookUpField(column)
+		if field == nil {
+			dst[column] = val
+			continue
+		}
+		tag, ok := field.Tag.Lookup(AuditTag)
+		switch {
+		case !ok:
+			dst[column] = val
+		case tag == "-":
+		case tag == "mask" || strings.HasPrefix(tag, "mask:"):
+			dst[column] = a.mask(val, strings.TrimPrefix(strings.TrimPrefix(tag, "mask"), ":"))
+		default:
+			dst[column] = val
+		}
+	}
+	return
+}
+
+func (a *audit) mask(val any, rule string) any {
+	if val == nil {
+		return nil
+	}
+	if utils.IsStrBlank(rule) {
+		rule = auditDefaultMaskRule
+	}
+	text := a.stringify(val)
+	masked, err := a.masker.Mask(text, rule)
+	if err != nil {
+		masked, _ = a.masker.Mask(text, auditDefaultMaskRule)
+	}
+	return masked
+}
+
+func (a *audit) stringify(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprintf("%v", reflect.Indirect(reflect.ValueOf(v)).Interface())
+	}
+}
+
+func (a *audit) primaryKeyValues(stmt *gorm.Statement) (pks []any) {
+	if len(stmt.Schema.PrimaryFields) != 1 {
+		return
+	}
+	field := stmt.Schema.PrimaryFields[0]
+	a.walkModels(stmt, func(rv reflect.Value) {
+		if val, zero := field.ValueOf(stmt.Context, rv); !zero {
+			pks = append(pks, val)
+		}
+	})
+	return
+}
+
+func (a *audit) walkModels(stmt *gorm.Statement, fn func(rv reflect.Value)) {
+	switch rv := reflect.Indirect(stmt.ReflectValue); rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if item := reflect.Indirect(rv.Index(i)); item.Kind() == reflect.Struct &&
+				item.Type() == stmt.Schema.ModelType {
+				fn(item)
+			}
+		}
+	case reflect.Struct:
+		if rv.Type() == stmt.Schema.ModelType {
+			fn(rv)
+		}
+	}
+}
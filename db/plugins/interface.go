@@ -2,14 +2,42 @@ package plugins
 
 import (
 	"context"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+const (
+	// SettingPrimaryOnly pins queries with the setting to the primary rather than read replicas
+	SettingPrimaryOnly = "gofusion:primary_only"
+	// SettingReadOnly marks raw statements with the setting as reads, they go to read replicas like queries built
+	// by gorm rather than the primary
+	SettingReadOnly = "gofusion:read_only"
+)
+
 type TableSharding interface {
 	gorm.Plugin
 
 	ShardingIDGen(ctx context.Context) (id uint64, err error)
 	ShardingByValues(ctx context.Context, src []map[string]any) (dst map[string][]map[string]any, err error)
 	ShardingByModelList(ctx context.Context, src ...any) (dst map[string][]any, err error)
+	ShardingTables(ctx context.Context) (tables []string, err error)
+}
+
+// TableResharding is implemented by TableSharding plugins which support changing the number of shards online
+type TableResharding interface {
+	CurrentLayout(ctx context.Context) (layout ShardingLayout)
+	ReshardingTables(ctx context.Context, layout ShardingLayout) (tables []string, err error)
+	ReshardingTable(ctx context.Context, layout ShardingLayout, row map[string]any) (table string, err error)
+	StartResharding(ctx context.Context, layout ShardingLayout) (err error)
+	StopResharding(ctx context.Context)
+	StartCutover(ctx context.Context, layout, from ShardingLayout) (err error)
+	Cutover(ctx context.Context, layout ShardingLayout) (err error)
+	RefuseWritesAfter(ctx context.Context, deadline time.Time)
+}
+
+type Audit interface {
+	gorm.Plugin
+
+	Audited(table string) bool
 }
@@ -0,0 +1,389 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/wfusion/gofusion/common/constant"
+	"github.com/wfusion/gofusion/common/utils"
+)
+
+const (
+	reshardingStateKey = "gofusion:resharding:%s"
+)
+
+var (
+	ErrReshardingUnsupported = errors.New("resharding tables sharded by raw values is not supported")
+	ErrReshardingConflict    = errors.New("resharding tables conflict with current sharding tables")
+	ErrReshardingUnsynced    = errors.New("writes are refused since resharding jobs are not synced in time")
+)
+
+// ShardingLayout is the number of shards and the custom suffix of a sharded table
+type ShardingLayout struct {
+	NumberOfShards uint
+	// Suffix optional, specifies shard tables a custom suffix like TableShardingConfig.CustomSuffix
+	Suffix string
+}
+
+type reshardingState struct {
+	current *tableSharder
+	target  *tableSharder
+	rows    []map[string]any
+}
+
+// CurrentLayout returns the layout which rows are routed by now
+func (t *tableSharding) CurrentLayout(ctx context.Context) (layout ShardingLayout) {
+	return t.sharder.Load().layout()
+}
+
+// ReshardingTables returns all physical tables of the sharded table in the layout, they should not be the same
+// as current physical tables, otherwise a custom suffix is required
+func (t *tableSharding) ReshardingTables(ctx context.Context, layout ShardingLayout) (tables []string, err error) {
+	s, err := t.reshardingSharder(layout)
+	if err != nil {
+		return
+	}
+	suffixes, err := t.sharderSuffixes(s)
+	if err != nil {
+		return
+	}
+	current, err := t.ShardingTables(ctx)
+	if err != nil {
+		return
+	}
+	currentSet := utils.NewSet(current...)
+	for _, suffix := range suffixes {
+		table := t.config.Table + suffix
+		if currentSet.Contains(table) {
+			return nil, errors.Wrapf(ErrReshardingConflict, "%s", table)
+		}
+		tables = append(tables, table)
+	}
+	return
+}
+
+// ReshardingTable returns the physical table in the layout which the row belongs to
+func (t *tableSharding) ReshardingTable(ctx context.Context, layout ShardingLayout, row map[string]any) (
+	table string, err error) {
+	s, err := t.reshardingSharder(layout)
+	if err != nil {
+		return
+	}
+	values := make([]any, 0, len(t.config.ShardingKeys))
+	for _, key := range t.config.ShardingKeys {
+		value, ok := row[key]
+		if !ok {
+			return "", errors.Wrapf(ErrMissingShardingKey, "column: %s", key)
+		}
+		values = append(values, value)
+	}
+	suffix, err := s.fn(ctx, values...)
+	if err != nil {
+		return
+	}
+	return t.config.Table + suffix, nil
+}
+
+// StartResharding dual writes rows created, updated, or deleted through the table into shard tables of the
+// layout in the same transaction, the layout tables should be created before
+func (t *tableSharding) StartResharding(ctx context.Context, layout ShardingLayout) (err error) {
+	// rows are routed by the layout already if the sharding config is updated before the job finished
+	current := t.sharder.Load()
+	if current.layout() == layout || (current.dual != nil && current.dual.layout() == layout) {
+		return
+	}
+	dual, err := t.reshardingSharder(layout)
+	if err != nil {
+		return
+	}
+	t.sharder.Store(current.withDual(dual))
+	return
+}
+
+// StopResharding stops dual writing without cutting over
+func (t *tableSharding) StopResharding(ctx context.Context) {
+	if current := t.sharder.Load(); current.dual != nil {
+		t.sharder.Store(current.withDual(nil))
+	}
+}
+
+// StartCutover routes rows by the layout and dual writes them back into shard tables of the from layout, so that
+// writers still routing by the from layout read and write the same rows until all of them cut over
+func (t *tableSharding) StartCutover(ctx context.Context, layout, from ShardingLayout) (err error) {
+	current := t.sharder.Load()
+	if current.layout() == layout && current.dual != nil && current.dual.layout() == from {
+		return
+	}
+	s, err := t.reshardingSharder(layout)
+	if err != nil {
+		return
+	}
+	dual, err := t.reshardingSharder(from)
+	if err != nil {
+		return
+	}
+	t.sharder.Store(s.withDual(dual))
+	return
+}
+
+// Cutover routes rows by the layout and stops dual writing, it is a no-op if the layout is current
+func (t *tableSharding) Cutover(ctx context.Context, layout ShardingLayout) (err error) {
+	current := t.sharder.Load()
+	if current.layout() == layout {
+		t.StopResharding(ctx)
+		return
+	}
+	s, err := t.reshardingSharder(layout)
+	if err != nil {
+		return
+	}
+	t.sharder.Store(s)
+	return
+}
+
+// RefuseWritesAfter refuses writes through the table after the deadline by ErrReshardingUnsynced, writers
+// following unfinished resharding jobs extend it once synced so that they never skip dual writing, and the zero
+// deadline never refuses writes
+func (t *tableSharding) RefuseWritesAfter(ctx context.Context, deadline time.Time) {
+	if deadline.IsZero() {
+		t.syncDeadline.Store(0)
+		return
+	}
+	t.syncDeadline.Store(deadline.UnixNano())
+}
+
+func (t *tableSharding) reshardingSharder(layout ShardingLayout) (s *tableSharder, err error) {
+	if t.config.ShardingKeyByRawValue {
+		return nil, ErrReshardingUnsupported
+	}
+	if layout.NumberOfShards <= 0 || layout.NumberOfShards >= 100000 {
+		return nil, errors.New("invalid number of shards")
+	}
+	return t.newSharder(layout.NumberOfShards, layout.Suffix), nil
+}
+
+func (t *tableSharding) registerReshardingCallbacks(db *gorm.DB) {
+	name := t.Name() + ":resharding"
+	utils.MustSuccess(db.Callback().
+		Create().
+		Before(t.Name()).
+		Register(name+":prepare", t.reshardingPrepare(false)))
+	utils.MustSuccess(db.Callback().
+		Create().
+		After("gorm:create").
+		Register(name, t.reshardingSync(true)))
+
+	utils.MustSuccess(db.Callback().
+		Update().
+		Before(t.Name()).
+		Register(name+":prepare", t.reshardingPrepare(true)))
+	utils.MustSuccess(db.Callback().
+		Update().
+		After("gorm:update").
+		Register(name, t.reshardingSync(false)))
+
+	utils.MustSuccess(db.Callback().
+		Delete().
+		Before(t.Name()).
+		Register(name+":prepare", t.reshardingPrepare(true)))
+	utils.MustSuccess(db.Callback().
+		Delete().
+		After("gorm:delete").
+		Register(name, t.reshardingSync(false)))
+}
+
+// reshardingPrepare records the sharding layouts before the statement is dispatched, and queries primary keys
+// and sharding keys of rows to be updated or deleted
+func (t *tableSharding) reshardingPrepare(withRows bool) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		stmt := db.Statement
+		if db.Error != nil || db.DryRun || stmt.Table != t.config.Table || t.isIgnored(db)() {
+			return
+		}
+		if deadline := t.syncDeadline.Load(); deadline > 0 && time.Now().UnixNano() > deadline {
+			_ = db.AddError(errors.Wrapf(ErrReshardingUnsynced, "%s", t.config.Table))
+			return
+		}
+		// current and target are loaded at once since cutting over swaps them together
+		current := t.sharder.Load()
+		if current.dual == nil || stmt.Schema == nil || stmt.Schema.PrioritizedPrimaryField == nil {
+			return
+		}
+		state := &reshardingState{current: current, target: current.dual}
+		db.InstanceSet(fmt.Sprintf(reshardingStateKey, t.config.Table), state)
+		if withRows && stmt.SQL.Len() == 0 {
+			if err := t.reshardingRows(db, state); err != nil {
+				_ = db.AddError(errors.Wrap(err, "resharding query rows failed"))
+			}
+		}
+	}
+}
+
+func (t *tableSharding) reshardingRows(db *gorm.DB, state *reshardingState) (err error) {
+	stmt := db.Statement
+
+	// models with primary keys carry sharding keys already
+	t.walkReshardingModels(stmt, func(row map[string]any) {
+		if pk, ok := row[stmt.Schema.PrioritizedPrimaryField.DBName]; ok && !utils.IsBlank(pk) {
+			state.rows = append(state.rows, row)
+		}
+	})
+	if len(state.rows) > 0 {
+		return
+	}
+
+	var exprs []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			exprs = append(exprs, clause.And(where.Exprs...))
+		}
+	}
+	if len(exprs) == 0 && !db.AllowGlobalUpdate {
+		return
+	}
+
+	columns := t.reshardingColumns(stmt)
+	rows := make([]map[string]any, 0)
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Set(SettingPrimaryOnly, true).
+		Model(stmt.Model).
+		Table(t.config.Table).
+		Select(columns)
+	if stmt.Unscoped {
+		tx = tx.Unscoped()
+	}
+	if len(exprs) > 0 {
+		tx = tx.Clauses(clause.Where{Exprs: exprs})
+	}
+	if err = tx.Find(&rows).Error; err != nil {
+		return
+	}
+	state.rows = rows
+	return
+}
+
+// reshardingSync copies the current rows of the affected primary keys from the current shard table into the
+// resharding one, rows not found are deleted from the resharding one
+func (t *tableSharding) reshardingSync(fromModels bool) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		val, ok := db.InstanceGet(fmt.Sprintf(reshardingStateKey, t.config.Table))
+		if !ok || db.Error != nil {
+			return
+		}
+		state := val.(*reshardingState)
+		if fromModels {
+			t.walkReshardingModels(db.Statement, func(row map[string]any) { state.rows = append(state.rows, row) })
+		}
+		if err := t.reshardingCopy(db, state); err != nil {
+			_ = db.AddError(err)
+		}
+	}
+}
+
+func (t *tableSharding) reshardingCopy(db *gorm.DB, state *reshardingState) (err error) {
+	stmt := db.Statement
+	pkName := stmt.Schema.PrioritizedPrimaryField.DBName
+
+	type tablePair struct{ from, to string }
+	pairs := make(map[tablePair][]any, 1)
+	for _, row := range state.rows {
+		pk, ok := row[pkName]
+		if !ok || utils.IsBlank(pk) {
+			continue
+		}
+		values := make([]any, 0, len(t.config.ShardingKeys))
+		for _, key := range t.config.ShardingKeys {
+			values = append(values, row[key])
+		}
+		fromSuffix, err := state.current.fn(stmt.Context, values...)
+		if err != nil {
+			return errors.Wrap(err, "resharding calculate current suffix failed")
+		}
+		toSuffix, err := state.target.fn(stmt.Context, values...)
+		if err != nil {
+			return errors.Wrap(err, "resharding calculate target suffix failed")
+		}
+		pair := tablePair{from: t.config.Table + fromSuffix, to: t.config.Table + toSuffix}
+		pairs[pair] = append(pairs[pair], pk)
+	}
+
+	columns := make([]string, 0, len(stmt.Schema.DBNames))
+	for _, name := range stmt.Schema.DBNames {
+		columns = append(columns, stmt.Quote(clause.Column{Name: name}))
+	}
+	columnList := strings.Join(columns, constant.Comma)
+	pkColumn := stmt.Quote(clause.Column{Name: pkName})
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	for pair, pks := range pairs {
+		from, to := stmt.Quote(clause.Table{Name: pair.from}), stmt.Quote(clause.Table{Name: pair.to})
+		if err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s IN ?", to, pkColumn), pks).Error; err != nil {
+			return errors.Wrapf(err, "resharding delete rows from %s failed", pair.to)
+		}
+		sql := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s IN ?",
+			to, columnList, columnList, from, pkColumn)
+		if err = tx.Exec(sql, pks).Error; err != nil {
+			return errors.Wrapf(err, "resharding copy rows into %s failed", pair.to)
+		}
+	}
+	return
+}
+
+// walkReshardingModels walks models or maps of the statement with their primary key and sharding keys
+func (t *tableSharding) walkReshardingModels(stmt *gorm.Statement, fn func(row map[string]any)) {
+	columns := t.reshardingColumns(stmt)
+	walk := func(rv reflect.Value) {
+		rv = reflect.Indirect(rv)
+		row := make(map[string]any, len(columns))
+		switch {
+		case rv.Kind() == reflect.Struct && rv.Type() == stmt.Schema.ModelType:
+			for _, column := range columns {
+				if field := stmt.Schema.LookUpField(column); field != nil {
+					row[column], _ = field.ValueOf(stmt.Context, rv)
+				}
+			}
+		case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+			for _, column := range columns {
+				keys := []string{column}
+				if field := stmt.Schema.LookUpField(column); field != nil {
+					keys = append(keys, field.Name)
+				}
+				for _, key := range keys {
+					if v := rv.MapIndex(reflect.ValueOf(key)); v.IsValid() {
+						row[column] = v.Interface()
+						break
+					}
+				}
+			}
+		default:
+			return
+		}
+		fn(row)
+	}
+
+	switch rv := reflect.Indirect(stmt.ReflectValue); rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			walk(rv.Index(i))
+		}
+	default:
+		walk(rv)
+	}
+}
+
+// reshardingColumns returns the primary key and sharding keys
+func (t *tableSharding) reshardingColumns(stmt *gorm.Statement) (columns []string) {
+	columns = []string{stmt.Schema.PrioritizedPrimaryField.DBName}
+	for _, key := range t.config.ShardingKeys {
+		if key != columns[0] {
+			columns = append(columns, key)
+		}
+	}
+	return
+}
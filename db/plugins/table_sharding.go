@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/PaesslerAG/gval"
@@ -89,7 +90,8 @@ type tableSharding struct {
 	shardingTableCreatedMutex sync.RWMutex
 	shardingTableCreated      map[string]struct{}
 
-	suffixFormat string
+	sharder      atomic.Pointer[tableSharder]
+	syncDeadline atomic.Int64
 }
 
 func DefaultTableSharding(config TableShardingConfig) TableSharding {
@@ -200,6 +202,18 @@ func (t *tableSharding) ShardingIDGen(ctx context.Context) (id uint64, err error
 	return t.config.PrimaryKeyGenerator.Next()
 }
 
+// ShardingTables returns all physical tables of the sharded table
+func (t *tableSharding) ShardingTables(ctx context.Context) (tables []string, err error) {
+	suffixes, err := t.suffixes()
+	if err != nil {
+		return
+	}
+	for _, suffix := range suffixes {
+		tables = append(tables, t.config.Table+suffix)
+	}
+	return
+}
+
 func (t *tableSharding) registerCallbacks(db *gorm.DB) {
 	utils.MustSuccess(db.Callback().
 		Create().
@@ -233,6 +247,8 @@ func (t *tableSharding) registerCallbacks(db *gorm.DB) {
 		Raw().
 		Before("gorm:raw").
 		Register(t.Name(), t.rawCallback))
+
+	t.registerReshardingCallbacks(db)
 }
 func (t *tableSharding) createCallback(db *gorm.DB) {
 	utils.IfAny(
@@ -368,10 +384,10 @@ func (t *tableSharding) dispatchTableBySQL(db *gorm.DB, opts ...utils.OptionExte
 		return
 	}
 
-	getSuffix := func(condition sqlparser.Node, tableName string, vars ...any) (suffix string, err error) {
+	getSuffix := func(condition sqlparser.Expr, tableName string, vars ...any) (suffix string, err error) {
 		values := make([]any, 0, len(t.config.ShardingKeys))
 		for _, key := range t.config.ShardingKeys {
-			val, err := t.nonInsertValue(condition, key, tableName, vars...)
+			val, err := nonInsertValue(condition, key, tableName, vars...)
 			if err != nil {
 				return "", db.AddError(err)
 			}
@@ -797,52 +813,69 @@ func (t *tableSharding) insertValue(keys []string, names []*sqlparser.Ident, exp
 	return
 }
 
-func (t *tableSharding) nonInsertValue(condition sqlparser.Node, key, tableName string, args ...any) (
-	value any, err error) {
-	found := false
-	err = sqlparser.Walk(
-		sqlparser.VisitFunc(func(node sqlparser.Node) (err error) {
-			n, ok := node.(*sqlparser.BinaryExpr)
-			if !ok {
-				return
-			}
-			if n.Op != sqlparser.EQ {
-				return
+// nonInsertValue returns the value of the key compared by = in the conjuncts of the condition, keys only compared
+// within or, in or other operators are missing since rows of them may be in more than one table
+func nonInsertValue(condition sqlparser.Expr, key, tableName string, args ...any) (value any, err error) {
+	for _, expr := range sqlparser.SplitExprTree(condition) {
+		n, ok := expr.(*sqlparser.BinaryExpr)
+		if !ok || n.Op != sqlparser.EQ {
+			continue
+		}
+		switch x := n.X.(type) {
+		case *sqlparser.Ident:
+			if x.Name != key {
+				continue
 			}
-
-			switch x := n.X.(type) {
-			case *sqlparser.Ident:
-				if x.Name != key {
-					return
-				}
-			case *sqlparser.QualifiedRef:
-				if !ok || x.Table.Name != tableName || x.Column.Name != key {
-					return
-				}
+		case *sqlparser.QualifiedRef:
+			if x.Table.Name != tableName || x.Column.Name != key {
+				continue
 			}
+		default:
+			continue
+		}
 
-			found = true
-			switch expr := n.Y.(type) {
-			case *sqlparser.BindExpr:
-				value = args[expr.Pos]
-			case *sqlparser.StringLit:
-				value = expr.Value
-			case *sqlparser.NumberLit:
-				value = expr.Value
-			default:
-				return sqlparser.ErrNotImplemented
-			}
+		switch y := n.Y.(type) {
+		case *sqlparser.BindExpr:
+			return args[y.Pos], nil
+		case *sqlparser.StringLit:
+			return y.Value, nil
+		case *sqlparser.NumberLit:
+			return y.Value, nil
+		default:
+			return nil, sqlparser.ErrNotImplemented
+		}
+	}
+	return nil, ErrMissingShardingKey
+}
 
-			return
-		}),
-		condition,
-	)
+// ShardingValuesBySQL returns the values of the sharding keys compared by = in the condition of the select,
+// update or delete sql, ErrMissingShardingKey is returned if any of them is not found
+func ShardingValuesBySQL(sql, tableName string, keys []string, vars ...any) (values []any, err error) {
+	expr, err := sqlparser.NewParser(strings.NewReader(sql)).ParseStatement()
 	if err != nil {
 		return
 	}
-	if !found {
+	var condition sqlparser.Expr
+	switch stmt := expr.(type) {
+	case *sqlparser.SelectStatement:
+		condition = stmt.Condition
+	case *sqlparser.UpdateStatement:
+		condition = stmt.Condition
+	case *sqlparser.DeleteStatement:
+		condition = stmt.Condition
+	}
+	if condition == nil {
 		return nil, ErrMissingShardingKey
 	}
+
+	values = make([]any, 0, len(keys))
+	for _, key := range keys {
+		val, err := nonInsertValue(condition, key, tableName, vars...)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, val)
+	}
 	return
 }
 
@@ -981,6 +1014,10 @@ func (t *tableSharding) createTableIfNotExists(db *gorm.DB, tableName, suffix st
 }
 
 func (t *tableSharding) suffixes() (suffixes []string, err error) {
+	return t.sharderSuffixes(t.sharder.Load())
+}
+
+func (t *tableSharding) sharderSuffixes(s *tableSharder) (suffixes []string, err error) {
 	switch {
 	case t.config.ShardingKeyByRawValue:
 		if len(t.config.ShardingKeysForMigrating) == 0 {
@@ -988,11 +1025,11 @@ func (t *tableSharding) suffixes() (suffixes []string, err error) {
 		}
 
 		for _, shardingKey := range t.config.ShardingKeysForMigrating {
-			suffixes = append(suffixes, fmt.Sprintf(t.suffixFormat, shardingKey))
+			suffixes = append(suffixes, fmt.Sprintf(s.suffixFormat, shardingKey))
 		}
 	default:
-		for i := 0; i < int(t.config.NumberOfShards); i++ {
-			suffixes = append(suffixes, fmt.Sprintf(t.suffixFormat, i))
+		for i := 0; i < int(s.numberOfShards); i++ {
+			suffixes = append(suffixes, fmt.Sprintf(s.suffixFormat, i))
 		}
 	}
 	return
@@ -1018,35 +1055,66 @@ func (t *tableSharding) defaultShardingFunc() func(ctx context.Context, values .
 	if !t.config.ShardingKeyByRawValue && t.config.NumberOfShards == 0 {
 		panic(errors.New("missing number_of_shards config"))
 	}
-	t.suffixFormat = constant.Underline
+	t.sharder.Store(t.newSharder(t.config.NumberOfShards, t.config.CustomSuffix))
+	return func(ctx context.Context, values ...any) (suffix string, err error) {
+		return t.sharder.Load().fn(ctx, values...)
+	}
+}
+
+// tableSharder calculates suffixes of a layout of shards, it is swapped atomically when resharding cuts over
+type tableSharder struct {
+	numberOfShards uint
+	customSuffix   string
+	suffixFormat   string
+	fn             func(ctx context.Context, values ...any) (suffix string, err error)
+
+	// dual optional, rows written are dual written into shard tables of it while resharding
+	dual *tableSharder
+}
+
+func (s *tableSharder) layout() ShardingLayout {
+	return ShardingLayout{NumberOfShards: s.numberOfShards, Suffix: s.customSuffix}
+}
+
+func (s *tableSharder) withDual(dual *tableSharder) *tableSharder {
+	copied := *s
+	copied.dual = dual
+	return &copied
+}
+
+func (t *tableSharding) newSharder(numberOfShards uint, customSuffix string) (s *tableSharder) {
+	s = &tableSharder{
+		numberOfShards: numberOfShards,
+		customSuffix:   customSuffix,
+		suffixFormat:   constant.Underline,
+	}
 
 	switch {
-	case utils.IsStrNotBlank(t.config.CustomSuffix):
-		t.suffixFormat += t.config.CustomSuffix
+	case utils.IsStrNotBlank(customSuffix):
+		s.suffixFormat += customSuffix
 	case t.config.ShardingKeyByRawValue:
-		t.suffixFormat += "%s"
+		s.suffixFormat += "%s"
 	default:
-		t.suffixFormat += strings.Join(t.config.ShardingKeys, constant.Underline)
+		s.suffixFormat += strings.Join(t.config.ShardingKeys, constant.Underline)
 	}
 
-	numberOfShards := t.config.NumberOfShards
-	if !strings.Contains(t.suffixFormat, "%") {
+	if !strings.Contains(s.suffixFormat, "%") {
 		if t.config.ShardingKeyByRawValue {
-			t.suffixFormat += "_%s"
+			s.suffixFormat += "_%s"
 		} else if numberOfShards < 10 {
-			t.suffixFormat += "_%01d"
+			s.suffixFormat += "_%01d"
 		} else if numberOfShards < 100 {
-			t.suffixFormat += "_%02d"
+			s.suffixFormat += "_%02d"
 		} else if numberOfShards < 1000 {
-			t.suffixFormat += "_%03d"
+			s.suffixFormat += "_%03d"
 		} else if numberOfShards < 10000 {
-			t.suffixFormat += "_%04d"
+			s.suffixFormat += "_%04d"
 		}
 	}
 
 	switch {
 	case t.config.ShardingKeyByRawValue:
-		return func(ctx context.Context, values ...any) (suffix string, err error) {
+		s.fn = func(ctx context.Context, values ...any) (suffix string, err error) {
 			data := make([]string, 0, len(values))
 			for _, value := range values {
 				v, err := cast.ToStringE(value)
@@ -1060,7 +1128,7 @@ func (t *tableSharding) defaultShardingFunc() func(ctx context.Context, values .
 		}
 	case t.config.ShardingKeyExpr != nil:
 		numberOfShardsFloat64 := float64(numberOfShards)
-		return func(ctx context.Context, values ...any) (suffix string, err error) {
+		s.fn = func(ctx context.Context, values ...any) (suffix string, err error) {
 			params := make(map[string]any, len(t.config.ShardingKeys))
 			for idx, column := range t.config.ShardingKeys {
 				params[column] = values[idx]
@@ -1071,88 +1139,98 @@ func (t *tableSharding) defaultShardingFunc() func(ctx context.Context, values .
 				return
 			}
 			shardingKey := int64(math.Mod(cast.ToFloat64(result), numberOfShardsFloat64))
-			return fmt.Sprintf(t.suffixFormat, shardingKey), nil
+			return fmt.Sprintf(s.suffixFormat, shardingKey), nil
 		}
 	default:
-		stringToByteSliceFunc := func(v string) (data []byte) {
-			utils.IfAny(
-				// number
-				func() (ok bool) {
-					num := new(big.Float)
-					if _, ok = num.SetString(v); !ok {
-						return
-					}
-					gobEncoded, err := num.GobEncode()
-					if err != nil {
-						return false
-					}
-					data = gobEncoded
-					return
-				},
-				// uuid
-				func() bool {
-					uid, err := uuid.Parse(v)
-					if err != nil {
-						return false
-					}
-					data = uid[:]
-					return true
-				},
-				// bytes
-				func() bool { data = []byte(v); return true },
-			)
+		s.fn = func(ctx context.Context, values ...any) (suffix string, err error) {
+			checksum, err := ShardingChecksum(values...)
+			if err != nil {
+				return
+			}
+			// checksum mod shards
+			shardingKey := uint64(checksum) % uint64(numberOfShards)
+			suffix = fmt.Sprintf(s.suffixFormat, shardingKey)
 			return
 		}
-		return func(ctx context.Context, values ...any) (suffix string, err error) {
-			size := 0
-			for _, value := range values {
-				s := binary.Size(value)
-				if s <= 0 {
-					s = int(unsafe.Sizeof(value))
-				}
-				size += s
-			}
-			w := new(bytes.Buffer)
-			w.Grow(size)
+	}
+	return
+}
 
-			for _, value := range values {
-				var data any
-				switch v := value.(type) {
-				case int, *int:
-					data = utils.IntNarrow(cast.ToInt(v))
-				case uint, *uint:
-					data = utils.UintNarrow(cast.ToUint(v))
-				case []int:
-					data = make([]any, len(v))
-					for i := 0; i < len(v); i++ {
-						data.([]any)[i] = utils.IntNarrow(cast.ToInt(v))
-					}
-				case []uint:
-					data = make([]any, len(v))
-					for i := 0; i < len(v); i++ {
-						data.([]any)[i] = utils.UintNarrow(cast.ToUint(v))
-					}
-				case string:
-					data = stringToByteSliceFunc(v)
-				case []byte:
-					data = stringToByteSliceFunc(utils.UnsafeBytesToString(v))
-				case uuid.UUID:
-					data = v[:]
-				default:
-					data = v
-				}
-				if err = binary.Write(w, binary.BigEndian, data); err != nil {
-					return
-				}
+// ShardingChecksum returns the crc32 checksum of the sharding values, which is shared by table sharding
+// and database sharding
+func ShardingChecksum(values ...any) (checksum uint32, err error) {
+	size := 0
+	for _, value := range values {
+		s := binary.Size(value)
+		if s <= 0 {
+			s = int(unsafe.Sizeof(value))
+		}
+		size += s
+	}
+	w := new(bytes.Buffer)
+	w.Grow(size)
+
+	for _, value := range values {
+		var data any
+		switch v := value.(type) {
+		case int, *int:
+			data = utils.IntNarrow(cast.ToInt(v))
+		case uint, *uint:
+			data = utils.UintNarrow(cast.ToUint(v))
+		case []int:
+			data = make([]any, len(v))
+			for i := 0; i < len(v); i++ {
+				data.([]any)[i] = utils.IntNarrow(cast.ToInt(v))
 			}
-
-			// checksum mod shards
-			checksum := crc32.ChecksumIEEE(w.Bytes())
-			shardingKey := uint64(checksum) % uint64(numberOfShards)
-			suffix = fmt.Sprintf(t.suffixFormat, shardingKey)
+		case []uint:
+			data = make([]any, len(v))
+			for i := 0; i < len(v); i++ {
+				data.([]any)[i] = utils.UintNarrow(cast.ToUint(v))
+			}
+		case string:
+			data = shardingStringToBytes(v)
+		case []byte:
+			data = shardingStringToBytes(utils.UnsafeBytesToString(v))
+		case uuid.UUID:
+			data = v[:]
+		default:
+			data = v
+		}
+		if err = binary.Write(w, binary.BigEndian, data); err != nil {
 			return
 		}
 	}
+	return crc32.ChecksumIEEE(w.Bytes()), nil
+}
+
+func shardingStringToBytes(v string) (data []byte) {
+	utils.IfAny(
+		// number
+		func() (ok bool) {
+			num := new(big.Float)
+			if _, ok = num.SetString(v); !ok {
+				return
+			}
+			gobEncoded, err := num.GobEncode()
+			if err != nil {
+				return false
+			}
+			data = gobEncoded
+			return
+		},
+		// uuid
+		func() bool {
+			uid, err := uuid.Parse(v)
+			if err != nil {
+				return false
+			}
+			data = uid[:]
+			return true
+		},
+		// bytes
+		func() bool { data = []byte(v); return true },
+	)
+	return
 }
 
 type shardingDialector struct {
@@ -1290,6 +1368,10 @@ func (s *shardingMigrator) getShardingDst(sharding *tableSharding, src ...any) (
 	return
 }
 func (s *shardingMigrator) tableName(db *gorm.DB, m any) (name string) {
+	// specified by db.Table, e.g. migrating a resharding table
+	if db.Statement.Table != "" {
+		return db.Statement.Table
+	}
 	if tabler, ok := m.(schema.Tabler); ok {
 		name = tabler.TableName()
 	}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/wfusion/gofusion/cache"
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/common/utils/serialize/json"
+	"github.com/wfusion/gofusion/common/utils/sqlparser"
+)
+
+const (
+	// ErrQueryCacheNotSupport is returned by cached queries with joins or preloads, whose results are tagged only by
+	// the main table so that writes of joined or preloaded tables would not invalidate them
+	ErrQueryCacheNotSupport utils.Error = "query cache does not support joins and preloads"
+
+	queryCacheCallbackName = "gofusion:query_cache"
+	// queryCacheVersionKey is the version of a table, cached results are keyed with it so that writes of the table
+	// invalidate all of them by switching the version
+	queryCacheVersionKey = "db:%s:version"
+	queryCacheResultKey  = "db:%s:%s:%s"
+)
+
+var (
+	queryCacheLocker sync.RWMutex
+	// appQueryCaches app name -> cache names used by Cached in the process
+	appQueryCaches = map[string]*utils.Set[string]{}
+	// queryCacheInstances app name:cache name:value type -> cache, local caches are shared in the process by it
+	queryCacheInstances sync.Map
+)
+
+type queryCacheTxKey struct{}
+
+// queryCacheTx collects tables written in the transaction, they are invalidated again after committing
+type queryCacheTx struct {
+	mutex  sync.Mutex
+	tables map[string]func(ctx context.Context)
+}
+
+func (q *queryCacheTx) add(key string, invalidate func(ctx context.Context)) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.tables[key] = invalidate
+}
+
+func (q *queryCacheTx) flush(ctx context.Context) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, invalidate := range q.tables {
+		invalidate(ctx)
+	}
+}
+
+// withQueryCacheTx runs fn in the transaction and invalidates written tables again after it is committed, otherwise
+// results read by others between the write and the commit would be cached with the new version,
+// nested transactions are flushed by the outermost one
+func withQueryCacheTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(queryCacheTxKey{}).(*queryCacheTx); ok {
+		return fn(ctx)
+	}
+	tx := &queryCacheTx{tables: make(map[string]func(ctx context.Context))}
+	if err = fn(context.WithValue(ctx, queryCacheTxKey{}, tx)); err != nil {
+		return
+	}
+	tx.flush(ctx)
+	return
+}
+
+func useQueryCache[V any](appName, name string) cache.Cachable[string, V, []V] {
+	key := fmt.Sprintf("%s:%s:%s", appName, name, reflect.TypeOf(new(V)).Elem())
+	if instance, ok := queryCacheInstances.Load(key); ok {
+		return instance.(cache.Cachable[string, V, []V])
+	}
+	instance, _ := queryCacheInstances.LoadOrStore(key, cache.New[string, V, []V](name, cache.AppName(appName)))
+	return instance.(cache.Cachable[string, V, []V])
+}
+
+// useQueryCacheVersions returns table versions in the cache, and registers the cache to be invalidated by writes
+func useQueryCacheVersions(appName, name string) *queryCacheVersions {
+	queryCacheLocker.Lock()
+	if appQueryCaches[appName] == nil {
+		appQueryCaches[appName] = utils.NewSet[string]()
+	}
+	appQueryCaches[appName].Insert(name)
+	queryCacheLocker.Unlock()
+	return &queryCacheVersions{Cachable: useQueryCache[string](appName, name)}
+}
+
+type queryCacheVersions struct {
+	cache.Cachable[string, string, []string]
+}
+
+func (q *queryCacheVersions) version(ctx context.Context, table string) string {
+	key := fmt.Sprintf(queryCacheVersionKey, table)
+	versions := q.Get(ctx, []string{key}, func(ctx context.Context, missed []string) (
+		map[string]string, []utils.OptionExtender) {
+		return map[string]string{key: utils.UUID_()}, nil
+	})
+	if len(versions) == 0 {
+		// results cached with a brand-new version are never hit
+		return utils.UUID_()
+	}
+	return versions[0]
+}
+
+func (q *queryCacheVersions) invalidate(ctx context.Context, table string) {
+	q.Set(ctx, map[string]string{fmt.Sprintf(queryCacheVersionKey, table): utils.UUID_()})
+}
+
+// queryWithCache runs the query through the cache of the Cached option, results are keyed by the table version,
+// the db name, and the normalized sql and vars built by dry running the query,
+// queries in transactions are not cached since they may read their own uncommitted writes, including transactions
+// not started by dal, and queries with joins or preloads are refused
+func queryWithCache[V any](ctx context.Context, appName, dbName string, o *mysqlDALOption,
+	newDB func() *gorm.DB, found *V, query func(tx *gorm.DB) *gorm.DB) (err error) {
+	if o == nil || utils.IsStrBlank(o.cacheName) || ctx.Value(queryCacheTxKey{}) != nil {
+		return query(newDB()).Error
+	}
+	if _, ok := newDB().Statement.ConnPool.(gorm.TxCommitter); ok {
+		return query(newDB()).Error
+	}
+	dry := query(newDB().Session(&gorm.Session{DryRun: true}))
+	if len(dry.Statement.Preloads) > 0 || joinedStatement(dry.Statement) {
+		return errors.Wrapf(ErrQueryCacheNotSupport, "%s", dry.Statement.Table)
+	}
+	table := queryCacheTable(dry.Statement, nil)
+	if dry.Error != nil || dry.Statement.SQL.Len() == 0 || utils.IsStrBlank(table) {
+		return query(newDB()).Error
+	}
+
+	version := useQueryCacheVersions(appName, o.cacheName).version(ctx, table)
+	key := fmt.Sprintf(queryCacheResultKey, table, version, queryCacheDigest(dbName, found, dry.Statement))
+	queried := false
+	cached := useQueryCache[V](appName, o.cacheName).Get(ctx, []string{key},
+		func(ctx context.Context, missed []string) (map[string]V, []utils.OptionExtender) {
+			queried = true
+			if err = query(newDB()).Error; err != nil {
+				return nil, nil
+			}
+			var opts []utils.OptionExtender
+			if o.cacheTTL > 0 {
+				opts = append(opts, cache.Expired[string](o.cacheTTL))
+			}
+			return map[string]V{key: *found}, opts
+		},
+	)
+	if !queried && len(cached) > 0 {
+		*found = cached[0]
+	}
+	return
+}
+
+func queryCacheDigest(dbName string, found any, stmt *gorm.Statement) string {
+	vars, err := json.Marshal(stmt.Vars)
+	if err != nil {
+		vars = []byte(fmt.Sprintf("%v", stmt.Vars))
+	}
+	h := sha256.New()
+	sql := strings.Join(strings.Fields(stmt.SQL.String()), " ")
+	for _, s := range []string{dbName, reflect.TypeOf(found).String(), sql} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	h.Write(vars)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// joinedStatement reports whether the built query joins other tables
+func joinedStatement(stmt *gorm.Statement) bool {
+	c, ok := stmt.Clauses["FROM"]
+	if !ok {
+		return false
+	}
+	from, ok := c.Expression.(clause.From)
+	return ok && len(from.Joins) > 0
+}
+
+// queryCacheTable returns the logical table of the statement, sharded tables are tagged by their main table
+func queryCacheTable(stmt *gorm.Statement, shardings []shardingConf) string {
+	if stmt.Schema != nil {
+		return stmt.Schema.Table
+	}
+	return queryCacheMainTable(stmt.Table, shardings)
+}
+
+func queryCacheMainTable(table string, shardings []shardingConf) string {
+	for _, s := range shardings {
+		if table == s.Table || strings.HasPrefix(table, s.Table+"_") {
+			return s.Table
+		}
+	}
+	return table
+}
+
+// rawWriteTables returns tables written by the raw insert, update or delete statement, statements failed to be
+// parsed like ddl return nothing
+func rawWriteTables(sql string, shardings []shardingConf) (tables []string) {
+	stmt, err := sqlparser.NewParser(strings.NewReader(sql)).ParseStatement()
+	if err != nil {
+		return
+	}
+	names := make([]*sqlparser.TableName, 0, 1)
+	switch stmt := stmt.(type) {
+	case *sqlparser.InsertStatement:
+		names = append(names, stmt.TableName)
+	case *sqlparser.UpdateStatement:
+		names = append(append(names, stmt.TableName), stmt.FromList...)
+	case *sqlparser.DeleteStatement:
+		names = append(append(names, stmt.TableName), stmt.UsingList...)
+	}
+	written := utils.NewSet[string]()
+	for _, name := range names {
+		if name != nil && sqlparser.IdentName(name.Name) != "" {
+			written.Insert(queryCacheMainTable(sqlparser.IdentName(name.Name), shardings))
+		}
+	}
+	return written.Items()
+}
+
+// invalidateQueryCaches switches versions of the table in caches used by Cached in the process and configured in
+// query_cache, so that remote caches are invalidated across replicas
+func invalidateQueryCaches(ctx context.Context, appName, table string, configured []string) {
+	queryCacheLocker.RLock()
+	names := utils.NewSet[string](configured...)
+	if used, ok := appQueryCaches[appName]; ok {
+		names.Insert(used.Items()...)
+	}
+	queryCacheLocker.RUnlock()
+	for _, name := range names.Items() {
+		useQueryCacheVersions(appName, name).invalidate(ctx, table)
+	}
+}
+
+// registerQueryCache invalidates cached results of tables written by the db, including raw writes by Exec, Row and
+// Rows whose tables are parsed from the sql, writes in transactions not started by dal are invalidated only before
+// committing, so results read by others before the commit may be cached until they expire
+func registerQueryCache(db *gorm.DB, appName string, conf *Conf) {
+	for _, name := range conf.QueryCache.Caches {
+		useQueryCacheVersions(appName, name)
+	}
+	invalidateTable := func(ctx context.Context, table string) {
+		if utils.IsStrBlank(table) {
+			return
+		}
+		invalidateQueryCaches(ctx, appName, table, conf.QueryCache.Caches)
+		if tx, ok := ctx.Value(queryCacheTxKey{}).(*queryCacheTx); ok {
+			tx.add(fmt.Sprintf("%s:%s", appName, table), func(ctx context.Context) {
+				invalidateQueryCaches(ctx, appName, table, conf.QueryCache.Caches)
+			})
+		}
+	}
+	invalidate := func(db *gorm.DB) {
+		if db.Error != nil || db.DryRun || db.RowsAffected == 0 {
+			return
+		}
+		invalidateTable(db.Statement.Context, queryCacheTable(db.Statement, conf.Sharding))
+	}
+	// rows affected by raw statements run by Row and Rows are unknown, so they are invalidated anyway
+	rawInvalidate := func(db *gorm.DB) {
+		if db.Error != nil || db.DryRun || !isRawStatement(db) {
+			return
+		}
+		for _, table := range rawWriteTables(db.Statement.SQL.String(), conf.Sharding) {
+			invalidateTable(db.Statement.Context, table)
+		}
+	}
+	cb := db.Callback()
+	utils.MustSuccess(cb.Create().After("gorm:create").Register(queryCacheCallbackName, invalidate))
+	utils.MustSuccess(cb.Update().After("gorm:update").Register(queryCacheCallbackName, invalidate))
+	utils.MustSuccess(cb.Delete().After("gorm:delete").Register(queryCacheCallbackName, invalidate))
+	utils.MustSuccess(cb.Raw().After("gorm:raw").Register(queryCacheCallbackName, func(db *gorm.DB) {
+		if db.RowsAffected > 0 {
+			rawInvalidate(db)
+		}
+	}))
+	utils.MustSuccess(cb.Row().After("gorm:row").Register(queryCacheCallbackName, rawInvalidate))
+}
@@ -0,0 +1,335 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm"
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/db/plugins"
+
+	fusCtx "github.com/wfusion/gofusion/context"
+)
+
+const (
+	replicaBalancerRandom          = "random"
+	replicaBalancerRoundRobin      = "round_robin"
+	replicaBalancerLeastConnection = "least_connections"
+
+	replicaCallbackName = "gofusion:replica"
+)
+
+// readYourWrites records the last write time of a request in unix nano
+type readYourWrites struct {
+	lastWrite atomic.Int64
+}
+
+// ReadYourWrites pins reads of db instances with replicas to the primary within the sticky window after a write
+// with the returned context, it should be called once at the beginning of a request
+func ReadYourWrites(ctx context.Context) context.Context {
+	if utils.GetCtxAny(ctx, fusCtx.KeyDBReadYourWrites, (*readYourWrites)(nil)) != nil {
+		return ctx
+	}
+	return utils.SetCtxAny(ctx, fusCtx.KeyDBReadYourWrites, new(readYourWrites))
+}
+
+type replica struct {
+	sqlDB   *sql.DB
+	host    string
+	healthy atomic.Bool
+}
+
+// replicaPool routes reads of the primary out of transactions to healthy replicas, replicas are ejected if
+// pinging failed or the replication lag exceeds the max lag, and reads go to the primary if all of them ejected
+type replicaPool struct {
+	appName      string
+	name         string
+	conf         replicasConf
+	driver       string
+	maxLag       time.Duration
+	stickyWindow time.Duration
+	replicas     []*replica
+	counter      atomic.Uint64
+}
+
+func newReplicaPool(ctx context.Context, appName, name string, conf *Conf, logObj logger.Interface) *replicaPool {
+	switch conf.Replicas.Balancer {
+	case replicaBalancerRandom, replicaBalancerRoundRobin, replicaBalancerLeastConnection:
+	default:
+		panic(errors.Errorf("unknown db %s replicas balancer: %s", name, conf.Replicas.Balancer))
+	}
+
+	p := &replicaPool{
+		appName:      appName,
+		name:         name,
+		conf:         conf.Replicas,
+		driver:       string(conf.Driver),
+		stickyWindow: utils.Must(utils.ParseDuration(conf.Replicas.StickyWindow)),
+		replicas:     make([]*replica, 0, len(conf.Replicas.Instances)),
+	}
+	if utils.IsStrNotBlank(conf.Replicas.MaxLag) {
+		p.maxLag = utils.Must(utils.ParseDuration(conf.Replicas.MaxLag))
+	}
+	if conf.Dialect == orm.DialectOpenGauss {
+		p.driver = string(orm.DriverPostgres)
+	}
+
+	for _, rc := range conf.Replicas.Instances {
+		option := conf.Option
+		if utils.IsStrNotBlank(rc.Host) {
+			option.Host = rc.Host
+		}
+		if rc.Port > 0 {
+			option.Port = rc.Port
+		}
+		if utils.IsStrNotBlank(rc.User) {
+			option.User = rc.User
+		}
+		if utils.IsStrNotBlank(rc.Password) {
+			option.Password = rc.Password
+		}
+		replicaDB, err := orm.Gorm.New(ctx, option, orm.WithLogger(logObj))
+		if err != nil {
+			panic(errors.Errorf("initialize gorm db %s replica %s error: %+v", name, option.Host, err))
+		}
+		r := &replica{sqlDB: utils.Must(replicaDB.GetProxy().DB()), host: option.Host}
+		r.healthy.Store(true)
+		p.replicas = append(p.replicas, r)
+	}
+	return p
+}
+
+// register registers read routing callbacks and write recording callbacks into the primary
+func (p *replicaPool) register(db *gorm.DB) {
+	utils.MustSuccess(db.Callback().Query().Before("gorm:query").Register(replicaCallbackName, p.route))
+	utils.MustSuccess(db.Callback().Row().Before("gorm:row").Register(replicaCallbackName, p.route))
+	utils.MustSuccess(db.Callback().Create().After("gorm:create").Register(replicaCallbackName, p.written))
+	utils.MustSuccess(db.Callback().Update().After("gorm:update").Register(replicaCallbackName, p.written))
+	utils.MustSuccess(db.Callback().Delete().After("gorm:delete").Register(replicaCallbackName, p.written))
+	utils.MustSuccess(db.Callback().Raw().After("gorm:raw").Register(replicaCallbackName, p.written))
+	utils.MustSuccess(db.Callback().Row().After("gorm:row").Register(replicaCallbackName+":row", p.rawWritten))
+}
+
+func (p *replicaPool) route(db *gorm.DB) {
+	if db.Error != nil || !p.readable(db) {
+		return
+	}
+	if r := p.pick(); r != nil {
+		db.Statement.ConnPool = r.sqlDB
+	}
+}
+
+// readable reports whether the statement could be read from replicas, statements in transactions, with locking
+// clauses, raw statements not marked by plugins.SettingReadOnly, or within the sticky window after a write stay
+// on the primary
+func (p *replicaPool) readable(db *gorm.DB) bool {
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return false
+	}
+	if _, ok := db.Get(plugins.SettingPrimaryOnly); ok {
+		return false
+	}
+	if _, ok := db.Statement.Clauses["FOR"]; ok {
+		return false
+	}
+	if isRawStatement(db) && !readOnlyRawStatement(db) {
+		return false
+	}
+	if ctx := db.Statement.Context; ctx != nil {
+		state := utils.GetCtxAny(ctx, fusCtx.KeyDBReadYourWrites, (*readYourWrites)(nil))
+		if state != nil && time.Since(time.Unix(0, state.lastWrite.Load())) < p.stickyWindow {
+			return false
+		}
+	}
+	return true
+}
+
+// isRawStatement reports whether the statement is written by db.Raw, queries built by gorm have select clauses
+// once built and no sql before built, while raw ones have sql without clauses
+func isRawStatement(db *gorm.DB) bool {
+	if db.Statement.SQL.Len() == 0 {
+		return false
+	}
+	_, built := db.Statement.Clauses["SELECT"]
+	return !built
+}
+
+// readOnlyRawStatement reports whether the raw statement is marked as a read and is a select without locking
+func readOnlyRawStatement(db *gorm.DB) bool {
+	if readOnly, ok := db.Get(plugins.SettingReadOnly); !ok || !cast.ToBool(readOnly) {
+		return false
+	}
+	sql := strings.ToUpper(strings.TrimLeft(db.Statement.SQL.String(), " \t\r\n("))
+	if !strings.HasPrefix(sql, "SELECT") {
+		return false
+	}
+	return !strings.Contains(sql, "FOR UPDATE") && !strings.Contains(sql, "FOR SHARE")
+}
+
+func (p *replicaPool) written(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Context == nil {
+		return
+	}
+	if state := utils.GetCtxAny(db.Statement.Context, fusCtx.KeyDBReadYourWrites,
+		(*readYourWrites)(nil)); state != nil {
+		state.lastWrite.Store(time.Now().UnixNano())
+	}
+}
+
+// rawWritten records raw statements not marked as reads, e.g. UPDATE ... RETURNING read by Row, as writes
+func (p *replicaPool) rawWritten(db *gorm.DB) {
+	if isRawStatement(db) && !readOnlyRawStatement(db) {
+		p.written(db)
+	}
+}
+
+func (p *replicaPool) pick() (r *replica) {
+	candidates := make([]*replica, 0, len(p.replicas))
+	for _, item := range p.replicas {
+		if item.healthy.Load() {
+			candidates = append(candidates, item)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	switch p.conf.Balancer {
+	case replicaBalancerRoundRobin:
+		return candidates[(p.counter.Add(1)-1)%uint64(len(candidates))]
+	case replicaBalancerLeastConnection:
+		for _, candidate := range candidates {
+			if r == nil || candidate.sqlDB.Stats().InUse < r.sqlDB.Stats().InUse {
+				r = candidate
+			}
+		}
+		return
+	default:
+		return candidates[rand.Intn(len(candidates))]
+	}
+}
+
+func (p *replicaPool) startChecking(ctx context.Context) {
+	interval := utils.Must(utils.ParseDuration(p.conf.CheckInterval))
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, r := range p.replicas {
+				p.check(ctx, r, interval)
+			}
+		}
+	}
+}
+
+func (p *replicaPool) check(ctx context.Context, r *replica, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := r.sqlDB.PingContext(ctx)
+	if err == nil && p.maxLag > 0 {
+		var lag time.Duration
+		if lag, err = p.lag(ctx, r); err == nil && lag > p.maxLag {
+			err = errors.Errorf("replication lag %s exceeds %s", lag, p.maxLag)
+		}
+	}
+
+	healthy := err == nil
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+	pid := syscall.Getpid()
+	app := config.Use(p.appName).AppName()
+	if healthy {
+		log.Printf("%v [Gofusion] %s %s %s replica %s recovered", pid, app, config.ComponentDB, p.name, r.host)
+	} else {
+		log.Printf("%v [Gofusion] %s %s %s replica %s ejected: %s",
+			pid, app, config.ComponentDB, p.name, r.host, err)
+	}
+}
+
+// lag queries the replication lag of the replica, it is zero for drivers not supported
+func (p *replicaPool) lag(ctx context.Context, r *replica) (lag time.Duration, err error) {
+	switch p.driver {
+	case string(orm.DriverMysql), string(orm.DriverTiDB):
+		var status map[string]any
+		if status, err = p.showReplicaStatus(ctx, r, "SHOW REPLICA STATUS"); err != nil {
+			// versions before mysql 8.0.22
+			if status, err = p.showReplicaStatus(ctx, r, "SHOW SLAVE STATUS"); err != nil {
+				return
+			}
+		}
+		seconds, ok := status["Seconds_Behind_Source"]
+		if !ok {
+			seconds = status["Seconds_Behind_Master"]
+		}
+		if status != nil && seconds == nil {
+			return 0, errors.New("replication is not running")
+		}
+		return time.Duration(cast.ToFloat64(seconds) * float64(time.Second)), nil
+	case string(orm.DriverPostgres):
+		var seconds float64
+		err = r.sqlDB.QueryRowContext(ctx,
+			"SELECT COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)").Scan(&seconds)
+		return time.Duration(seconds * float64(time.Second)), err
+	default:
+		return
+	}
+}
+
+func (p *replicaPool) showReplicaStatus(ctx context.Context, r *replica, query string) (
+	status map[string]any, err error) {
+	rows, err := r.sqlDB.QueryContext(ctx, query)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns, err := rows.Columns()
+	if err != nil || !rows.Next() {
+		return nil, err
+	}
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err = rows.Scan(pointers...); err != nil {
+		return
+	}
+	status = make(map[string]any, len(columns))
+	for i, column := range columns {
+		if bs, ok := values[i].([]byte); ok {
+			values[i] = string(bs)
+		}
+		status[column] = values[i]
+	}
+	return
+}
+
+func (p *replicaPool) close() {
+	for _, r := range p.replicas {
+		if err := r.sqlDB.Close(); err != nil {
+			log.Printf("%v [Gofusion] %s %s %s replica %s close error: %s", syscall.Getpid(),
+				config.Use(p.appName).AppName(), config.ComponentDB, p.name, r.host, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm/reshard"
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/db/plugins"
+)
+
+const (
+	ErrTableNotSharded      utils.Error = "table is not sharded"
+	ErrReshardingNotSupport utils.Error = "table sharding plugin does not support resharding"
+
+	// reshardSyncInterval how often instances watch the resharding job table to dual write or cut over
+	reshardSyncInterval = 5 * time.Second
+	// reshardSyncTimeout writes through sharded tables are refused if resharding jobs are not synced within it
+	reshardSyncTimeout = 2 * reshardSyncInterval
+)
+
+type reshardOption struct {
+	suffix string
+	batch  int
+	settle *time.Duration
+}
+
+// ReshardSuffix sets the custom suffix of new shard tables, it is required if new shard tables have the same
+// names as current ones, e.g. resharding from 2 to 4 shards without custom suffixes
+func ReshardSuffix(suffix string) utils.OptionFunc[reshardOption] {
+	return func(o *reshardOption) {
+		o.suffix = suffix
+	}
+}
+
+// ReshardBatch sets the number of rows copied in one batch, 500 by default
+func ReshardBatch(batch int) utils.OptionFunc[reshardOption] {
+	return func(o *reshardOption) {
+		o.batch = batch
+	}
+}
+
+// ReshardSettle sets how long to wait for other instances to start dual writing before copying and to cut over
+// before done, 15s by default, it should be longer than 10s which instances refuse writes after failing to watch
+// resharding jobs within
+func ReshardSettle(d time.Duration) utils.OptionFunc[reshardOption] {
+	return func(o *reshardOption) {
+		o.settle = &d
+	}
+}
+
+// Reshard changes the number of shards of the table sharded model online, rows are copied into new shard tables
+// batch by batch through Scan while writes through the db instance are dual written, and then verified by
+// checksums before cutting over. The progress is persisted in the gofusion_reshard_jobs table so that calling it
+// again resumes the unfinished job, and other instances follow the job within seconds, they dual write rows back
+// into old shard tables while cutting over until all of them have cut over. The
+// number_of_shards and suffix of the sharding config should be updated once done, old shard tables are left for
+// dropping by hand.
+func Reshard[T any, TS ~[]*T](ctx context.Context, name string, numberOfShards uint,
+	opts ...utils.OptionExtender) (job *reshard.Job, err error) {
+	opt := utils.ApplyOptions[useOption](opts...)
+	optR := utils.ApplyOptions[reshardOption](opts...)
+	if optR.settle == nil {
+		settle := reshardSyncTimeout + reshardSyncInterval
+		optR.settle = &settle
+	}
+
+	rwlock.RLock()
+	instance, ok := appInstances[opt.appName][name]
+	rwlock.RUnlock()
+	if !ok {
+		return nil, errors.Wrapf(ErrDatabaseNotFound, "%s", name)
+	}
+	orm := instance.GetProxy().Set(plugins.SettingPrimaryOnly, true).WithContext(ctx)
+	stmt := &gorm.Statement{DB: orm}
+	if err = stmt.Parse(new(T)); err != nil {
+		return
+	}
+	sharding, ok := instance.tableShardingPlugins[stmt.Table]
+	if !ok {
+		return nil, errors.Wrapf(ErrTableNotSharded, "%s", stmt.Table)
+	}
+	plugin, ok := sharding.(plugins.TableResharding)
+	if !ok {
+		return nil, errors.Wrapf(ErrReshardingNotSupport, "%s", stmt.Table)
+	}
+	if stmt.Schema.PrioritizedPrimaryField == nil {
+		return nil, errors.Errorf("resharding table %s without primary key", stmt.Table)
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField.DBName
+
+	layout := plugins.ShardingLayout{NumberOfShards: numberOfShards, Suffix: optR.suffix}
+	current := plugin.CurrentLayout(ctx)
+	sources, err := sharding.ShardingTables(ctx)
+	if err != nil {
+		return
+	}
+	targets, err := plugin.ReshardingTables(ctx, layout)
+	if err != nil {
+		return
+	}
+	plan := &reshard.Plan{
+		Table:      stmt.Table,
+		Sources:    sources,
+		Targets:    targets,
+		FromShards: current.NumberOfShards,
+		ToShards:   numberOfShards,
+		FromSuffix: current.Suffix,
+		Suffix:     optR.suffix,
+		Route: func(ctx context.Context, row map[string]any) (string, error) {
+			return plugin.ReshardingTable(ctx, layout, row)
+		},
+		CreateTable: func(ctx context.Context, db *gorm.DB, source, target string) error {
+			return db.Table(target).AutoMigrate(new(T))
+		},
+		Follow: func(ctx context.Context, job *reshard.Job) error {
+			return followResharding(ctx, plugin, job)
+		},
+	}
+
+	scan := func(ctx context.Context, table string, cursor any, batch int,
+		cb func(rows []map[string]any) error) (err error) {
+		if cursor == nil {
+			cursor = 0
+		}
+		var cbErr error
+		err = Scan[T, TS](ctx, func(mList TS) bool {
+			rows := make([]map[string]any, 0, len(mList))
+			for _, m := range mList {
+				rows = append(rows, reshardRow(ctx, stmt, m))
+			}
+			cbErr = cb(rows)
+			return cbErr == nil
+		},
+			AppName(opt.appName),
+			ScanUse(name),
+			ScanTable(table),
+			ScanUnscoped(),
+			ScanCursor(fmt.Sprintf("%s > ?", stmt.Quote(clause.Column{Name: pk})), []string{pk}, cursor),
+			ScanBatch(batch),
+		)
+		if cbErr != nil {
+			return cbErr
+		}
+		return
+	}
+
+	return reshard.New(orm,
+		reshard.Batch(optR.batch),
+		reshard.PrimaryKey(pk),
+		reshard.Scan(scan),
+		reshard.Settle(*optR.settle),
+	).Run(ctx, plan)
+}
+
+func reshardRow(ctx context.Context, stmt *gorm.Statement, m any) (row map[string]any) {
+	rv := utils.IndirectValue(reflect.ValueOf(m))
+	row = make(map[string]any, len(stmt.Schema.DBNames))
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName != "" {
+			row[field.DBName], _ = field.ValueOf(ctx, rv)
+		}
+	}
+	return
+}
+
+// syncResharding makes table sharding plugins of the instance follow the latest resharding jobs, and refuses
+// writes through tables with unfinished jobs if they are not synced again within reshardSyncTimeout, tables without
+// unfinished jobs are never refused
+func (d *Instance) syncResharding(ctx context.Context) (err error) {
+	deadline := time.Now().Add(reshardSyncTimeout)
+	tables := make([]string, 0, len(d.tableShardingPlugins))
+	for table := range d.tableShardingPlugins {
+		tables = append(tables, table)
+	}
+	// the job table is read from the primary in case replicas lag behind
+	jobs, err := reshard.New(d.GetProxy().Set(plugins.SettingPrimaryOnly, true)).Latest(ctx, tables...)
+	if err != nil {
+		return
+	}
+	for table, sharding := range d.tableShardingPlugins {
+		plugin, ok := sharding.(plugins.TableResharding)
+		if !ok {
+			continue
+		}
+		job := jobs[table]
+		if job == nil {
+			plugin.RefuseWritesAfter(ctx, time.Time{})
+			continue
+		}
+		if err = followResharding(ctx, plugin, job); err != nil {
+			return errors.Wrapf(err, "sync resharding job %v of %s failed", job.ID, table)
+		}
+		if job.Finished() {
+			plugin.RefuseWritesAfter(ctx, time.Time{})
+		} else {
+			plugin.RefuseWritesAfter(ctx, deadline)
+		}
+	}
+	return
+}
+
+// followResharding dual writes while unfinished jobs are copying or verifying, routes rows into new shard tables
+// and dual writes them back while cutting, cuts over once done, and stops dual writing once aborted
+func followResharding(ctx context.Context, plugin plugins.TableResharding, job *reshard.Job) (err error) {
+	layout := plugins.ShardingLayout{NumberOfShards: job.ToShards, Suffix: job.Suffix}
+	switch job.Phase {
+	case reshard.PhaseCopying, reshard.PhaseVerifying:
+		return plugin.StartResharding(ctx, layout)
+	case reshard.PhaseCutting:
+		return plugin.StartCutover(ctx, layout,
+			plugins.ShardingLayout{NumberOfShards: job.FromShards, Suffix: job.FromSuffix})
+	case reshard.PhaseDone:
+		return plugin.Cutover(ctx, layout)
+	case reshard.PhaseAborted:
+		plugin.StopResharding(ctx)
+	}
+	return
+}
+
+func startReshardingSync(ctx context.Context, appName, name string, instance *Instance) {
+	app := config.Use(appName).AppName()
+	ticker := time.NewTicker(reshardSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// writes through tables with unfinished jobs are refused once the deadline of the last sync passes
+			if err := instance.syncResharding(ctx); err != nil {
+				log.Printf("%v [Gofusion] %s %s %s %s", syscall.Getpid(), app, config.ComponentDB, name, err)
+			}
+		}
+	}
+}
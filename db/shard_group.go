@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"log"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/PaesslerAG/gval"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/db/plugins"
+)
+
+const (
+	ErrShardGroupNotFound utils.Error = "not found shard group to use"
+	ErrShardNotFound      utils.Error = "not found shard for the sharding key"
+	ErrCrossShardTx       utils.Error = "cross shard transaction not allowed"
+
+	ShardStrategyHash  = "hash"
+	ShardStrategyRange = "range"
+)
+
+var (
+	shardGroupLocker sync.RWMutex
+	// appShardGroups app name -> shard group name -> shard group
+	appShardGroups = map[string]map[string]*shardGroup{}
+)
+
+type shardGroup struct {
+	name              string
+	instances         []string
+	columns           []string
+	expr              gval.Evaluable
+	strategy          string
+	ranges            []*shardRangeConf
+	allowCrossShardTx bool
+}
+
+func addShardGroup(appName, name string, conf *Conf) {
+	groupConf := conf.ShardGroup
+	if len(groupConf.Columns) == 0 {
+		panic(errors.Errorf("missing sharding columns of db shard group %s", name))
+	}
+	group := &shardGroup{
+		name:              name,
+		instances:         groupConf.Instances,
+		columns:           groupConf.Columns,
+		strategy:          strings.ToLower(groupConf.Strategy),
+		ranges:            groupConf.Ranges,
+		allowCrossShardTx: groupConf.AllowCrossShardTx,
+	}
+	if utils.IsStrNotBlank(groupConf.ShardingKeyExpr) {
+		group.expr = utils.Must(gval.Full().NewEvaluable(groupConf.ShardingKeyExpr))
+	}
+
+	members := utils.NewSet(group.instances...)
+	rwlock.RLock()
+	for _, instance := range group.instances {
+		if _, ok := appInstances[appName][instance]; !ok {
+			rwlock.RUnlock()
+			panic(errors.Errorf("db shard group %s member not found: %s", name, instance))
+		}
+	}
+	rwlock.RUnlock()
+	switch group.strategy {
+	case ShardStrategyHash:
+	case ShardStrategyRange:
+		for _, r := range group.ranges {
+			if !members.Contains(r.Instance) {
+				panic(errors.Errorf("db shard group %s range instance is not a member: %s", name, r.Instance))
+			}
+		}
+	default:
+		panic(errors.Errorf("unknown db shard group %s strategy: %s", name, group.strategy))
+	}
+
+	shardGroupLocker.Lock()
+	defer shardGroupLocker.Unlock()
+	if appShardGroups[appName] == nil {
+		appShardGroups[appName] = make(map[string]*shardGroup)
+	}
+	if _, ok := appShardGroups[appName][name]; ok {
+		panic(ErrDuplicatedName)
+	}
+	appShardGroups[appName][name] = group
+	log.Printf("%v [Gofusion] %s %s shard group %s routes to %s by %s", syscall.Getpid(),
+		config.Use(appName).AppName(), config.ComponentDB, name, strings.Join(group.instances, ","), group.strategy)
+}
+
+func getShardGroup(appName, name string) *shardGroup {
+	shardGroupLocker.RLock()
+	defer shardGroupLocker.RUnlock()
+	group, ok := appShardGroups[appName][name]
+	if !ok {
+		panic(errors.Wrapf(ErrShardGroupNotFound, "app: %s name: %s", appName, name))
+	}
+	return group
+}
+
+// locate returns the instance which rows with the sharding values belong to
+func (g *shardGroup) locate(ctx context.Context, values ...any) (instance string, err error) {
+	if len(values) != len(g.columns) {
+		return "", plugins.ErrMissingShardingKey
+	}
+	values = utils.SliceMapping(values, normalizeShardingValue)
+
+	var key int64
+	switch {
+	case g.expr != nil:
+		params := make(map[string]any, len(g.columns))
+		for i, column := range g.columns {
+			params[column] = values[i]
+		}
+		result, err := g.expr(ctx, params)
+		if err != nil {
+			return "", err
+		}
+		if key, err = cast.ToInt64E(result); err != nil {
+			return "", err
+		}
+	case g.strategy == ShardStrategyRange:
+		if key, err = cast.ToInt64E(values[0]); err != nil {
+			return
+		}
+	default:
+		checksum, err := plugins.ShardingChecksum(values...)
+		if err != nil {
+			return "", err
+		}
+		key = int64(checksum)
+	}
+
+	if g.strategy == ShardStrategyRange {
+		for _, r := range g.ranges {
+			if key >= r.From && (r.To == 0 || key < r.To) {
+				return r.Instance, nil
+			}
+		}
+		return "", errors.Wrapf(ErrShardNotFound, "sharding key: %v", key)
+	}
+	if key < 0 {
+		key = -key
+	}
+	return g.instances[key%int64(len(g.instances))], nil
+}
+
+// normalizeShardingValue unifies values from models and sql vars, e.g. int64 fields and int vars
+func normalizeShardingValue(v any) any {
+	if valuer, ok := v.(driver.Valuer); ok {
+		if val, err := valuer.Value(); err == nil {
+			v = val
+		}
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int(u)
+		}
+		return uint(rv.Uint())
+	case reflect.String:
+		return rv.String()
+	case reflect.Invalid:
+		return nil
+	default:
+		return rv.Interface()
+	}
+}
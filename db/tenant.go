@@ -0,0 +1,330 @@
+package db
+
+import (
+	"reflect"
+
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/db/plugins"
+
+	fusCtx "github.com/wfusion/gofusion/context"
+)
+
+const (
+	ErrTenantRequired utils.Error = "tenant id required in context"
+	ErrTenantMismatch utils.Error = "tenant id mismatches the one in context"
+
+	tenantEnabledFlag   = "tenant_enabled"
+	tenantUpsertFlag    = "tenant_upsert"
+	tenantCallbackName  = "gofusion:tenant"
+	settingTenantBypass = "gofusion:tenant_bypass"
+)
+
+// Tenant isolates rows of models embedding it by the tenant id in the context, queries, updates and deletes
+// are filtered by it and creates are filled with it, statements without a tenant id are refused unless bypassed
+// by WithoutTenant or the BypassTenant dal option, upserts never update existing rows and return
+// ErrTenantMismatch if a conflicting row belongs to another tenant, raw sql by Raw and Exec and joined tables
+// are not filtered
+type Tenant struct {
+	TenantID TenantID `gorm:"column:tenant_id;type:varchar(64);index" json:"tenantID"`
+}
+
+func (t *Tenant) Clone() *Tenant {
+	if t == nil {
+		return nil
+	}
+	return &Tenant{TenantID: t.TenantID}
+}
+func (t *Tenant) Equals(o *Tenant) bool {
+	if t == nil && o == nil {
+		return true
+	}
+	if t == nil || o == nil {
+		return false
+	}
+	return t.TenantID == o.TenantID
+}
+
+type TenantID string
+
+var tenantIDType = reflect.TypeOf(TenantID(""))
+
+// WithoutTenant is a gorm scope bypassing the tenant isolation, e.g. orm.Scopes(db.WithoutTenant).Find(&rows)
+func WithoutTenant(tx *gorm.DB) *gorm.DB {
+	return tx.Set(settingTenantBypass, true)
+}
+
+func tenantBypassed(stmt *gorm.Statement) bool {
+	bypass, ok := stmt.Settings.Load(settingTenantBypass)
+	return ok && bypass == true
+}
+
+func (TenantID) QueryClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{TenantQueryClause{Field: f}}
+}
+
+type TenantQueryClause struct {
+	Field *schema.Field
+}
+
+func (t TenantQueryClause) Name() string {
+	return ""
+}
+func (t TenantQueryClause) Build(clause.Builder) {
+}
+func (t TenantQueryClause) MergeClause(*clause.Clause) {
+}
+func (t TenantQueryClause) ModifyStatement(stmt *gorm.Statement) {
+	if _, ok := stmt.Clauses[tenantEnabledFlag]; ok || stmt.SQL.Len() > 0 || tenantBypassed(stmt) {
+		return
+	}
+	tenantID := fusCtx.GetTenantID(stmt.Context)
+	if utils.IsStrBlank(tenantID) {
+		_ = stmt.AddError(ErrTenantRequired)
+		return
+	}
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) >= 1 {
+			for _, expr := range where.Exprs {
+				if orCond, ok := expr.(clause.OrConditions); ok && len(orCond.Exprs) == 1 {
+					where.Exprs = []clause.Expression{clause.And(where.Exprs...)}
+					c.Expression = where
+					stmt.Clauses["WHERE"] = c
+					break
+				}
+			}
+		}
+	}
+
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: t.Field.DBName}, Value: tenantID},
+	}})
+	stmt.Clauses[tenantEnabledFlag] = clause.Clause{}
+}
+
+func (TenantID) UpdateClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{TenantUpdateClause{Field: f}}
+}
+
+type TenantUpdateClause struct {
+	Field *schema.Field
+}
+
+func (t TenantUpdateClause) Name() string {
+	return ""
+}
+func (t TenantUpdateClause) Build(clause.Builder) {
+}
+func (t TenantUpdateClause) MergeClause(*clause.Clause) {
+}
+
+// ModifyStatement filters updates by the tenant id in the context, and keeps the tenant id of updated rows, e.g.
+// saving a model without the tenant id fills it rather than clearing the column
+func (t TenantUpdateClause) ModifyStatement(stmt *gorm.Statement) {
+	if _, ok := stmt.Clauses[tenantEnabledFlag]; ok || stmt.SQL.Len() > 0 || tenantBypassed(stmt) {
+		return
+	}
+	TenantQueryClause(t).ModifyStatement(stmt)
+	tenantID := TenantID(fusCtx.GetTenantID(stmt.Context))
+	if tenantID == "" {
+		return
+	}
+
+	if dest, ok := stmt.Dest.(map[string]any); ok {
+		for _, key := range []string{t.Field.DBName, t.Field.Name} {
+			if v, ok := dest[key]; ok && TenantID(cast.ToString(v)) != tenantID {
+				_ = stmt.AddError(ErrTenantMismatch)
+				return
+			}
+		}
+		return
+	}
+	rv := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+	if rv.Kind() != reflect.Struct || stmt.Schema == nil || rv.Type() != stmt.Schema.ModelType {
+		return
+	}
+	switch val, zero := t.Field.ValueOf(stmt.Context, rv); {
+	case zero:
+		stmt.SetColumn(t.Field.DBName, tenantID, true)
+	case val.(TenantID) != tenantID:
+		_ = stmt.AddError(ErrTenantMismatch)
+	}
+}
+
+func (TenantID) DeleteClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{TenantDeleteClause{Field: f}}
+}
+
+type TenantDeleteClause struct {
+	Field *schema.Field
+}
+
+func (t TenantDeleteClause) Name() string {
+	return ""
+}
+func (t TenantDeleteClause) Build(clause.Builder) {
+}
+func (t TenantDeleteClause) MergeClause(*clause.Clause) {
+}
+func (t TenantDeleteClause) ModifyStatement(stmt *gorm.Statement) {
+	TenantQueryClause(t).ModifyStatement(stmt)
+}
+
+func (TenantID) CreateClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{TenantCreateClause{Field: f}}
+}
+
+type TenantCreateClause struct {
+	Field *schema.Field
+}
+
+func (t TenantCreateClause) Name() string {
+	return ""
+}
+func (t TenantCreateClause) Build(clause.Builder) {
+}
+func (t TenantCreateClause) MergeClause(*clause.Clause) {
+}
+
+// ModifyStatement fills the tenant id of models from the context, models with another tenant id are refused,
+// and models with the tenant id set explicitly are allowed without the context one, upserts updating conflicting
+// rows are turned into inserts doing nothing on conflict, because the conflicting row may belong to another
+// tenant, e.g. gorm Save falls back to an upsert when the update filtered by the tenant affects no rows
+func (t TenantCreateClause) ModifyStatement(stmt *gorm.Statement) {
+	if stmt.SQL.Len() > 0 || tenantBypassed(stmt) {
+		return
+	}
+	if c, ok := stmt.Clauses["ON CONFLICT"]; ok {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok &&
+			(onConflict.UpdateAll || len(onConflict.DoUpdates) > 0) {
+			c.Expression = clause.OnConflict{Columns: onConflict.Columns, DoNothing: true}
+			stmt.Clauses["ON CONFLICT"] = c
+			stmt.Clauses[tenantUpsertFlag] = clause.Clause{}
+		}
+	}
+	tenantID := TenantID(fusCtx.GetTenantID(stmt.Context))
+	if dest, ok := stmt.Dest.(map[string]any); ok {
+		v, ok := dest[t.Field.DBName]
+		switch {
+		case ok && v != nil && tenantID != "" && TenantID(cast.ToString(v)) != tenantID:
+			_ = stmt.AddError(ErrTenantMismatch)
+		case ok && v != nil:
+		case tenantID == "":
+			_ = stmt.AddError(ErrTenantRequired)
+		default:
+			stmt.SetColumn(t.Field.DBName, tenantID, true)
+		}
+		return
+	}
+
+	fill := func(rv reflect.Value) {
+		val, zero := t.Field.ValueOf(stmt.Context, rv)
+		switch {
+		case zero && tenantID == "":
+			_ = stmt.AddError(ErrTenantRequired)
+		case zero:
+			_ = stmt.AddError(t.Field.Set(stmt.Context, rv, tenantID))
+		case tenantID != "" && val.(TenantID) != tenantID:
+			_ = stmt.AddError(ErrTenantMismatch)
+		}
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			fill(reflect.Indirect(stmt.ReflectValue.Index(i)))
+		}
+	case reflect.Struct:
+		fill(stmt.ReflectValue)
+	}
+}
+
+// checkTenantUpsert returns ErrTenantMismatch if rows conflicting with upserts of tenant models do not belong to
+// the tenant, they are counted by primary keys within the tenant after the insert
+func checkTenantUpsert(db *gorm.DB) {
+	if _, ok := db.Statement.Clauses[tenantUpsertFlag]; !ok {
+		return
+	}
+	delete(db.Statement.Clauses, tenantUpsertFlag)
+	if db.Error != nil || db.DryRun || db.Statement.Schema == nil {
+		return
+	}
+
+	var rvs []reflect.Value
+	switch db.Statement.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < db.Statement.ReflectValue.Len(); i++ {
+			rvs = append(rvs, reflect.Indirect(db.Statement.ReflectValue.Index(i)))
+		}
+	case reflect.Struct:
+		rvs = append(rvs, db.Statement.ReflectValue)
+	default:
+		return
+	}
+	if db.RowsAffected >= int64(len(rvs)) {
+		return
+	}
+
+	// rows conflicting on other unique keys could not be located
+	primaryKeys := db.Statement.Schema.PrimaryFields
+	if len(primaryKeys) == 0 {
+		_ = db.AddError(ErrTenantMismatch)
+		return
+	}
+	var tenantField *schema.Field
+	for _, field := range db.Statement.Schema.Fields {
+		if field.FieldType == tenantIDType {
+			tenantField = field
+		}
+	}
+	if tenantField == nil {
+		return
+	}
+	exprs := make([]clause.Expression, 0, len(rvs))
+	for _, rv := range rvs {
+		conds := make([]clause.Expression, 0, len(primaryKeys)+1)
+		for _, field := range primaryKeys {
+			val, zero := field.ValueOf(db.Statement.Context, rv)
+			if zero {
+				_ = db.AddError(ErrTenantMismatch)
+				return
+			}
+			conds = append(conds, clause.Eq{Column: clause.Column{Name: field.DBName}, Value: val})
+		}
+		val, _ := tenantField.ValueOf(db.Statement.Context, rv)
+		conds = append(conds, clause.Eq{Column: clause.Column{Name: tenantField.DBName}, Value: val})
+		exprs = append(exprs, clause.And(conds...))
+	}
+
+	var count int64
+	if err := db.Session(&gorm.Session{NewDB: true}).Table(db.Statement.Table).
+		Set(plugins.SettingPrimaryOnly, true).Scopes(WithoutTenant).Clauses(clause.Where{Exprs: []clause.Expression{clause.Or(exprs...)}}).
+		Count(&count).Error; err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	if count < int64(len(rvs)) {
+		_ = db.AddError(ErrTenantMismatch)
+	}
+}
+
+// tenanted reports whether the model has the tenant field
+func tenanted(db *gorm.DB, model any) bool {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return false
+	}
+	for _, field := range stmt.Schema.Fields {
+		if field.FieldType == tenantIDType {
+			return true
+		}
+	}
+	return false
+}
+
+func registerTenant(db *gorm.DB) {
+	utils.MustSuccess(db.Callback().Create().After("gorm:create").Register(tenantCallbackName, checkTenantUpsert))
+}
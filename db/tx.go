@@ -37,11 +37,13 @@ func WithinTx(ctx context.Context, cb func(ctx context.Context) (err error), opt
 		panic(ErrDatabaseNotFound)
 	}
 
-	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		return cb(SetCtxGormDB(ctx, &DB{
-			DB:                   &orm.DB{DB: tx},
-			Name:                 db.Name,
-			tableShardingPlugins: db.tableShardingPlugins,
-		}))
+	return withQueryCacheTx(ctx, func(ctx context.Context) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return cb(SetCtxGormDB(ctx, &DB{
+				DB:                   &orm.DB{DB: tx},
+				Name:                 db.Name,
+				tableShardingPlugins: db.tableShardingPlugins,
+			}))
+		})
 	})
 }
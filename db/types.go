@@ -26,6 +26,11 @@ type Conf struct {
 	orm.Option             `yaml:",inline" json:",inline" toml:",inline"`
 	AutoIncrementIncrement int64          `yaml:"auto_increment_increment" json:"auto_increment_increment" toml:"auto_increment_increment"`
 	Sharding               []shardingConf `yaml:"sharding" json:"sharding" toml:"sharding"`
+	Migration              migrationConf  `yaml:"migration" json:"migration" toml:"migration"`
+	Replicas               replicasConf   `yaml:"replicas" json:"replicas" toml:"replicas"`
+	Audit                  auditConf      `yaml:"audit" json:"audit" toml:"audit"`
+	ShardGroup             shardGroupConf `yaml:"shard_group" json:"shard_group" toml:"shard_group"`
+	QueryCache             queryCacheConf `yaml:"query_cache" json:"query_cache" toml:"query_cache"`
 	EnableLogger           bool           `yaml:"enable_logger" json:"enable_logger" toml:"enable_logger" default:"false"`
 	LoggerConfig           struct {
 		Logger        string `yaml:"logger" json:"logger" toml:"logger" default:"github.com/wfusion/gofusion/log/customlogger.gormLogger"`
@@ -38,14 +43,93 @@ type Conf struct {
 // shardingConf
 //nolint: revive // struct tag too long issue
 type shardingConf struct {
-	Table                    string   `yaml:"table"`
-	Suffix                   string   `yaml:"suffix"`
-	Columns                  []string `yaml:"columns"`
-	ShardingKeyExpr          string   `yaml:"sharding_key_expr"`
-	ShardingKeyByRawValue    bool     `yaml:"sharding_key_by_raw_value"`
-	ShardingKeysForMigrating []string `yaml:"sharding_keys_for_migrating"`
-	NumberOfShards           uint     `yaml:"number_of_shards"`
-	IDGen                    string   `yaml:"idgen" default:"github.com/wfusion/gofusion/common/infra/drivers/orm/idgen.NewSnowflake"`
+	Table                    string          `yaml:"table"`
+	Suffix                   string          `yaml:"suffix"`
+	Columns                  []string        `yaml:"columns"`
+	ShardingKeyExpr          string          `yaml:"sharding_key_expr"`
+	ShardingKeyByRawValue    bool            `yaml:"sharding_key_by_raw_value"`
+	ShardingKeysForMigrating []string        `yaml:"sharding_keys_for_migrating"`
+	NumberOfShards           uint            `yaml:"number_of_shards"`
+	IDGen                    string          `yaml:"idgen" default:"github.com/wfusion/gofusion/common/infra/drivers/orm/idgen.NewSnowflake"`
+	IDGenWorker              idgenWorkerConf `yaml:"idgen_worker"`
+}
+
+// idgenWorkerConf leases the machine id of the snowflake idgen from db, redis, or kv instead of hashing hosts
+//nolint: revive // struct tag too long issue
+type idgenWorkerConf struct {
+	// Type db, redis, or kv, the db leases from the instance itself
+	Type     string `yaml:"type" json:"type" toml:"type"`
+	Instance string `yaml:"instance" json:"instance" toml:"instance"`
+	// Key is the table of db, the key of redis, or the key prefix of kv
+	Key      string `yaml:"key" json:"key" toml:"key"`
+	TTL      string `yaml:"ttl" json:"ttl" toml:"ttl" default:"30s"`
+	PoolSize int    `yaml:"pool_size" json:"pool_size" toml:"pool_size" default:"1024"`
+}
+
+// migrationConf
+//nolint: revive // struct tag too long issue
+type migrationConf struct {
+	Enable       bool   `yaml:"enable" json:"enable" toml:"enable" default:"false"`
+	Dir          string `yaml:"dir" json:"dir" toml:"dir"`
+	Table        string `yaml:"table" json:"table" toml:"table" default:"gofusion_migrations"`
+	LockInstance string `yaml:"lock_instance" json:"lock_instance" toml:"lock_instance"`
+	LockTimeout  string `yaml:"lock_timeout" json:"lock_timeout" toml:"lock_timeout" default:"1m"`
+	LockExpired  string `yaml:"lock_expired" json:"lock_expired" toml:"lock_expired" default:"10m"`
+}
+
+// replicasConf
+//nolint: revive // struct tag too long issue
+type replicasConf struct {
+	Instances     []*replicaConf `yaml:"instances" json:"instances" toml:"instances"`
+	Balancer      string         `yaml:"balancer" json:"balancer" toml:"balancer" default:"random"`
+	CheckInterval string         `yaml:"check_interval" json:"check_interval" toml:"check_interval" default:"5s"`
+	MaxLag        string         `yaml:"max_lag" json:"max_lag" toml:"max_lag"`
+	StickyWindow  string         `yaml:"sticky_window" json:"sticky_window" toml:"sticky_window" default:"1s"`
+}
+
+// auditConf
+//nolint: revive // struct tag too long issue
+type auditConf struct {
+	Enable      bool     `yaml:"enable" json:"enable" toml:"enable" default:"false"`
+	Tables      []string `yaml:"tables" json:"tables" toml:"tables"`
+	Sink        string   `yaml:"sink" json:"sink" toml:"sink" default:"table"`
+	Table       string   `yaml:"table" json:"table" toml:"table" default:"gofusion_audit_logs"`
+	LogInstance string   `yaml:"log_instance" json:"log_instance" toml:"log_instance"`
+	MQInstance  string   `yaml:"mq_instance" json:"mq_instance" toml:"mq_instance"`
+	MaskConfig  string   `yaml:"mask_config" json:"mask_config" toml:"mask_config"`
+}
+
+// queryCacheConf caches invalidated by writes of the db besides the ones used by db.Cached in the process,
+// caches used by replicas only reading them should be listed so that their writes invalidate the results
+//nolint: revive // struct tag too long issue
+type queryCacheConf struct {
+	Caches []string `yaml:"caches" json:"caches" toml:"caches"`
+}
+
+// shardGroupConf a logical db routing rows to the db instances by the sharding key, no connection is made for it
+//nolint: revive // struct tag too long issue
+type shardGroupConf struct {
+	Instances         []string          `yaml:"instances" json:"instances" toml:"instances"`
+	Columns           []string          `yaml:"columns" json:"columns" toml:"columns"`
+	ShardingKeyExpr   string            `yaml:"sharding_key_expr" json:"sharding_key_expr" toml:"sharding_key_expr"`
+	Strategy          string            `yaml:"strategy" json:"strategy" toml:"strategy" default:"hash"`
+	Ranges            []*shardRangeConf `yaml:"ranges" json:"ranges" toml:"ranges"`
+	AllowCrossShardTx bool              `yaml:"allow_cross_shard_tx" json:"allow_cross_shard_tx" toml:"allow_cross_shard_tx" default:"false"`
+}
+
+// shardRangeConf routes sharding keys in [from, to) to the instance, to 0 means unbounded
+type shardRangeConf struct {
+	Instance string `yaml:"instance" json:"instance" toml:"instance"`
+	From     int64  `yaml:"from" json:"from" toml:"from"`
+	To       int64  `yaml:"to" json:"to" toml:"to"`
+}
+
+// replicaConf fields not set are inherited from the primary
+type replicaConf struct {
+	Host     string `yaml:"host" json:"host" toml:"host"`
+	Port     uint   `yaml:"port" json:"port" toml:"port"`
+	User     string `yaml:"user" json:"user" toml:"user"`
+	Password string `yaml:"password" json:"password" toml:"password" encrypted:""`
 }
 
 type customLogger interface {
@@ -0,0 +1,236 @@
+package db
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/db/callbacks"
+
+	fusCtx "github.com/wfusion/gofusion/context"
+)
+
+const (
+	versionCheckedFlag      = "optimistic_lock_version_checked"
+	versionSetFlag          = "optimistic_lock_version_set"
+	versionCallbackName     = "gofusion:optimistic_lock"
+	defaultUpdateRetryTimes = 3
+)
+
+var (
+	// ErrStaleObject is returned when updating a model with the version field but the row has been updated by others
+	ErrStaleObject = errors.New("stale object updated by others")
+
+	versionType = reflect.TypeOf(Version(0))
+)
+
+// Version is the optimistic lock field of models, updates with the version known are executed with the version
+// in the where clause and increase it, e.g. Version db.Version `gorm:"column:version;type:bigint"`
+type Version int64
+
+func (Version) CreateClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{VersionCreateClause{Field: f}}
+}
+
+type VersionCreateClause struct {
+	Field *schema.Field
+}
+
+func (v VersionCreateClause) Name() string {
+	return ""
+}
+func (v VersionCreateClause) Build(clause.Builder) {
+}
+func (v VersionCreateClause) MergeClause(*clause.Clause) {
+}
+func (v VersionCreateClause) ModifyStatement(stmt *gorm.Statement) {
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			v.initVersion(stmt, reflect.Indirect(stmt.ReflectValue.Index(i)))
+		}
+	case reflect.Struct:
+		v.initVersion(stmt, stmt.ReflectValue)
+	}
+}
+func (v VersionCreateClause) initVersion(stmt *gorm.Statement, rv reflect.Value) {
+	if _, zero := v.Field.ValueOf(stmt.Context, rv); zero && rv.CanAddr() {
+		_ = stmt.AddError(v.Field.Set(stmt.Context, rv, Version(1)))
+	}
+}
+
+func (Version) UpdateClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{VersionUpdateClause{Field: f}}
+}
+
+type VersionUpdateClause struct {
+	Field *schema.Field
+}
+
+func (v VersionUpdateClause) Name() string {
+	return ""
+}
+func (v VersionUpdateClause) Build(clause.Builder) {
+}
+func (v VersionUpdateClause) MergeClause(*clause.Clause) {
+}
+
+// ModifyStatement checks the version and increases it if the version is known from the updating model or map,
+// otherwise it increases the version without checking
+func (v VersionUpdateClause) ModifyStatement(stmt *gorm.Statement) {
+	if _, ok := stmt.Clauses[versionCheckedFlag]; ok || stmt.SQL.Len() > 0 {
+		return
+	}
+
+	current, known := v.currentVersion(stmt)
+	if !known || current <= 0 {
+		v.increaseVersion(stmt)
+		return
+	}
+
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: v.Field.DBName}, Value: current},
+	}})
+	stmt.SetColumn(v.Field.DBName, current+1, true)
+	stmt.Clauses[versionCheckedFlag] = clause.Clause{
+		Expression: versionChecked{field: v.Field.DBName, current: current},
+	}
+}
+
+// increaseVersion sets the version to version + 1, the expression could not be set into structs, so assignments
+// of updating structs are converted here and gorm uses the set clause rather than converting them again
+func (v VersionUpdateClause) increaseVersion(stmt *gorm.Statement) {
+	increased := gorm.Expr(stmt.Quote(v.Field.DBName) + " + 1")
+	if _, ok := stmt.Dest.(map[string]any); ok {
+		stmt.SetColumn(v.Field.DBName, increased, true)
+		return
+	}
+	if _, ok := stmt.Clauses["SET"]; ok {
+		return
+	}
+
+	assignments := callbacks.ConvertToAssignments(stmt)
+	if stmt.Error != nil || len(assignments) == 0 {
+		return
+	}
+	set := make(clause.Set, 0, len(assignments)+1)
+	for _, assignment := range assignments {
+		if assignment.Column.Name != v.Field.DBName {
+			set = append(set, assignment)
+		}
+	}
+	set = append(set, clause.Assignment{Column: clause.Column{Name: v.Field.DBName}, Value: increased})
+	stmt.AddClause(set)
+	stmt.Clauses[versionSetFlag] = clause.Clause{}
+}
+func (v VersionUpdateClause) currentVersion(stmt *gorm.Statement) (current Version, known bool) {
+	if dest, ok := stmt.Dest.(map[string]any); ok {
+		for _, key := range []string{v.Field.DBName, v.Field.Name} {
+			if val, ok := dest[key]; ok {
+				if _, isExpr := val.(clause.Expression); isExpr {
+					return
+				}
+				return Version(cast.ToInt64(val)), true
+			}
+		}
+		return
+	}
+
+	// the updating struct goes first, then the model
+	for _, rv := range []reflect.Value{reflect.Indirect(reflect.ValueOf(stmt.Dest)), stmt.ReflectValue} {
+		if rv.Kind() != reflect.Struct || stmt.Schema == nil || rv.Type() != stmt.Schema.ModelType {
+			continue
+		}
+		if val, zero := v.Field.ValueOf(stmt.Context, rv); !zero {
+			return val.(Version), true
+		}
+	}
+	return
+}
+
+type versionChecked struct {
+	field   string
+	current Version
+}
+
+func (versionChecked) Build(clause.Builder) {}
+
+// checkStaleObject turns updates with the version checked but no rows affected into ErrStaleObject, and restores
+// the version of the model
+func checkStaleObject(db *gorm.DB) {
+	// the set clause converted by increaseVersion should not be reused by later updates of the statement
+	if _, ok := db.Statement.Clauses[versionSetFlag]; ok {
+		delete(db.Statement.Clauses, "SET")
+		delete(db.Statement.Clauses, versionSetFlag)
+	}
+
+	c, ok := db.Statement.Clauses[versionCheckedFlag]
+	if !ok || db.Error != nil || db.DryRun || db.RowsAffected > 0 {
+		return
+	}
+	if checked, ok := c.Expression.(versionChecked); ok {
+		db.Statement.SetColumn(checked.field, checked.current, true)
+	}
+	_ = db.AddError(ErrStaleObject)
+}
+
+func registerOptimisticLock(db *gorm.DB) {
+	utils.MustSuccess(db.Callback().Update().After("gorm:update").Register(versionCallbackName, checkStaleObject))
+}
+
+// versioned reports whether the model has the version field
+func versioned(db *gorm.DB, model any) bool {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return false
+	}
+	for _, field := range stmt.Schema.Fields {
+		if field.FieldType == versionType {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateWithRetry reloads the model by the primary key from the write db, mutates and saves it, and retries
+// when the model is updated by others, the conds are extra conditions like sharding keys, or options like
+// Retries and Unscoped
+func (d *dal[T, TS]) UpdateWithRetry(ctx context.Context, id any, mutateFn func(mod *T) error,
+	conds ...any) (mod *T, err error) {
+	o, conds := d.parseOptionFromArgs(conds...)
+	ctx = context.WithValue(ctx, fusCtx.KeyDALOption, o)
+	retries := o.retries
+	if retries <= 0 {
+		retries = defaultUpdateRetryTimes
+	}
+
+	for i := 0; i <= retries; i++ {
+		mod = d.Model()
+		query := d.WriteDB(ctx).Clauses(o.clauses...).Clauses(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.PrimaryColumn, Value: id},
+		}})
+		if len(conds) > 0 {
+			query = query.Where(conds[0], conds[1:]...)
+		}
+		if err = query.First(mod).Error; err != nil {
+			return nil, err
+		}
+		if err = mutateFn(mod); err != nil {
+			return nil, err
+		}
+		err = d.WriteDB(ctx).Model(mod).Clauses(o.clauses...).Select("*").Save(mod).Error
+		if !errors.Is(err, ErrStaleObject) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
@@ -0,0 +1,162 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/atomic"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/routine"
+)
+
+var (
+	rwlock       sync.RWMutex
+	appCheckers  = map[string]map[string]*checker{}
+	appDrainings = map[string]*atomic.Bool{}
+)
+
+type checker struct {
+	name     string
+	fn       Checker
+	liveness bool
+}
+
+// Register registers a checker named by the component and instance, the same name will be replaced
+func Register(component, name string, fn Checker, opts ...utils.OptionExtender) {
+	opt := utils.ApplyOptions[useOption](opts...)
+	optR := utils.ApplyOptions[registerOption](opts...)
+	rwlock.Lock()
+	defer rwlock.Unlock()
+	if appCheckers[opt.appName] == nil {
+		appCheckers[opt.appName] = make(map[string]*checker)
+	}
+	checkerName := Name(component, name)
+	appCheckers[opt.appName][checkerName] = &checker{name: checkerName, fn: fn, liveness: optR.liveness}
+}
+
+// Unregister removes the checker named by the component and instance
+func Unregister(component, name string, opts ...utils.OptionExtender) {
+	opt := utils.ApplyOptions[useOption](opts...)
+	rwlock.Lock()
+	defer rwlock.Unlock()
+	if delete(appCheckers[opt.appName], Name(component, name)); len(appCheckers[opt.appName]) == 0 {
+		delete(appCheckers, opt.appName)
+	}
+}
+
+// Name returns the checker name which criticality configures by, e.g. db.default, redis.cache
+func Name(component, name string) string {
+	return fmt.Sprintf("%s.%s", strings.ToLower(component), name)
+}
+
+// Drain makes readiness failing, it is called when the application starts shutting down gracefully
+func Drain(opts ...utils.OptionExtender) {
+	draining(utils.ApplyOptions[useOption](opts...).appName).Store(true)
+}
+
+// Resume makes readiness depends on checkers again
+func Resume(opts ...utils.OptionExtender) {
+	draining(utils.ApplyOptions[useOption](opts...).appName).Store(false)
+}
+
+// Draining reports whether the application is shutting down
+func Draining(opts ...utils.OptionExtender) bool {
+	return draining(utils.ApplyOptions[useOption](opts...).appName).Load()
+}
+
+func draining(appName string) (d *atomic.Bool) {
+	rwlock.RLock()
+	d, ok := appDrainings[appName]
+	rwlock.RUnlock()
+	if ok {
+		return
+	}
+
+	rwlock.Lock()
+	defer rwlock.Unlock()
+	if d, ok = appDrainings[appName]; !ok {
+		d = atomic.NewBool(false)
+		appDrainings[appName] = d
+	}
+	return
+}
+
+// Check runs checkers of the probe concurrently, the report is down if any critical checker fails
+func Check(ctx context.Context, probe Probe, opts ...utils.OptionExtender) (report *Report) {
+	opt := utils.ApplyOptions[useOption](opts...)
+	optC := utils.ApplyOptions[checkOption](opts...)
+
+	report = &Report{Status: StatusUp}
+	if probe == ProbeReadiness && Draining(AppName(opt.appName)) {
+		report.Status = StatusDown
+		report.Draining = true
+		return
+	}
+
+	rwlock.RLock()
+	checkers := make([]*checker, 0, len(appCheckers[opt.appName]))
+	for _, c := range appCheckers[opt.appName] {
+		if probe == ProbeHealth || (probe == ProbeLiveness) == c.liveness {
+			checkers = append(checkers, c)
+		}
+	}
+	rwlock.RUnlock()
+	sort.Slice(checkers, func(i, j int) bool { return checkers[i].name < checkers[j].name })
+
+	if optC.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, optC.timeout)
+		defer cancel()
+	}
+
+	report.Checks = make([]*Result, len(checkers))
+	wg := new(sync.WaitGroup)
+	for idx, c := range checkers {
+		idx, c := idx, c
+		report.Checks[idx] = &Result{Name: c.name, Status: StatusUp, Critical: optC.isCritical(c.name)}
+		wg.Add(1)
+		routine.Go(func() { report.Checks[idx].run(ctx, c.fn) }, routine.WaitGroup(wg), routine.AppName(opt.appName))
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		switch {
+		case result.Status == StatusUp:
+		case result.Critical:
+			report.Status = StatusDown
+		case report.Status == StatusUp:
+			report.Status = StatusDegraded
+		}
+	}
+	return
+}
+
+func (r *Result) run(ctx context.Context, fn Checker) {
+	begin := time.Now()
+	defer func() { r.Latency = time.Since(begin).String() }()
+
+	// checkers of some drivers ignore the context, so wait for them in another goroutine
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				errCh <- errors.Errorf("check panic: %v", p)
+			}
+		}()
+		errCh <- fn(ctx)
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			r.Status, r.Error = StatusDown, err.Error()
+		}
+	case <-ctx.Done():
+		r.Status, r.Error = StatusDown, errors.Wrap(ctx.Err(), "check timeout").Error()
+	}
+}
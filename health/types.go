@@ -0,0 +1,97 @@
+package health
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/wfusion/gofusion/common/utils"
+)
+
+// Checker returns an error if the instance is unreachable
+type Checker func(ctx context.Context) error
+
+type Probe string
+
+const (
+	// ProbeHealth runs all checkers
+	ProbeHealth Probe = "health"
+	// ProbeReadiness runs checkers registered without Liveness, and fails during graceful shutdown
+	ProbeReadiness Probe = "readiness"
+	// ProbeLiveness runs checkers registered with Liveness only
+	ProbeLiveness Probe = "liveness"
+)
+
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDown     Status = "down"
+	StatusDegraded Status = "degraded" // only non-critical checkers failed
+)
+
+type Report struct {
+	Status   Status    `json:"status"`
+	Draining bool      `json:"draining,omitempty"`
+	Checks   []*Result `json:"checks,omitempty"`
+}
+
+type Result struct {
+	Name     string `json:"name"`
+	Status   Status `json:"status"`
+	Critical bool   `json:"critical"`
+	Latency  string `json:"latency"`
+	Error    string `json:"error,omitempty"`
+}
+
+type useOption struct {
+	appName string
+}
+
+func AppName(name string) utils.OptionFunc[useOption] {
+	return func(o *useOption) {
+		o.appName = name
+	}
+}
+
+type registerOption struct {
+	liveness bool
+}
+
+// Liveness registers the checker for liveness rather than readiness
+func Liveness() utils.OptionFunc[registerOption] {
+	return func(o *registerOption) {
+		o.liveness = true
+	}
+}
+
+type checkOption struct {
+	timeout     time.Duration
+	nonCritical []string
+}
+
+// Timeout limits the duration of a whole check
+func Timeout(timeout time.Duration) utils.OptionFunc[checkOption] {
+	return func(o *checkOption) {
+		o.timeout = timeout
+	}
+}
+
+// NonCritical marks checkers not failing the report, names are checker names like redis.cache or component
+// names like redis
+func NonCritical(names ...string) utils.OptionFunc[checkOption] {
+	return func(o *checkOption) {
+		o.nonCritical = append(o.nonCritical, names...)
+	}
+}
+
+func (c *checkOption) isCritical(name string) bool {
+	name = strings.ToLower(name)
+	for _, nonCritical := range c.nonCritical {
+		nonCritical = strings.ToLower(nonCritical)
+		if name == nonCritical || strings.HasPrefix(name, nonCritical+".") {
+			return false
+		}
+	}
+	return true
+}
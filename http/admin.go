@@ -0,0 +1,228 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/routine"
+)
+
+var (
+	adminLogLevels = utils.NewSet("debug", "info", "warn", "error", "panic", "fatal")
+
+	// adminLoggerComponents are components configured by instances and switching enable_logger on the fly
+	adminLoggerComponents = map[string]string{
+		"db":      config.ComponentDB,
+		"redis":   config.ComponentRedis,
+		"mongo":   config.ComponentMongo,
+		"kv":      config.ComponentKV,
+		"mq":      config.ComponentMessageQueue,
+		"async":   config.ComponentAsync,
+		"cron":    config.ComponentCron,
+		"http":    config.ComponentHttp,
+		"metrics": config.ComponentMetrics,
+	}
+)
+
+// adminConfigPatcher is implemented by the config registry, patching configs is kept out of config.Configurable
+type adminConfigPatcher interface {
+	PatchComponentConfig(name string, patch map[string]any) (err error)
+}
+
+type adminLogLevelReq struct {
+	Level string `json:"level" binding:"required"`
+}
+
+type adminLoggerReq struct {
+	Enable *bool `json:"enable" binding:"required"`
+}
+
+type adminRoutines struct {
+	Pools    []*routine.PoolStatus `json:"pools"`
+	Routines map[string]int        `json:"routines"`
+}
+
+// initAdmin mounts the runtime admin api, changes are applied by patching the component configs which
+// loggers reload on each call, so they are lost after restart and overwritten by remote config changes
+func initAdmin(engine *gin.Engine, appName, name string, conf Conf) {
+	if !conf.Admin.Enable {
+		return
+	}
+
+	// the admin api changes log levels and dumps configs, it is never mounted unprotected
+	if len(conf.Admin.Authenticators) == 0 {
+		panic(errors.Errorf("http admin api requires authenticators: %s", name))
+	}
+
+	a := &admin{appName: appName, successCode: conf.SuccessCode, errorCode: conf.ErrorCode}
+	group := engine.Group(conf.Admin.Path)
+	group.Use(Authenticate(AppName(appName), Name(name), Authenticators(conf.Admin.Authenticators...)))
+	group.GET("/logs", a.logLevels)
+	group.PUT("/logs/:name", a.setLogLevel)
+	group.GET("/loggers", a.loggers)
+	group.PUT("/loggers/:component/:name", a.setLogger)
+	group.GET("/configs", a.configs)
+	group.GET("/routines", a.routines)
+}
+
+type admin struct {
+	appName     string
+	successCode int
+	errorCode   int
+}
+
+// logLevels lists log instances with their levels, e.g. {"default": "info"}
+func (a *admin) logLevels(c *gin.Context) {
+	var cfgs map[string]map[string]any
+	if err := config.Use(a.appName).LoadComponentConfig(config.ComponentLog, &cfgs); err != nil {
+		a.fail(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	levels := make(map[string]string, len(cfgs))
+	for name, cfg := range cfgs {
+		levels[name] = cast.ToString(cfg["log_level"])
+	}
+	a.success(c, levels, len(levels))
+}
+
+func (a *admin) setLogLevel(c *gin.Context) {
+	req := new(adminLogLevelReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		a.fail(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	level := strings.ToLower(req.Level)
+	if !adminLogLevels.Contains(level) {
+		a.fail(c, http.StatusBadRequest, fmt.Sprintf("unknown log level: %s", req.Level))
+		return
+	}
+
+	var cfgs map[string]map[string]any
+	_ = config.Use(a.appName).LoadComponentConfig(config.ComponentLog, &cfgs)
+	name := c.Param("name")
+	if _, ok := cfgs[name]; !ok {
+		a.fail(c, http.StatusNotFound, fmt.Sprintf("log instance not found: %s", name))
+		return
+	}
+	patch := map[string]any{name: map[string]any{"log_level": level}}
+	if err := a.patch(config.ComponentLog, patch); err != nil {
+		a.fail(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.success(c, map[string]string{name: level}, 1)
+}
+
+// loggers lists enable_logger of component instances, e.g. {"db": {"default": true}}
+func (a *admin) loggers(c *gin.Context) {
+	loggers := make(map[string]map[string]bool, len(adminLoggerComponents))
+	for component, componentName := range adminLoggerComponents {
+		cfgs, err := a.loadInstanceConfigs(componentName)
+		if err != nil || len(cfgs) == 0 {
+			continue
+		}
+		loggers[component] = make(map[string]bool, len(cfgs))
+		for name, cfg := range cfgs {
+			loggers[component][name] = cast.ToBool(cfg["enable_logger"])
+		}
+	}
+	a.success(c, loggers, len(loggers))
+}
+
+func (a *admin) setLogger(c *gin.Context) {
+	req := new(adminLoggerReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		a.fail(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	component, name := strings.ToLower(c.Param("component")), c.Param("name")
+	componentName, ok := adminLoggerComponents[component]
+	if !ok {
+		a.fail(c, http.StatusBadRequest, fmt.Sprintf("unsupported component: %s, supported%v",
+			c.Param("component"), adminLoggerComponentNames()))
+		return
+	}
+
+	cfgs, _ := a.loadInstanceConfigs(componentName)
+	if _, ok := cfgs[name]; !ok {
+		a.fail(c, http.StatusNotFound, fmt.Sprintf("%s instance not found: %s", componentName, name))
+		return
+	}
+	patch := map[string]any{name: map[string]any{"enable_logger": *req.Enable}}
+	if componentName == config.ComponentHttp {
+		patch = map[string]any{"enable_logger": *req.Enable}
+		if name != config.DefaultInstanceKey {
+			patch = map[string]any{"servers": map[string]any{name: patch}}
+		}
+	}
+	if err := a.patch(componentName, patch); err != nil {
+		a.fail(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.success(c, map[string]map[string]bool{component: {name: *req.Enable}}, 1)
+}
+
+// loadInstanceConfigs loads component configs by instance names, the http configuration itself is the default server
+// and named servers are configured in its servers
+func (a *admin) loadInstanceConfigs(componentName string) (cfgs map[string]map[string]any, err error) {
+	if componentName != config.ComponentHttp {
+		err = config.Use(a.appName).LoadComponentConfig(componentName, &cfgs)
+		return
+	}
+
+	conf := new(Conf)
+	if err = config.Use(a.appName).LoadComponentConfig(componentName, conf); err != nil {
+		return
+	}
+	confs := serverConfs(conf)
+	cfgs = make(map[string]map[string]any, len(confs))
+	for name, serverConf := range confs {
+		cfgs[name] = map[string]any{"enable_logger": serverConf.EnableLogger}
+	}
+	return
+}
+
+func (a *admin) patch(componentName string, patch map[string]any) (err error) {
+	patcher, ok := config.Use(a.appName).(adminConfigPatcher)
+	if !ok {
+		return errors.Errorf("config of app %s is not patchable", a.appName)
+	}
+	return patcher.PatchComponentConfig(componentName, patch)
+}
+
+// configs dumps the effective configs with encrypted fields and secrets redacted
+func (a *admin) configs(c *gin.Context) {
+	configs := config.Use(a.appName).GetAllConfigs()
+	config.CryptoRedactByTag(configs)
+	a.success(c, configs, -1)
+}
+
+func (a *admin) routines(c *gin.Context) {
+	a.success(c, &adminRoutines{
+		Pools:    routine.Pools(routine.AppName(a.appName)),
+		Routines: routine.Routines(routine.AppName(a.appName)),
+	}, -1)
+}
+
+func (a *admin) success(c *gin.Context, data any, count int) {
+	c.Header("Cache-Control", "no-store")
+	rspSuccess(c, a.successCode, data, 0, count, "")
+}
+
+func (a *admin) fail(c *gin.Context, status int, msg string) {
+	c.Status(status)
+	rspError(c, a.appName, a.errorCode, nil, 0, -1, msg)
+}
+
+func adminLoggerComponentNames() (names []string) {
+	names = utils.MapKeys(adminLoggerComponents)
+	sort.Strings(names)
+	return
+}
@@ -33,7 +33,7 @@ func initAsynq(ctx context.Context, appName string, r IRouter, confs []asynqConf
 			ReadOnly:          conf.Readonly,
 		})
 
-		r.Any(h.RootPath()+"/*any", gin.WrapH(h))
+		r.Any(h.RootPath()+"/*any", gin.WrapH(h), APIIgnore())
 	}
 }
 
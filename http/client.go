@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
 	"sync"
@@ -82,9 +83,12 @@ func New(opts ...utils.OptionExtender) *resty.Client {
 		c.SetLogger(cfg.logger)
 	}
 
-	if cliCfg := cfg.c; cliCfg == nil || !cliCfg.Mock {
+	cliCfg := cfg.c
+	if cliCfg == nil || !cliCfg.Mock {
 		c.EnableTrace()
-	} else {
+	}
+	// timeout, retry and transport settings apply to every client, they were applied to mock clients only before
+	if cliCfg != nil {
 		c.SetTimeout(utils.Must(utils.ParseDuration(cliCfg.Timeout)))
 		c.SetRetryCount(cliCfg.RetryCount)
 		c.SetRetryWaitTime(utils.Must(utils.ParseDuration(cliCfg.RetryWaitTime)))
@@ -101,7 +105,7 @@ func New(opts ...utils.OptionExtender) *resty.Client {
 			KeepAlive: utils.Must(utils.ParseDuration(cliCfg.DialKeepaliveTime)),
 		}
 
-		c.SetTransport(&http.Transport{
+		transport := &http.Transport{
 			Proxy:                 http.ProxyFromEnvironment,
 			DialContext:           dialer.DialContext,
 			ForceAttemptHTTP2:     cliCfg.ForceAttemptHTTP2,
@@ -112,11 +116,26 @@ func New(opts ...utils.OptionExtender) *resty.Client {
 			MaxIdleConns:          cliCfg.MaxIdleConns,
 			MaxIdleConnsPerHost:   cliCfg.MaxIdleConnsPerHost,
 			MaxConnsPerHost:       cliCfg.MaxConnsPerHost,
-		})
+		}
+		if cfg.reloader != nil {
+			transport.TLSClientConfig = cfg.reloader.clientConfig(cliCfg.ServerName, cliCfg.InsecureSkipVerify)
+		} else if utils.IsStrNotBlank(cliCfg.ServerName) || cliCfg.InsecureSkipVerify {
+			transport.TLSClientConfig = &tls.Config{
+				ServerName:         cliCfg.ServerName,
+				InsecureSkipVerify: cliCfg.InsecureSkipVerify, //nolint: gosec // configured explicitly
+			}
+		}
+		c.SetTransport(transport)
 
 		if cliCfg.Mock {
 			httpmock.ActivateNonDefault(c.GetClient())
 		}
+		if cfg.discovery != nil {
+			cfg.discovery.apply(c)
+		}
+		if cfg.resilience != nil {
+			cfg.resilience.apply(c)
+		}
 	}
 
 	if _, ok := appClientMap[opt.appName]; !ok {
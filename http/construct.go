@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"reflect"
+	"sort"
 	"sync"
 	"syscall"
 	"time"
@@ -33,7 +34,7 @@ var (
 	Router IRouter
 
 	locker          sync.RWMutex
-	routers         = map[string]IRouter{}
+	routers         = map[string]map[string]IRouter{}
 	appClientMap    = map[string]map[string]*resty.Client{}
 	appClientCfgMap = map[string]map[string]*cfg{}
 )
@@ -45,28 +46,71 @@ func Construct(ctx context.Context, conf Conf, opts ...utils.OptionExtender) fun
 		opt.AppName = optU.appName
 	}
 
-	var logger resty.Logger
+	confs := serverConfs(&conf)
+	names := utils.MapKeys(confs)
+	sort.Strings(names)
+	exitInstanceFns := make([]func(), 0, len(names))
+	for _, name := range names {
+		exitInstanceFns = append(exitInstanceFns, addInstance(ctx, name, confs[name], opt))
+	}
+	// clients are shared by servers of the app, so they are configured by the http configuration itself
+	exitClientFn := addClient(ctx, conf, newLogger(config.DefaultInstanceKey, &conf, opt), opt)
+	exitI18nFn := addI18n(confs, opt)
+
+	// gracefully exit outside gofusion, clients are closed after all servers are drained
+	return func() {
+		for i := len(exitInstanceFns) - 1; i >= 0; i-- {
+			exitInstanceFns[i]()
+		}
+		exitClientFn()
+		exitI18nFn()
+	}
+}
+
+// serverConfs returns the default server configured by the http configuration itself and the named ones in servers
+func serverConfs(conf *Conf) map[string]*Conf {
+	confs := make(map[string]*Conf, len(conf.Servers)+1)
+	for name, serverConf := range conf.Servers {
+		if name == config.DefaultInstanceKey {
+			panic(errors.Errorf("duplicated http name: %s", name))
+		}
+		if serverConf != nil {
+			confs[name] = serverConf
+		}
+	}
+	confs[config.DefaultInstanceKey] = conf
+	return confs
+}
+
+func newLogger(name string, conf *Conf, opt *config.InitOption) (logger resty.Logger) {
 	if utils.IsStrNotBlank(conf.Logger) {
 		logger = reflect.New(inspect.TypeOf(conf.Logger)).Interface().(resty.Logger)
 		if custom, ok := logger.(customLogger); ok {
 			l := fusLog.Use(conf.LogInstance, fusLog.AppName(opt.AppName))
-			custom.Init(l, opt.AppName)
+			custom.Init(l, opt.AppName, name)
 		}
 	}
+	return
+}
 
-	exitRouterFn := addRouter(ctx, conf, logger, opt)
-	exitI18nFn := addI18n(conf, opt)
-	exitClientFn := addClient(ctx, conf, logger, opt)
+func addInstance(ctx context.Context, name string, conf *Conf, opt *config.InitOption) func() {
+	logger := newLogger(name, conf, opt)
+	exitRateLimitFn := addRateLimit(ctx, name, *conf, opt)
+	exitAuthFn := addAuth(ctx, name, *conf, opt)
+	exitIdempotencyFn := addIdempotency(ctx, name, *conf, opt)
+	exitResponseCacheFn := addResponseCache(ctx, name, *conf, opt)
+	exitRouterFn := addRouter(ctx, name, *conf, logger, opt)
 
-	// gracefully exit outside gofusion
 	return func() {
-		exitClientFn()
 		exitRouterFn()
-		exitI18nFn()
+		exitResponseCacheFn()
+		exitIdempotencyFn()
+		exitAuthFn()
+		exitRateLimitFn()
 	}
 }
 
-func addRouter(ctx context.Context, conf Conf, logger resty.Logger, opt *config.InitOption) func() {
+func addRouter(ctx context.Context, name string, conf Conf, logger resty.Logger, opt *config.InitOption) func() {
 	if config.Use(opt.AppName).Debug() {
 		gin.SetMode(gin.DebugMode)
 	} else {
@@ -78,12 +122,21 @@ func addRouter(ctx context.Context, conf Conf, logger resty.Logger, opt *config.
 		gin.ForceConsoleColor()
 	}
 
+	var tracer *tracing
+	middlewares := []gin.HandlerFunc{gin.Recovery(), middleware.Gateway, middleware.Trace()}
+	if conf.Trace.Enable {
+		tracer = utils.Must(newTracing(ctx, opt.AppName, conf.Trace))
+		if opt.AppName == "" && name == config.DefaultInstanceKey {
+			tracer.setGlobal()
+		}
+		middlewares = append(middlewares,
+			middleware.Tracing(tracer.provider, tracer.propagator, conf.Trace.ExcludePaths))
+	}
+
 	cors := conf.CORS
 	engine := gin.New()
+	engine.Use(middlewares...)
 	engine.Use(
-		gin.Recovery(),
-		middleware.Gateway,
-		middleware.Trace(),
 		middleware.Logging(ctx, opt.AppName, conf.Metrics.HeaderLabels, logger),
 		middleware.Cors(cors.AllowOrigins, cors.AllowMethods, cors.AllowHeaders,
 			cors.ExposeHeaders, cors.AllowCredentials, cors.OptionsResponse, cors.ForbiddenResponse),
@@ -116,31 +169,47 @@ func addRouter(ctx context.Context, conf Conf, logger resty.Logger, opt *config.
 	if conf.Pprof {
 		pprof.Register(engine)
 	}
+	initOpenAPI(engine, opt.AppName, name, conf.OpenAPI)
+	initHealth(engine, opt.AppName, conf.Health)
+	initAdmin(engine, opt.AppName, name, conf)
 	instance := newRouter(ctx, engine, opt.AppName, conf.SuccessCode, conf.ErrorCode)
+	instance.(*router).name = name
 	instance.(*router).metricsConf = conf.Metrics
+	instance.(*router).registry = conf.Registry
+	if conf.Health.Enable {
+		instance.(*router).shutdownDelay = utils.Must(utils.ParseDuration(conf.Health.ShutdownDelay))
+	}
+	instance.(*router).streams.init(conf.Stream)
+	instance.(*router).sockets.init(conf.WebSocket)
 
 	locker.Lock()
 	defer locker.Unlock()
 	if len(conf.Asynq) > 0 {
 		initAsynq(ctx, opt.AppName, instance, conf.Asynq)
 	}
-	if _, ok := routers[opt.AppName]; ok {
-		panic(errors.Errorf("duplicated http name: %s", opt.AppName))
+	if routers[opt.AppName] == nil {
+		routers[opt.AppName] = make(map[string]IRouter)
 	}
-	routers[opt.AppName] = instance
-	if opt.AppName == "" {
+	if _, ok := routers[opt.AppName][name]; ok {
+		panic(errors.Errorf("duplicated http name: %s %s", opt.AppName, name))
+	}
+	routers[opt.AppName][name] = instance
+	if opt.AppName == "" && name == config.DefaultInstanceKey {
 		Router = instance
 	}
 
 	if opt.DI != nil {
-		opt.DI.MustProvide(func() IRouter { return Use(AppName(opt.AppName)) })
+		opt.DI.MustProvide(func() IRouter { return Use(Name(name), AppName(opt.AppName)) }, di.Name(name))
+		if name == config.DefaultInstanceKey {
+			opt.DI.MustProvide(func() IRouter { return Use(AppName(opt.AppName)) })
+		}
 	}
 
 	return func() {
 		locker.Lock()
 		defer locker.Unlock()
 		if routers != nil {
-			if router, ok := routers[opt.AppName]; ok {
+			if router, ok := routers[opt.AppName][name]; ok {
 				router.shutdown()
 				wg := new(sync.WaitGroup)
 				wg.Add(1)
@@ -152,15 +221,21 @@ func addRouter(ctx context.Context, conf Conf, logger resty.Logger, opt *config.
 				}
 			}
 
-			delete(routers, opt.AppName)
+			if delete(routers[opt.AppName], name); len(routers[opt.AppName]) == 0 {
+				delete(routers, opt.AppName)
+			}
 		}
-		if opt.AppName == "" {
+		delOpenAPI(opt.AppName, name)
+		if tracer != nil {
+			tracer.shutdown(context.Background())
+		}
+		if opt.AppName == "" && name == config.DefaultInstanceKey {
 			Router = nil
 		}
 	}
 }
 
-func addI18n(conf Conf, opt *config.InitOption) func() {
+func addI18n(confs map[string]*Conf, opt *config.InitOption) func() {
 	bundle := i18n.NewBundle[Errcode](i18n.DefaultLang(i18n.AppName(opt.AppName)))
 	errBundle := i18n.NewBundle[Error](i18n.DefaultLang(i18n.AppName(opt.AppName)))
 	if I18n == nil {
@@ -179,18 +254,31 @@ func addI18n(conf Conf, opt *config.InitOption) func() {
 	i18ns[opt.AppName] = bundle
 	i18nErrs[opt.AppName] = errBundle
 
-	// initialize http internal error
-	bundle.AddMessages(Errcode(conf.ErrorCode), map[language.Tag]*i18n.Message{
-		language.English: {Other: "Invalid request parameters{{.err}}"},
-		language.Chinese: {Other: "请求参数错误{{.err}}"},
-	}, i18n.Var("err"))
+	// initialize http internal error, servers may share the same codes
+	names := utils.MapKeys(confs)
+	sort.Strings(names)
+	shared := &sharedBundle{Localizable: bundle, added: utils.NewSet[Errcode]()}
+	for _, name := range names {
+		conf := *confs[name]
+		shared.AddMessages(Errcode(conf.ErrorCode), map[language.Tag]*i18n.Message{
+			language.English: {Other: "Invalid request parameters{{.err}}"},
+			language.Chinese: {Other: "请求参数错误{{.err}}"},
+		}, i18n.Var("err"))
+		addRateLimitI18n(shared, conf)
+		addAuthI18n(shared, conf)
+		addIdempotencyI18n(shared, conf)
+	}
 
 	if opt.DI != nil {
 		opt.DI.MustProvide(func() i18n.Localizable[Errcode] { return bundle })
 		opt.DI.MustProvide(func() i18n.Localizable[Error] { return errBundle })
 	}
 
-	errParam = Errcode(conf.ErrorCode)
+	if conf, ok := confs[config.DefaultInstanceKey]; ok {
+		errParam = Errcode(conf.ErrorCode)
+	} else if len(names) > 0 {
+		errParam = Errcode(confs[names[0]].ErrorCode)
+	}
 
 	ginBindingValidatorI18n(opt.AppName)
 
@@ -208,6 +296,21 @@ func addI18n(conf Conf, opt *config.InitOption) func() {
 	}
 }
 
+// sharedBundle adds the messages of a code only once
+type sharedBundle struct {
+	i18n.Localizable[Errcode]
+	added *utils.Set[Errcode]
+}
+
+func (s *sharedBundle) AddMessages(code Errcode, trans map[language.Tag]*i18n.Message,
+	opts ...utils.OptionExtender) i18n.Localizable[Errcode] {
+	if s.added.Contains(code) {
+		return s
+	}
+	s.added.Insert(code)
+	return s.Localizable.AddMessages(code, trans, opts...)
+}
+
 func addClient(ctx context.Context, conf Conf, logger resty.Logger, opt *config.InitOption) func() {
 	if _, ok := appClientCfgMap[opt.AppName]; !ok {
 		defaultCfg := &cfg{
@@ -226,6 +329,14 @@ func addClient(ctx context.Context, conf Conf, logger resty.Logger, opt *config.
 			appName: opt.AppName,
 			logger:  logger,
 		}
+		if len(cliConf.CA) > 0 || utils.IsStrNotBlank(cliConf.Cert) || utils.IsStrNotBlank(cliConf.Key) {
+			cliCfg.reloader = utils.Must(newCertReloader(opt.AppName, cliConf.Cert, cliConf.Key, cliConf.CA))
+			cliCfg.reloader.start(utils.Must(utils.ParseDuration(cliConf.ReloadInterval)))
+		}
+		cliCfg.resilience = newClientResilience(ctx, opt.AppName, name, cliConf)
+		if cliCfg.discovery = newClientDiscovery(ctx, opt.AppName, name, cliConf); cliCfg.discovery != nil {
+			cliCfg.discovery.start()
+		}
 		appClientCfgMap[opt.AppName][name] = cliCfg
 		if name == config.DefaultInstanceKey {
 			appClientCfgMap[opt.AppName][""] = cliCfg
@@ -249,6 +360,14 @@ func addClient(ctx context.Context, conf Conf, logger resty.Logger, opt *config.
 			delete(appClientMap, opt.AppName)
 		}
 		if appClientCfgMap != nil {
+			for _, cliCfg := range appClientCfgMap[opt.AppName] {
+				if cliCfg.reloader != nil {
+					cliCfg.reloader.close()
+				}
+				if cliCfg.discovery != nil {
+					cliCfg.discovery.close()
+				}
+			}
 			delete(appClientCfgMap, opt.AppName)
 		}
 		if opt.AppName == "" {
@@ -259,6 +378,7 @@ func addClient(ctx context.Context, conf Conf, logger resty.Logger, opt *config.
 
 type useOption struct {
 	appName string
+	name    string
 }
 
 func AppName(name string) utils.OptionFunc[useOption] {
@@ -267,14 +387,29 @@ func AppName(name string) utils.OptionFunc[useOption] {
 	}
 }
 
+// Name selects the named http server configured in servers, which is also the server middlewares like
+// Authenticate belong to, defaults to the default one
+func Name(name string) utils.OptionFunc[useOption] {
+	return func(o *useOption) {
+		o.name = name
+	}
+}
+
+func (o *useOption) serverName() string {
+	if utils.IsStrBlank(o.name) {
+		return config.DefaultInstanceKey
+	}
+	return o.name
+}
+
 func Use(opts ...utils.OptionExtender) IRouter {
 	opt := utils.ApplyOptions[useOption](opts...)
 	locker.RLock()
 	defer locker.RUnlock()
 
-	router, ok := routers[opt.appName]
+	router, ok := routers[opt.appName][opt.serverName()]
 	if !ok {
-		panic(errors.Errorf("router not found"))
+		panic(errors.Errorf("router not found: %s", opt.serverName()))
 	}
 	return router
 }
@@ -0,0 +1,317 @@
+package http
+
+import (
+	"context"
+	"hash/crc32"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/http/gracefully"
+	"github.com/wfusion/gofusion/kv"
+	"github.com/wfusion/gofusion/routine"
+)
+
+const (
+	balancerRoundRobin     = "round_robin"
+	balancerLeastInFlight  = "least_in_flight"
+	balancerConsistentHash = "consistent_hash"
+
+	// discoveryVirtualNodes is the number of virtual nodes of each instance on the consistent hash ring
+	discoveryVirtualNodes = 160
+)
+
+var (
+	// ErrClientNoServiceInstance is returned when the discovered service has no instance
+	ErrClientNoServiceInstance = errors.New("http client no service instance")
+)
+
+type discoveryInstance struct {
+	*kv.ServiceInstance
+	inFlight     atomic.Int64
+	failures     atomic.Int64
+	ejectedUntil atomic.Int64 // unix nano
+}
+
+func (i *discoveryInstance) ejected(now int64) bool {
+	return i.ejectedUntil.Load() > now
+}
+
+type discoveryRingNode struct {
+	hash     uint32
+	instance *discoveryInstance
+}
+
+// clientDiscovery is shared by resty clients created by the same client configure, so the balancer and the
+// outlier ejection count all requests of the client
+type clientDiscovery struct {
+	ctx          context.Context
+	appName      string
+	name         string
+	conf         clientDiscoveryConf
+	interval     time.Duration
+	ejectionTime time.Duration
+
+	mutex     sync.RWMutex
+	loaded    bool
+	instances []*discoveryInstance
+	ring      []*discoveryRingNode
+	counter   atomic.Uint64
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newClientDiscovery(ctx context.Context, appName, name string, conf *clientConf) *clientDiscovery {
+	if utils.IsStrBlank(conf.Discovery.Service) {
+		return nil
+	}
+	switch conf.Discovery.Balancer {
+	case balancerRoundRobin, balancerLeastInFlight, balancerConsistentHash:
+	default:
+		panic(errors.Errorf("unknown http client %s balancer: %s", name, conf.Discovery.Balancer))
+	}
+	return &clientDiscovery{
+		ctx:          ctx,
+		appName:      appName,
+		name:         name,
+		conf:         conf.Discovery,
+		interval:     utils.Must(utils.ParseDuration(conf.Discovery.RefreshInterval)),
+		ejectionTime: utils.Must(utils.ParseDuration(conf.Discovery.EjectionTime)),
+		closed:       make(chan struct{}),
+	}
+}
+
+// apply sets the base url as the service if not set and wraps the transport, it should be called before the
+// resilience is applied, so that retries and hedges may be sent to other instances
+func (d *clientDiscovery) apply(c *resty.Client) {
+	if utils.IsStrBlank(c.BaseURL) {
+		c.SetBaseURL(d.conf.Scheme + "://" + d.conf.Service)
+	}
+	c.SetTransport(&discoveryTransport{clientDiscovery: d, next: c.GetClient().Transport})
+}
+
+func (d *clientDiscovery) start() {
+	if d.interval > 0 {
+		routine.Go(d.watch, routine.AppName(d.appName))
+	}
+}
+
+func (d *clientDiscovery) watch() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closed:
+			return
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.refresh(d.ctx); err != nil {
+				log.Printf("%v [Gofusion] %s %s client %s refresh service %s failed: %s", syscall.Getpid(),
+					config.Use(d.appName).AppName(), config.ComponentHttp, d.name, d.conf.Service, err)
+			}
+		}
+	}
+}
+
+func (d *clientDiscovery) close() {
+	d.closeOnce.Do(func() { close(d.closed) })
+}
+
+// refresh resolves instances of the service, instances keep their in-flight counters and ejection states
+// across refreshes, and the previous instances are kept if resolving failed
+func (d *clientDiscovery) refresh(ctx context.Context) (err error) {
+	found, err := kv.ResolveService(ctx, d.conf.KV, d.conf.Service,
+		kv.AppName(d.appName), kv.ServicePrefix(d.conf.Prefix))
+	if err != nil {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	previous := make(map[string]*discoveryInstance, len(d.instances))
+	for _, ins := range d.instances {
+		previous[ins.ID] = ins
+	}
+	instances := make([]*discoveryInstance, 0, len(found))
+	for _, s := range found {
+		ins, ok := previous[s.ID]
+		if !ok || ins.Host() != s.Host() {
+			ins = &discoveryInstance{ServiceInstance: s}
+		}
+		instances = append(instances, ins)
+	}
+	d.instances = instances
+	d.loaded = true
+
+	if d.conf.Balancer != balancerConsistentHash {
+		return
+	}
+	d.ring = make([]*discoveryRingNode, 0, len(instances)*discoveryVirtualNodes)
+	for _, ins := range instances {
+		for i := 0; i < discoveryVirtualNodes; i++ {
+			d.ring = append(d.ring, &discoveryRingNode{
+				hash:     crc32.ChecksumIEEE([]byte(ins.ID + "#" + strconv.Itoa(i))),
+				instance: ins,
+			})
+		}
+	}
+	sort.Slice(d.ring, func(i, j int) bool { return d.ring[i].hash < d.ring[j].hash })
+	return
+}
+
+// pick chooses an instance by the balancer among instances not ejected, or among all instances if all of
+// them are ejected
+func (d *clientDiscovery) pick(req *http.Request) (ins *discoveryInstance, err error) {
+	d.mutex.RLock()
+	loaded := d.loaded
+	d.mutex.RUnlock()
+	if !loaded {
+		if err = d.refresh(req.Context()); err != nil {
+			return
+		}
+	}
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if len(d.instances) == 0 {
+		return nil, errors.Wrap(ErrClientNoServiceInstance, d.conf.Service)
+	}
+
+	now := time.Now().UnixNano()
+	if d.conf.Balancer == balancerConsistentHash {
+		return d.pickByHash(req, now), nil
+	}
+
+	candidates := make([]*discoveryInstance, 0, len(d.instances))
+	for _, ins := range d.instances {
+		if !ins.ejected(now) {
+			candidates = append(candidates, ins)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = d.instances
+	}
+
+	start := int((d.counter.Add(1) - 1) % uint64(len(candidates)))
+	if d.conf.Balancer == balancerRoundRobin {
+		return candidates[start], nil
+	}
+
+	// least in flight, ties are broken in turn
+	for i := 0; i < len(candidates); i++ {
+		candidate := candidates[(start+i)%len(candidates)]
+		if ins == nil || candidate.inFlight.Load() < ins.inFlight.Load() {
+			ins = candidate
+		}
+	}
+	return
+}
+
+func (d *clientDiscovery) pickByHash(req *http.Request, now int64) *discoveryInstance {
+	key := req.URL.Path
+	if utils.IsStrNotBlank(d.conf.HashHeader) {
+		if val := req.Header.Get(d.conf.HashHeader); utils.IsStrNotBlank(val) {
+			key = val
+		}
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(d.ring), func(i int) bool { return d.ring[i].hash >= hash })
+	for i := 0; i < len(d.ring); i++ {
+		if node := d.ring[(idx+i)%len(d.ring)]; !node.instance.ejected(now) {
+			return node.instance
+		}
+	}
+	return d.ring[idx%len(d.ring)].instance
+}
+
+// report ejects the instance for the ejection time after consecutive failures
+func (d *clientDiscovery) report(ins *discoveryInstance, success bool) {
+	if success {
+		ins.failures.Store(0)
+		return
+	}
+	if d.conf.MaxFailures <= 0 || ins.failures.Add(1) < int64(d.conf.MaxFailures) {
+		return
+	}
+	ins.failures.Store(0)
+	ins.ejectedUntil.Store(time.Now().Add(d.ejectionTime).UnixNano())
+	log.Printf("%v [Gofusion] %s %s client %s ejected service %s instance %s for %s", syscall.Getpid(),
+		config.Use(d.appName).AppName(), config.ComponentHttp, d.name, d.conf.Service, ins.ID, d.ejectionTime)
+}
+
+// discoveryTransport sends requests to the service host to one of the service instances
+type discoveryTransport struct {
+	*clientDiscovery
+	next http.RoundTripper
+}
+
+func (t *discoveryTransport) RoundTrip(req *http.Request) (rsp *http.Response, err error) {
+	if req.URL.Host != t.conf.Service {
+		return t.next.RoundTrip(req)
+	}
+	ins, err := t.pick(req)
+	if err != nil {
+		return
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Host = ins.Host()
+	req.Host = ""
+	ins.inFlight.Add(1)
+	rsp, err = t.next.RoundTrip(req)
+	// requests cancelled by the caller, e.g. hedges lost, are not failures of the instance
+	if req.Context().Err() == nil {
+		t.report(ins, err == nil && rsp.StatusCode < http.StatusInternalServerError)
+	}
+	if err != nil {
+		ins.inFlight.Add(-1)
+		return
+	}
+	rsp.Body = newOnCloseBody(rsp.Body, func() { ins.inFlight.Add(-1) })
+	return
+}
+
+// serveRegistry registers the server through kv when the server starts, and deregisters it before draining
+// readiness when the server shuts down, so it should be called before serveHealth
+func (r *router) serveRegistry(srv drainableServer) (err error) {
+	if !r.registry.Enable {
+		return
+	}
+
+	conf := r.registry
+	ins := &kv.ServiceInstance{Service: conf.Service, Address: conf.Address, Port: conf.Port, Meta: conf.Meta}
+	if utils.IsStrBlank(ins.Service) {
+		ins.Service = config.Use(r.appName).AppName()
+	}
+	if utils.IsStrBlank(ins.Address) {
+		ins.Address = utils.ClientIP()
+	}
+	if ins.Port == 0 {
+		ins.Port = r.Config().Port
+	}
+	deregister, err := kv.RegisterService(r.ctx, conf.KV, ins, kv.AppName(r.appName),
+		kv.ServiceTTL(utils.Must(utils.ParseDuration(conf.TTL))), kv.ServicePrefix(conf.Prefix))
+	if err != nil {
+		return
+	}
+
+	r.deregister = deregister
+	srv.RegisterOnShutdown(deregister)
+	for _, sig := range []os.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM} {
+		_ = srv.RegisterSignalHook(gracefully.PreSignal, sig, deregister)
+	}
+	return
+}
@@ -73,6 +73,7 @@ type endlessServer struct {
 	SignalHooks map[int]map[os.Signal][]func()
 	BeforeBegin func(addr string)
 	AppName     string
+	reloadHooks []func()
 
 	endlessListener  net.Listener
 	tlsInnerListener *endlessListener
@@ -317,6 +318,29 @@ func (e *endlessServer) RegisterSignalHook(prePost int, sig os.Signal, f func())
 	return
 }
 
+// RegisterReloadHook registers a function to be run on SIGHUP, e.g., reloading certificates. SIGHUP reloads the
+// server in place instead of forking a new process once any reload hook is registered
+func (e *endlessServer) RegisterReloadHook(f func()) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.reloadHooks = append(e.reloadHooks, f)
+}
+
+func (e *endlessServer) reloadable() bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return len(e.reloadHooks) > 0
+}
+
+func (e *endlessServer) reload() {
+	e.lock.RLock()
+	hooks := e.reloadHooks
+	e.lock.RUnlock()
+	for _, f := range hooks {
+		f()
+	}
+}
+
 // getListener either opens a new socket to listen on, or takes the acceptor socket
 // it got passed when restarted.
 func (e *endlessServer) getListener(addr string) (l net.Listener, err error) {
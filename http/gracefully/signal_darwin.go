@@ -68,6 +68,11 @@ func (e *endlessServer) handleSignals() {
 		e.signalHooks(PreSignal, sig)
 		switch sig {
 		case syscall.SIGHUP:
+			if e.reloadable() {
+				log.Println(pid, "[Common] endless received SIGHUP. reloading...")
+				e.reload()
+				break
+			}
 			signal.Stop(e.sigChan)
 			close(e.sigChan)
 			log.Println(pid, "[Common] endless received SIGHUP. forking...")
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/health"
+	"github.com/wfusion/gofusion/http/gracefully"
+)
+
+// drainableServer is the graceful server which drains readiness before shutting down
+type drainableServer interface {
+	RegisterOnShutdown(f func())
+	RegisterSignalHook(prePost int, sig os.Signal, f func()) error
+}
+
+func initHealth(engine *gin.Engine, appName string, conf healthConf) {
+	if !conf.Enable {
+		return
+	}
+
+	opts := []utils.OptionExtender{
+		health.AppName(appName),
+		health.Timeout(utils.Must(utils.ParseDuration(conf.Timeout))),
+		health.NonCritical(conf.NonCritical...),
+	}
+	probes := map[string]health.Probe{
+		conf.HealthzPath: health.ProbeHealth,
+		conf.ReadyzPath:  health.ProbeReadiness,
+		conf.LivezPath:   health.ProbeLiveness,
+	}
+	for path, probe := range probes {
+		if utils.IsStrBlank(path) {
+			continue
+		}
+		probe := probe
+		engine.GET(path, func(c *gin.Context) {
+			report := health.Check(c.Request.Context(), probe, opts...)
+			status := http.StatusOK
+			if report.Status == health.StatusDown {
+				status = http.StatusServiceUnavailable
+			}
+			c.Header("Cache-Control", "no-store")
+			c.JSON(status, report)
+		})
+	}
+}
+
+// serveHealth resumes readiness when the server starts, and drains it when the server shuts down
+func (r *router) serveHealth(srv drainableServer) {
+	health.Resume(health.AppName(r.appName))
+	srv.RegisterOnShutdown(r.drain)
+	for _, sig := range []os.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM} {
+		_ = srv.RegisterSignalHook(gracefully.PreSignal, sig, r.drain)
+	}
+}
+
+// drain fails readiness and waits for the shutdown delay, so load balancers stop routing before the
+// listener is closed
+func (r *router) drain() {
+	if health.Draining(health.AppName(r.appName)) {
+		return
+	}
+	health.Drain(health.AppName(r.appName))
+	if r.shutdownDelay > 0 {
+		time.Sleep(r.shutdownDelay)
+	}
+}
@@ -0,0 +1,529 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+
+	rdsDrv "github.com/redis/go-redis/v9"
+
+	"github.com/wfusion/gofusion/cache"
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/common/utils/serialize/json"
+	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/i18n"
+	"github.com/wfusion/gofusion/lock"
+	"github.com/wfusion/gofusion/redis"
+
+	fusCtx "github.com/wfusion/gofusion/context"
+)
+
+const (
+	// HeaderIdempotentReplayed is set on the responses replayed from the idempotency store
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	localIdempotencySize     = 1 << 16
+	idempotencyRetryWaitTime = 100 * time.Millisecond
+)
+
+var (
+	idempotencyLocker  sync.RWMutex
+	appIdempotencies   = map[string]map[string]*idempotency{}
+	idempotencySkipped = utils.NewSet(
+		"Content-Length", "Date", "Transfer-Encoding", "Connection", HeaderIdempotentReplayed)
+)
+
+type idempotencyRule struct {
+	ttl         time.Duration
+	waitTimeout time.Duration
+	disable     bool
+}
+
+// idempotentResponse the first response of an idempotency key
+type idempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+type idempotencyStore interface {
+	get(ctx context.Context, key string) (rsp *idempotentResponse, err error)
+	set(ctx context.Context, key string, rsp *idempotentResponse, ttl time.Duration) (err error)
+}
+
+type idempotency struct {
+	appName      string
+	header       string
+	errorCode    Errcode
+	mismatchCode Errcode
+	lockExpire   time.Duration
+	ttl          time.Duration
+	waitTimeout  time.Duration
+	rule         *idempotencyRule
+	methods      *utils.Set[string]
+	whiteList    *utils.Set[string]
+	store        idempotencyStore
+	locker       lock.Lockable
+}
+
+func addIdempotency(ctx context.Context, name string, conf Conf, opt *config.InitOption) func() {
+	ic := conf.Idempotency
+	methods := make([]string, 0, len(ic.Methods))
+	for _, method := range ic.Methods {
+		methods = append(methods, strings.ToUpper(method))
+	}
+	i := &idempotency{
+		appName:      opt.AppName,
+		header:       ic.Header,
+		errorCode:    Errcode(ic.ErrorCode),
+		mismatchCode: Errcode(ic.MismatchCode),
+		lockExpire:   utils.Must(utils.ParseDuration(ic.LockExpire)),
+		ttl:          utils.Must(utils.ParseDuration(ic.TTL)),
+		waitTimeout:  utils.Must(utils.ParseDuration(ic.WaitTimeout)),
+		methods:      utils.NewSet(methods...),
+		whiteList:    utils.NewSet(ic.WhiteURLList...),
+	}
+	if ic.Enable {
+		i.rule = &idempotencyRule{ttl: i.ttl, waitTimeout: i.waitTimeout}
+	}
+	utils.MustSuccess((&idempotencyRule{ttl: i.ttl, waitTimeout: i.waitTimeout}).check())
+
+	switch {
+	case utils.IsStrBlank(ic.Instance):
+		i.store = newLocalIdempotencyStore()
+	case ic.InstanceType == instanceTypeRedis:
+		i.store = newRedisIdempotencyStore(ctx, opt.AppName, ic.Instance)
+	case ic.InstanceType == instanceTypeCache:
+		i.store = newCacheIdempotencyStore(opt.AppName, ic.Instance)
+	default:
+		panic(errors.Errorf("unknown idempotency instance type: %+v", ic.InstanceType))
+	}
+	if utils.IsStrBlank(ic.LockInstance) {
+		i.locker = newLocalIdempotencyLocker()
+	} else {
+		i.locker = lock.Use(ic.LockInstance, lock.AppName(opt.AppName))
+	}
+
+	idempotencyLocker.Lock()
+	defer idempotencyLocker.Unlock()
+	if appIdempotencies[opt.AppName] == nil {
+		appIdempotencies[opt.AppName] = make(map[string]*idempotency)
+	}
+	appIdempotencies[opt.AppName][name] = i
+
+	return func() {
+		idempotencyLocker.Lock()
+		defer idempotencyLocker.Unlock()
+		if delete(appIdempotencies[opt.AppName], name); len(appIdempotencies[opt.AppName]) == 0 {
+			delete(appIdempotencies, opt.AppName)
+		}
+	}
+}
+
+func addIdempotencyI18n(bundle i18n.Localizable[Errcode], conf Conf) {
+	if conf.Idempotency.ErrorCode != conf.ErrorCode {
+		bundle.AddMessages(Errcode(conf.Idempotency.ErrorCode), map[language.Tag]*i18n.Message{
+			language.English: {Other: "A request with the same idempotency key is being processed"},
+			language.Chinese: {Other: "相同幂等键的请求正在处理中"},
+		})
+	}
+	if conf.Idempotency.MismatchCode != conf.ErrorCode {
+		bundle.AddMessages(Errcode(conf.Idempotency.MismatchCode), map[language.Tag]*i18n.Message{
+			language.English: {Other: "Idempotency key was reused with a different request"},
+			language.Chinese: {Other: "幂等键已被用于不同的请求"},
+		})
+	}
+}
+
+func getIdempotency(appName, name string) *idempotency {
+	idempotencyLocker.RLock()
+	defer idempotencyLocker.RUnlock()
+	return appIdempotencies[appName][name]
+}
+
+// handler returns the idempotency handler of the route, the route rule overrides the global one
+func (i *idempotency) handler(rule *idempotencyRule) gin.HandlerFunc {
+	routeScoped := rule != nil
+	if rule == nil {
+		rule = i.rule
+	} else if !rule.disable {
+		// unset route values fall back to the global ones
+		merged := &idempotencyRule{ttl: i.ttl, waitTimeout: i.waitTimeout}
+		if rule.ttl > 0 {
+			merged.ttl = rule.ttl
+		}
+		if rule.waitTimeout > 0 {
+			merged.waitTimeout = rule.waitTimeout
+		}
+		rule = merged
+	}
+	if rule == nil || rule.disable {
+		return nil
+	}
+
+	return func(c *gin.Context) {
+		idempotencyKey := c.GetHeader(i.header)
+		switch {
+		case utils.IsStrBlank(idempotencyKey),
+			!routeScoped && !i.methods.Contains(c.Request.Method),
+			i.whiteList.Contains(c.FullPath()) || i.whiteList.Contains(c.Request.URL.Path):
+			c.Next()
+			return
+		}
+
+		fingerprint, err := i.fingerprint(c)
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			rspError(c, i.appName, errParam, nil, 0, 0, Err(c, errParam, Param(map[string]any{
+				"err": fmt.Sprintf(": %s", err),
+			})).Error())
+			c.Abort()
+			return
+		}
+
+		key := i.formatKey(c, idempotencyKey)
+		locked, replayed := i.acquire(c, key, fingerprint, rule)
+		if replayed {
+			c.Abort()
+			return
+		}
+		if !locked {
+			c.Next()
+			return
+		}
+		defer func() {
+			if err := i.locker.Unlock(context.Background(), key); err != nil {
+				i.logf("unlock idempotency key %s failed: %s", key, err)
+			}
+		}()
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer, body: new(bytes.Buffer)}
+		c.Writer = writer
+		defer func() { c.Writer = writer.ResponseWriter }()
+
+		c.Next()
+
+		// server errors and streaming responses are not replayable, retries should execute again
+		status := writer.Status()
+		if status >= http.StatusInternalServerError ||
+			strings.HasPrefix(writer.Header().Get("Content-Type"), "text/event-stream") {
+			return
+		}
+		rsp := &idempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      status,
+			Header:      make(http.Header, len(writer.Header())),
+			Body:        writer.body.Bytes(),
+		}
+		for k, v := range writer.Header() {
+			if !idempotencySkipped.Contains(http.CanonicalHeaderKey(k)) {
+				rsp.Header[k] = v
+			}
+		}
+		if err := i.store.set(context.Background(), key, rsp, rule.ttl); err != nil {
+			i.logf("store idempotent response of %s failed: %s", key, err)
+		}
+	}
+}
+
+// acquire replays the stored response or locks the key, concurrent duplicates wait for the first request
+// until the wait timeout, then the 409 conflict is responded
+func (i *idempotency) acquire(c *gin.Context, key, fingerprint string, rule *idempotencyRule) (
+	locked, replayed bool) {
+	var deadline <-chan time.Time
+	if rule.waitTimeout > 0 {
+		timer := time.NewTimer(rule.waitTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		rsp, err := i.store.get(c, key)
+		if err != nil {
+			// fail open when the store backend is unavailable
+			i.logf("get idempotent response of %s failed: %s", key, err)
+			return
+		}
+		if rsp != nil {
+			i.replay(c, rsp, fingerprint)
+			return false, true
+		}
+
+		switch err = i.locker.Lock(c, key, lock.Expire(i.lockExpire)); {
+		case err == nil:
+			// the first request may finish between the lookup and locking
+			if rsp, err = i.store.get(c, key); err == nil && rsp != nil {
+				_ = i.locker.Unlock(context.Background(), key)
+				i.replay(c, rsp, fingerprint)
+				return false, true
+			}
+			return true, false
+		case !errors.Is(err, lock.ErrTimeout):
+			i.logf("lock idempotency key %s failed: %s", key, err)
+			return
+		}
+
+		if deadline == nil {
+			i.conflict(c)
+			return false, true
+		}
+		select {
+		case <-deadline:
+			i.conflict(c)
+			return false, true
+		case <-c.Request.Context().Done():
+			i.conflict(c)
+			return false, true
+		case <-time.After(idempotencyRetryWaitTime):
+		}
+	}
+}
+
+func (i *idempotency) replay(c *gin.Context, rsp *idempotentResponse, fingerprint string) {
+	if rsp.Fingerprint != fingerprint {
+		c.Status(http.StatusUnprocessableEntity)
+		rspError(c, i.appName, i.mismatchCode, nil, 0, 0, Err(c, i.mismatchCode).Error())
+		return
+	}
+
+	// headers written by the current request, e.g., trace id, take precedence over the stored ones
+	header := c.Writer.Header()
+	for k, v := range rsp.Header {
+		if _, ok := header[k]; !ok {
+			header[k] = v
+		}
+	}
+	header.Set(HeaderIdempotentReplayed, "true")
+	c.Status(rsp.Status)
+	_, _ = c.Writer.Write(rsp.Body)
+}
+
+func (i *idempotency) conflict(c *gin.Context) {
+	c.Status(http.StatusConflict)
+	rspError(c, i.appName, i.errorCode, nil, 0, 0, Err(c, i.errorCode).Error())
+}
+
+// fingerprint digests the request query and body to detect the key reused with a different request
+func (i *idempotency) fingerprint(c *gin.Context) (fingerprint string, err error) {
+	h := sha256.New()
+	_, _ = h.Write([]byte(c.Request.URL.RawQuery))
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return "", err
+		}
+		_ = c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		_, _ = h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (i *idempotency) formatKey(c *gin.Context, idempotencyKey string) string {
+	route := c.FullPath()
+	if utils.IsStrBlank(route) {
+		route = c.Request.URL.Path
+	}
+	return fmt.Sprintf("%s:idempotency:%s:%s:%s:%s", config.Use(i.appName).AppName(),
+		c.Request.Method, route, fusCtx.GetUserID(c), idempotencyKey)
+}
+
+func (i *idempotency) logf(format string, args ...any) {
+	pid := syscall.Getpid()
+	app := config.Use(i.appName).AppName()
+	log.Printf("%v [Gofusion] %s %s "+format, append([]any{pid, app, config.ComponentHttp}, args...)...)
+}
+
+func (r *idempotencyRule) check() error {
+	if r.disable {
+		return nil
+	}
+	if r.ttl <= 0 {
+		return errors.Errorf("idempotency ttl should be positive [ttl[%s]]", r.ttl)
+	}
+	if r.waitTimeout < 0 {
+		return errors.Errorf("idempotency wait timeout should not be negative [wait_timeout[%s]]", r.waitTimeout)
+	}
+	return nil
+}
+
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+type localIdempotencyStore struct {
+	entries gcache.Cache
+}
+
+func newLocalIdempotencyStore() idempotencyStore {
+	return &localIdempotencyStore{entries: gcache.New(localIdempotencySize).LRU().Build()}
+}
+
+func (l *localIdempotencyStore) get(_ context.Context, key string) (rsp *idempotentResponse, err error) {
+	v, err := l.entries.Get(key)
+	if errors.Is(err, gcache.KeyNotFoundError) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	return v.(*idempotentResponse), nil
+}
+
+func (l *localIdempotencyStore) set(_ context.Context, key string, rsp *idempotentResponse,
+	ttl time.Duration) (err error) {
+	return l.entries.SetWithExpire(key, rsp, ttl)
+}
+
+type redisIdempotencyStore struct {
+	ctx       context.Context
+	appName   string
+	redisName string
+}
+
+func newRedisIdempotencyStore(ctx context.Context, appName, redisName string) idempotencyStore {
+	return &redisIdempotencyStore{ctx: ctx, appName: appName, redisName: redisName}
+}
+
+func (r *redisIdempotencyStore) get(ctx context.Context, key string) (rsp *idempotentResponse, err error) {
+	bs, err := redis.Use(ctx, r.redisName, redis.AppName(r.appName)).Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, rdsDrv.Nil) {
+			err = nil
+		}
+		return
+	}
+	rsp = new(idempotentResponse)
+	if err = json.Unmarshal(bs, rsp); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (r *redisIdempotencyStore) set(ctx context.Context, key string, rsp *idempotentResponse,
+	ttl time.Duration) (err error) {
+	bs, err := json.Marshal(rsp)
+	if err != nil {
+		return
+	}
+	return redis.Use(ctx, r.redisName, redis.AppName(r.appName)).Set(ctx, key, bs, ttl).Err()
+}
+
+type cacheIdempotencyStore struct {
+	entries cache.Cachable[string, *idempotentResponse, []*idempotentResponse]
+}
+
+func newCacheIdempotencyStore(appName, cacheName string) idempotencyStore {
+	return &cacheIdempotencyStore{
+		entries: cache.New[string, *idempotentResponse, []*idempotentResponse](cacheName, cache.AppName(appName)),
+	}
+}
+
+func (c *cacheIdempotencyStore) get(ctx context.Context, key string) (rsp *idempotentResponse, err error) {
+	if rs := c.entries.Get(ctx, []string{key}, nil); len(rs) > 0 {
+		rsp = rs[0]
+	}
+	return
+}
+
+func (c *cacheIdempotencyStore) set(ctx context.Context, key string, rsp *idempotentResponse,
+	ttl time.Duration) (err error) {
+	failure := c.entries.Set(ctx, map[string]*idempotentResponse{key: rsp}, cache.Expired[string](ttl))
+	if len(failure) > 0 {
+		return errors.Errorf("set idempotent response into cache failed: %s", key)
+	}
+	return
+}
+
+// localIdempotencyLocker in-process locker used when no lock instance is configured
+type localIdempotencyLocker struct {
+	mutex sync.Mutex
+	keys  map[string]struct{}
+}
+
+func newLocalIdempotencyLocker() lock.Lockable {
+	return &localIdempotencyLocker{keys: make(map[string]struct{})}
+}
+
+func (l *localIdempotencyLocker) Lock(_ context.Context, key string, _ ...utils.OptionExtender) (err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, ok := l.keys[key]; ok {
+		return lock.ErrTimeout
+	}
+	l.keys[key] = struct{}{}
+	return
+}
+
+func (l *localIdempotencyLocker) Unlock(_ context.Context, key string, _ ...utils.OptionExtender) (err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.keys, key)
+	return
+}
+
+type idempotencyOption struct {
+	ttl         time.Duration
+	waitTimeout time.Duration
+}
+
+// IdempotencyTTL how long the first response of the route is replayed, defaults to the global ttl
+func IdempotencyTTL(ttl time.Duration) utils.OptionFunc[idempotencyOption] {
+	return func(o *idempotencyOption) {
+		o.ttl = ttl
+	}
+}
+
+// IdempotencyWait concurrent duplicates of the route wait for the first request at most timeout
+// instead of responding 409 conflict immediately
+func IdempotencyWait(timeout time.Duration) utils.OptionFunc[idempotencyOption] {
+	return func(o *idempotencyOption) {
+		o.waitTimeout = timeout
+	}
+}
+
+// Idempotent enables the idempotency key of the route whatever the request method is
+func Idempotent(opts ...utils.OptionExtender) utils.OptionFunc[routerOption] {
+	opt := utils.ApplyOptions[idempotencyOption](opts...)
+	rule := &idempotencyRule{ttl: opt.ttl, waitTimeout: opt.waitTimeout}
+	if rule.ttl < 0 || rule.waitTimeout < 0 {
+		panic(errors.Errorf("idempotency ttl and wait timeout should not be negative [ttl[%s] wait_timeout[%s]]",
+			rule.ttl, rule.waitTimeout))
+	}
+	return func(o *routerOption) {
+		o.idempotency = rule
+	}
+}
+
+// NoIdempotency disables the global idempotency key of the route
+func NoIdempotency() utils.OptionFunc[routerOption] {
+	return func(o *routerOption) {
+		o.idempotency = &idempotencyRule{disable: true}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/iancoleman/strcase"
+	"github.com/sony/gobreaker"
 	"github.com/spf13/cast"
 
 	"github.com/wfusion/gofusion/common/utils"
@@ -13,7 +14,8 @@ import (
 )
 
 var (
-	metricsCodeTotalKey = []string{"http", "code", "total"}
+	metricsCodeTotalKey          = []string{"http", "code", "total"}
+	metricsClientBreakerStateKey = []string{"http", "client", "breaker", "state"}
 )
 
 func metricsCode(ctx context.Context, appName, path, method string, headerLabels map[string]string,
@@ -58,3 +60,31 @@ func metricsCode(ctx context.Context, appName, path, method string, headerLabels
 		}
 	})
 }
+
+// metricsClientBreaker exports the circuit breaker state of a client, 0 closed, 1 half-open, 2 open
+func metricsClientBreaker(ctx context.Context, appName, name string, state gobreaker.State) {
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+
+	_, _ = utils.Catch(func() {
+		app := config.Use(appName).AppName()
+		labels := []metrics.Label{{Key: "client", Value: name}}
+
+		stateKey := append([]string{app}, metricsClientBreakerStateKey...)
+		for _, m := range metrics.Internal(metrics.AppName(appName)) {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				if m.IsEnableServiceLabel() {
+					m.SetGauge(ctx, stateKey, float64(state), metrics.Labels(labels))
+				} else {
+					m.SetGauge(ctx, metricsClientBreakerStateKey, float64(state), metrics.Labels(labels))
+				}
+			}
+		}
+	})
+}
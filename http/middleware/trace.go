@@ -1,11 +1,23 @@
 package middleware
 
 import (
+	"fmt"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/wfusion/gofusion/common/utils"
 
 	fusCtx "github.com/wfusion/gofusion/context"
+	fusLog "github.com/wfusion/gofusion/log"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+const (
+	tracerName = "github.com/wfusion/gofusion/http"
 )
 
 func Trace() gin.HandlerFunc {
@@ -45,3 +57,62 @@ func Trace() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// Tracing creates an opentelemetry server span for each request named by the route template,
+// the span trace id overrides the trace id resolved by Trace
+func Tracing(tp trace.TracerProvider, propagator propagation.TextMapPropagator,
+	excludePaths []string) gin.HandlerFunc {
+	tracer := tp.Tracer(tracerName)
+	excludes := utils.NewSet(excludePaths...)
+	return func(c *gin.Context) {
+		if excludes.Contains(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		route := c.FullPath()
+		spanName := c.Request.Method
+		if route != "" {
+			spanName = fmt.Sprintf("%s %s", c.Request.Method, route)
+		}
+
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracer.Start(ctx, spanName,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.HTTPRoute(route),
+				semconv.ClientAddress(c.ClientIP()),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			traceID := sc.TraceID().String()
+			c.Header("traceid", traceID)
+			c.Set(fusCtx.KeyTraceID, traceID)
+
+			fields := fusLog.Fields{"span_id": sc.SpanID().String()}
+			if v, ok := c.Get(fusCtx.KeyLogFields); ok {
+				if fs, ok := v.(fusLog.Fields); ok {
+					fields = utils.MapMerge(fs, fields)
+				}
+			}
+			c.Set(fusCtx.KeyLogFields, fields)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		for _, err := range c.Errors {
+			span.RecordError(err.Err)
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -0,0 +1,606 @@
+package http
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+
+	"github.com/wfusion/gofusion/common/constant"
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/i18n"
+)
+
+var (
+	//go:embed swagger.html
+	swaggerUIHTML     string
+	swaggerUITemplate = template.Must(template.New("swagger").Parse(swaggerUIHTML))
+
+	openAPILocker sync.RWMutex
+	appOpenAPIs   = map[string]map[string][]*openAPIRoute{}
+
+	openAPIPathParamRegexp = regexp.MustCompile(`[:*]([^/]+)`)
+	openAPINameRegexp      = regexp.MustCompile(`[^a-zA-Z0-9.\-_]`)
+
+	timeType           = reflect.TypeOf(time.Time{})
+	durationType       = reflect.TypeOf(time.Duration(0))
+	fileHeaderType     = reflect.TypeOf(multipart.FileHeader{})
+	openAPIAnyMethods  = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	openAPIRspDataName = map[string]bool{"data": true, "Data": true}
+)
+
+type openAPIDoc struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       openAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*openAPIOp `json:"paths"`
+	Components openAPIComponents                `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+type openAPIOp struct {
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+	Parameters  []*openAPIParam             `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParam struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Default              any                       `json:"default,omitempty"`
+	Enum                 []any                     `json:"enum,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+}
+
+type openAPIRoute struct {
+	method  string
+	path    string
+	handler reflect.Type
+	parse   parseFrom
+	opt     *apiDocOption
+}
+
+type apiDocOption struct {
+	ignore      bool
+	summary     string
+	description string
+	tags        []string
+	deprecated  bool
+}
+
+// APISummary openapi operation summary of the route
+func APISummary(summary string) utils.OptionFunc[routerOption] {
+	return func(o *routerOption) {
+		o.apiDoc.summary = summary
+	}
+}
+
+// APIDescription openapi operation description of the route
+func APIDescription(description string) utils.OptionFunc[routerOption] {
+	return func(o *routerOption) {
+		o.apiDoc.description = description
+	}
+}
+
+// APITags openapi operation tags of the route
+func APITags(tags ...string) utils.OptionFunc[routerOption] {
+	return func(o *routerOption) {
+		o.apiDoc.tags = tags
+	}
+}
+
+// APIDeprecated marks the openapi operation of the route as deprecated
+func APIDeprecated() utils.OptionFunc[routerOption] {
+	return func(o *routerOption) {
+		o.apiDoc.deprecated = true
+	}
+}
+
+// APIIgnore excludes the route from the openapi document
+func APIIgnore() utils.OptionFunc[routerOption] {
+	return func(o *routerOption) {
+		o.apiDoc.ignore = true
+	}
+}
+
+func addOpenAPIRoute(appName, name, method, path string, handler routerHandler, opt *routerOption) {
+	if opt.apiDoc.ignore {
+		return
+	}
+
+	parse := opt.parseFrom
+	if parse == 0 {
+		parse = parseFromQuery
+		if methodWithBody[method] {
+			parse = parseFromBody
+		}
+	}
+
+	openAPILocker.Lock()
+	defer openAPILocker.Unlock()
+	if appOpenAPIs[appName] == nil {
+		appOpenAPIs[appName] = make(map[string][]*openAPIRoute)
+	}
+	appOpenAPIs[appName][name] = append(appOpenAPIs[appName][name], &openAPIRoute{
+		method:  method,
+		path:    path,
+		handler: reflect.TypeOf(handler),
+		parse:   parse,
+		opt:     &opt.apiDoc,
+	})
+}
+
+func initOpenAPI(engine *gin.Engine, appName, name string, conf openAPIConf) {
+	if !conf.Enable {
+		return
+	}
+
+	engine.GET(conf.Path, func(c *gin.Context) {
+		// routes are registered after the router constructed, so build the document lazily
+		c.JSON(http.StatusOK, newOpenAPIBuilder(appName, name).build(conf))
+	})
+	if !conf.SwaggerUI {
+		return
+	}
+
+	page := new(bytes.Buffer)
+	utils.MustSuccess(swaggerUITemplate.Execute(page, map[string]string{
+		"Title":    conf.Title,
+		"Asset":    strings.TrimSuffix(conf.SwaggerUIAsset, "/"),
+		"SpecPath": conf.Path,
+	}))
+	engine.GET(conf.SwaggerUIPath, func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+	})
+}
+
+func delOpenAPI(appName, name string) {
+	openAPILocker.Lock()
+	defer openAPILocker.Unlock()
+	if delete(appOpenAPIs[appName], name); len(appOpenAPIs[appName]) == 0 {
+		delete(appOpenAPIs, appName)
+	}
+}
+
+type openAPIBuilder struct {
+	appName string
+	name    string
+	schemas map[string]*openAPISchema
+	names   map[reflect.Type]string
+}
+
+func newOpenAPIBuilder(appName, name string) *openAPIBuilder {
+	return &openAPIBuilder{
+		appName: appName,
+		name:    name,
+		schemas: make(map[string]*openAPISchema),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+func (b *openAPIBuilder) build(conf openAPIConf) (doc *openAPIDoc) {
+	title := conf.Title
+	if utils.IsStrBlank(title) {
+		title = config.Use(b.appName).AppName()
+	}
+	doc = &openAPIDoc{
+		OpenAPI:    "3.0.3",
+		Info:       openAPIInfo{Title: title, Description: conf.Description, Version: conf.Version},
+		Paths:      make(map[string]map[string]*openAPIOp),
+		Components: openAPIComponents{Schemas: b.schemas},
+	}
+	b.schemas["Errcode"] = b.errcodeSchema()
+
+	openAPILocker.RLock()
+	routes := appOpenAPIs[b.appName][b.name]
+	openAPILocker.RUnlock()
+	for _, route := range routes {
+		path := openAPIPathParamRegexp.ReplaceAllString(route.path, "{$1}")
+		if _, ok := doc.Paths[path]; !ok {
+			doc.Paths[path] = make(map[string]*openAPIOp)
+		}
+
+		methods := []string{route.method}
+		switch route.method {
+		case "Any":
+			methods = openAPIAnyMethods
+		case "Handle":
+			methods = []string{http.MethodHead}
+		}
+		for _, method := range methods {
+			doc.Paths[path][strings.ToLower(method)] = b.operation(route)
+		}
+	}
+	return
+}
+
+func (b *openAPIBuilder) operation(route *openAPIRoute) (op *openAPIOp) {
+	op = &openAPIOp{
+		Summary:     route.opt.summary,
+		Description: route.opt.description,
+		Tags:        route.opt.tags,
+		Deprecated:  route.opt.deprecated,
+		Responses:   make(map[string]*openAPIResponse),
+	}
+
+	typ := route.handler
+	pathParams := utils.NewSet[string]()
+	for _, match := range openAPIPathParamRegexp.FindAllStringSubmatch(route.path, -1) {
+		pathParams.Insert(match[1])
+	}
+	if (typ.NumIn() == 2 && typ.In(1) != sseWriterType) || typ.NumIn() == 3 {
+		var params []*openAPIParam
+		reqType := utils.IndirectType(typ.In(1))
+		switch route.parse {
+		case parseFromBody:
+			params = b.parameters(reqType, true)
+			op.RequestBody = b.requestBody(reqType)
+		default:
+			params = b.parameters(reqType, false)
+		}
+		for _, p := range params {
+			if p.In != "path" {
+				op.Parameters = append(op.Parameters, p)
+			} else if pathParams.Contains(p.Name) {
+				op.Parameters = append(op.Parameters, p)
+				pathParams.Remove(p.Name)
+			}
+		}
+	}
+	for _, name := range pathParams.Items() {
+		op.Parameters = append(op.Parameters, &openAPIParam{
+			Name: name, In: "path", Required: true, Schema: &openAPISchema{Type: "string"},
+		})
+	}
+
+	// stream handler emits text/event-stream with event data
+	if isStreamHandler(typ) {
+		data := &openAPISchema{}
+		if typ.NumOut() == 2 && typ.Out(0).Elem() != sseEventType {
+			data = b.schema(typ.Out(0).Elem())
+		}
+		op.Responses["200"] = &openAPIResponse{
+			Description: "OK",
+			Content:     map[string]*openAPIMediaType{"text/event-stream": {Schema: data}},
+		}
+		op.Responses["default"] = &openAPIResponse{
+			Description: "Error",
+			Content:     map[string]*openAPIMediaType{gin.MIMEJSON: {Schema: b.envelope(nil, true)}},
+		}
+		return
+	}
+
+	// native gin handler writes response by itself
+	if typ.NumOut() == 0 {
+		op.Responses["200"] = &openAPIResponse{Description: "OK"}
+		return
+	}
+	op.Responses["200"] = &openAPIResponse{
+		Description: "OK",
+		Content:     map[string]*openAPIMediaType{gin.MIMEJSON: {Schema: b.responseSchema(typ)}},
+	}
+	op.Responses["default"] = &openAPIResponse{
+		Description: "Error",
+		Content:     map[string]*openAPIMediaType{gin.MIMEJSON: {Schema: b.envelope(nil, true)}},
+	}
+	return
+}
+
+func (b *openAPIBuilder) parameters(typ reflect.Type, uriOnly bool) (params []*openAPIParam) {
+	if typ.Kind() != reflect.Struct {
+		return
+	}
+	b.travelFields(typ, func(f reflect.StructField) {
+		in, name := "", ""
+		switch {
+		case f.Tag.Get("uri") != "":
+			in, name = "path", b.tagName(f.Tag.Get("uri"))
+		case uriOnly:
+			return
+		case f.Tag.Get("form") != "":
+			in, name = "query", b.tagName(f.Tag.Get("form"))
+		case f.Tag.Get("json") != "":
+			in, name = "query", b.tagName(f.Tag.Get("json"))
+		default:
+			in, name = "query", f.Name
+		}
+		if name == "-" {
+			return
+		}
+		schema := b.fieldSchema(f)
+		params = append(params, &openAPIParam{
+			Name:        name,
+			In:          in,
+			Description: schema.Description,
+			Required:    in == "path" || b.isRequired(f),
+			Schema:      schema,
+		})
+	})
+	return
+}
+
+func (b *openAPIBuilder) requestBody(typ reflect.Type) (body *openAPIRequestBody) {
+	body = &openAPIRequestBody{Required: true, Content: make(map[string]*openAPIMediaType)}
+	if typ.Kind() != reflect.Struct {
+		body.Content[gin.MIMEJSON] = &openAPIMediaType{Schema: b.schema(typ)}
+		return
+	}
+
+	hasFile := false
+	b.travelFields(typ, func(f reflect.StructField) {
+		hasFile = hasFile || b.isFile(f.Type)
+	})
+	if hasFile {
+		body.Content[gin.MIMEMultipartPOSTForm] = &openAPIMediaType{Schema: b.objectSchema(typ, "form")}
+		return
+	}
+	body.Content[gin.MIMEJSON] = &openAPIMediaType{Schema: b.schema(typ)}
+	body.Content[gin.MIMEPOSTForm] = &openAPIMediaType{Schema: b.objectSchema(typ, "form")}
+	return
+}
+
+func (b *openAPIBuilder) responseSchema(typ reflect.Type) *openAPISchema {
+	if typ.NumOut() == 1 {
+		return b.envelope(nil, false)
+	}
+
+	rspType := typ.Out(0)
+	indirect := utils.IndirectType(rspType)
+	if utils.EmbedsType(indirect, embedType) || utils.EmbedsType(indirect, responseType) {
+		return b.schema(rspType)
+	}
+	if typ.NumOut() == 2 && indirect.Kind() == reflect.Struct {
+		// response struct with data field is parsed as {Data any; Page, Count int; Msg string}
+		if f, ok := indirect.FieldByNameFunc(func(s string) bool { return openAPIRspDataName[s] }); ok {
+			return b.envelope(b.schema(f.Type), false)
+		}
+	}
+	return b.envelope(b.schema(rspType), false)
+}
+
+func (b *openAPIBuilder) envelope(data *openAPISchema, isErr bool) *openAPISchema {
+	code := &openAPISchema{Type: "integer"}
+	if isErr {
+		code = &openAPISchema{Ref: "#/components/schemas/Errcode"}
+	}
+	if data == nil {
+		data = &openAPISchema{Nullable: true}
+	}
+	return &openAPISchema{
+		Type: "object",
+		Properties: map[string]*openAPISchema{
+			"code":    code,
+			"message": {Type: "string"},
+			"data":    data,
+			"page":    {Type: "integer"},
+			"count":   {Type: "integer"},
+			"traceid": {Type: "string"},
+		},
+		Required: []string{"code", "message", "data", "traceid"},
+	}
+}
+
+func (b *openAPIBuilder) errcodeSchema() (schema *openAPISchema) {
+	locker.RLock()
+	errcodes, errs := i18ns[b.appName], i18nErrs[b.appName]
+	locker.RUnlock()
+
+	codes := make(map[int]string)
+	if enum, ok := errcodes.(i18n.Enumerable[Errcode]); ok {
+		for _, code := range enum.Codes() {
+			codes[int(code)] = errcodes.Localize(code)
+		}
+	}
+	if enum, ok := errs.(i18n.Enumerable[Error]); ok {
+		for _, e := range enum.Codes() {
+			codes[int(e.Code)] = errs.Localize(e)
+		}
+	}
+
+	keys := utils.MapKeys(codes)
+	sort.Ints(keys)
+	schema = &openAPISchema{Type: "integer"}
+	lines := make([]string, 0, len(keys))
+	for _, code := range keys {
+		schema.Enum = append(schema.Enum, code)
+		lines = append(lines, cast.ToString(code)+": "+codes[code])
+	}
+	schema.Description = strings.Join(lines, constant.LineBreak)
+	return
+}
+
+func (b *openAPIBuilder) schema(typ reflect.Type) *openAPISchema {
+	nullable := false
+	for typ.Kind() == reflect.Ptr {
+		typ, nullable = typ.Elem(), true
+	}
+
+	var schema *openAPISchema
+	switch {
+	case typ == timeType:
+		schema = &openAPISchema{Type: "string", Format: "date-time"}
+	case typ == durationType:
+		schema = &openAPISchema{Type: "integer", Format: "int64"}
+	case typ == fileHeaderType:
+		schema = &openAPISchema{Type: "string", Format: "binary"}
+	default:
+		switch typ.Kind() {
+		case reflect.Bool:
+			schema = &openAPISchema{Type: "boolean"}
+		case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+			schema = &openAPISchema{Type: "integer", Format: "int64"}
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			schema = &openAPISchema{Type: "integer", Format: "int32"}
+		case reflect.Float32:
+			schema = &openAPISchema{Type: "number", Format: "float"}
+		case reflect.Float64:
+			schema = &openAPISchema{Type: "number", Format: "double"}
+		case reflect.String:
+			schema = &openAPISchema{Type: "string"}
+		case reflect.Slice, reflect.Array:
+			if typ.Elem().Kind() == reflect.Uint8 {
+				schema = &openAPISchema{Type: "string", Format: "byte"}
+			} else {
+				schema = &openAPISchema{Type: "array", Items: b.schema(typ.Elem())}
+			}
+		case reflect.Map:
+			schema = &openAPISchema{Type: "object", AdditionalProperties: b.schema(typ.Elem())}
+		case reflect.Struct:
+			schema = b.structRef(typ)
+		default:
+			schema = &openAPISchema{}
+		}
+	}
+	if nullable && schema.Ref == "" {
+		schema.Nullable = true
+	}
+	return schema
+}
+
+func (b *openAPIBuilder) structRef(typ reflect.Type) *openAPISchema {
+	if typ.Name() == "" {
+		return b.objectSchema(typ, "json")
+	}
+	if name, ok := b.names[typ]; ok {
+		return &openAPISchema{Ref: "#/components/schemas/" + name}
+	}
+
+	name := openAPINameRegexp.ReplaceAllString(typ.String(), "_")
+	for i := 1; b.schemas[name] != nil; i++ {
+		name = openAPINameRegexp.ReplaceAllString(typ.String(), "_") + cast.ToString(i)
+	}
+	b.names[typ] = name
+	b.schemas[name] = &openAPISchema{} // placeholder for recursive types
+	*b.schemas[name] = *b.objectSchema(typ, "json")
+	return &openAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+func (b *openAPIBuilder) objectSchema(typ reflect.Type, tagName string) (schema *openAPISchema) {
+	schema = &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	b.travelFields(typ, func(f reflect.StructField) {
+		name := f.Name
+		if tag := f.Tag.Get(tagName); tag != "" {
+			name = b.tagName(tag)
+		} else if tag = f.Tag.Get("json"); tag != "" {
+			name = b.tagName(tag)
+		}
+		if name == "-" {
+			return
+		}
+		schema.Properties[name] = b.fieldSchema(f)
+		if b.isRequired(f) {
+			schema.Required = append(schema.Required, name)
+		}
+	})
+	return
+}
+
+func (b *openAPIBuilder) fieldSchema(f reflect.StructField) (schema *openAPISchema) {
+	schema = b.schema(f.Type)
+	if schema.Ref != "" {
+		return
+	}
+	if desc := f.Tag.Get("description"); desc != "" {
+		schema.Description = desc
+	}
+	if def := f.Tag.Get("default"); def != "" {
+		schema.Default = def
+	}
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		if strings.HasPrefix(rule, "oneof=") {
+			for _, v := range strings.Fields(strings.TrimPrefix(rule, "oneof=")) {
+				schema.Enum = append(schema.Enum, v)
+			}
+		}
+	}
+	return
+}
+
+// travelFields visits exported fields, and flattens the anonymous struct fields without tag name
+func (b *openAPIBuilder) travelFields(typ reflect.Type, fn func(f reflect.StructField)) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Anonymous && f.Tag.Get("json") == "" && utils.IndirectType(f.Type).Kind() == reflect.Struct {
+			if ft := utils.IndirectType(f.Type); ft != embedType {
+				b.travelFields(ft, fn)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		fn(f)
+	}
+}
+
+func (b *openAPIBuilder) tagName(tag string) string {
+	return strings.Split(tag, ",")[0]
+}
+
+func (b *openAPIBuilder) isRequired(f reflect.StructField) bool {
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *openAPIBuilder) isFile(typ reflect.Type) bool {
+	typ = utils.IndirectType(typ)
+	if typ.Kind() == reflect.Slice {
+		typ = utils.IndirectType(typ.Elem())
+	}
+	return typ == fileHeaderType
+}
@@ -0,0 +1,25 @@
+package parser
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ApplicationMsgpackParser decodes fields by json tag as the json parser does
+type ApplicationMsgpackParser struct{}
+
+func (a *ApplicationMsgpackParser) PreParse(args map[string]string) error {
+	return nil
+}
+
+func (a *ApplicationMsgpackParser) Parse(src io.Reader, dst reflect.Value) (err error) {
+	dec := msgpack.NewDecoder(src)
+	dec.SetCustomStructTag("json")
+	if err = dec.Decode(dst.Addr().Interface()); err != nil {
+		return malformedRequest(err.Error())
+	}
+
+	return
+}
@@ -0,0 +1,34 @@
+package parser
+
+import (
+	"io"
+	"reflect"
+)
+
+var (
+	readerType = reflect.TypeOf((*io.Reader)(nil)).Elem()
+)
+
+// ApplicationOctetStreamParser sets the body to the first io.Reader field of the struct without reading it
+type ApplicationOctetStreamParser struct{}
+
+func (a *ApplicationOctetStreamParser) PreParse(args map[string]string) error {
+	return nil
+}
+
+func (a *ApplicationOctetStreamParser) Parse(src io.Reader, dst reflect.Value) (err error) {
+	if dst.Kind() != reflect.Struct {
+		return malformedRequest("octet-stream body into non struct " + dst.Type().String())
+	}
+	for i := 0; i < dst.NumField(); i++ {
+		f := dst.Field(i)
+		if !f.CanSet() || f.Kind() != reflect.Interface || !reflect.TypeOf(src).AssignableTo(f.Type()) ||
+			!f.Type().Implements(readerType) {
+			continue
+		}
+		f.Set(reflect.ValueOf(src))
+		return
+	}
+
+	return malformedRequest("missing io.Reader field in " + dst.Type().String())
+}
@@ -0,0 +1,30 @@
+package parser
+
+import (
+	"io"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+type ApplicationProtobufParser struct{}
+
+func (a *ApplicationProtobufParser) PreParse(args map[string]string) error {
+	return nil
+}
+
+func (a *ApplicationProtobufParser) Parse(src io.Reader, dst reflect.Value) (err error) {
+	msg, ok := dst.Addr().Interface().(proto.Message)
+	if !ok {
+		return malformedRequest("protobuf body into non proto message " + dst.Type().String())
+	}
+	body, err := io.ReadAll(src)
+	if err != nil {
+		return
+	}
+	if err = proto.Unmarshal(body, msg); err != nil {
+		return malformedRequest(err.Error())
+	}
+
+	return
+}
@@ -0,0 +1,21 @@
+package parser
+
+import (
+	"encoding/xml"
+	"io"
+	"reflect"
+)
+
+type ApplicationXmlParser struct{}
+
+func (a *ApplicationXmlParser) PreParse(args map[string]string) error {
+	return nil
+}
+
+func (a *ApplicationXmlParser) Parse(src io.Reader, dst reflect.Value) (err error) {
+	if err = xml.NewDecoder(src).Decode(dst.Addr().Interface()); err != nil {
+		return malformedRequest(err.Error())
+	}
+
+	return
+}
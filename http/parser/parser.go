@@ -6,6 +6,7 @@ import (
 	"reflect"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 type Parser interface {
@@ -26,7 +27,29 @@ var (
 		gin.MIMEJSON:              reflect.TypeOf((*ApplicationJsonParser)(nil)),
 		gin.MIMEPOSTForm:          reflect.TypeOf((*ApplicationFormUrlencodedParser)(nil)),
 		gin.MIMEMultipartPOSTForm: reflect.TypeOf((*MultipartFormDataParser)(nil)),
+		gin.MIMEXML:               reflect.TypeOf((*ApplicationXmlParser)(nil)),
+		gin.MIMEXML2:              reflect.TypeOf((*ApplicationXmlParser)(nil)),
+		binding.MIMEPROTOBUF:      reflect.TypeOf((*ApplicationProtobufParser)(nil)),
+		MIMEPROTOBUF2:             reflect.TypeOf((*ApplicationProtobufParser)(nil)),
+		binding.MIMEMSGPACK:       reflect.TypeOf((*ApplicationMsgpackParser)(nil)),
+		binding.MIMEMSGPACK2:      reflect.TypeOf((*ApplicationMsgpackParser)(nil)),
+		MIMEOctetStream:           reflect.TypeOf((*ApplicationOctetStreamParser)(nil)),
 	}
+
+	// bypassBindingTypes are content types gin binding does not support or decodes differently from parsers,
+	// e.g. protobuf into non proto messages, msgpack by codec tag, so they are parsed by parsers directly
+	bypassBindingTypes = map[string]bool{
+		binding.MIMEPROTOBUF: true,
+		MIMEPROTOBUF2:        true,
+		binding.MIMEMSGPACK:  true,
+		binding.MIMEMSGPACK2: true,
+		MIMEOctetStream:      true,
+	}
+)
+
+const (
+	MIMEPROTOBUF2   = "application/protobuf"
+	MIMEOctetStream = "application/octet-stream"
 )
 
 func GetByContentType(typ string) (parser Parser, err error) {
@@ -37,3 +60,13 @@ func GetByContentType(typ string) (parser Parser, err error) {
 
 	return reflect.New(parserType.Elem()).Interface().(Parser), nil
 }
+
+// BypassBinding reports whether the content type should be parsed by parsers rather than gin binding
+func BypassBinding(typ string) bool {
+	return bypassBindingTypes[typ]
+}
+
+// Stream reports whether the parser keeps the body as a stream, so the body should not be read in advance
+func Stream(typ string) bool {
+	return typ == MIMEOctetStream
+}
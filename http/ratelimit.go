@@ -0,0 +1,463 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"golang.org/x/text/language"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/i18n"
+	"github.com/wfusion/gofusion/redis"
+
+	fusCtx "github.com/wfusion/gofusion/context"
+)
+
+type RateLimitAlgorithm string
+
+const (
+	RateLimitTokenBucket   RateLimitAlgorithm = "token_bucket"
+	RateLimitSlidingWindow RateLimitAlgorithm = "sliding_window"
+)
+
+type RateLimitKeyBy string
+
+const (
+	RateLimitByIP     RateLimitKeyBy = "ip"
+	RateLimitByHeader RateLimitKeyBy = "header"
+	RateLimitByUser   RateLimitKeyBy = "user"
+	RateLimitByRoute  RateLimitKeyBy = "route"
+)
+
+const (
+	localRateLimitSize = 1 << 16
+
+	redisLuaTokenBucketCommand = `
+local rate = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / interval)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * interval / rate) + 1000)
+local reset = (burst - tokens) * interval / rate
+if allowed == 0 then
+	reset = (1 - tokens) * interval / rate
+end
+return {allowed, math.floor(tokens), math.ceil(reset)}`
+
+	redisLuaSlidingWindowCommand = `
+local limit = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - interval)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call("PEXPIRE", KEYS[1], interval)
+local reset = interval
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+if #oldest > 0 then
+	reset = tonumber(oldest[2]) + interval - now
+end
+return {allowed, limit - count, reset}`
+)
+
+var (
+	rateLimitLocker sync.RWMutex
+	appRateLimits   = map[string]map[string]*rateLimit{}
+)
+
+type rateLimitRule struct {
+	algorithm RateLimitAlgorithm
+	rate      int
+	interval  time.Duration
+	burst     int
+	keyBy     RateLimitKeyBy
+	header    string
+	disable   bool
+}
+
+type rateLimitResult struct {
+	allowed   bool
+	remaining int
+	reset     time.Duration
+}
+
+type rateLimiter interface {
+	take(ctx context.Context, key string, rule *rateLimitRule) (rst *rateLimitResult, err error)
+}
+
+type rateLimit struct {
+	appName   string
+	errorCode Errcode
+	rule      *rateLimitRule
+	limiter   rateLimiter
+	whiteList *utils.Set[string]
+}
+
+func addRateLimit(ctx context.Context, name string, conf Conf, opt *config.InitOption) func() {
+	rl := &rateLimit{
+		appName:   opt.AppName,
+		errorCode: Errcode(conf.RateLimit.ErrorCode),
+		whiteList: utils.NewSet(conf.RateLimit.WhiteURLList...),
+	}
+	if conf.RateLimit.Enable {
+		rl.rule = &rateLimitRule{
+			algorithm: conf.RateLimit.Algorithm,
+			rate:      conf.RateLimit.Rate,
+			interval:  utils.Must(utils.ParseDuration(conf.RateLimit.Interval)),
+			burst:     conf.RateLimit.Burst,
+			keyBy:     conf.RateLimit.KeyBy,
+			header:    conf.RateLimit.Header,
+		}
+		utils.MustSuccess(rl.rule.check())
+	}
+
+	switch {
+	case utils.IsStrBlank(conf.RateLimit.Instance):
+		rl.limiter = newLocalRateLimiter()
+	case conf.RateLimit.InstanceType == instanceTypeRedis:
+		rl.limiter = newRedisRateLimiter(ctx, opt.AppName, conf.RateLimit.Instance)
+	default:
+		panic(errors.Errorf("unknown rate limit instance type: %+v", conf.RateLimit.InstanceType))
+	}
+
+	rateLimitLocker.Lock()
+	defer rateLimitLocker.Unlock()
+	if appRateLimits[opt.AppName] == nil {
+		appRateLimits[opt.AppName] = make(map[string]*rateLimit)
+	}
+	appRateLimits[opt.AppName][name] = rl
+
+	return func() {
+		rateLimitLocker.Lock()
+		defer rateLimitLocker.Unlock()
+		if delete(appRateLimits[opt.AppName], name); len(appRateLimits[opt.AppName]) == 0 {
+			delete(appRateLimits, opt.AppName)
+		}
+	}
+}
+
+func addRateLimitI18n(bundle i18n.Localizable[Errcode], conf Conf) {
+	if conf.RateLimit.ErrorCode == conf.ErrorCode {
+		return
+	}
+	bundle.AddMessages(Errcode(conf.RateLimit.ErrorCode), map[language.Tag]*i18n.Message{
+		language.English: {Other: "Too many requests, please retry after {{.retry_after}} seconds"},
+		language.Chinese: {Other: "请求过于频繁, 请在 {{.retry_after}} 秒后重试"},
+	}, i18n.Var("retry_after"))
+}
+
+func getRateLimit(appName, name string) *rateLimit {
+	rateLimitLocker.RLock()
+	defer rateLimitLocker.RUnlock()
+	return appRateLimits[appName][name]
+}
+
+// handler returns the rate limit handler of the route, the route rule overrides the global one
+func (r *rateLimit) handler(method, uri string, rule *rateLimitRule) gin.HandlerFunc {
+	scope := ""
+	if rule == nil {
+		rule = r.rule
+	} else {
+		scope = fmt.Sprintf("%s %s", method, uri)
+	}
+	if rule == nil || rule.disable {
+		return nil
+	}
+
+	return func(c *gin.Context) {
+		if r.whiteList.Contains(c.FullPath()) || r.whiteList.Contains(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		rst, err := r.limiter.take(c, r.formatKey(c, scope, rule), rule)
+		if err != nil {
+			// fail open when the limiter backend is unavailable
+			pid := syscall.Getpid()
+			app := config.Use(r.appName).AppName()
+			log.Printf("%v [Gofusion] %s %s rate limit take token failed: %s", pid, app, config.ComponentHttp, err)
+			c.Next()
+			return
+		}
+
+		resetSeconds := int(math.Ceil(rst.reset.Seconds()))
+		c.Header("RateLimit-Limit", strconv.Itoa(rule.limit()))
+		c.Header("RateLimit-Remaining", strconv.Itoa(utils.Max(rst.remaining, 0)))
+		c.Header("RateLimit-Reset", strconv.Itoa(resetSeconds))
+		if !rst.allowed {
+			c.Header("Retry-After", strconv.Itoa(resetSeconds))
+			c.Status(http.StatusTooManyRequests)
+			msg := Err(c, r.errorCode, Param(map[string]any{"retry_after": resetSeconds})).Error()
+			rspError(c, r.appName, r.errorCode, nil, 0, 0, msg)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func (r *rateLimit) formatKey(c *gin.Context, scope string, rule *rateLimitRule) string {
+	var id string
+	switch rule.keyBy {
+	case RateLimitByHeader:
+		id = c.GetHeader(rule.header)
+	case RateLimitByUser:
+		id = fusCtx.GetUserID(c)
+	case RateLimitByRoute:
+		id = fmt.Sprintf("%s %s", c.Request.Method, c.FullPath())
+	}
+	if utils.IsStrBlank(id) {
+		id = c.ClientIP()
+	}
+	return fmt.Sprintf("%s:ratelimit:%s:%s:%s", config.Use(r.appName).AppName(), rule.keyBy, scope, id)
+}
+
+func (r *rateLimitRule) check() error {
+	if r.disable {
+		return nil
+	}
+	if r.rate <= 0 || r.interval <= 0 {
+		return errors.Errorf("rate limit rate and interval should be positive [rate[%v] interval[%s]]",
+			r.rate, r.interval)
+	}
+	switch r.algorithm {
+	case RateLimitTokenBucket, RateLimitSlidingWindow:
+	default:
+		return errors.Errorf("unknown rate limit algorithm: %s", r.algorithm)
+	}
+	switch r.keyBy {
+	case RateLimitByIP, RateLimitByUser, RateLimitByRoute:
+	case RateLimitByHeader:
+		if utils.IsStrBlank(r.header) {
+			return errors.New("rate limit header is empty when key by header")
+		}
+	default:
+		return errors.Errorf("unknown rate limit key by: %s", r.keyBy)
+	}
+	return nil
+}
+
+func (r *rateLimitRule) limit() int {
+	if r.algorithm == RateLimitTokenBucket && r.burst > 0 {
+		return r.burst
+	}
+	return r.rate
+}
+
+type localRateLimiter struct {
+	entries gcache.Cache
+}
+
+func newLocalRateLimiter() rateLimiter {
+	return &localRateLimiter{
+		entries: gcache.New(localRateLimitSize).LRU().
+			LoaderFunc(func(any) (any, error) { return new(localRateLimitEntry), nil }).
+			Build(),
+	}
+}
+
+type localRateLimitEntry struct {
+	sync.Mutex
+	tokens float64
+	last   time.Time
+
+	windowStart time.Time
+	prevCount   int
+	currCount   int
+}
+
+func (l *localRateLimiter) take(_ context.Context, key string, rule *rateLimitRule) (
+	rst *rateLimitResult, err error) {
+	v, err := l.entries.Get(key)
+	if err != nil {
+		return
+	}
+	entry := v.(*localRateLimitEntry)
+	entry.Lock()
+	defer entry.Unlock()
+
+	now := time.Now()
+	switch rule.algorithm {
+	case RateLimitSlidingWindow:
+		return entry.slidingWindow(now, rule), nil
+	default:
+		return entry.tokenBucket(now, rule), nil
+	}
+}
+
+func (e *localRateLimitEntry) tokenBucket(now time.Time, rule *rateLimitRule) (rst *rateLimitResult) {
+	burst := float64(rule.limit())
+	perToken := float64(rule.interval) / float64(rule.rate)
+	if e.last.IsZero() {
+		e.tokens = burst
+	} else {
+		e.tokens = math.Min(burst, e.tokens+float64(now.Sub(e.last))/perToken)
+	}
+	e.last = now
+
+	rst = new(rateLimitResult)
+	if e.tokens >= 1 {
+		e.tokens--
+		rst.allowed = true
+		rst.reset = time.Duration((burst - e.tokens) * perToken)
+	} else {
+		rst.reset = time.Duration((1 - e.tokens) * perToken)
+	}
+	rst.remaining = int(e.tokens)
+	return
+}
+
+// slidingWindow approximates the sliding window by weighting the previous fixed window
+func (e *localRateLimitEntry) slidingWindow(now time.Time, rule *rateLimitRule) (rst *rateLimitResult) {
+	switch elapsed := now.Sub(e.windowStart); {
+	case elapsed >= 2*rule.interval:
+		e.windowStart, e.prevCount, e.currCount = now, 0, 0
+	case elapsed >= rule.interval:
+		e.windowStart, e.prevCount, e.currCount = e.windowStart.Add(rule.interval), e.currCount, 0
+	}
+
+	weight := 1 - float64(now.Sub(e.windowStart))/float64(rule.interval)
+	count := int(math.Floor(float64(e.prevCount)*weight)) + e.currCount
+
+	rst = &rateLimitResult{reset: e.windowStart.Add(rule.interval).Sub(now)}
+	if count < rule.rate {
+		e.currCount++
+		count++
+		rst.allowed = true
+	}
+	rst.remaining = rule.rate - count
+	return
+}
+
+type redisRateLimiter struct {
+	ctx       context.Context
+	appName   string
+	redisName string
+}
+
+func newRedisRateLimiter(ctx context.Context, appName, redisName string) rateLimiter {
+	return &redisRateLimiter{ctx: ctx, appName: appName, redisName: redisName}
+}
+
+func (r *redisRateLimiter) take(ctx context.Context, key string, rule *rateLimitRule) (
+	rst *rateLimitResult, err error) {
+	now := time.Now().UnixMilli()
+	interval := rule.interval.Milliseconds()
+	rds := redis.Use(ctx, r.redisName, redis.AppName(r.appName))
+
+	var vals []any
+	switch rule.algorithm {
+	case RateLimitSlidingWindow:
+		member := strings.Join([]string{strconv.FormatInt(now, 10), utils.UUID_()}, ":")
+		vals, err = rds.Eval(ctx, redisLuaSlidingWindowCommand, []string{key},
+			rule.rate, interval, now, member).Slice()
+	default:
+		vals, err = rds.Eval(ctx, redisLuaTokenBucketCommand, []string{key},
+			rule.rate, interval, rule.limit(), now).Slice()
+	}
+	if err != nil {
+		return
+	}
+	if len(vals) != 3 {
+		return nil, errors.Errorf("unexpected rate limit redis result: %+v", vals)
+	}
+
+	return &rateLimitResult{
+		allowed:   cast.ToInt(vals[0]) == 1,
+		remaining: cast.ToInt(vals[1]),
+		reset:     time.Duration(cast.ToInt64(vals[2])) * time.Millisecond,
+	}, nil
+}
+
+type rateLimitOption struct {
+	algorithm RateLimitAlgorithm
+	burst     int
+	keyBy     RateLimitKeyBy
+	header    string
+}
+
+// LimitAlgorithm rate limit algorithm of the route, defaults to token bucket
+func LimitAlgorithm(algorithm RateLimitAlgorithm) utils.OptionFunc[rateLimitOption] {
+	return func(o *rateLimitOption) {
+		o.algorithm = algorithm
+	}
+}
+
+// LimitBurst token bucket capacity of the route, defaults to rate
+func LimitBurst(burst int) utils.OptionFunc[rateLimitOption] {
+	return func(o *rateLimitOption) {
+		o.burst = burst
+	}
+}
+
+// LimitBy rate limit key of the route, header name is required when key by header
+func LimitBy(keyBy RateLimitKeyBy, header ...string) utils.OptionFunc[rateLimitOption] {
+	return func(o *rateLimitOption) {
+		o.keyBy = keyBy
+		if len(header) > 0 {
+			o.header = header[0]
+		}
+	}
+}
+
+// RateLimit overrides the global rate limit of the route, allows rate requests per interval
+func RateLimit(rate int, interval time.Duration, opts ...utils.OptionExtender) utils.OptionFunc[routerOption] {
+	opt := utils.ApplyOptions[rateLimitOption](opts...)
+	rule := &rateLimitRule{
+		algorithm: RateLimitTokenBucket,
+		rate:      rate,
+		interval:  interval,
+		burst:     opt.burst,
+		keyBy:     RateLimitByIP,
+		header:    opt.header,
+	}
+	if opt.algorithm != "" {
+		rule.algorithm = opt.algorithm
+	}
+	if opt.keyBy != "" {
+		rule.keyBy = opt.keyBy
+	}
+	utils.MustSuccess(rule.check())
+	return func(o *routerOption) {
+		o.rateLimit = rule
+	}
+}
+
+// NoRateLimit disables the global rate limit of the route
+func NoRateLimit() utils.OptionFunc[routerOption] {
+	return func(o *routerOption) {
+		o.rateLimit = &rateLimitRule{disable: true}
+	}
+}
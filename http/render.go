@@ -0,0 +1,129 @@
+package http
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/wfusion/gofusion/http/parser"
+)
+
+const (
+	// HeaderResponseCode and HeaderResponseMessage carry the code and the url escaped message of the response in
+	// protobuf, whose body is the data only
+	HeaderResponseCode    = "X-Response-Code"
+	HeaderResponseMessage = "X-Response-Message"
+)
+
+var (
+	// renderFormats are offered in order, json is the first one for requests without accept or accepting any
+	renderFormats = []string{
+		gin.MIMEJSON,
+		gin.MIMEXML,
+		gin.MIMEXML2,
+		binding.MIMEMSGPACK,
+		binding.MIMEMSGPACK2,
+		binding.MIMEPROTOBUF,
+		parser.MIMEPROTOBUF2,
+	}
+)
+
+// render writes the body in the format negotiated by the Accept header, and falls back to json if the body
+// cannot be rendered in the format, e.g. maps in xml, or non proto messages in protobuf. Protobuf renders
+// the data of the response only since the response itself is not a proto message, the code and the message
+// are carried by HeaderResponseCode and HeaderResponseMessage
+func render(c *gin.Context, status int, obj any) {
+	switch format := negotiateFormat(c.GetHeader("Accept")); format {
+	case gin.MIMEXML, gin.MIMEXML2:
+		if body, err := xml.Marshal(obj); err == nil {
+			c.Data(status, format+"; charset=utf-8", body)
+			return
+		}
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		buf := bytes.NewBuffer(nil)
+		enc := msgpack.NewEncoder(buf)
+		enc.SetCustomStructTag("json")
+		if err := enc.Encode(obj); err == nil {
+			c.Data(status, format, buf.Bytes())
+			return
+		}
+	case binding.MIMEPROTOBUF, parser.MIMEPROTOBUF2:
+		data := obj
+		rsp, isRsp := obj.(*Response)
+		if isRsp {
+			data = rsp.Data
+		}
+		if msg, ok := data.(proto.Message); ok {
+			if body, err := proto.Marshal(msg); err == nil {
+				if isRsp {
+					c.Header(HeaderResponseCode, strconv.Itoa(rsp.Code))
+					c.Header(HeaderResponseMessage, url.QueryEscape(rsp.Message))
+				}
+				c.Data(status, format, body)
+				return
+			}
+		}
+	}
+
+	c.PureJSON(status, obj)
+}
+
+// negotiateFormat returns json unless the client explicitly prefers another format, i.e. the format is listed
+// with the highest quality of the Accept header and a higher quality than json, so that browsers accepting
+// xml with a lower quality than html still get json
+func negotiateFormat(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return gin.MIMEJSON
+	}
+
+	top, jsonQuality := 0.0, 0.0
+	explicit := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		mime, quality := parseAcceptPart(part)
+		if mime == "" {
+			continue
+		}
+		if quality > top {
+			top = quality
+		}
+		if q, ok := explicit[mime]; !ok || quality > q {
+			explicit[mime] = quality
+		}
+	}
+	for _, mime := range []string{gin.MIMEJSON, "application/*", "*/*"} {
+		if q, ok := explicit[mime]; ok {
+			jsonQuality = q
+			break
+		}
+	}
+
+	for _, format := range renderFormats[1:] {
+		if q, ok := explicit[format]; ok && q > 0 && q == top && q > jsonQuality {
+			return format
+		}
+	}
+	return gin.MIMEJSON
+}
+
+// parseAcceptPart parses a media range of the Accept header, the quality defaults to 1
+func parseAcceptPart(part string) (mime string, quality float64) {
+	params := strings.Split(part, ";")
+	mime, quality = strings.ToLower(strings.TrimSpace(params[0])), 1
+	for _, param := range params[1:] {
+		key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || strings.TrimSpace(key) != "q" {
+			continue
+		}
+		if q, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+			quality = q
+		}
+	}
+	return
+}
@@ -0,0 +1,318 @@
+package http
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/PaesslerAG/gval"
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+	"github.com/sony/gobreaker"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+)
+
+var (
+	// ErrClientBulkheadFull is returned when concurrent requests of a client exceed the bulkhead
+	ErrClientBulkheadFull = errors.New("http client bulkhead full")
+	// ErrClientCircuitOpen is returned when the circuit breaker of a client is open
+	ErrClientCircuitOpen = gobreaker.ErrOpenState
+	// ErrClientCircuitTooManyRequests is returned when the circuit breaker of a client is half-open and the
+	// number of requests exceeds max_requests
+	ErrClientCircuitTooManyRequests = gobreaker.ErrTooManyRequests
+)
+
+type clientDeadlineKey struct{}
+
+// clientResilience is shared by resty clients created by the same client configure, so the breaker and the
+// bulkhead count all requests of the client
+type clientResilience struct {
+	deadline     time.Duration
+	breaker      *gobreaker.TwoStepCircuitBreaker
+	bulkhead     chan struct{}
+	bulkheadWait time.Duration
+	hedgeDelay   time.Duration
+	hedgeMax     int
+}
+
+func newClientResilience(ctx context.Context, appName, name string, conf *clientConf) (r *clientResilience) {
+	r = &clientResilience{
+		bulkheadWait: utils.Must(utils.ParseDuration(conf.Bulkhead.MaxWait)),
+		hedgeMax:     conf.Hedging.MaxAttempts,
+	}
+	if utils.IsStrNotBlank(conf.Deadline) {
+		r.deadline = utils.Must(utils.ParseDuration(conf.Deadline))
+	}
+	if utils.IsStrNotBlank(conf.Hedging.Delay) {
+		r.hedgeDelay = utils.Must(utils.ParseDuration(conf.Hedging.Delay))
+	}
+	if conf.Bulkhead.MaxConcurrency > 0 {
+		r.bulkhead = make(chan struct{}, conf.Bulkhead.MaxConcurrency)
+	}
+	if conf.CircuitBreaker.Enable {
+		r.breaker = newClientBreaker(ctx, appName, name, conf.CircuitBreaker)
+	}
+	if r.deadline <= 0 && r.breaker == nil && r.bulkhead == nil && (r.hedgeDelay <= 0 || r.hedgeMax < 2) {
+		return nil
+	}
+	return
+}
+
+func newClientBreaker(ctx context.Context, appName, name string,
+	conf clientCircuitBreakerConf) *gobreaker.TwoStepCircuitBreaker {
+	var expr gval.Evaluable
+	if utils.IsStrNotBlank(conf.TripExpr) {
+		expr = utils.Must(gval.Full().NewEvaluable(conf.TripExpr))
+	}
+	return gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+		Name:        name,
+		MaxRequests: uint32(conf.MaxRequests),
+		Interval:    utils.Must(utils.ParseDuration(conf.Interval)),
+		Timeout:     utils.Must(utils.ParseDuration(conf.Timeout)),
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			// fallback to default ready to trip expression
+			if expr == nil {
+				return counts.ConsecutiveFailures > 5
+			}
+			if ok, err := expr.EvalBool(ctx, map[string]uint32{
+				"requests":              counts.Requests,
+				"total_successes":       counts.TotalSuccesses,
+				"total_failures":        counts.TotalFailures,
+				"consecutive_successes": counts.ConsecutiveSuccesses,
+				"consecutive_failures":  counts.ConsecutiveFailures,
+			}); err == nil {
+				return ok
+			}
+			// fallback to default ready to trip expression
+			return counts.ConsecutiveFailures > 5
+		},
+		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+			log.Printf("%v [Gofusion] %s %s client %s circuit breaker state changed: %s -> %s",
+				syscall.Getpid(), config.Use(appName).AppName(), config.ComponentHttp, name, from, to)
+			go metricsClientBreaker(ctx, appName, name, to)
+		},
+	})
+}
+
+// apply sets the overall deadline and wraps the transport, it should be called after the transport is set
+func (r *clientResilience) apply(c *resty.Client) {
+	if r.deadline > 0 {
+		c.OnBeforeRequest(r.setDeadline)
+		c.OnSuccess(func(_ *resty.Client, rsp *resty.Response) { r.cancelDeadline(rsp.Request, rsp) })
+		c.OnError(func(req *resty.Request, err error) {
+			var rspErr *resty.ResponseError
+			if errors.As(err, &rspErr) {
+				r.cancelDeadline(req, rspErr.Response)
+				return
+			}
+			r.cancelDeadline(req, nil)
+		})
+		c.OnPanic(func(req *resty.Request, _ error) { r.cancelDeadline(req, nil) })
+	}
+	if r.breaker != nil || r.bulkhead != nil || (r.hedgeDelay > 0 && r.hedgeMax > 1) {
+		c.SetTransport(&resilientTransport{clientResilience: r, next: c.GetClient().Transport})
+	}
+}
+
+// setDeadline runs before each attempt, the deadline is set by the first attempt only
+func (r *clientResilience) setDeadline(_ *resty.Client, req *resty.Request) (err error) {
+	ctx := req.Context()
+	if ctx.Value(clientDeadlineKey{}) != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.deadline)
+	req.SetContext(context.WithValue(ctx, clientDeadlineKey{}, cancel))
+	return
+}
+
+// cancelDeadline releases the deadline timer once the execution finished, unless the body is left unread for
+// the caller, e.g. SetDoNotParseResponse, in which case the timer is released when the deadline exceeds
+func (r *clientResilience) cancelDeadline(req *resty.Request, rsp *resty.Response) {
+	if req == nil {
+		return
+	}
+	if rsp != nil && rsp.RawResponse != nil && rsp.Body() == nil {
+		return
+	}
+	if cancel, ok := req.Context().Value(clientDeadlineKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+}
+
+// resilientTransport applies the bulkhead, the circuit breaker and hedging in order for each attempt
+type resilientTransport struct {
+	*clientResilience
+	next http.RoundTripper
+}
+
+func (t *resilientTransport) RoundTrip(req *http.Request) (rsp *http.Response, err error) {
+	// rejections by the bulkhead are not failures of the server, so acquire it before the breaker
+	release, err := t.acquire(req.Context())
+	if err != nil {
+		return
+	}
+	var done func(success bool)
+	if t.breaker != nil {
+		if done, err = t.breaker.Allow(); err != nil {
+			release()
+			return
+		}
+	}
+
+	if t.hedgeDelay > 0 && t.hedgeMax > 1 && isHedgeable(req) {
+		rsp, err = t.hedge(req)
+	} else {
+		rsp, err = t.next.RoundTrip(req)
+	}
+	if done != nil {
+		done(err == nil && rsp.StatusCode < http.StatusInternalServerError)
+	}
+	if err != nil {
+		release()
+		return
+	}
+	rsp.Body = newOnCloseBody(rsp.Body, release)
+	return
+}
+
+// acquire holds a slot of the bulkhead until the response body is closed
+func (t *resilientTransport) acquire(ctx context.Context) (release func(), err error) {
+	if t.bulkhead == nil {
+		return func() {}, nil
+	}
+	release = func() { <-t.bulkhead }
+	select {
+	case t.bulkhead <- struct{}{}:
+		return
+	default:
+		if t.bulkheadWait <= 0 {
+			return nil, ErrClientBulkheadFull
+		}
+	}
+
+	timer := time.NewTimer(t.bulkheadWait)
+	defer timer.Stop()
+	select {
+	case t.bulkhead <- struct{}{}:
+		return
+	case <-timer.C:
+		return nil, ErrClientBulkheadFull
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type hedgeResult struct {
+	idx int
+	rsp *http.Response
+	err error
+}
+
+// hedge sends another attempt if no response after the delay or the previous attempt failed, the first
+// successful response wins and the others are cancelled
+func (t *resilientTransport) hedge(req *http.Request) (rsp *http.Response, err error) {
+	results := make(chan *hedgeResult, t.hedgeMax)
+	cancels := make([]context.CancelFunc, 0, t.hedgeMax)
+	launch := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		idx := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			rsp, err := t.next.RoundTrip(req.Clone(ctx))
+			results <- &hedgeResult{idx: idx, rsp: rsp, err: err}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(t.hedgeDelay)
+	defer timer.Stop()
+
+	var last *hedgeResult
+	for received := 0; ; {
+		select {
+		case <-timer.C:
+			if len(cancels) < t.hedgeMax {
+				launch()
+				timer.Reset(t.hedgeDelay)
+			}
+			continue
+		case result := <-results:
+			received++
+			if result.err != nil || result.rsp.StatusCode >= http.StatusInternalServerError {
+				if last != nil {
+					last.discard(cancels)
+				}
+				last = result
+				if received < len(cancels) {
+					continue
+				}
+				if len(cancels) < t.hedgeMax {
+					launch()
+					continue
+				}
+			}
+
+			// a failed attempt kept as the fallback is released once a later one wins
+			if last != nil && last != result {
+				last.discard(cancels)
+			}
+			// the winner keeps its context until the body is closed
+			for idx, cancel := range cancels {
+				if idx != result.idx {
+					cancel()
+				}
+			}
+			go discardHedges(results, cancels, len(cancels)-received)
+			if result.err != nil {
+				cancels[result.idx]()
+				return nil, result.err
+			}
+			result.rsp.Body = newOnCloseBody(result.rsp.Body, cancels[result.idx])
+			return result.rsp, nil
+		}
+	}
+}
+
+func (h *hedgeResult) discard(cancels []context.CancelFunc) {
+	if h.rsp != nil && h.rsp.Body != nil {
+		_ = h.rsp.Body.Close()
+	}
+	cancels[h.idx]()
+}
+
+func discardHedges(results chan *hedgeResult, cancels []context.CancelFunc, pending int) {
+	for i := 0; i < pending; i++ {
+		(<-results).discard(cancels)
+	}
+}
+
+func isHedgeable(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		(req.Body == nil || req.Body == http.NoBody)
+}
+
+type onCloseBody struct {
+	io.ReadCloser
+	once sync.Once
+	fn   func()
+}
+
+func newOnCloseBody(body io.ReadCloser, fn func()) io.ReadCloser {
+	if body == nil {
+		fn()
+		return body
+	}
+	return &onCloseBody{ReadCloser: body, fn: fn}
+}
+
+func (b *onCloseBody) Close() (err error) {
+	err = b.ReadCloser.Close()
+	b.once.Do(b.fn)
+	return
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"encoding/xml"
 	"net/http"
 	"reflect"
 
@@ -15,16 +16,17 @@ import (
 )
 
 type Response struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Data    any    `json:"data"`
+	XMLName xml.Name `json:"-" xml:"response"`
+	Code    int      `json:"code" xml:"code"`
+	Message string   `json:"message" xml:"message"`
+	Data    any      `json:"data" xml:"data"`
 
 	// pagination
-	Page  *int `json:"page,omitempty"`
-	Count *int `json:"count,omitempty"`
+	Page  *int `json:"page,omitempty" xml:"page,omitempty"`
+	Count *int `json:"count,omitempty" xml:"count,omitempty"`
 
 	// Trace
-	TraceID string `json:"traceid"`
+	TraceID string `json:"traceid" xml:"traceid"`
 }
 
 type Embed struct {
@@ -88,7 +90,7 @@ func rspSuccess(c *gin.Context, code int, data any, page, count int, msg string)
 		countPtr = utils.AnyPtr(count)
 	}
 
-	c.PureJSON(status, &Response{
+	render(c, status, &Response{
 		Code:    code,
 		Message: msg,
 		Data:    data,
@@ -127,7 +129,7 @@ func rspError[T constraint.Integer | Error](c *gin.Context, appName string, code
 		countPtr = utils.AnyPtr(count)
 	}
 
-	c.PureJSON(status, &Response{
+	render(c, status, &Response{
 		Code:    cast.ToInt(code),
 		Message: msg,
 		Data:    data,
@@ -147,7 +149,7 @@ func embedResponse(c *gin.Context, data any, err error) {
 		}
 	}
 
-	c.PureJSON(status, data)
+	render(c, status, data)
 }
 
 func langs(c *gin.Context) (langs []string) {
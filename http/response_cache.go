@@ -0,0 +1,598 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/wfusion/gofusion/cache"
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+
+	fusCtx "github.com/wfusion/gofusion/context"
+)
+
+const (
+	// HeaderCacheStatus is set on responses of cached routes, HIT if served from the response cache, or MISS
+	HeaderCacheStatus = "X-Cache"
+
+	localResponseCacheSize = 1 << 16
+	responseCacheTagsKey   = "gofusion:response_cache:tags"
+)
+
+var (
+	responseCacheLocker  sync.RWMutex
+	appResponseCaches    = map[string]map[string]*responseCache{}
+	responseCacheSkipped = utils.NewSet(
+		"Content-Length", "Date", "Transfer-Encoding", "Connection", "Set-Cookie", "Age", HeaderCacheStatus)
+)
+
+type responseCacheRule struct {
+	ttl  time.Duration
+	vary []string
+	tags []string
+}
+
+// cachedResponse a cached response with versions of its tags when it was stored, it is stale once any tag
+// is invalidated, i.e., the version of the tag changes
+type cachedResponse struct {
+	Status   int              `json:"status"`
+	Header   http.Header      `json:"header"`
+	Body     []byte           `json:"body"`
+	ETag     string           `json:"etag"`
+	Tags     map[string]int64 `json:"tags"`
+	StoredAt int64            `json:"stored_at"`
+}
+
+type responseCacheTag struct {
+	Tag     string `json:"tag"`
+	Version int64  `json:"version"`
+}
+
+type responseCacheStore interface {
+	get(ctx context.Context, key string) (rsp *cachedResponse, err error)
+	set(ctx context.Context, key string, rsp *cachedResponse, ttl time.Duration) (err error)
+	tags(ctx context.Context, tags []string) (versions map[string]int64, err error)
+	setTags(ctx context.Context, versions map[string]int64, ttl time.Duration) (err error)
+}
+
+type responseCache struct {
+	appName     string
+	name        string
+	ttl         time.Duration
+	tagTTL      time.Duration
+	vary        []string
+	maxBodySize int
+	store       responseCacheStore
+}
+
+func addResponseCache(_ context.Context, name string, conf Conf, opt *config.InitOption) func() {
+	rc := conf.ResponseCache
+	r := &responseCache{
+		appName:     opt.AppName,
+		name:        name,
+		ttl:         utils.Must(utils.ParseDuration(rc.TTL)),
+		tagTTL:      utils.Must(utils.ParseDuration(rc.TagTTL)),
+		vary:        canonicalHeaders(rc.VaryHeaders),
+		maxBodySize: rc.MaxBodySize,
+	}
+	if r.ttl <= 0 || r.tagTTL <= 0 {
+		panic(errors.Errorf("response cache ttl and tag ttl should be positive [ttl[%s] tag_ttl[%s]]",
+			r.ttl, r.tagTTL))
+	}
+	if utils.IsStrBlank(rc.Instance) {
+		r.store = newLocalResponseCacheStore()
+	} else {
+		r.store = newCacheResponseCacheStore(opt.AppName, rc.Instance)
+	}
+
+	responseCacheLocker.Lock()
+	defer responseCacheLocker.Unlock()
+	if appResponseCaches[opt.AppName] == nil {
+		appResponseCaches[opt.AppName] = make(map[string]*responseCache)
+	}
+	appResponseCaches[opt.AppName][name] = r
+
+	return func() {
+		responseCacheLocker.Lock()
+		defer responseCacheLocker.Unlock()
+		if delete(appResponseCaches[opt.AppName], name); len(appResponseCaches[opt.AppName]) == 0 {
+			delete(appResponseCaches, opt.AppName)
+		}
+	}
+}
+
+func getResponseCache(appName, name string) *responseCache {
+	responseCacheLocker.RLock()
+	defer responseCacheLocker.RUnlock()
+	return appResponseCaches[appName][name]
+}
+
+// handler returns the response cache handler of the route, only GET and HEAD responses are cached
+func (r *responseCache) handler(method string, rule *responseCacheRule) gin.HandlerFunc {
+	if rule == nil || (method != http.MethodGet && method != http.MethodHead) {
+		return nil
+	}
+	ttl := r.ttl
+	if rule.ttl > 0 {
+		ttl = rule.ttl
+	}
+	vary := canonicalHeaders(append(append([]string{}, r.vary...), rule.vary...))
+
+	return func(c *gin.Context) {
+		directives := parseCacheControl(c.GetHeader("Cache-Control"))
+		if _, ok := directives["no-store"]; ok {
+			c.Next()
+			return
+		}
+
+		// credentials without a resolved principal cannot be told apart, so they are never cached
+		principal := GetPrincipal(c)
+		if principal == nil && c.GetHeader("Authorization") != "" {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		key := r.formatKey(c, vary, principal)
+		_, noCache := directives["no-cache"]
+		if maxAge, ok := directives["max-age"]; ok && maxAge == "0" {
+			noCache = true
+		}
+		if !noCache {
+			if rsp := r.lookup(ctx, key); rsp != nil {
+				r.replay(c, rsp)
+				c.Abort()
+				return
+			}
+		}
+
+		// versions of route tags are read before the handler, so invalidations during the handler make
+		// the stored response stale
+		versions, err := r.store.tags(ctx, rule.tags)
+		if err != nil {
+			r.logf("get response cache tags of %s failed: %s", key, err)
+			c.Next()
+			return
+		}
+
+		writer := &responseCacheWriter{ResponseWriter: c.Writer, body: new(bytes.Buffer), maxSize: r.maxBodySize}
+		c.Writer = writer
+		defer func() { c.Writer = writer.ResponseWriter }()
+		writer.Header().Set(HeaderCacheStatus, "MISS")
+
+		c.Next()
+
+		if writer.passThrough {
+			return
+		}
+		rsp := &cachedResponse{
+			Status:   writer.Status(),
+			Header:   make(http.Header, len(writer.Header())),
+			Body:     writer.body.Bytes(),
+			ETag:     writer.Header().Get("ETag"),
+			Tags:     versions,
+			StoredAt: time.Now().Unix(),
+		}
+		if utils.IsStrBlank(rsp.ETag) {
+			sum := sha256.Sum256(rsp.Body)
+			rsp.ETag = `"` + hex.EncodeToString(sum[:16]) + `"`
+			writer.Header().Set("ETag", rsp.ETag)
+		}
+		writer.flush(etagMatch(c.GetHeader("If-None-Match"), rsp.ETag))
+
+		rspTTL, ok := r.cacheable(writer, ttl)
+		if !ok {
+			return
+		}
+		if tags := CacheTagsOf(c); len(tags) > 0 {
+			dynamic, err := r.store.tags(ctx, tags)
+			if err != nil {
+				r.logf("get response cache tags of %s failed: %s", key, err)
+				return
+			}
+			rsp.Tags = utils.MapMerge(dynamic, rsp.Tags)
+		}
+		if len(rsp.Tags) > 0 && rspTTL > r.tagTTL {
+			rspTTL = r.tagTTL
+		}
+		for k, v := range writer.Header() {
+			if !responseCacheSkipped.Contains(http.CanonicalHeaderKey(k)) {
+				rsp.Header[k] = v
+			}
+		}
+		if err := r.store.set(context.Background(), key, rsp, rspTTL); err != nil {
+			r.logf("store cached response of %s failed: %s", key, err)
+		}
+	}
+}
+
+// lookup returns the cached response unless any tag of it is invalidated, and fails open when the store
+// backend is unavailable
+func (r *responseCache) lookup(ctx context.Context, key string) (rsp *cachedResponse) {
+	rsp, err := r.store.get(ctx, key)
+	if err != nil {
+		r.logf("get cached response of %s failed: %s", key, err)
+		return nil
+	}
+	if rsp == nil || len(rsp.Tags) == 0 {
+		return
+	}
+	versions, err := r.store.tags(ctx, utils.MapKeys(rsp.Tags))
+	if err != nil {
+		r.logf("get response cache tags of %s failed: %s", key, err)
+		return nil
+	}
+	for tag, version := range rsp.Tags {
+		if versions[tag] != version {
+			return nil
+		}
+	}
+	return
+}
+
+func (r *responseCache) replay(c *gin.Context, rsp *cachedResponse) {
+	// headers written by the current request, e.g., trace id, take precedence over the cached ones
+	header := c.Writer.Header()
+	for k, v := range rsp.Header {
+		if _, ok := header[k]; !ok {
+			header[k] = v
+		}
+	}
+	header.Set("ETag", rsp.ETag)
+	header.Set("Age", strconv.FormatInt(utils.Max(time.Now().Unix()-rsp.StoredAt, 0), 10))
+	header.Set(HeaderCacheStatus, "HIT")
+	if etagMatch(c.GetHeader("If-None-Match"), rsp.ETag) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Status(rsp.Status)
+	if c.Request.Method == http.MethodHead {
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	_, _ = c.Writer.Write(rsp.Body)
+}
+
+// cacheable stores 200 responses only, and honours Cache-Control of the response, max-age or s-maxage
+// overrides the ttl of the route
+func (r *responseCache) cacheable(w *responseCacheWriter, ttl time.Duration) (time.Duration, bool) {
+	if w.Status() != http.StatusOK || len(w.Header().Values("Set-Cookie")) > 0 {
+		return 0, false
+	}
+	directives := parseCacheControl(w.Header().Get("Cache-Control"))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[directive]; ok {
+			return 0, false
+		}
+	}
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if v, ok := directives[directive]; ok {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return ttl, true
+}
+
+// invalidate changes versions of the tags, so responses stored with them become stale
+func (r *responseCache) invalidate(ctx context.Context, tags []string) error {
+	versions := make(map[string]int64, len(tags))
+	version := time.Now().UnixNano()
+	for _, tag := range tags {
+		versions[tag] = version
+	}
+	return r.store.setTags(ctx, versions, r.tagTTL)
+}
+
+// formatKey digests the principal, the path, the sorted query and the vary headers of the request
+func (r *responseCache) formatKey(c *gin.Context, vary []string, principal *Principal) string {
+	h := sha256.New()
+	// responses of tenants are kept apart even for anonymous requests whose tenant ids come from trusted headers
+	_, _ = h.Write([]byte(c.GetString(fusCtx.KeyTenantID) + "\n"))
+	if principal != nil {
+		_, _ = h.Write([]byte(principal.Authenticator + "\n" + principal.UserID + "\n"))
+	}
+	_, _ = h.Write([]byte(c.Request.URL.Path))
+	_, _ = h.Write([]byte("?" + c.Request.URL.Query().Encode()))
+	for _, name := range vary {
+		_, _ = h.Write([]byte("\n" + name + ":" + strings.Join(c.Request.Header.Values(name), ",")))
+	}
+	return fmt.Sprintf("%s:response_cache:%s:%s:%s", config.Use(r.appName).AppName(),
+		r.name, c.Request.Method, hex.EncodeToString(h.Sum(nil)))
+}
+
+func (r *responseCache) logf(format string, args ...any) {
+	pid := syscall.Getpid()
+	app := config.Use(r.appName).AppName()
+	log.Printf("%v [Gofusion] %s %s "+format, append([]any{pid, app, config.ComponentHttp}, args...)...)
+}
+
+func canonicalHeaders(headers []string) (canonical []string) {
+	set := utils.NewSet[string]()
+	for _, header := range headers {
+		if utils.IsStrNotBlank(header) {
+			set.Insert(http.CanonicalHeaderKey(strings.TrimSpace(header)))
+		}
+	}
+	canonical = set.Items()
+	sort.Strings(canonical)
+	return
+}
+
+func parseCacheControl(value string) (directives map[string]string) {
+	directives = make(map[string]string)
+	for _, directive := range strings.Split(value, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			directives[k] = strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	return
+}
+
+func etagMatch(ifNoneMatch, etag string) bool {
+	if utils.IsStrBlank(ifNoneMatch) {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// responseCacheWriter buffers the response to set the etag before the header is written, it passes
+// through once the response is flushed, e.g., streaming, or exceeds the max size
+type responseCacheWriter struct {
+	gin.ResponseWriter
+	body        *bytes.Buffer
+	maxSize     int
+	passThrough bool
+}
+
+func (w *responseCacheWriter) Write(b []byte) (int, error) {
+	if w.passThrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.maxSize > 0 && w.body.Len()+len(b) > w.maxSize {
+		w.pass()
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *responseCacheWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responseCacheWriter) Flush() {
+	if !w.passThrough {
+		w.pass()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *responseCacheWriter) pass() {
+	w.passThrough = true
+	w.ResponseWriter.Header().Del(HeaderCacheStatus)
+	if w.body.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+	} else {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+	w.body.Reset()
+}
+
+// flush writes the buffered response, or 304 without the body if the etag matches
+func (w *responseCacheWriter) flush(notModified bool) {
+	if notModified && w.Status() == http.StatusOK {
+		w.ResponseWriter.WriteHeader(http.StatusNotModified)
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	if w.body.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	_, _ = w.ResponseWriter.Write(w.body.Bytes())
+}
+
+type localResponseCacheStore struct {
+	entries  gcache.Cache
+	versions gcache.Cache
+}
+
+func newLocalResponseCacheStore() responseCacheStore {
+	return &localResponseCacheStore{
+		entries:  gcache.New(localResponseCacheSize).LRU().Build(),
+		versions: gcache.New(localResponseCacheSize).LRU().Build(),
+	}
+}
+
+func (l *localResponseCacheStore) get(_ context.Context, key string) (rsp *cachedResponse, err error) {
+	v, err := l.entries.Get(key)
+	if errors.Is(err, gcache.KeyNotFoundError) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	return v.(*cachedResponse), nil
+}
+
+func (l *localResponseCacheStore) set(_ context.Context, key string, rsp *cachedResponse,
+	ttl time.Duration) (err error) {
+	return l.entries.SetWithExpire(key, rsp, ttl)
+}
+
+func (l *localResponseCacheStore) tags(_ context.Context, tags []string) (versions map[string]int64, err error) {
+	versions = make(map[string]int64, len(tags))
+	for _, tag := range tags {
+		v, err := l.versions.Get(tag)
+		if errors.Is(err, gcache.KeyNotFoundError) {
+			versions[tag] = 0
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		versions[tag] = v.(int64)
+	}
+	return
+}
+
+func (l *localResponseCacheStore) setTags(_ context.Context, versions map[string]int64,
+	ttl time.Duration) (err error) {
+	for tag, version := range versions {
+		if err = l.versions.SetWithExpire(tag, version, ttl); err != nil {
+			return
+		}
+	}
+	return
+}
+
+type cacheResponseCacheStore struct {
+	entries  cache.Cachable[string, *cachedResponse, []*cachedResponse]
+	versions cache.Cachable[string, *responseCacheTag, []*responseCacheTag]
+}
+
+func newCacheResponseCacheStore(appName, cacheName string) responseCacheStore {
+	return &cacheResponseCacheStore{
+		entries: cache.New[string, *cachedResponse, []*cachedResponse](cacheName, cache.AppName(appName)),
+		versions: cache.New[string, *responseCacheTag, []*responseCacheTag](
+			cacheName, cache.AppName(appName)),
+	}
+}
+
+func (c *cacheResponseCacheStore) get(ctx context.Context, key string) (rsp *cachedResponse, err error) {
+	if rs := c.entries.Get(ctx, []string{key}, nil); len(rs) > 0 {
+		rsp = rs[0]
+	}
+	return
+}
+
+func (c *cacheResponseCacheStore) set(ctx context.Context, key string, rsp *cachedResponse,
+	ttl time.Duration) (err error) {
+	failure := c.entries.Set(ctx, map[string]*cachedResponse{key: rsp}, cache.Expired[string](ttl))
+	if len(failure) > 0 {
+		return errors.Errorf("set cached response into cache failed: %s", key)
+	}
+	return
+}
+
+func (c *cacheResponseCacheStore) tags(ctx context.Context, tags []string) (versions map[string]int64, err error) {
+	versions = make(map[string]int64, len(tags))
+	if len(tags) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		versions[tag] = 0
+		keys = append(keys, c.tagKey(tag))
+	}
+	for _, v := range c.versions.Get(ctx, keys, nil) {
+		versions[v.Tag] = v.Version
+	}
+	return
+}
+
+func (c *cacheResponseCacheStore) setTags(ctx context.Context, versions map[string]int64,
+	ttl time.Duration) (err error) {
+	kvs := make(map[string]*responseCacheTag, len(versions))
+	for tag, version := range versions {
+		kvs[c.tagKey(tag)] = &responseCacheTag{Tag: tag, Version: version}
+	}
+	if failure := c.versions.Set(ctx, kvs, cache.Expired[string](ttl)); len(failure) > 0 {
+		return errors.Errorf("set response cache tags into cache failed: %v", failure)
+	}
+	return
+}
+
+func (c *cacheResponseCacheStore) tagKey(tag string) string {
+	return "response_cache_tag:" + tag
+}
+
+type responseCacheOption struct {
+	ttl  time.Duration
+	vary []string
+	tags []string
+}
+
+// CacheTTL how long responses of the route are cached, defaults to the global ttl, max-age or s-maxage of
+// the response Cache-Control takes precedence
+func CacheTTL(ttl time.Duration) utils.OptionFunc[responseCacheOption] {
+	return func(o *responseCacheOption) {
+		o.ttl = ttl
+	}
+}
+
+// CacheVary request headers added to the cache key of the route besides the global vary headers
+func CacheVary(headers ...string) utils.OptionFunc[responseCacheOption] {
+	return func(o *responseCacheOption) {
+		o.vary = append(o.vary, headers...)
+	}
+}
+
+// CacheTags tags of all responses of the route, responses are invalidated by InvalidateCache with the tags
+func CacheTags(tags ...string) utils.OptionFunc[responseCacheOption] {
+	return func(o *responseCacheOption) {
+		o.tags = append(o.tags, tags...)
+	}
+}
+
+// Cached caches GET and HEAD responses of the route in the response cache
+func Cached(opts ...utils.OptionExtender) utils.OptionFunc[routerOption] {
+	opt := utils.ApplyOptions[responseCacheOption](opts...)
+	if opt.ttl < 0 {
+		panic(errors.Errorf("response cache ttl should not be negative [ttl[%s]]", opt.ttl))
+	}
+	rule := &responseCacheRule{ttl: opt.ttl, vary: opt.vary, tags: opt.tags}
+	return func(o *routerOption) {
+		o.responseCache = rule
+	}
+}
+
+// AddCacheTags tags the response of the current request besides tags of the route, e.g., user:1
+func AddCacheTags(c *gin.Context, tags ...string) {
+	c.Set(responseCacheTagsKey, append(CacheTagsOf(c), tags...))
+}
+
+// CacheTagsOf returns tags added to the response of the current request by AddCacheTags
+func CacheTagsOf(c *gin.Context) (tags []string) {
+	if v, ok := c.Get(responseCacheTagsKey); ok {
+		tags, _ = v.([]string)
+	}
+	return
+}
+
+// InvalidateCache makes cached responses with any of the tags stale on the server, the default one if the
+// server is not specified
+func InvalidateCache(ctx context.Context, tags []string, opts ...utils.OptionExtender) error {
+	opt := utils.ApplyOptions[useOption](opts...)
+	r := getResponseCache(opt.appName, opt.serverName())
+	if r == nil {
+		return errors.Errorf("http server not found: %s", opt.serverName())
+	}
+	return r.invalidate(ctx, tags)
+}
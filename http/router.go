@@ -8,7 +8,9 @@ import (
 	"io"
 	"mime"
 	"net/http"
+	"path"
 	"reflect"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -54,14 +56,20 @@ var (
 type router struct {
 	gin.IRouter
 
-	open         chan struct{}
-	close        chan struct{}
-	ctx          context.Context
-	appName      string
-	successCode  int
-	errorCode    Errcode
-	shutdownFunc func()
-	metricsConf  metricsConf
+	open          chan struct{}
+	close         chan struct{}
+	ctx           context.Context
+	appName       string
+	name          string
+	successCode   int
+	errorCode     Errcode
+	shutdownFunc  func()
+	shutdownDelay time.Duration
+	metricsConf   metricsConf
+	registry      registryConf
+	deregister    func()
+	streams       *streamGroup
+	sockets       *wsGroup
 
 	routes gin.IRoutes      `optional:"true"`
 	group  *gin.RouterGroup `optional:"true"`
@@ -75,8 +83,11 @@ func newRouter(ctx context.Context, r gin.IRouter, appName string, successCode,
 		open:        make(chan struct{}),
 		close:       make(chan struct{}),
 		appName:     appName,
+		name:        config.DefaultInstanceKey,
 		successCode: successCode,
 		errorCode:   Errcode(errorCode),
+		streams:     newStreamGroup(),
+		sockets:     newWSGroup(),
 	}
 }
 
@@ -94,17 +105,22 @@ func (r *router) Use(middlewares ...gin.HandlerFunc) IRouter {
 	}
 
 	return &router{
-		IRouter:      r.IRouter,
-		open:         r.open,
-		close:        r.close,
-		ctx:          r.ctx,
-		appName:      r.appName,
-		successCode:  r.successCode,
-		errorCode:    r.errorCode,
-		shutdownFunc: r.shutdownFunc,
-		routes:       routes,
-		group:        r.group,
-		ptr:          ptr,
+		IRouter:       r.IRouter,
+		open:          r.open,
+		close:         r.close,
+		ctx:           r.ctx,
+		appName:       r.appName,
+		name:          r.name,
+		successCode:   r.successCode,
+		errorCode:     r.errorCode,
+		shutdownFunc:  r.shutdownFunc,
+		shutdownDelay: r.shutdownDelay,
+		metricsConf:   r.metricsConf,
+		streams:       r.streams,
+		sockets:       r.sockets,
+		routes:        routes,
+		group:         r.group,
+		ptr:           ptr,
 	}
 }
 
@@ -155,17 +171,22 @@ func (r *router) HEAD(uri string, fn routerHandler, opts ...utils.OptionExtender
 }
 func (r *router) Group(relativePath string, handlers ...gin.HandlerFunc) IRouter {
 	return &router{
-		IRouter:      r.IRouter,
-		open:         r.open,
-		close:        r.close,
-		ctx:          r.ctx,
-		appName:      r.appName,
-		successCode:  r.successCode,
-		errorCode:    r.errorCode,
-		shutdownFunc: r.shutdownFunc,
-		routes:       r.routes,
-		group:        r.useIRouter().Group(relativePath, handlers...),
-		ptr:          dispatchGroup,
+		IRouter:       r.IRouter,
+		open:          r.open,
+		close:         r.close,
+		ctx:           r.ctx,
+		appName:       r.appName,
+		name:          r.name,
+		successCode:   r.successCode,
+		errorCode:     r.errorCode,
+		shutdownFunc:  r.shutdownFunc,
+		shutdownDelay: r.shutdownDelay,
+		metricsConf:   r.metricsConf,
+		streams:       r.streams,
+		sockets:       r.sockets,
+		routes:        r.routes,
+		group:         r.useIRouter().Group(relativePath, handlers...),
+		ptr:           dispatchGroup,
 	}
 }
 
@@ -196,6 +217,13 @@ func (r *router) ListenAndServe() (err error) {
 
 	port := fmt.Sprintf(":%v", conf.Port)
 	srv := gracefully.NewServer(r.appName, r.IRouter.(*gin.Engine), port, conf.NextProtos)
+	srv.RegisterOnShutdown(r.streams.drain)
+	srv.RegisterOnShutdown(r.sockets.shutdown)
+	if err = r.serveRegistry(srv); err != nil {
+		return
+	}
+	r.serveHealth(srv)
+	r.streams.reopen()
 	r.shutdownFunc = srv.Shutdown
 
 	r.close = make(chan struct{})
@@ -206,7 +234,10 @@ func (r *router) ListenAndServe() (err error) {
 	}()
 
 	if conf.TLS {
-		return srv.ListenAndServeTLS(conf.Cert, conf.Key)
+		if err = setupServerTLS(r.appName, conf, srv.Server, srv); err != nil {
+			return
+		}
+		return srv.ListenAndServeTLS("", "")
 	} else {
 		return srv.ListenAndServe()
 	}
@@ -222,9 +253,15 @@ func (r *router) Start() {
 
 	port := fmt.Sprintf(":%v", conf.Port)
 	srv := gracefully.NewServer(r.appName, r.IRouter.(*gin.Engine), port, conf.NextProtos)
+	srv.RegisterOnShutdown(r.streams.drain)
+	srv.RegisterOnShutdown(r.sockets.shutdown)
+	utils.MustSuccess(r.serveRegistry(srv))
+	r.serveHealth(srv)
+	r.streams.reopen()
 	r.shutdownFunc = srv.Shutdown
 	if conf.TLS {
-		routine.Go(srv.ListenAndServeTLS, routine.Args(conf.Cert, conf.Key), routine.AppName(r.appName))
+		utils.MustSuccess(setupServerTLS(r.appName, conf, srv.Server, srv))
+		routine.Go(srv.ListenAndServeTLS, routine.Args("", ""), routine.AppName(r.appName))
 	} else {
 		routine.Go(srv.ListenAndServe, routine.AppName(r.appName))
 	}
@@ -233,19 +270,27 @@ func (r *router) Start() {
 	close(r.open)
 }
 func (r *router) Config() OutputConf {
-	cfg := new(Conf)
-	_ = config.Use(r.appName).LoadComponentConfig(config.ComponentHttp, cfg)
+	conf := new(Conf)
+	_ = config.Use(r.appName).LoadComponentConfig(config.ComponentHttp, conf)
+	cfg, ok := serverConfs(conf)[r.name]
+	if !ok {
+		cfg = new(Conf)
+	}
 
 	return OutputConf{
-		Port:         cfg.Port,
-		TLS:          cfg.TLS,
-		Cert:         cfg.Cert,
-		Key:          cfg.Key,
-		NextProtos:   cfg.NextProtos,
-		SuccessCode:  cfg.SuccessCode,
-		ReadTimeout:  utils.Must(utils.ParseDuration(cfg.ReadTimeout)),
-		WriteTimeout: utils.Must(utils.ParseDuration(cfg.WriteTimeout)),
-		AsynqConf:    clone.Slowly(cfg.Asynq),
+		Port:           cfg.Port,
+		TLS:            cfg.TLS,
+		Cert:           cfg.Cert,
+		Key:            cfg.Key,
+		NextProtos:     cfg.NextProtos,
+		ClientCA:       cfg.ClientCA,
+		ClientAuth:     cfg.ClientAuth,
+		ReloadInterval: utils.Must(utils.ParseDuration(cfg.ReloadInterval)),
+		ReloadOnSIGHUP: cfg.ReloadOnSIGHUP,
+		SuccessCode:    cfg.SuccessCode,
+		ReadTimeout:    utils.Must(utils.ParseDuration(cfg.ReadTimeout)),
+		WriteTimeout:   utils.Must(utils.ParseDuration(cfg.WriteTimeout)),
+		AsynqConf:      clone.Slowly(cfg.Asynq),
 	}
 }
 func (r *router) Running() <-chan struct{} { return r.open }
@@ -258,6 +303,10 @@ func (r *router) shutdown() {
 		}
 	}
 	if r.shutdownFunc != nil {
+		if r.deregister != nil {
+			r.deregister()
+		}
+		r.drain()
 		r.shutdownFunc()
 	}
 	if r.close != nil {
@@ -317,9 +366,21 @@ func (r *router) useIRouter() gin.IRouter {
 // - func(c *gin.Context, req *FromQuery) (data any, page, count int, msg string, err error)
 // - class.public.func(c *gin.Context, req Struct FromQuery) error
 // - class.private.func(c *gin.Context, req Struct FromQuery) error
+// - func(c *gin.Context, w SSEWriter) error
+// - func(c *gin.Context, req Struct FromQuery, w SSEWriter) error
+// - func(c *gin.Context, req *FromQuery) (ch <-chan T, err error)
 func (r *router) convert(method, uri string, handler routerHandler, opt *routerOption) gin.HandlerFunc {
 	// check IRouter handler type
 	typ := reflect.TypeOf(handler)
+	if isStreamHandler(typ) {
+		if err := r.checkStreamHandlerType(method, uri, typ); err != nil {
+			panic(err)
+		}
+		if typ.NumIn() == 1 || (typ.NumIn() == 2 && typ.In(1) == sseWriterType) {
+			return r.wrapStreamHandlerFunc(handler, nil)
+		}
+		return r.wrapStreamHandlerFunc(handler, r.reqParser(method, opt))
+	}
 	if err := r.checkHandlerType(method, uri, typ); err != nil {
 		panic(err)
 	}
@@ -337,35 +398,61 @@ func (r *router) convert(method, uri string, handler routerHandler, opt *routerO
 		return r.wrapHandlerFunc(handler, nil)
 	}
 
+	return r.wrapHandlerFunc(handler, r.reqParser(method, opt))
+}
+
+func (r *router) reqParser(method string, opt *routerOption) routerRequestParser {
 	parseMap := map[parseFrom]routerRequestParser{
 		parseFromBody:  r.parseReqFromBody,
 		parseFromQuery: r.parseReqFromQuery,
 	}
 
-	var reqParse routerRequestParser
 	if p, ok := parseMap[opt.parseFrom]; ok {
-		reqParse = p
+		return p
 	} else if methodWithBody[method] {
-		reqParse = r.parseReqFromBody
+		return r.parseReqFromBody
 	} else {
-		reqParse = r.parseReqFromQuery
+		return r.parseReqFromQuery
 	}
-
-	return r.wrapHandlerFunc(handler, reqParse)
 }
 
 func (r *router) convertMulti(method, uri string, hdr routerHandler, opt *routerOption) (result gin.HandlersChain) {
-	result = make(gin.HandlersChain, 0, len(opt.beforeHandlers)+len(opt.aftersHandlers)+1)
+	result = make(gin.HandlersChain, 0, len(opt.beforeHandlers)+len(opt.aftersHandlers)+2)
+	if rl := getRateLimit(r.appName, r.name); rl != nil {
+		if limitHandler := rl.handler(method, uri, opt.rateLimit); limitHandler != nil {
+			result = append(result, limitHandler)
+		}
+	}
+	if i := getIdempotency(r.appName, r.name); i != nil {
+		if idempotencyHandler := i.handler(opt.idempotency); idempotencyHandler != nil {
+			result = append(result, idempotencyHandler)
+		}
+	}
 	for _, hdr := range opt.beforeHandlers {
 		result = append(result, r.convert(method, uri, hdr, opt))
 	}
+	// response cache runs after before handlers so that a cache hit still passes them
+	if rc := getResponseCache(r.appName, r.name); rc != nil {
+		if cacheHandler := rc.handler(method, opt.responseCache); cacheHandler != nil {
+			result = append(result, cacheHandler)
+		}
+	}
 	result = append(result, r.convert(method, uri, hdr, opt))
+	addOpenAPIRoute(r.appName, r.name, method, r.fullPath(uri), hdr, opt)
 	for _, hdr := range opt.aftersHandlers {
 		result = append(result, r.convert(method, uri, hdr, opt))
 	}
 	return
 }
 
+func (r *router) fullPath(uri string) string {
+	base, ok := r.use().(interface{ BasePath() string })
+	if !ok {
+		return uri
+	}
+	return path.Join(base.BasePath(), uri)
+}
+
 func (r *router) checkHandlerType(method, uri string, typ reflect.Type) (err error) {
 	if typ.Kind() != reflect.Func {
 		return errors.Errorf("router handler should be a function [method[%s] uri[%s]]", method, uri)
@@ -467,6 +554,11 @@ func (r *router) parseReqFromBody(c *gin.Context, typ reflect.Type) (dst reflect
 		}
 	}()
 
+	if contentType, param, e := mime.ParseMediaType(c.GetHeader("Content-Type")); e == nil &&
+		parser.BypassBinding(contentType) {
+		return r.parseReqByParser(c, typ, contentType, param)
+	}
+
 	bodyBytes, _ := io.ReadAll(c.Request.Body)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
@@ -508,6 +600,44 @@ func (r *router) parseReqFromBody(c *gin.Context, typ reflect.Type) (dst reflect
 	return
 }
 
+// parseReqByParser parses the body by parsers without gin binding and validates it as gin binding does,
+// streams are handed over to the request without buffering
+func (r *router) parseReqByParser(c *gin.Context, typ reflect.Type, contentType string,
+	param map[string]string) (dst reflect.Value, err error) {
+	dst = reflect.Indirect(reflect.New(typ))
+	p, err := parser.GetByContentType(contentType)
+	if err != nil {
+		return
+	}
+	if err = p.PreParse(param); err != nil {
+		return
+	}
+
+	body := c.Request.Body
+	if !parser.Stream(contentType) {
+		bodyBytes, _ := io.ReadAll(c.Request.Body)
+		defer func() { c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes)) }()
+		body = io.NopCloser(bytes.NewReader(bodyBytes))
+	}
+	if err = p.Parse(body, dst); err != nil {
+		return
+	}
+	if binding.Validator != nil {
+		if err = binding.Validator.ValidateStruct(dst.Addr().Interface()); err != nil {
+			err = parseGinBindingValidatorError(err)
+			return
+		}
+	}
+
+	err = utils.ParseTag(
+		dst.Addr().Interface(),
+		utils.ParseTagName("default"),
+		utils.ParseTagUnmarshalType(utils.MarshalTypeYaml),
+	)
+
+	return
+}
+
 func (r *router) parseReqFromQuery(c *gin.Context, typ reflect.Type) (dst reflect.Value, err error) {
 	ptrDepth := 0
 	for typ.Kind() == reflect.Ptr {
@@ -823,6 +953,10 @@ type routerOption struct {
 	parseFrom      parseFrom
 	beforeHandlers []routerHandler
 	aftersHandlers []routerHandler
+	rateLimit      *rateLimitRule
+	idempotency    *idempotencyRule
+	responseCache  *responseCacheRule
+	apiDoc         apiDocOption
 }
 
 func ParseFromBody() utils.OptionFunc[routerOption] {
@@ -0,0 +1,425 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/wfusion/gofusion/common/constant"
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/common/utils/serialize/json"
+)
+
+const (
+	ctxStreamKey = "gofusion:http:stream"
+)
+
+var (
+	sseWriterType = reflect.TypeOf((*SSEWriter)(nil)).Elem()
+	sseEventType  = reflect.TypeOf(SSEEvent{})
+
+	// ErrStreamClosed returned by SSEWriter when the client is gone or the server is shutting down
+	ErrStreamClosed = errors.New("http stream closed")
+)
+
+// SSEEvent server-sent event, Data is json marshaled unless it is a string or []byte
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  any
+	Retry time.Duration
+}
+
+// SSEWriter streams server-sent events to the client, it is safe for concurrent use
+type SSEWriter interface {
+	// Send writes an event and flushes it to the client immediately
+	Send(event SSEEvent) error
+	// Data writes an event with the data only
+	Data(data any) error
+	// Context is done when the client disconnects or the server starts shutting down
+	Context() context.Context
+}
+
+// StreamContext returns the context of a streaming handler which is done when the client disconnects, the server
+// starts shutting down or the handler returns, producers behind a channel handler should select on it when
+// sending and stop then, otherwise they block forever.
+func StreamContext(c *gin.Context) context.Context {
+	if ctx, ok := c.Get(ctxStreamKey); ok {
+		if streamCtx, ok := ctx.(context.Context); ok {
+			return streamCtx
+		}
+	}
+	return c.Request.Context()
+}
+
+// streamGroup tracks open streams so that they can be drained rather than cut off on shutdown
+type streamGroup struct {
+	heartbeat    time.Duration
+	drainTimeout time.Duration
+
+	mutex    sync.Mutex
+	draining chan struct{}
+}
+
+func newStreamGroup() *streamGroup {
+	return &streamGroup{
+		heartbeat:    15 * time.Second,
+		drainTimeout: 10 * time.Second,
+		draining:     make(chan struct{}),
+	}
+}
+
+func (s *streamGroup) init(conf streamConf) {
+	s.heartbeat = utils.Must(utils.ParseDuration(conf.HeartbeatInterval))
+	s.drainTimeout = utils.Must(utils.ParseDuration(conf.DrainTimeout))
+}
+
+// reopen makes the group accept streams again after the server restarts
+func (s *streamGroup) reopen() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := utils.IsChannelClosed(s.draining); ok {
+		s.draining = make(chan struct{})
+	}
+}
+
+// drain notifies all open streams to finish, it is registered as the http.Server shutdown hook
+func (s *streamGroup) drain() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := utils.IsChannelClosed(s.draining); !ok {
+		close(s.draining)
+	}
+}
+
+func (s *streamGroup) drainingChan() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.draining
+}
+
+func (s *streamGroup) context(c *gin.Context) (ctx context.Context, draining <-chan struct{}, cancel func()) {
+	ctx, cancel = context.WithCancel(c.Request.Context())
+	draining = s.drainingChan()
+	go func() {
+		select {
+		case <-draining:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	c.Set(ctxStreamKey, ctx)
+	return
+}
+
+type sseWriter struct {
+	ctx     context.Context
+	c       *gin.Context
+	mutex   sync.Mutex
+	started bool
+	closed  bool
+}
+
+func newSSEWriter(ctx context.Context, c *gin.Context) *sseWriter {
+	return &sseWriter{ctx: ctx, c: c}
+}
+
+func (w *sseWriter) Context() context.Context { return w.ctx }
+func (w *sseWriter) Data(data any) error      { return w.Send(SSEEvent{Data: data}) }
+func (w *sseWriter) Send(event SSEEvent) (err error) {
+	if w.c.Request.Context().Err() != nil {
+		return ErrStreamClosed
+	}
+	buf, err := encodeSSEEvent(event)
+	if err != nil {
+		return
+	}
+	return w.write(buf)
+}
+
+func (w *sseWriter) ping() error { return w.write([]byte(": ping\n\n")) }
+
+func (w *sseWriter) write(buf []byte) (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return ErrStreamClosed
+	}
+	w.start()
+	if _, err = w.c.Writer.Write(buf); err != nil {
+		return
+	}
+	w.flush()
+	return
+}
+
+func (w *sseWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	header := w.c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	w.c.Status(http.StatusOK)
+
+	// streams outlive the server write timeout if the writer supports clearing its deadline
+	if d, ok := w.c.Writer.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		_ = d.SetWriteDeadline(time.Time{})
+	}
+	w.c.Writer.WriteHeaderNow()
+	w.flush()
+}
+
+func (w *sseWriter) flush() {
+	if f, ok := w.c.Writer.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *sseWriter) isStarted() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.started
+}
+
+func (w *sseWriter) close() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.closed = true
+}
+
+func (w *sseWriter) heartbeat(interval time.Duration, done <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-w.c.Request.Context().Done():
+			return
+		case <-ticker.C:
+			if err := w.ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func encodeSSEEvent(event SSEEvent) (buf []byte, err error) {
+	var data string
+	switch v := event.Data.(type) {
+	case nil:
+	case string:
+		data = v
+	case []byte:
+		data = string(v)
+	default:
+		var b []byte
+		if b, err = json.Marshal(v); err != nil {
+			return
+		}
+		data = string(b)
+	}
+
+	b := new(bytes.Buffer)
+	if event.ID != "" {
+		_, _ = fmt.Fprintf(b, "id: %s\n", sseEscape(event.ID))
+	}
+	if event.Event != "" {
+		_, _ = fmt.Fprintf(b, "event: %s\n", sseEscape(event.Event))
+	}
+	if event.Retry > 0 {
+		_, _ = fmt.Fprintf(b, "retry: %d\n", event.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		_, _ = fmt.Fprintf(b, "data: %s\n", line)
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+func sseEscape(s string) string {
+	return strings.NewReplacer("\n", "", "\r", "").Replace(s)
+}
+
+// isStreamHandler returns true when the handler returns a receive channel or writes events via SSEWriter
+// - func(c *gin.Context, w SSEWriter) error
+// - func(c *gin.Context, req Struct, w SSEWriter) error
+// - func(c *gin.Context) (<-chan T, error)
+// - func(c *gin.Context, req Struct) (<-chan T, error)
+func isStreamHandler(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Func {
+		return false
+	}
+	if typ.NumIn() > 1 && typ.In(typ.NumIn()-1) == sseWriterType {
+		return true
+	}
+	return typ.NumOut() == 2 && isStreamChanType(typ.Out(0))
+}
+
+func isStreamChanType(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Chan && typ.ChanDir()&reflect.RecvDir != 0
+}
+
+func (r *router) checkStreamHandlerType(method, uri string, typ reflect.Type) (err error) {
+	numIn := typ.NumIn()
+	withWriter := typ.In(numIn-1) == sseWriterType
+	if withWriter {
+		numIn--
+	}
+	if numIn > 2 {
+		return errors.Errorf("router stream handler should not have more than 2 parameters in "+
+			"besides SSEWriter [method[%s] uri[%s]]", method, uri)
+	}
+	if typ.In(0) != constant.GinContextType {
+		return errors.Errorf("router stream handler first parameter in should be *gin.Context "+
+			"[method[%s] uri[%s]]", method, uri)
+	}
+	if numIn == 2 && !r.checkParamType(typ.In(1), supportParamType) {
+		return errors.Errorf("router stream handler second parameter in type not supportted "+
+			"[method[%s] uri[%s]]", method, uri)
+	}
+	if withWriter && (typ.NumOut() != 1 || !typ.Out(0).AssignableTo(constant.ErrorType)) {
+		return errors.Errorf("router stream handler with SSEWriter should only return error "+
+			"[method[%s] uri[%s]]", method, uri)
+	}
+	if !withWriter && !typ.Out(1).AssignableTo(constant.ErrorType) {
+		return errors.Errorf("router stream handler last paramater out should be error type "+
+			"[method[%s] uri[%s]]", method, uri)
+	}
+	return
+}
+
+func (r *router) wrapStreamHandlerFunc(handler routerHandler, reqParse routerRequestParser) gin.HandlerFunc {
+	typ := reflect.TypeOf(handler)
+	withWriter := typ.In(typ.NumIn()-1) == sseWriterType
+	return func(c *gin.Context) {
+		args := []reflect.Value{reflect.ValueOf(c)}
+		if reqParse != nil {
+			reqVal, err := reqParse(c, typ.In(1))
+			if err != nil {
+				r.rspError(c, nil, Err(c, r.errorCode,
+					Param(map[string]any{"err": fmt.Sprintf(": %s", err.Error())})))
+				c.Next()
+				return
+			}
+			args = append(args, reqVal)
+		}
+
+		ctx, draining, cancel := r.streams.context(c)
+		defer cancel()
+
+		w := newSSEWriter(ctx, c)
+		defer w.close()
+		done := make(chan struct{})
+		defer close(done)
+		go w.heartbeat(r.streams.heartbeat, done)
+
+		var err error
+		if withWriter {
+			args = append(args, reflect.ValueOf(w))
+			if errVal := reflect.ValueOf(handler).Call(args)[0]; !errVal.IsNil() {
+				err = errVal.Interface().(error)
+			}
+		} else {
+			rspVals := reflect.ValueOf(handler).Call(args)
+			if errVal := rspVals[1]; !errVal.IsNil() {
+				err = errVal.Interface().(error)
+			} else if !rspVals[0].IsNil() {
+				err = r.forwardStream(c, w, rspVals[0], draining)
+			}
+		}
+
+		switch {
+		case err == nil, errors.Is(err, ErrStreamClosed), c.Request.Context().Err() != nil:
+		case !w.isStarted():
+			r.rspError(c, nil, err) // nothing has been streamed yet
+		default:
+			code, _, _, _, msg := parseRspError(nil, err)
+			_ = w.Send(SSEEvent{Event: "error", Data: map[string]any{"code": code, "message": msg}})
+		}
+
+		c.Next()
+	}
+}
+
+// forwardStream writes every item received from ch until it is closed, the client disconnects or
+// the drain timeout expires after the server starts shutting down
+func (r *router) forwardStream(c *gin.Context, w *sseWriter, ch reflect.Value,
+	draining <-chan struct{}) (err error) {
+	// keep consuming until the producer closes the channel or the stream context is done, so that producers
+	// selecting on StreamContext never block on a gone client
+	defer func() {
+		drainCases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: ch},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(w.ctx.Done())},
+		}
+		go func() {
+			for {
+				if chosen, _, ok := reflect.Select(drainCases); chosen == 1 || !ok {
+					return
+				}
+			}
+		}()
+	}()
+
+	var drainTimer <-chan time.Time
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Request.Context().Done())},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(draining)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(drainTimer)},
+	}
+	w.mutex.Lock()
+	w.start()
+	w.mutex.Unlock()
+	for {
+		chosen, item, ok := reflect.Select(cases)
+		switch chosen {
+		case 0:
+			if !ok {
+				return
+			}
+			if err = w.Send(toSSEEvent(item)); err != nil {
+				return
+			}
+		case 1:
+			return ErrStreamClosed
+		case 2:
+			// producers observe StreamContext and close the channel, wait for them at most drainTimeout
+			cases[2].Chan = reflect.ValueOf((<-chan struct{})(nil))
+			cases[3].Chan = reflect.ValueOf(time.After(r.streams.drainTimeout))
+		case 3:
+			return ErrStreamClosed
+		}
+	}
+}
+
+func toSSEEvent(item reflect.Value) SSEEvent {
+	if item.Kind() == reflect.Interface && !item.IsNil() {
+		item = item.Elem()
+	}
+	switch {
+	case item.Type() == sseEventType:
+		return item.Interface().(SSEEvent)
+	case item.Kind() == reflect.Ptr && item.Type().Elem() == sseEventType && !item.IsNil():
+		return *(item.Interface().(*SSEEvent))
+	default:
+		return SSEEvent{Data: item.Interface()}
+	}
+}
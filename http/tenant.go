@@ -0,0 +1,94 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+
+	"github.com/wfusion/gofusion/common/utils"
+
+	fusCtx "github.com/wfusion/gofusion/context"
+)
+
+const (
+	defaultTenantHeader = "X-Tenant-ID"
+	defaultTenantClaim  = "tenant_id"
+)
+
+type tenantOption struct {
+	header     string
+	claim      string
+	optional   bool
+	fromHeader bool
+}
+
+// TenantHeader sets the request header carrying the tenant id, X-Tenant-ID by default
+func TenantHeader(header string) utils.OptionFunc[tenantOption] {
+	return func(o *tenantOption) {
+		o.header = header
+	}
+}
+
+// TenantClaim sets the claim of the authenticated principal carrying the tenant id, tenant_id by default
+func TenantClaim(claim string) utils.OptionFunc[tenantOption] {
+	return func(o *tenantOption) {
+		o.claim = claim
+	}
+}
+
+// TenantFromHeader falls back to the header for requests without the tenant claim, including ones not
+// authenticated, it should only be used when the header is trusted, e.g. set by a gateway
+func TenantFromHeader() utils.OptionFunc[tenantOption] {
+	return func(o *tenantOption) {
+		o.fromHeader = true
+	}
+}
+
+// TenantOptional passes requests without a tenant id instead of responding 403
+func TenantOptional() utils.OptionFunc[tenantOption] {
+	return func(o *tenantOption) {
+		o.optional = true
+	}
+}
+
+// Tenant middleware writes the tenant id into context.KeyTenantID from the claim of the authenticated principal,
+// or from the header only with TenantFromHeader, so that requests cannot pick other tenants by the header, and
+// responds 403 if there is none
+func Tenant(opts ...utils.OptionExtender) gin.HandlerFunc {
+	opt := utils.ApplyOptions[useOption](opts...)
+	optT := utils.ApplyOptions[tenantOption](opts...)
+	if optT.header == "" {
+		optT.header = defaultTenantHeader
+	}
+	if optT.claim == "" {
+		optT.claim = defaultTenantClaim
+	}
+	a := getAuth(opt.appName, opt.serverName())
+
+	return func(c *gin.Context) {
+		tenantID := ""
+		if p := GetPrincipal(c); p != nil {
+			tenantID = cast.ToString(p.Claims[optT.claim])
+		} else if claims, ok := c.Get(fusCtx.KeyClaims); ok {
+			if m, ok := claims.(map[string]any); ok {
+				tenantID = cast.ToString(m[optT.claim])
+			}
+		}
+		if tenantID = strings.TrimSpace(tenantID); tenantID == "" && optT.fromHeader {
+			tenantID = strings.TrimSpace(c.GetHeader(optT.header))
+		}
+
+		if tenantID == "" && !optT.optional {
+			c.Status(http.StatusForbidden)
+			rspError(c, a.appName, a.forbiddenCode, nil, 0, 0, Err(c, a.forbiddenCode).Error())
+			c.Abort()
+			return
+		}
+		if tenantID != "" {
+			c.Set(fusCtx.KeyTenantID, tenantID)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,280 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/routine"
+)
+
+var (
+	clientAuthTypes = map[string]tls.ClientAuthType{
+		"no":                 tls.NoClientCert,
+		"request":            tls.RequestClientCert,
+		"require_any":        tls.RequireAnyClientCert,
+		"verify_if_given":    tls.VerifyClientCertIfGiven,
+		"require_and_verify": tls.RequireAndVerifyClientCert,
+	}
+)
+
+// tlsServer is the graceful server which reloads certificates on SIGHUP
+type tlsServer interface {
+	RegisterOnShutdown(f func())
+	RegisterReloadHook(f func())
+}
+
+// setupServerTLS replaces the static certificate pair with the reloadable one
+func setupServerTLS(appName string, conf OutputConf, httpSrv *http.Server, srv tlsServer) (err error) {
+	clientAuth, err := parseClientAuth(conf.ClientAuth, conf.ClientCA)
+	if err != nil {
+		return
+	}
+	reloader, err := newCertReloader(appName, conf.Cert, conf.Key, conf.ClientCA)
+	if err != nil {
+		return
+	}
+	httpSrv.TLSConfig = reloader.serverConfig(httpSrv.TLSConfig, clientAuth)
+	if conf.ReloadOnSIGHUP {
+		srv.RegisterReloadHook(reloader.reloadLogged)
+	}
+	srv.RegisterOnShutdown(reloader.close)
+	reloader.start(conf.ReloadInterval)
+	return
+}
+
+// certReloader serves the certificate and ca bundles loaded from files, and reloads them when files changed
+type certReloader struct {
+	appName  string
+	certFile string
+	keyFile  string
+	caFiles  []string
+
+	mutex    sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes map[string]time.Time
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newCertReloader(appName, certFile, keyFile string, caFiles []string) (r *certReloader, err error) {
+	r = &certReloader{
+		appName:  appName,
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFiles:  caFiles,
+		closed:   make(chan struct{}),
+	}
+	if err = r.reload(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (r *certReloader) reload() (err error) {
+	modTimes := make(map[string]time.Time, len(r.caFiles)+2)
+	var cert *tls.Certificate
+	if utils.IsStrNotBlank(r.certFile) || utils.IsStrNotBlank(r.keyFile) {
+		pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return errors.Wrapf(err, "load x509 key pair failed [cert[%s] key[%s]]", r.certFile, r.keyFile)
+		}
+		cert = &pair
+	}
+
+	var pool *x509.CertPool
+	if len(r.caFiles) > 0 {
+		pool = x509.NewCertPool()
+		for _, caFile := range r.caFiles {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return errors.Wrapf(err, "read ca bundle failed [ca[%s]]", caFile)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return errors.Errorf("no certificate found in ca bundle [ca[%s]]", caFile)
+			}
+		}
+	}
+
+	for _, file := range r.files() {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cert, r.pool, r.modTimes = cert, pool, modTimes
+	return
+}
+
+// reloadLogged keeps serving the previous certificates if reloading failed
+func (r *certReloader) reloadLogged() {
+	pid := syscall.Getpid()
+	app := config.Use(r.appName).AppName()
+	if err := r.reload(); err != nil {
+		log.Printf("%v [Gofusion] %s %s reload certificates failed: %s", pid, app, config.ComponentHttp, err)
+		return
+	}
+	log.Printf("%v [Gofusion] %s %s reload certificates success [files%v]",
+		pid, app, config.ComponentHttp, r.files())
+}
+
+func (r *certReloader) changed() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if modTime, ok := r.modTimes[file]; !ok || !modTime.Equal(info.ModTime()) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch polls the modification time of files since the certificates are usually replaced by renaming
+func (r *certReloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.closed:
+			return
+		case <-ticker.C:
+			if r.changed() {
+				r.reloadLogged()
+			}
+		}
+	}
+}
+
+func (r *certReloader) start(interval time.Duration) {
+	if interval > 0 {
+		routine.Go(r.watch, routine.Args(interval), routine.AppName(r.appName))
+	}
+}
+
+func (r *certReloader) close() {
+	r.closeOnce.Do(func() { close(r.closed) })
+}
+
+func (r *certReloader) files() (files []string) {
+	files = make([]string, 0, len(r.caFiles)+2)
+	if utils.IsStrNotBlank(r.certFile) {
+		files = append(files, r.certFile)
+	}
+	if utils.IsStrNotBlank(r.keyFile) {
+		files = append(files, r.keyFile)
+	}
+	return append(files, r.caFiles...)
+}
+
+func (r *certReloader) certificate() *tls.Certificate {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert
+}
+
+func (r *certReloader) certPool() *x509.CertPool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.pool
+}
+
+// serverConfig verifies client certificates by the ca bundles when client auth requires
+func (r *certReloader) serverConfig(base *tls.Config, clientAuth tls.ClientAuthType) (cfg *tls.Config) {
+	if base == nil {
+		base = new(tls.Config)
+	}
+	cfg = base.Clone()
+	if !utils.NewSet(cfg.NextProtos...).Contains("http/1.1") {
+		cfg.NextProtos = append(cfg.NextProtos, "http/1.1")
+	}
+	cfg.ClientAuth = clientAuth
+	cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cert := r.certificate(); cert != nil {
+			return cert, nil
+		}
+		return nil, errors.New("no server certificate")
+	}
+	if len(r.caFiles) == 0 {
+		return
+	}
+
+	// client cas are read per handshake, so the reloaded bundles take effect on new connections
+	cfg.ClientCAs = r.certPool()
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		connCfg := cfg.Clone()
+		connCfg.GetConfigForClient = nil
+		connCfg.ClientCAs = r.certPool()
+		return connCfg, nil
+	}
+	return
+}
+
+// clientConfig presents the client certificate and pins the ca bundles to verify servers
+func (r *certReloader) clientConfig(serverName string, insecureSkipVerify bool) (cfg *tls.Config) {
+	cfg = &tls.Config{ServerName: serverName, InsecureSkipVerify: insecureSkipVerify}
+	if utils.IsStrNotBlank(r.certFile) {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := r.certificate(); cert != nil {
+				return cert, nil
+			}
+			return new(tls.Certificate), nil
+		}
+	}
+	if len(r.caFiles) == 0 || insecureSkipVerify {
+		return
+	}
+
+	// the standard verification reads the static RootCAs, so verify by the reloaded bundles instead
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = func(cs tls.ConnectionState) (err error) {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no server certificate")
+		}
+		opts := x509.VerifyOptions{
+			Roots:         r.certPool(),
+			DNSName:       cs.ServerName,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err = cs.PeerCertificates[0].Verify(opts)
+		return
+	}
+	return
+}
+
+func parseClientAuth(clientAuth string, caFiles []string) (typ tls.ClientAuthType, err error) {
+	if utils.IsStrBlank(clientAuth) {
+		if len(caFiles) > 0 {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+		return tls.NoClientCert, nil
+	}
+	typ, ok := clientAuthTypes[strings.ToLower(clientAuth)]
+	if !ok {
+		return typ, errors.Errorf("unknown http tls client auth: %s", clientAuth)
+	}
+	if typ >= tls.VerifyClientCertIfGiven && len(caFiles) == 0 {
+		return typ, errors.Errorf("http tls client auth %s requires client ca bundles", clientAuth)
+	}
+	return
+}
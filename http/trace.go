@@ -0,0 +1,133 @@
+package http
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/config"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+var (
+	propagatorMap = map[string]propagation.TextMapPropagator{
+		"tracecontext": propagation.TraceContext{},
+		"baggage":      propagation.Baggage{},
+	}
+)
+
+type tracing struct {
+	provider   *trace.TracerProvider
+	propagator propagation.TextMapPropagator
+	closer     io.Closer
+}
+
+func newTracing(ctx context.Context, appName string, conf traceConf) (t *tracing, err error) {
+	exporter, closer, err := newTraceExporter(ctx, conf)
+	if err != nil {
+		return
+	}
+
+	serviceName := conf.ServiceName
+	if utils.IsStrBlank(serviceName) {
+		serviceName = config.Use(appName).AppName()
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return
+	}
+
+	var sampler trace.Sampler
+	switch {
+	case conf.SampleRatio >= 1:
+		sampler = trace.AlwaysSample()
+	case conf.SampleRatio <= 0:
+		sampler = trace.NeverSample()
+	default:
+		sampler = trace.TraceIDRatioBased(conf.SampleRatio)
+	}
+	if conf.ParentBased {
+		sampler = trace.ParentBased(sampler)
+	}
+
+	opts := []trace.TracerProviderOption{trace.WithResource(res), trace.WithSampler(sampler)}
+	if exporter != nil {
+		opts = append(opts, trace.WithBatcher(exporter))
+	}
+
+	propagators := make([]propagation.TextMapPropagator, 0, len(conf.Propagators))
+	for _, name := range conf.Propagators {
+		p, ok := propagatorMap[strings.ToLower(name)]
+		if !ok {
+			return nil, errors.Errorf("unknown trace propagator: %s", name)
+		}
+		propagators = append(propagators, p)
+	}
+
+	return &tracing{
+		provider:   trace.NewTracerProvider(opts...),
+		propagator: propagation.NewCompositeTextMapPropagator(propagators...),
+		closer:     closer,
+	}, nil
+}
+
+func newTraceExporter(ctx context.Context, conf traceConf) (exporter trace.SpanExporter, closer io.Closer,
+	err error) {
+	switch traceExporter(strings.ToLower(string(conf.Exporter))) {
+	case traceExporterOTLP:
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(conf.Endpoint),
+			otlptracehttp.WithURLPath(conf.URLPath),
+			otlptracehttp.WithTimeout(utils.Must(utils.ParseDuration(conf.Timeout))),
+		}
+		if conf.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(conf.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(conf.Headers))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case traceExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case traceExporterFile:
+		if utils.IsStrBlank(conf.FilePath) {
+			return nil, nil, errors.New("trace file exporter file_path is empty")
+		}
+		var f *os.File
+		if f, err = os.OpenFile(conf.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+			return
+		}
+		closer = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case traceExporterNone:
+	default:
+		err = errors.Errorf("unknown trace exporter: %s", conf.Exporter)
+	}
+	return
+}
+
+func (t *tracing) shutdown(ctx context.Context) {
+	_ = t.provider.Shutdown(ctx)
+	if t.closer != nil {
+		utils.CloseAnyway(t.closer)
+	}
+}
+
+func (t *tracing) setGlobal() {
+	otel.SetTracerProvider(t.provider)
+	otel.SetTextMapPropagator(t.propagator)
+}
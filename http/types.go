@@ -23,6 +23,7 @@ type IRouter interface {
 	PUT(uri string, fn routerHandler, opts ...utils.OptionExtender) IRouter
 	OPTIONS(uri string, fn routerHandler, opts ...utils.OptionExtender) IRouter
 	HEAD(uri string, fn routerHandler, opts ...utils.OptionExtender) IRouter
+	WS(uri string, fn routerHandler, opts ...utils.OptionExtender) IRouter
 	Group(relativePath string, handlers ...gin.HandlerFunc) IRouter
 
 	StaticFile(string, string) IRouter
@@ -48,7 +49,11 @@ type Conf struct {
 	TLS             bool                   `yaml:"tls" json:"tls" toml:"tls" default:"false"`
 	Cert            string                 `yaml:"cert" json:"cert" toml:"cert"`
 	Key             string                 `yaml:"key" json:"key" toml:"key"`
-	NextProtos      []string               `yaml:"next_protos" json:"next_protos" toml:"next_protos" default:"[http/1.1]"` // h2, http/1.1 is ok
+	NextProtos      []string               `yaml:"next_protos" json:"next_protos" toml:"next_protos" default:"[http/1.1]"`     // h2, http/1.1 is ok
+	ClientCA        []string               `yaml:"client_ca" json:"client_ca" toml:"client_ca"`                                // ca bundles to verify client certificates
+	ClientAuth      string                 `yaml:"client_auth" json:"client_auth" toml:"client_auth"`                          // no, request, require_any, verify_if_given, require_and_verify
+	ReloadInterval  string                 `yaml:"reload_interval" json:"reload_interval" toml:"reload_interval" default:"1m"` // 0s disables certificate polling
+	ReloadOnSIGHUP  bool                   `yaml:"reload_on_sighup" json:"reload_on_sighup" toml:"reload_on_sighup"`
 	SuccessCode     int                    `yaml:"success_code" json:"success_code" toml:"success_code"`
 	ErrorCode       int                    `yaml:"error_code" json:"error_code" toml:"error_code" default:"-1"`
 	Pprof           bool                   `yaml:"pprof" json:"pprof" toml:"pprof"`
@@ -63,6 +68,18 @@ type Conf struct {
 	Asynq           []asynqConf            `yaml:"asynq" json:"asynq" toml:"asynq"`
 	Clients         map[string]*clientConf `yaml:"clients" json:"clients" toml:"clients"`
 	Metrics         metricsConf            `yaml:"metrics" json:"metrics" toml:"metrics"`
+	Trace           traceConf              `yaml:"trace" json:"trace" toml:"trace"`
+	RateLimit       rateLimitConf          `yaml:"rate_limit" json:"rate_limit" toml:"rate_limit"`
+	OpenAPI         openAPIConf            `yaml:"openapi" json:"openapi" toml:"openapi"`
+	Stream          streamConf             `yaml:"stream" json:"stream" toml:"stream"`
+	WebSocket       wsConf                 `yaml:"websocket" json:"websocket" toml:"websocket"`
+	Auth            authConf               `yaml:"auth" json:"auth" toml:"auth"`
+	Idempotency     idempotencyConf        `yaml:"idempotency" json:"idempotency" toml:"idempotency"`
+	ResponseCache   responseCacheConf      `yaml:"response_cache" json:"response_cache" toml:"response_cache"`
+	Health          healthConf             `yaml:"health" json:"health" toml:"health"`
+	Admin           adminConf              `yaml:"admin" json:"admin" toml:"admin"`
+	Registry        registryConf           `yaml:"registry" json:"registry" toml:"registry"`
+	Servers         map[string]*Conf       `yaml:"servers" json:"servers" toml:"servers"` // named servers, nested servers and clients are ignored
 }
 
 type corsConf struct {
@@ -103,6 +120,66 @@ type clientConf struct {
 	RetryMaxWaitTime      string   `yaml:"retry_max_wait_time" json:"retry_max_wait_time" toml:"retry_max_wait_time" default:"2s"`
 	RetryConditionFuncs   []string `yaml:"retry_condition_funcs" json:"retry_condition_funcs" toml:"retry_condition_funcs"`
 	RetryHooks            []string `yaml:"retry_hooks" json:"retry_hooks" toml:"retry_hooks"`
+	CA                    []string `yaml:"ca" json:"ca" toml:"ca"` // ca bundles to verify servers
+	Cert                  string   `yaml:"cert" json:"cert" toml:"cert"`
+	Key                   string   `yaml:"key" json:"key" toml:"key"`
+	ServerName            string   `yaml:"server_name" json:"server_name" toml:"server_name"`
+	InsecureSkipVerify    bool     `yaml:"insecure_skip_verify" json:"insecure_skip_verify" toml:"insecure_skip_verify"`
+	ReloadInterval        string   `yaml:"reload_interval" json:"reload_interval" toml:"reload_interval" default:"1m"`
+
+	// Deadline limits a request across all retries, while Timeout limits each attempt
+	Deadline       string                   `yaml:"deadline" json:"deadline" toml:"deadline"`
+	CircuitBreaker clientCircuitBreakerConf `yaml:"circuit_breaker" json:"circuit_breaker" toml:"circuit_breaker"`
+	Bulkhead       clientBulkheadConf       `yaml:"bulkhead" json:"bulkhead" toml:"bulkhead"`
+	Hedging        clientHedgingConf        `yaml:"hedging" json:"hedging" toml:"hedging"`
+
+	// Discovery resolves the service through kv and balances requests among its instances
+	Discovery clientDiscoveryConf `yaml:"discovery" json:"discovery" toml:"discovery"`
+}
+
+// clientCircuitBreakerConf http client circuit breaker configure, transport errors and 5xx responses are failures
+//nolint: revive // struct field annotation issue
+type clientCircuitBreakerConf struct {
+	Enable bool `yaml:"enable" json:"enable" toml:"enable"`
+	// MaxRequests is the maximum number of requests allowed to pass through when half-open, 0 means 1
+	MaxRequests uint `yaml:"max_requests" json:"max_requests" toml:"max_requests"`
+	// Interval is the cyclic period of the closed state to clear counts, 0s means never
+	Interval string `yaml:"interval" json:"interval" toml:"interval" default:"0s"`
+	// Timeout is the period of the open state, after which the state becomes half-open
+	Timeout string `yaml:"timeout" json:"timeout" toml:"timeout" default:"60s"`
+	// TripExpr ready to trip expression, defaults to consecutive_failures > 5
+	// support params: requests, total_successes, total_failures, consecutive_successes, consecutive_failures
+	TripExpr string `yaml:"trip_expr" json:"trip_expr" toml:"trip_expr"`
+}
+
+// clientBulkheadConf http client concurrency bulkhead configure
+//nolint: revive // struct field annotation issue
+type clientBulkheadConf struct {
+	MaxConcurrency int    `yaml:"max_concurrency" json:"max_concurrency" toml:"max_concurrency"` // 0 disables the bulkhead
+	MaxWait        string `yaml:"max_wait" json:"max_wait" toml:"max_wait" default:"0s"`         // 0s rejects at once when full
+}
+
+// clientHedgingConf http client hedging configure, only GET and HEAD requests without body are hedged
+//nolint: revive // struct field annotation issue
+type clientHedgingConf struct {
+	Delay       string `yaml:"delay" json:"delay" toml:"delay"` // send another attempt if no response after the delay
+	MaxAttempts int    `yaml:"max_attempts" json:"max_attempts" toml:"max_attempts" default:"2"`
+}
+
+// clientDiscoveryConf http client service discovery configure, requests to scheme://service are sent to
+// instances of the service, the host of the url is set as the service name if the base url is not set
+//nolint: revive // struct field annotation issue
+type clientDiscoveryConf struct {
+	Service         string `yaml:"service" json:"service" toml:"service"` // empty disables the discovery
+	KV              string `yaml:"kv" json:"kv" toml:"kv" default:"default"`
+	Prefix          string `yaml:"prefix" json:"prefix" toml:"prefix" default:"/gofusion/services/"` // etcd and redis only
+	Scheme          string `yaml:"scheme" json:"scheme" toml:"scheme" default:"http"`
+	Balancer        string `yaml:"balancer" json:"balancer" toml:"balancer" default:"round_robin"` // round_robin, least_in_flight, consistent_hash
+	HashHeader      string `yaml:"hash_header" json:"hash_header" toml:"hash_header"`              // consistent hash key, url path if empty
+	RefreshInterval string `yaml:"refresh_interval" json:"refresh_interval" toml:"refresh_interval" default:"10s"`
+	// MaxFailures is the consecutive failures after which an instance is ejected, 0 disables the ejection
+	MaxFailures  int    `yaml:"max_failures" json:"max_failures" toml:"max_failures" default:"5"`
+	EjectionTime string `yaml:"ejection_time" json:"ejection_time" toml:"ejection_time" default:"30s"`
 }
 
 // metricsConf http metrics configure
@@ -110,30 +187,211 @@ type metricsConf struct {
 	HeaderLabels []string `yaml:"header_labels" json:"header_labels" toml:"header_labels"`
 }
 
+// traceConf http opentelemetry tracing configure
+//nolint: revive // struct field annotation issue
+type traceConf struct {
+	Enable       bool              `yaml:"enable" json:"enable" toml:"enable"`
+	ServiceName  string            `yaml:"service_name" json:"service_name" toml:"service_name"`
+	Exporter     traceExporter     `yaml:"exporter" json:"exporter" toml:"exporter" default:"otlp"`
+	Endpoint     string            `yaml:"endpoint" json:"endpoint" toml:"endpoint" default:"localhost:4318"` // otlp http endpoint
+	URLPath      string            `yaml:"url_path" json:"url_path" toml:"url_path" default:"/v1/traces"`
+	Insecure     bool              `yaml:"insecure" json:"insecure" toml:"insecure"`
+	Headers      map[string]string `yaml:"headers" json:"headers" toml:"headers"`
+	Timeout      string            `yaml:"timeout" json:"timeout" toml:"timeout" default:"10s"`
+	FilePath     string            `yaml:"file_path" json:"file_path" toml:"file_path"` // file exporter output path
+	SampleRatio  float64           `yaml:"sample_ratio" json:"sample_ratio" toml:"sample_ratio" default:"1"`
+	ParentBased  bool              `yaml:"parent_based" json:"parent_based" toml:"parent_based" default:"true"`
+	Propagators  []string          `yaml:"propagators" json:"propagators" toml:"propagators" default:"[tracecontext, baggage]"`
+	ExcludePaths []string          `yaml:"exclude_paths" json:"exclude_paths" toml:"exclude_paths" default:"[/health]"`
+}
+
+// rateLimitConf http rate limit configure
+//nolint: revive // struct field annotation issue
+type rateLimitConf struct {
+	Enable       bool               `yaml:"enable" json:"enable" toml:"enable"`
+	Algorithm    RateLimitAlgorithm `yaml:"algorithm" json:"algorithm" toml:"algorithm" default:"token_bucket"`
+	Rate         int                `yaml:"rate" json:"rate" toml:"rate"` // permitted requests per interval
+	Interval     string             `yaml:"interval" json:"interval" toml:"interval" default:"1s"`
+	Burst        int                `yaml:"burst" json:"burst" toml:"burst"` // token bucket capacity, defaults to rate
+	KeyBy        RateLimitKeyBy     `yaml:"key_by" json:"key_by" toml:"key_by" default:"ip"`
+	Header       string             `yaml:"header" json:"header" toml:"header"`
+	Instance     string             `yaml:"instance" json:"instance" toml:"instance"` // in-process limiter if empty
+	InstanceType instanceType       `yaml:"instance_type" json:"instance_type" toml:"instance_type"`
+	ErrorCode    int                `yaml:"error_code" json:"error_code" toml:"error_code" default:"-429"`
+	WhiteURLList []string           `yaml:"white_url_list" json:"white_url_list" toml:"white_url_list"`
+}
+
+// idempotencyConf http idempotency key configure
+//nolint: revive // struct field annotation issue
+type idempotencyConf struct {
+	Enable       bool         `yaml:"enable" json:"enable" toml:"enable"`
+	Header       string       `yaml:"header" json:"header" toml:"header" default:"Idempotency-Key"`
+	Methods      []string     `yaml:"methods" json:"methods" toml:"methods" default:"[POST, PATCH]"`
+	TTL          string       `yaml:"ttl" json:"ttl" toml:"ttl" default:"24h"                          ` // how long responses are replayed
+	WaitTimeout  string       `yaml:"wait_timeout" json:"wait_timeout" toml:"wait_timeout" default:"0s"` // 409 immediately if zero
+	Instance     string       `yaml:"instance" json:"instance" toml:"instance"                         ` // in-process store if empty
+	InstanceType instanceType `yaml:"instance_type" json:"instance_type" toml:"instance_type"          ` // redis or cache
+	LockInstance string       `yaml:"lock_instance" json:"lock_instance" toml:"lock_instance"          ` // in-process lock if empty
+	LockExpire   string       `yaml:"lock_expire" json:"lock_expire" toml:"lock_expire" default:"1m"`
+	ErrorCode    int          `yaml:"error_code" json:"error_code" toml:"error_code" default:"-409"`
+	MismatchCode int          `yaml:"mismatch_code" json:"mismatch_code" toml:"mismatch_code" default:"-422"`
+	WhiteURLList []string     `yaml:"white_url_list" json:"white_url_list" toml:"white_url_list"`
+}
+
+// responseCacheConf http response cache configure, routes are cached with the http.Cached option
+//nolint: revive // struct field annotation issue
+type responseCacheConf struct {
+	Instance    string   `yaml:"instance" json:"instance" toml:"instance"` // cache instance, in-process store if empty
+	TTL         string   `yaml:"ttl" json:"ttl" toml:"ttl" default:"1m"`
+	TagTTL      string   `yaml:"tag_ttl" json:"tag_ttl" toml:"tag_ttl" default:"24h"` // tagged responses expire no later
+	VaryHeaders []string `yaml:"vary_headers" json:"vary_headers" toml:"vary_headers" default:"[Accept, Accept-Language]"`
+	MaxBodySize int      `yaml:"max_body_size" json:"max_body_size" toml:"max_body_size" default:"1048576"` // 0 is unlimited
+}
+
+// openAPIConf http openapi document configure
+//nolint: revive // struct field annotation issue
+type openAPIConf struct {
+	Enable         bool   `yaml:"enable" json:"enable" toml:"enable"`
+	Path           string `yaml:"path" json:"path" toml:"path" default:"/openapi.json"`
+	Title          string `yaml:"title" json:"title" toml:"title"` // defaults to the app name
+	Description    string `yaml:"description" json:"description" toml:"description"`
+	Version        string `yaml:"version" json:"version" toml:"version" default:"1.0.0"`
+	SwaggerUI      bool   `yaml:"swagger_ui" json:"swagger_ui" toml:"swagger_ui"`
+	SwaggerUIPath  string `yaml:"swagger_ui_path" json:"swagger_ui_path" toml:"swagger_ui_path" default:"/swagger"`
+	SwaggerUIAsset string `yaml:"swagger_ui_asset" json:"swagger_ui_asset" toml:"swagger_ui_asset" default:"https://unpkg.com/swagger-ui-dist@5"`
+}
+
+// healthConf http health, readiness and liveness endpoints configure
+//nolint: revive // struct field annotation issue
+type healthConf struct {
+	Enable        bool     `yaml:"enable" json:"enable" toml:"enable"`
+	HealthzPath   string   `yaml:"healthz_path" json:"healthz_path" toml:"healthz_path" default:"/healthz"`
+	ReadyzPath    string   `yaml:"readyz_path" json:"readyz_path" toml:"readyz_path" default:"/readyz"`
+	LivezPath     string   `yaml:"livez_path" json:"livez_path" toml:"livez_path" default:"/livez"`
+	Timeout       string   `yaml:"timeout" json:"timeout" toml:"timeout" default:"3s"`
+	NonCritical   []string `yaml:"non_critical" json:"non_critical" toml:"non_critical"` // e.g. redis.cache, mq
+	ShutdownDelay string   `yaml:"shutdown_delay" json:"shutdown_delay" toml:"shutdown_delay" default:"0s"`
+}
+
+// adminConf http runtime admin api configure
+//nolint: revive // struct field annotation issue
+type adminConf struct {
+	Enable         bool     `yaml:"enable" json:"enable" toml:"enable"`
+	Path           string   `yaml:"path" json:"path" toml:"path" default:"/admin"`
+	Authenticators []string `yaml:"authenticators" json:"authenticators" toml:"authenticators"` // names in auth, unprotected if empty
+}
+
+// registryConf http server self-registration configure, the server registers itself through kv on start and
+// deregisters on shutdown
+//nolint: revive // struct field annotation issue
+type registryConf struct {
+	Enable  bool              `yaml:"enable" json:"enable" toml:"enable"`
+	KV      string            `yaml:"kv" json:"kv" toml:"kv" default:"default"`
+	Service string            `yaml:"service" json:"service" toml:"service"` // app name if empty
+	Address string            `yaml:"address" json:"address" toml:"address"` // local ip if empty
+	Port    int               `yaml:"port" json:"port" toml:"port"`          // server port if 0
+	TTL     string            `yaml:"ttl" json:"ttl" toml:"ttl" default:"15s"`
+	Prefix  string            `yaml:"prefix" json:"prefix" toml:"prefix" default:"/gofusion/services/"` // etcd and redis only
+	Meta    map[string]string `yaml:"meta" json:"meta" toml:"meta"`
+}
+
+// streamConf http server-sent events and streaming response configure
+//nolint: revive // struct field annotation issue
+type streamConf struct {
+	HeartbeatInterval string `yaml:"heartbeat_interval" json:"heartbeat_interval" toml:"heartbeat_interval" default:"15s"`
+	DrainTimeout      string `yaml:"drain_timeout" json:"drain_timeout" toml:"drain_timeout" default:"10s"` // wait producers on shutdown
+}
+
+// wsConf http websocket configure
+//nolint: revive // struct field annotation issue
+type wsConf struct {
+	PingInterval      string   `yaml:"ping_interval" json:"ping_interval" toml:"ping_interval" default:"30s"`
+	PongTimeout       string   `yaml:"pong_timeout" json:"pong_timeout" toml:"pong_timeout" default:"60s"`
+	WriteTimeout      string   `yaml:"write_timeout" json:"write_timeout" toml:"write_timeout" default:"10s"`
+	ReadLimit         int64    `yaml:"read_limit" json:"read_limit" toml:"read_limit" default:"1048576"` // max message bytes
+	ReadBufferSize    int      `yaml:"read_buffer_size" json:"read_buffer_size" toml:"read_buffer_size"`
+	WriteBufferSize   int      `yaml:"write_buffer_size" json:"write_buffer_size" toml:"write_buffer_size"`
+	EnableCompression bool     `yaml:"enable_compression" json:"enable_compression" toml:"enable_compression"`
+	AllowOrigins      []string `yaml:"allow_origins" json:"allow_origins" toml:"allow_origins"` // same origin only if empty
+}
+
+// authConf http authentication configure
+//nolint: revive // struct field annotation issue
+type authConf struct {
+	UnauthorizedCode int                           `yaml:"unauthorized_code" json:"unauthorized_code" toml:"unauthorized_code" default:"-401"`
+	ForbiddenCode    int                           `yaml:"forbidden_code" json:"forbidden_code" toml:"forbidden_code" default:"-403"`
+	Authenticators   map[string]*authenticatorConf `yaml:"authenticators" json:"authenticators" toml:"authenticators"`
+}
+
+// authenticatorConf http authenticator configure
+//nolint: revive // struct field annotation issue
+type authenticatorConf struct {
+	Type   AuthType `yaml:"type" json:"type" toml:"type"`
+	Header string   `yaml:"header" json:"header" toml:"header"` // Authorization for jwt, X-API-Key for api_key
+	Scheme string   `yaml:"scheme" json:"scheme" toml:"scheme" default:"Bearer"`
+	Query  string   `yaml:"query" json:"query" toml:"query"` // query parameter fallback, e.g. for websocket
+
+	// jwt
+	Algorithms  []string `yaml:"algorithms" json:"algorithms" toml:"algorithms" default:"[RS256, ES256, HS256]"`
+	Secret      string   `yaml:"secret" json:"secret" toml:"secret"`             // hs key
+	PublicKey   string   `yaml:"public_key" json:"public_key" toml:"public_key"` // rs/es/ed pem file path
+	JWKS        string   `yaml:"jwks" json:"jwks" toml:"jwks"`                   // jwks file path or url
+	JWKSRefresh string   `yaml:"jwks_refresh" json:"jwks_refresh" toml:"jwks_refresh" default:"10m"`
+	Issuer      string   `yaml:"issuer" json:"issuer" toml:"issuer"`
+	Audience    string   `yaml:"audience" json:"audience" toml:"audience"`
+	Leeway      string   `yaml:"leeway" json:"leeway" toml:"leeway" default:"0s"`
+	UserClaim   string   `yaml:"user_claim" json:"user_claim" toml:"user_claim" default:"sub"`
+
+	// api key
+	APIKeys map[string]string `yaml:"api_keys" json:"api_keys" toml:"api_keys"` // api key -> user id
+
+	// hmac
+	HMACKeys      map[string]string `yaml:"hmac_keys" json:"hmac_keys" toml:"hmac_keys"` // key id -> secret
+	HMACAlgorithm string            `yaml:"hmac_algorithm" json:"hmac_algorithm" toml:"hmac_algorithm" default:"sha256"`
+	MaxSkew       string            `yaml:"max_skew" json:"max_skew" toml:"max_skew" default:"5m"`
+}
+
 type OutputConf struct {
-	Port         int
-	TLS          bool
-	Cert         string
-	Key          string
-	NextProtos   []string
-	SuccessCode  int
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	AsynqConf    []asynqConf
+	Port           int
+	TLS            bool
+	Cert           string
+	Key            string
+	NextProtos     []string
+	ClientCA       []string
+	ClientAuth     string
+	ReloadInterval time.Duration
+	ReloadOnSIGHUP bool
+	SuccessCode    int
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	AsynqConf      []asynqConf
 }
 
 type cfg struct {
-	c       *clientConf
-	appName string
-	logger  resty.Logger
+	c          *clientConf
+	appName    string
+	logger     resty.Logger
+	reloader   *certReloader
+	resilience *clientResilience
+	discovery  *clientDiscovery
 }
 
 type instanceType string
 
 const (
 	instanceTypeRedis instanceType = "redis"
+	instanceTypeCache instanceType = "cache"
+)
+
+type traceExporter string
+
+const (
+	traceExporterOTLP   traceExporter = "otlp"
+	traceExporterStdout traceExporter = "stdout"
+	traceExporterFile   traceExporter = "file"
+	traceExporterNone   traceExporter = "none"
 )
 
 type customLogger interface {
-	Init(log log.Loggable, appName string)
+	Init(log log.Loggable, appName, name string)
 }
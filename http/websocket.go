@@ -0,0 +1,508 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+
+	"github.com/wfusion/gofusion/common/constant"
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/common/utils/serialize/json"
+	"github.com/wfusion/gofusion/http/parser"
+	"github.com/wfusion/gofusion/mq"
+	"github.com/wfusion/gofusion/routine"
+
+	fusCtx "github.com/wfusion/gofusion/context"
+)
+
+var (
+	wsConnType = reflect.TypeOf((*WSConn)(nil)).Elem()
+	bytesType  = reflect.TypeOf([]byte(nil))
+
+	// ErrWSConnClosed returned by WSConn when the connection has been closed
+	ErrWSConnClosed = errors.New("websocket connection closed")
+)
+
+// WSConn websocket connection of a WS route, it is safe for concurrent use
+type WSConn interface {
+	// ID unique connection id
+	ID() string
+	// Context carries the user id, trace id and languages of the upgrade request,
+	// it is done when the connection is closed
+	Context() context.Context
+	// Send writes a json message, string and []byte are written as is
+	Send(msg any) error
+	// Close closes the connection normally
+	Close() error
+}
+
+type wsOption struct {
+	onConnect func(c *gin.Context, conn WSConn) error
+	onClose   func(c *gin.Context, conn WSConn)
+	hubs      []*WSHub
+}
+
+// WSOnConnect is called after upgraded, the connection is closed if it returns an error
+func WSOnConnect(fn func(c *gin.Context, conn WSConn) error) utils.OptionFunc[wsOption] {
+	return func(o *wsOption) {
+		o.onConnect = fn
+	}
+}
+
+// WSOnClose is called after the connection is closed
+func WSOnClose(fn func(c *gin.Context, conn WSConn)) utils.OptionFunc[wsOption] {
+	return func(o *wsOption) {
+		o.onClose = fn
+	}
+}
+
+// WSJoin joins every connection of the route into the hubs
+func WSJoin(hubs ...*WSHub) utils.OptionFunc[wsOption] {
+	return func(o *wsOption) {
+		o.hubs = append(o.hubs, hubs...)
+	}
+}
+
+// wsGroup tracks open websocket connections so that they are closed gracefully on shutdown
+type wsGroup struct {
+	upgrader     *websocket.Upgrader
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	writeTimeout time.Duration
+	readLimit    int64
+
+	mutex sync.RWMutex
+	conns map[*wsConn]struct{}
+}
+
+func newWSGroup() *wsGroup {
+	return &wsGroup{
+		upgrader:     &websocket.Upgrader{},
+		pingInterval: 30 * time.Second,
+		pongTimeout:  60 * time.Second,
+		writeTimeout: 10 * time.Second,
+		readLimit:    1 << 20,
+		conns:        make(map[*wsConn]struct{}),
+	}
+}
+
+func (g *wsGroup) init(conf wsConf) {
+	g.pingInterval = utils.Must(utils.ParseDuration(conf.PingInterval))
+	g.pongTimeout = utils.Must(utils.ParseDuration(conf.PongTimeout))
+	g.writeTimeout = utils.Must(utils.ParseDuration(conf.WriteTimeout))
+	g.readLimit = conf.ReadLimit
+
+	allowOrigins := utils.NewSet(conf.AllowOrigins...)
+	g.upgrader = &websocket.Upgrader{
+		ReadBufferSize:    conf.ReadBufferSize,
+		WriteBufferSize:   conf.WriteBufferSize,
+		EnableCompression: conf.EnableCompression,
+	}
+	if allowOrigins.Size() > 0 {
+		g.upgrader.CheckOrigin = func(r *http.Request) bool {
+			return allowOrigins.Contains("*") || allowOrigins.Contains(r.Header.Get("Origin"))
+		}
+	}
+}
+
+func (g *wsGroup) add(c *gin.Context, conn *websocket.Conn, hubs []*WSHub) (w *wsConn) {
+	ctx, cancel := context.WithCancel(fusCtx.New(fusCtx.Gin(c)))
+	w = &wsConn{
+		id:     utils.UUID(),
+		ctx:    ctx,
+		cancel: cancel,
+		conn:   conn,
+		group:  g,
+		hubs:   hubs,
+	}
+	for _, hub := range hubs {
+		hub.join(w)
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.conns[w] = struct{}{}
+	return
+}
+
+func (g *wsGroup) remove(w *wsConn) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.conns, w)
+}
+
+// shutdown sends going away close frames to all open connections, it is registered as the http.Server shutdown hook
+func (g *wsGroup) shutdown() {
+	g.mutex.RLock()
+	conns := make([]*wsConn, 0, len(g.conns))
+	for w := range g.conns {
+		conns = append(conns, w)
+	}
+	g.mutex.RUnlock()
+
+	for _, w := range conns {
+		_ = w.close(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+type wsConn struct {
+	id     string
+	ctx    context.Context
+	cancel context.CancelFunc
+	conn   *websocket.Conn
+	group  *wsGroup
+	hubs   []*WSHub
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+func (w *wsConn) ID() string               { return w.id }
+func (w *wsConn) Context() context.Context { return w.ctx }
+func (w *wsConn) Close() error             { return w.close(websocket.CloseNormalClosure, "") }
+func (w *wsConn) Send(msg any) (err error) {
+	var payload []byte
+	switch v := msg.(type) {
+	case []byte:
+		payload = v
+	case string:
+		payload = []byte(v)
+	default:
+		if payload, err = json.Marshal(v); err != nil {
+			return
+		}
+	}
+	return w.write(websocket.TextMessage, payload)
+}
+
+func (w *wsConn) write(messageType int, payload []byte) (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return ErrWSConnClosed
+	}
+	if err = w.conn.SetWriteDeadline(time.Now().Add(w.group.writeTimeout)); err != nil {
+		return
+	}
+	return w.conn.WriteMessage(messageType, payload)
+}
+
+func (w *wsConn) ping() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return ErrWSConnClosed
+	}
+	return w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(w.group.writeTimeout))
+}
+
+func (w *wsConn) close(code int, text string) (err error) {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return
+	}
+	w.closed = true
+	_ = w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text),
+		time.Now().Add(w.group.writeTimeout))
+	err = w.conn.Close()
+	w.mutex.Unlock()
+
+	w.cancel()
+	w.group.remove(w)
+	for _, hub := range w.hubs {
+		hub.leave(w)
+	}
+	return
+}
+
+func (w *wsConn) keepalive() {
+	if w.group.pingInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(w.group.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (r *router) WS(uri string, fn routerHandler, opts ...utils.OptionExtender) IRouter {
+	opt := utils.ApplyOptions[routerOption](opts...)
+	wsOpt := utils.ApplyOptions[wsOption](opts...)
+
+	handlers := make(gin.HandlersChain, 0, len(opt.beforeHandlers)+2)
+	if rl := getRateLimit(r.appName, r.name); rl != nil {
+		if limitHandler := rl.handler(http.MethodGet, uri, opt.rateLimit); limitHandler != nil {
+			handlers = append(handlers, limitHandler)
+		}
+	}
+	for _, hdr := range opt.beforeHandlers {
+		handlers = append(handlers, r.convert(http.MethodGet, uri, hdr, opt))
+	}
+	handlers = append(handlers, r.convertWS(uri, fn, wsOpt))
+	r.use().GET(uri, handlers...)
+	return r
+}
+
+// convertWS
+// support websocket handler signature as follows, messages are parsed by the json parser:
+// - func(c *gin.Context, conn WSConn, msg []byte) error
+// - func(c *gin.Context, conn WSConn, msg *Struct) error
+// - func(c *gin.Context, conn WSConn, msg *Struct) (rsp *Struct, err error)
+// - func(c *gin.Context, conn WSConn, msg map[string]any) (rsp any, err error)
+func (r *router) convertWS(uri string, handler routerHandler, opt *wsOption) gin.HandlerFunc {
+	typ := reflect.TypeOf(handler)
+	if err := r.checkWSHandlerType(uri, typ); err != nil {
+		panic(err)
+	}
+
+	return func(c *gin.Context) {
+		conn, err := r.sockets.upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// upgrader has replied with an http error
+			c.Abort()
+			return
+		}
+		// hijacked connection should not be written by gin anymore
+		c.Abort()
+
+		w := r.sockets.add(c, conn, opt.hubs)
+		defer func() {
+			_ = w.Close()
+			if opt.onClose != nil {
+				opt.onClose(c, w)
+			}
+		}()
+
+		conn.SetReadLimit(r.sockets.readLimit)
+		if r.sockets.pongTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(r.sockets.pongTimeout))
+			conn.SetPongHandler(func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(r.sockets.pongTimeout))
+			})
+		}
+		if opt.onConnect != nil {
+			if err = opt.onConnect(c, w); err != nil {
+				_ = w.close(websocket.ClosePolicyViolation, err.Error())
+				return
+			}
+		}
+		routine.Go(w.keepalive, routine.AppName(r.appName))
+
+		for {
+			messageType, payload, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+				continue
+			}
+			if r.sockets.pongTimeout > 0 {
+				_ = conn.SetReadDeadline(time.Now().Add(r.sockets.pongTimeout))
+			}
+			if err = r.handleWSMessage(c, w, handler, payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (r *router) checkWSHandlerType(uri string, typ reflect.Type) (err error) {
+	if typ.Kind() != reflect.Func {
+		return errors.Errorf("websocket handler should be a function [uri[%s]]", uri)
+	}
+	if typ.NumIn() != 3 || typ.In(0) != constant.GinContextType || typ.In(1) != wsConnType {
+		return errors.Errorf("websocket handler parameter in should be (*gin.Context, WSConn, message) "+
+			"[uri[%s]]", uri)
+	}
+	if typ.In(2) != bytesType && !r.checkParamType(typ.In(2), supportParamType) {
+		return errors.Errorf("websocket handler message type not supportted [uri[%s]]", uri)
+	}
+	if typ.NumOut() < 1 || typ.NumOut() > 2 || !typ.Out(typ.NumOut()-1).AssignableTo(constant.ErrorType) {
+		return errors.Errorf("websocket handler parameter out should be error or (data, error) [uri[%s]]", uri)
+	}
+	if typ.NumOut() == 2 && !r.checkParamType(typ.Out(0), supportDataType) {
+		return errors.Errorf("websocket handler parameter out format is illegal [uri[%s]]", uri)
+	}
+	return
+}
+
+// handleWSMessage calls the handler with the parsed message and replies the result in the response envelope,
+// it only returns an error when the reply cannot be written
+func (r *router) handleWSMessage(c *gin.Context, w *wsConn, handler routerHandler, payload []byte) (err error) {
+	typ := reflect.TypeOf(handler)
+	msgVal, err := r.parseWSMessage(typ.In(2), payload)
+	if err != nil {
+		return r.replyWSError(c, w, Err(c, r.errorCode, Param(map[string]any{"err": fmt.Sprintf(": %s", err)})))
+	}
+
+	rspVals := reflect.ValueOf(handler).Call([]reflect.Value{reflect.ValueOf(c), reflect.ValueOf(w), msgVal})
+	if errVal := rspVals[len(rspVals)-1]; !errVal.IsNil() {
+		return r.replyWSError(c, w, errVal.Interface().(error))
+	}
+	if len(rspVals) == 1 {
+		return
+	}
+
+	data, page, count, msg := parseRspSuccess(rspVals[:1])
+	if msg == "" {
+		msg = "ok"
+	}
+	rsp := &Response{Code: r.successCode, Message: msg, Data: data, TraceID: fusCtx.GetTraceID(w.ctx)}
+	if page > 0 {
+		rsp.Page = utils.AnyPtr(page)
+	}
+	if count > 0 {
+		rsp.Count = utils.AnyPtr(count)
+	}
+	return w.Send(rsp)
+}
+
+func (r *router) replyWSError(c *gin.Context, w *wsConn, err error) error {
+	code, _, _, _, msg := parseRspError(nil, err)
+	return w.Send(&Response{Code: code, Message: msg, TraceID: c.GetString(fusCtx.KeyTraceID)})
+}
+
+func (r *router) parseWSMessage(typ reflect.Type, payload []byte) (dst reflect.Value, err error) {
+	if typ == bytesType {
+		return reflect.ValueOf(payload), nil
+	}
+
+	ptrDepth := 0
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+		ptrDepth++
+	}
+	defer func() {
+		for ptrDepth > 0 {
+			dst = dst.Addr()
+			ptrDepth--
+		}
+	}()
+
+	dst = reflect.Indirect(reflect.New(typ))
+	p, err := parser.GetByContentType(gin.MIMEJSON)
+	if err != nil {
+		return
+	}
+	if err = p.Parse(bytes.NewReader(payload), dst); err != nil {
+		return
+	}
+	if err = utils.ParseTag(
+		dst.Addr().Interface(),
+		utils.ParseTagName("default"),
+		utils.ParseTagUnmarshalType(utils.MarshalTypeYaml),
+	); err != nil {
+		return
+	}
+	if typ.Kind() == reflect.Struct && binding.Validator != nil {
+		if err = binding.Validator.ValidateStruct(dst.Addr().Interface()); err != nil {
+			err = parseGinBindingValidatorError(err)
+		}
+	}
+	return
+}
+
+// WSHub broadcasts messages to the websocket connections joined by WSJoin, when the hub is backed by mq,
+// messages are published to the topic and every replica subscribing the same topic delivers them to its clients
+type WSHub struct {
+	ctx     context.Context
+	appName string
+	pub     mq.Publisher
+
+	mutex sync.RWMutex
+	conns map[*wsConn]struct{}
+}
+
+// NewWSHub creates a hub, sub and pub should be bound to the same topic, or both be nil for a local only hub
+func NewWSHub(ctx context.Context, sub mq.Subscriber, pub mq.Publisher, opts ...utils.OptionExtender) *WSHub {
+	opt := utils.ApplyOptions[useOption](opts...)
+	h := &WSHub{
+		ctx:     ctx,
+		appName: opt.appName,
+		pub:     pub,
+		conns:   make(map[*wsConn]struct{}),
+	}
+	if sub != nil {
+		msgCh := utils.Must(sub.SubscribeRaw(ctx))
+		routine.Go(func() {
+			for msg := range msgCh {
+				h.deliver(msg.Payload())
+				msg.Ack()
+			}
+		}, routine.AppName(h.appName))
+	}
+	return h
+}
+
+// Broadcast sends msg to every joined connection of all replicas
+func (h *WSHub) Broadcast(ctx context.Context, msg any) (err error) {
+	var payload []byte
+	switch v := msg.(type) {
+	case []byte:
+		payload = v
+	case string:
+		payload = []byte(v)
+	default:
+		if payload, err = json.Marshal(v); err != nil {
+			return
+		}
+	}
+
+	if h.pub == nil {
+		h.deliver(payload)
+		return
+	}
+	return h.pub.PublishRaw(ctx, mq.Messages(mq.NewMessage(utils.UUID(), payload)))
+}
+
+// Len returns the number of local connections joined
+func (h *WSHub) Len() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.conns)
+}
+
+func (h *WSHub) deliver(payload []byte) {
+	h.mutex.RLock()
+	conns := make([]*wsConn, 0, len(h.conns))
+	for w := range h.conns {
+		conns = append(conns, w)
+	}
+	h.mutex.RUnlock()
+
+	for _, w := range conns {
+		if err := w.write(websocket.TextMessage, payload); err != nil && !errors.Is(err, ErrWSConnClosed) {
+			_ = w.close(websocket.CloseInternalServerErr, "write message failed")
+		}
+	}
+}
+
+func (h *WSHub) join(w *wsConn) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.conns[w] = struct{}{}
+}
+
+func (h *WSHub) leave(w *wsConn) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.conns, w)
+}
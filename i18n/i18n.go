@@ -96,6 +96,11 @@ func (i *bundle[T]) AddMessages(code T, trans map[language.Tag]*Message, opts ..
 	return i
 }
 
+// Codes returns the codes added by AddMessages
+func (i *bundle[T]) Codes() []T {
+	return i.dup.Items()
+}
+
 func (i *bundle[T]) checkDuplicated(code T, trans map[language.Tag]*Message) {
 	if !i.dup.Contains(code) {
 		i.dup.Insert(code)
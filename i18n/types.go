@@ -14,6 +14,11 @@ type Localizable[T comparable] interface {
 	Localize(code T, opts ...utils.OptionExtender) (message string)
 }
 
+// Enumerable is optionally implemented by Localizable to list the codes added, check it by type assertion
+type Enumerable[T comparable] interface {
+	Codes() []T
+}
+
 // Conf i18n configure
 type Conf struct {
 	DefaultLang string `yaml:"default_lang" json:"default_lang" toml:"default_lang" default:"zh"`
@@ -10,6 +10,7 @@ import (
 	"github.com/wfusion/gofusion/common/di"
 	"github.com/wfusion/gofusion/common/utils"
 	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/health"
 )
 
 func Construct(ctx context.Context, confs map[string]*Conf, opts ...utils.OptionExtender) func() {
@@ -30,6 +31,7 @@ func Construct(ctx context.Context, confs map[string]*Conf, opts ...utils.Option
 		app := config.Use(opt.AppName).AppName()
 		if appInstances != nil {
 			for name, instance := range appInstances[opt.AppName] {
+				health.Unregister(config.ComponentKV, name, health.AppName(opt.AppName))
 				if err := instance.close(); err != nil {
 					log.Printf("%v [Gofusion] %s %s %s close error: %s",
 						pid, app, config.ComponentKV, name, err)
@@ -67,6 +69,7 @@ func addInstance(ctx context.Context, name string, conf *Conf, opt *config.InitO
 		panic(ErrDuplicatedName)
 	}
 	appInstances[opt.AppName][name] = instance
+	health.Register(config.ComponentKV, name, instance.ping, health.AppName(opt.AppName))
 
 	if opt.DI != nil {
 		opt.DI.MustProvide(func() Storable { return Use(ctx, name, AppName(opt.AppName)) }, di.Name(name))
@@ -15,6 +15,9 @@ import (
 const (
 	consulMinTTL = 10 * time.Second
 	consulMaxTTL = 24 * time.Hour
+
+	// consulDeregisterTTLTimes the agent removes services whose ttl check has been critical for such times of ttl
+	consulDeregisterTTLTimes = 10
 )
 
 type consulKV struct {
@@ -189,6 +192,107 @@ func (c *consulKV) Paginate(ctx context.Context, pattern string, pageSize int, o
 
 func (c *consulKV) getProxy() any { return c.cli }
 func (c *consulKV) close() error  { return nil }
+func (c *consulKV) ping(ctx context.Context) (err error) {
+	_, err = c.cli.Status().LeaderWithQueryOptions((&api.QueryOptions{}).WithContext(ctx))
+	return
+}
+
+// registerService registers the instance into the agent with a ttl check, and passes the check as heartbeat
+func (c *consulKV) registerService(ctx context.Context, ins *ServiceInstance, opt *serviceOption) (err error) {
+	checkID := consulServiceCheckID(ins)
+	qopt := new(api.QueryOptions).WithContext(ctx)
+	if err = c.cli.Agent().UpdateTTLOpts(checkID, "", api.HealthPassing, qopt); err == nil {
+		return
+	}
+
+	// the check is not found if the service is not registered yet or removed by the agent
+	reg := &api.AgentServiceRegistration{
+		ID:      ins.ID,
+		Name:    ins.Service,
+		Address: ins.Address,
+		Port:    ins.Port,
+		Meta:    ins.Meta,
+		Check: &api.AgentServiceCheck{
+			CheckID:                        checkID,
+			TTL:                            opt.ttl.String(),
+			DeregisterCriticalServiceAfter: utils.Max(opt.ttl*consulDeregisterTTLTimes, time.Minute).String(),
+		},
+	}
+	if err = c.cli.Agent().ServiceRegisterOpts(reg, api.ServiceRegisterOpts{}.WithContext(ctx)); err != nil {
+		return
+	}
+	return c.cli.Agent().UpdateTTLOpts(checkID, "", api.HealthPassing, qopt)
+}
+func (c *consulKV) deregisterService(ctx context.Context, ins *ServiceInstance, _ *serviceOption) error {
+	return c.cli.Agent().ServiceDeregisterOpts(ins.ID, new(api.QueryOptions).WithContext(ctx))
+}
+func (c *consulKV) resolveService(ctx context.Context, service string,
+	_ *serviceOption) (instances []*ServiceInstance, err error) {
+	qopt := &api.QueryOptions{Datacenter: c.conf.Endpoint.ConsulDatacenter}
+	entries, _, err := c.cli.Health().Service(service, "", true, qopt.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	instances = make([]*ServiceInstance, 0, len(entries))
+	for _, entry := range entries {
+		address := entry.Service.Address
+		if utils.IsStrBlank(address) {
+			address = entry.Node.Address
+		}
+		instances = append(instances, &ServiceInstance{
+			ID:      entry.Service.ID,
+			Service: entry.Service.Service,
+			Address: address,
+			Port:    entry.Service.Port,
+			Meta:    entry.Service.Meta,
+		})
+	}
+	return
+}
+
+// leaseKey acquires the key by a session with the ttl if it is absent, and renews the session if it is owned by
+// the owner, the key is deleted once the session expires
+func (c *consulKV) leaseKey(ctx context.Context, key, owner string, ttl time.Duration) (ok bool, err error) {
+	if ttl < consulMinTTL || ttl > consulMaxTTL {
+		return false, ErrInvalidExpiration
+	}
+	qopt := new(api.QueryOptions).WithContext(ctx)
+	wopt := new(api.WriteOptions).WithContext(ctx)
+	pair, _, err := c.cli.KV().Get(key, qopt)
+	if err != nil {
+		return
+	}
+	if pair != nil {
+		if string(pair.Value) != owner || pair.Session == "" {
+			return
+		}
+		entry, _, err := c.cli.Session().Renew(pair.Session, wopt)
+		return err == nil && entry != nil, err
+	}
+
+	entry := &api.SessionEntry{Name: key, Behavior: api.SessionBehaviorDelete, TTL: ttl.String()}
+	id, _, err := c.cli.Session().CreateNoChecks(entry, wopt)
+	if err != nil {
+		return
+	}
+	if ok, _, err = c.cli.KV().Acquire(&api.KVPair{Key: key, Value: []byte(owner), Session: id}, wopt); err != nil || !ok {
+		_, _ = c.cli.Session().Destroy(id, wopt)
+	}
+	return
+}
+func (c *consulKV) releaseKey(ctx context.Context, key, owner string) (err error) {
+	wopt := new(api.WriteOptions).WithContext(ctx)
+	pair, _, err := c.cli.KV().Get(key, new(api.QueryOptions).WithContext(ctx))
+	if err != nil || pair == nil || string(pair.Value) != owner || pair.Session == "" {
+		return
+	}
+	_, err = c.cli.Session().Destroy(pair.Session, wopt)
+	return
+}
+
+func consulServiceCheckID(ins *ServiceInstance) string {
+	return "service:" + ins.ID
+}
 
 type consulGetValue struct {
 	pair *api.KVPair
@@ -0,0 +1,160 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/common/utils/serialize/json"
+	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/routine"
+)
+
+const (
+	defaultServicePrefix = "/gofusion/services/"
+	defaultServiceTTL    = 15 * time.Second
+)
+
+// ServiceInstance is an instance of a service registered in consul catalog or under keys of etcd and redis
+type ServiceInstance struct {
+	ID      string            `json:"id"`
+	Service string            `json:"service"`
+	Address string            `json:"address"`
+	Port    int               `json:"port"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// Host returns address:port of the instance
+func (s *ServiceInstance) Host() string {
+	return net.JoinHostPort(s.Address, strconv.Itoa(s.Port))
+}
+
+type serviceOption struct {
+	ttl    time.Duration
+	prefix string
+}
+
+// ServiceTTL is the duration after which an instance not heartbeating expires, defaults to 15s
+func ServiceTTL(ttl time.Duration) utils.OptionFunc[serviceOption] {
+	return func(o *serviceOption) {
+		o.ttl = ttl
+	}
+}
+
+// ServicePrefix is the key prefix services register under for etcd and redis, defaults to /gofusion/services/
+func ServicePrefix(prefix string) utils.OptionFunc[serviceOption] {
+	return func(o *serviceOption) {
+		o.prefix = prefix
+	}
+}
+
+func newServiceOption(opts ...utils.OptionExtender) (o *serviceOption) {
+	o = utils.ApplyOptions[serviceOption](opts...)
+	if o.ttl <= 0 {
+		o.ttl = defaultServiceTTL
+	}
+	if utils.IsStrBlank(o.prefix) {
+		o.prefix = defaultServicePrefix
+	}
+	if !strings.HasSuffix(o.prefix, "/") {
+		o.prefix += "/"
+	}
+	return
+}
+
+// RegisterService registers the instance through the kv instance named by name and heartbeats it every third
+// of the ttl until the returned deregister is called
+func RegisterService(ctx context.Context, name string, ins *ServiceInstance,
+	opts ...utils.OptionExtender) (deregister func(), err error) {
+	opt := utils.ApplyOptions[useOption](opts...)
+	optS := newServiceOption(opts...)
+	if utils.IsStrBlank(ins.ID) {
+		ins.ID = fmt.Sprintf("%s-%s", ins.Service, ins.Host())
+	}
+	instance := Use(ctx, name, opts...)
+	if err = instance.registerService(ctx, ins, optS); err != nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	heartbeat := func() {
+		ticker := time.NewTicker(optS.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-closed:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := instance.registerService(ctx, ins, optS); err != nil {
+					log.Printf("%v [Gofusion] %s %s %s heartbeat service %s failed: %s", syscall.Getpid(),
+						config.Use(opt.appName).AppName(), config.ComponentKV, name, ins.ID, err)
+				}
+			}
+		}
+	}
+	routine.Go(heartbeat, routine.AppName(opt.appName))
+
+	once := new(sync.Once)
+	return func() {
+		once.Do(func() {
+			close(closed)
+			ctx, cancel := context.WithTimeout(context.Background(), optS.ttl)
+			defer cancel()
+			if err := instance.deregisterService(ctx, ins, optS); err != nil {
+				log.Printf("%v [Gofusion] %s %s %s deregister service %s failed: %s", syscall.Getpid(),
+					config.Use(opt.appName).AppName(), config.ComponentKV, name, ins.ID, err)
+			}
+		})
+	}, nil
+}
+
+// ResolveService returns alive instances of the service sorted by id through the kv instance named by name
+func ResolveService(ctx context.Context, name, service string,
+	opts ...utils.OptionExtender) (instances []*ServiceInstance, err error) {
+	if instances, err = Use(ctx, name, opts...).resolveService(ctx, service, newServiceOption(opts...)); err != nil {
+		return
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].ID < instances[j].ID })
+	return
+}
+
+func serviceKey(opt *serviceOption, service, id string) string {
+	return opt.prefix + service + "/" + id
+}
+
+// registerServiceByKey puts the instance under the service prefix with expiration, it is used by kv without
+// service catalog
+func registerServiceByKey(ctx context.Context, s Storable, ins *ServiceInstance, opt *serviceOption) error {
+	return s.Put(ctx, serviceKey(opt, ins.Service, ins.ID), utils.Must(json.Marshal(ins)), Expire(opt.ttl)).Err()
+}
+
+func parseServiceInstances(kvs KeyValues) (instances []*ServiceInstance) {
+	instances = make([]*ServiceInstance, 0, len(kvs))
+	for _, kv := range kvs {
+		var val []byte
+		switch v := kv.Val.(type) {
+		case string:
+			val = []byte(v)
+		case []byte:
+			val = v
+		default:
+			continue
+		}
+		ins := new(ServiceInstance)
+		if err := json.Unmarshal(val, ins); err != nil || utils.IsStrBlank(ins.Address) {
+			continue
+		}
+		instances = append(instances, ins)
+	}
+	return
+}
@@ -6,9 +6,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cast"
 	"go.etcd.io/etcd/api/v3/etcdserverpb"
 	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	"go.etcd.io/etcd/client/v3"
 
 	"github.com/wfusion/gofusion/common/utils"
@@ -151,6 +153,59 @@ func (e *etcdKV) Paginate(ctx context.Context, pattern string, pageSize int, opt
 
 func (e *etcdKV) getProxy() any { return e.cli }
 func (e *etcdKV) close() error  { return e.cli.Close() }
+func (e *etcdKV) ping(ctx context.Context) (err error) {
+	// the same as etcdctl endpoint health, a permission denied response also means the cluster is reachable
+	if _, err = e.cli.Get(ctx, "health", clientv3.WithCountOnly()); errors.Is(err, rpctypes.ErrPermissionDenied) {
+		err = nil
+	}
+	return
+}
+
+func (e *etcdKV) registerService(ctx context.Context, ins *ServiceInstance, opt *serviceOption) error {
+	return registerServiceByKey(ctx, e, ins, opt)
+}
+func (e *etcdKV) deregisterService(ctx context.Context, ins *ServiceInstance, opt *serviceOption) error {
+	return e.Del(ctx, serviceKey(opt, ins.Service, ins.ID)).Err()
+}
+func (e *etcdKV) resolveService(ctx context.Context, service string,
+	opt *serviceOption) (instances []*ServiceInstance, err error) {
+	got := e.Get(ctx, serviceKey(opt, service, ""), Prefix())
+	if err = got.Err(); err != nil {
+		return
+	}
+	return parseServiceInstances(got.KeyValues()), nil
+}
+
+// leaseKey puts the key with a new lease if it is absent or owned by the owner, leases replaced expire by themselves
+func (e *etcdKV) leaseKey(ctx context.Context, key, owner string, ttl time.Duration) (ok bool, err error) {
+	lease := clientv3.NewLease(e.cli)
+	grant, err := lease.Grant(ctx, utils.Max(int64(ttl/time.Second), 1))
+	if err != nil {
+		return
+	}
+	rsp, err := e.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, owner, clientv3.WithLease(grant.ID))).
+		Commit()
+	if err == nil && !rsp.Succeeded {
+		rsp, err = e.cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.Value(key), "=", owner)).
+			Then(clientv3.OpPut(key, owner, clientv3.WithLease(grant.ID))).
+			Commit()
+	}
+	if err != nil || !rsp.Succeeded {
+		_, _ = lease.Revoke(ctx, grant.ID)
+		return false, err
+	}
+	return true, nil
+}
+func (e *etcdKV) releaseKey(ctx context.Context, key, owner string) (err error) {
+	_, err = e.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(key), "=", owner)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	return
+}
 
 type etcdGetValue struct {
 	rsp *clientv3.GetResponse
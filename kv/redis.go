@@ -4,6 +4,7 @@ import (
 	"context"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cast"
@@ -11,6 +12,7 @@ import (
 	"github.com/wfusion/gofusion/common/infra/drivers/redis"
 	"github.com/wfusion/gofusion/common/utils"
 	"github.com/wfusion/gofusion/common/utils/inspect"
+	"github.com/wfusion/gofusion/common/utils/serialize/json"
 	"github.com/wfusion/gofusion/config"
 
 	rdsDrv "github.com/redis/go-redis/v9"
@@ -204,6 +206,104 @@ func (r *redisKV) Paginate(ctx context.Context, pattern string, pageSize int, op
 
 func (r *redisKV) getProxy() any { return r.cli }
 func (r *redisKV) close() error  { return r.cli.Close() }
+func (r *redisKV) ping(ctx context.Context) error {
+	return r.cli.GetProxy().Ping(ctx).Err()
+}
+
+// registerService puts the instance with expiration and adds its id to the set of the service, so that resolving
+// the service reads the set rather than scanning the keyspace
+func (r *redisKV) registerService(ctx context.Context, ins *ServiceInstance, opt *serviceOption) (err error) {
+	setKey := redisServiceSetKey(opt, ins.Service)
+	_, err = r.cli.GetProxy().Pipelined(ctx, func(pipe rdsDrv.Pipeliner) error {
+		pipe.Set(ctx, serviceKey(opt, ins.Service, ins.ID), utils.Must(json.Marshal(ins)), opt.ttl)
+		pipe.SAdd(ctx, setKey, ins.ID)
+		// the set expires as well when no instance heartbeats any more
+		pipe.Expire(ctx, setKey, opt.ttl)
+		return nil
+	})
+	return
+}
+func (r *redisKV) deregisterService(ctx context.Context, ins *ServiceInstance, opt *serviceOption) (err error) {
+	_, err = r.cli.GetProxy().Pipelined(ctx, func(pipe rdsDrv.Pipeliner) error {
+		pipe.Del(ctx, serviceKey(opt, ins.Service, ins.ID))
+		pipe.SRem(ctx, redisServiceSetKey(opt, ins.Service), ins.ID)
+		return nil
+	})
+	return
+}
+
+// resolveService reads instances in the set of the service, ids of expired instances are removed from the set
+func (r *redisKV) resolveService(ctx context.Context, service string,
+	opt *serviceOption) (instances []*ServiceInstance, err error) {
+	proxy := r.cli.GetProxy()
+	ids, err := proxy.SMembers(ctx, redisServiceSetKey(opt, service)).Result()
+	if err != nil || len(ids) == 0 {
+		return
+	}
+
+	// instance keys may be in different slots of a cluster, so they are got by a pipeline instead of mget
+	cmds := make([]*rdsDrv.StringCmd, 0, len(ids))
+	if _, err = proxy.Pipelined(ctx, func(pipe rdsDrv.Pipeliner) error {
+		for _, id := range ids {
+			cmds = append(cmds, pipe.Get(ctx, serviceKey(opt, service, id)))
+		}
+		return nil
+	}); err != nil && !errors.Is(err, rdsDrv.Nil) {
+		return
+	}
+
+	err = nil
+	kvs := make(KeyValues, 0, len(cmds))
+	expired := make([]any, 0, len(cmds))
+	for i, cmd := range cmds {
+		if errors.Is(cmd.Err(), rdsDrv.Nil) {
+			expired = append(expired, ids[i])
+			continue
+		}
+		kvs = append(kvs, &KeyValue{Key: serviceKey(opt, service, ids[i]), Val: cmd.Val()})
+	}
+	if len(expired) > 0 {
+		_ = proxy.SRem(ctx, redisServiceSetKey(opt, service), expired...).Err()
+	}
+	return parseServiceInstances(kvs), nil
+}
+
+// redisServiceSetKey is the set of instance ids of the service, it is outside of keys under the service prefix
+func redisServiceSetKey(opt *serviceOption, service string) string {
+	return opt.prefix + service
+}
+
+var (
+	// redisLeaseKeyScript KEYS[1] key, ARGV[1] owner, ARGV[2] ttl in milliseconds
+	redisLeaseKeyScript = rdsDrv.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if owner then
+	return 0
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2], 'NX') then
+	return 1
+end
+return 0
+`)
+
+	// redisReleaseKeyScript KEYS[1] key, ARGV[1] owner
+	redisReleaseKeyScript = rdsDrv.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
+func (r *redisKV) leaseKey(ctx context.Context, key, owner string, ttl time.Duration) (ok bool, err error) {
+	return redisLeaseKeyScript.Run(ctx, r.cli.GetProxy(), []string{key}, owner, ttl.Milliseconds()).Bool()
+}
+func (r *redisKV) releaseKey(ctx context.Context, key, owner string) error {
+	return redisReleaseKeyScript.Run(ctx, r.cli.GetProxy(), []string{key}, owner).Err()
+}
 
 type redisGetValue struct {
 	*rdsDrv.StringCmd
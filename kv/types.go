@@ -32,6 +32,12 @@ type Storable interface {
 	Paginate(ctx context.Context, pattern string, pageSize int, opts ...utils.OptionExtender) Paginated
 
 	getProxy() any
+	ping(ctx context.Context) error
+	registerService(ctx context.Context, ins *ServiceInstance, opt *serviceOption) error
+	deregisterService(ctx context.Context, ins *ServiceInstance, opt *serviceOption) error
+	resolveService(ctx context.Context, service string, opt *serviceOption) ([]*ServiceInstance, error)
+	leaseKey(ctx context.Context, key, owner string, ttl time.Duration) (ok bool, err error)
+	releaseKey(ctx context.Context, key, owner string) error
 	close() error
 	config() *Conf
 }
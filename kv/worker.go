@@ -0,0 +1,79 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm/idgen"
+	"github.com/wfusion/gofusion/common/utils"
+)
+
+const (
+	defaultWorkerPrefix = "/gofusion/idgen/workers/"
+)
+
+type workerOption struct {
+	prefix string
+}
+
+// WorkerPrefix is the key prefix worker ids are leased under, defaults to /gofusion/idgen/workers/
+func WorkerPrefix(prefix string) utils.OptionFunc[workerOption] {
+	return func(o *workerOption) {
+		o.prefix = prefix
+	}
+}
+
+type workerLeaser struct {
+	instance Storable
+	prefix   string
+}
+
+// WorkerLeaser leases snowflake worker ids through the kv instance named by name, a worker id is a key held by
+// its owner with expiration, zookeeper is not supported for now
+func WorkerLeaser(ctx context.Context, name string, opts ...utils.OptionExtender) idgen.WorkerLeaser {
+	opt := utils.ApplyOptions[workerOption](opts...)
+	if utils.IsStrBlank(opt.prefix) {
+		opt.prefix = defaultWorkerPrefix
+	}
+	if !strings.HasSuffix(opt.prefix, "/") {
+		opt.prefix += "/"
+	}
+	return &workerLeaser{instance: Use(ctx, name, opts...), prefix: opt.prefix}
+}
+
+func (w *workerLeaser) Lease(ctx context.Context, owner string, size int, ttl time.Duration) (
+	workerID uint16, err error) {
+	for id := 0; id < size; id++ {
+		ok, err := w.instance.leaseKey(ctx, w.key(uint16(id)), owner, ttl)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return uint16(id), nil
+		}
+	}
+	return 0, errors.Wrapf(idgen.ErrWorkerIDExhausted, "all of %v worker ids are leased under %s", size, w.prefix)
+}
+
+func (w *workerLeaser) Renew(ctx context.Context, owner string, workerID uint16, ttl time.Duration) (err error) {
+	ok, err := w.instance.leaseKey(ctx, w.key(workerID), owner, ttl)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return errors.Wrapf(idgen.ErrWorkerIDLost, "worker id %v", workerID)
+	}
+	return
+}
+
+func (w *workerLeaser) Release(ctx context.Context, owner string, workerID uint16) error {
+	return w.instance.releaseKey(ctx, w.key(workerID), owner)
+}
+
+func (w *workerLeaser) key(workerID uint16) string {
+	return w.prefix + strconv.Itoa(int(workerID))
+}
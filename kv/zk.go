@@ -4,6 +4,7 @@ import (
 	"context"
 	"math/big"
 	"reflect"
+	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/go-zookeeper/zk"
@@ -267,6 +268,28 @@ func (z *zkKV) Paginate(ctx context.Context, pattern string, pageSize int, opts
 
 func (z *zkKV) getProxy() any      { return z.cli }
 func (z *zkKV) close() (err error) { z.cli.Close(); return }
+func (z *zkKV) ping(_ context.Context) (err error) {
+	if state := z.cli.State(); state != zk.StateHasSession {
+		return errors.Errorf("zookeeper session state is %s", state)
+	}
+	return
+}
+
+func (z *zkKV) registerService(context.Context, *ServiceInstance, *serviceOption) error {
+	return ErrNotImplement
+}
+func (z *zkKV) deregisterService(context.Context, *ServiceInstance, *serviceOption) error {
+	return ErrNotImplement
+}
+func (z *zkKV) resolveService(context.Context, string, *serviceOption) ([]*ServiceInstance, error) {
+	return nil, ErrNotImplement
+}
+func (z *zkKV) leaseKey(context.Context, string, string, time.Duration) (bool, error) {
+	return false, ErrNotImplement
+}
+func (z *zkKV) releaseKey(context.Context, string, string) error {
+	return ErrNotImplement
+}
 
 type zkGetValue struct {
 	key, value string
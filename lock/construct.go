@@ -3,6 +3,7 @@ package lock
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -27,7 +28,6 @@ func Construct(ctx context.Context, confs map[string]*Conf, opts ...utils.Option
 	for name, conf := range confs {
 		addInstance(ctx, name, conf, opt)
 	}
-
 	return func() {
 		rwlock.Lock()
 		defer rwlock.Unlock()
@@ -131,4 +131,10 @@ func UseReentrant(ctx context.Context, name string, opts ...utils.OptionExtender
 
 func init() {
 	config.AddComponent(config.ComponentLock, Construct, config.WithFlag(&flagString))
+	db.SetMigrationGuard(func(appName string) db.MigrationGuard {
+		return func(ctx context.Context, lockInstance, key string,
+			expired, timeout time.Duration, cb func() error) error {
+			return Within(ctx, Use(lockInstance, AppName(appName)), key, expired, timeout, cb, AppName(appName))
+		}
+	})
 }
@@ -6,7 +6,6 @@ import (
 	"strings"
 
 	"github.com/go-resty/resty/v2"
-	"github.com/spf13/cast"
 
 	"github.com/wfusion/gofusion/config"
 	"github.com/wfusion/gofusion/log"
@@ -21,15 +20,22 @@ func DefaultHttpLogger() resty.Logger {
 	return new(httpLogger)
 }
 
+type httpLoggerConf struct {
+	EnableLogger bool                       `yaml:"enable_logger"`
+	Servers      map[string]*httpLoggerConf `yaml:"servers"`
+}
+
 type httpLogger struct {
-	log     log.Loggable
-	appName string
-	enabled bool
+	log      log.Loggable
+	appName  string
+	confName string
+	enabled  bool
 }
 
-func (h *httpLogger) Init(log log.Loggable, appName string) {
+func (h *httpLogger) Init(log log.Loggable, appName, name string) {
 	h.log = log
 	h.appName = appName
+	h.confName = name
 	h.reloadConfig()
 }
 
@@ -85,8 +91,14 @@ func (h *httpLogger) parseArgs(args ...any) (ctx context.Context, params []any)
 }
 
 func (h *httpLogger) reloadConfig() {
-	cfg := make(map[string]any)
-	_ = config.Use(h.appName).LoadComponentConfig(config.ComponentHttp, &cfg)
+	cfg := new(httpLoggerConf)
+	_ = config.Use(h.appName).LoadComponentConfig(config.ComponentHttp, cfg)
+	if h.confName != config.DefaultInstanceKey {
+		// named servers are configured in servers of the http configuration
+		if cfg = cfg.Servers[h.confName]; cfg == nil {
+			return
+		}
+	}
 
-	h.enabled = cast.ToBool(cfg["enable_logger"])
+	h.enabled = cfg.EnableLogger
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/wfusion/gofusion/common/utils"
 	"github.com/wfusion/gofusion/common/utils/inspect"
 	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/health"
 
 	mgoEvt "go.mongodb.org/mongo-driver/event"
 	mgoDrv "go.mongodb.org/mongo-driver/mongo"
@@ -38,6 +39,7 @@ func Construct(ctx context.Context, confs map[string]*Conf, opts ...utils.Option
 		app := config.Use(opt.AppName).AppName()
 		if appInstances != nil {
 			for name, instance := range appInstances[opt.AppName] {
+				health.Unregister(config.ComponentMongo, name, health.AppName(opt.AppName))
 				if err := instance.GetProxy().Disconnect(nil); err != nil {
 					log.Printf("%v [Gofusion] %s %s %s disconnect error: %s",
 						pid, app, config.ComponentMongo, name, err)
@@ -80,6 +82,7 @@ func addInstance(ctx context.Context, name string, conf *Conf, opt *config.InitO
 		panic(ErrDuplicatedName)
 	}
 	appInstances[opt.AppName][name] = &instance{mongo: mgoCli, name: name, database: conf.DB}
+	health.Register(config.ComponentMongo, name, appInstances[opt.AppName][name].ping, health.AppName(opt.AppName))
 
 	// ioc
 	if opt.DI != nil {
@@ -1,6 +1,7 @@
 package mongo
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -31,6 +32,10 @@ func (d *instance) GetProxy() *mgoDrv.Client {
 	return d.mongo.GetProxy()
 }
 
+func (d *instance) ping(ctx context.Context) error {
+	return d.mongo.GetProxy().Ping(ctx, readpref.Primary())
+}
+
 func (d *instance) Database(opts ...*options.DatabaseOptions) *mgoDrv.Database {
 	return d.mongo.Database(d.database, opts...)
 }
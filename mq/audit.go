@@ -0,0 +1,21 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/db"
+	"github.com/wfusion/gofusion/db/plugins"
+)
+
+// dbAuditPublisher publishes audit records of db instances with the mq sink
+func dbAuditPublisher(appName string) db.AuditPublisher {
+	return func(ctx context.Context, name string, records []*plugins.AuditRecord) error {
+		uuidGen := func(r *plugins.AuditRecord) string {
+			return fmt.Sprintf("%s:%s:%s:%s:%v", r.Database, r.Table, r.Action, r.PrimaryKey, r.CreatedAt.UnixNano())
+		}
+		objects := utils.SliceMapping(records, func(r *plugins.AuditRecord) any { return r })
+		return Pub(name, AppName(appName)).Publish(ctx, Objects(uuidGen, objects...))
+	}
+}
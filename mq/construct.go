@@ -14,6 +14,8 @@ import (
 	"github.com/wfusion/gofusion/common/utils"
 	"github.com/wfusion/gofusion/common/utils/inspect"
 	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/db"
+	"github.com/wfusion/gofusion/health"
 
 	fusLog "github.com/wfusion/gofusion/log"
 
@@ -37,11 +39,18 @@ func Construct(ctx context.Context, confs map[string]*Conf, opts ...utils.Option
 	for name, conf := range confs {
 		addInstance(ctx, name, conf, opt)
 	}
+	db.SetAuditPublisher(dbAuditPublisher(opt.AppName), db.AppName(opt.AppName))
 
 	return func() {
+		db.SetAuditPublisher(nil, db.AppName(opt.AppName))
+
 		locker.Lock()
 		defer locker.Unlock()
 
+		for name := range confs {
+			health.Unregister(config.ComponentMessageQueue, name, health.AppName(opt.AppName))
+		}
+
 		pid := syscall.Getpid()
 		app := config.Use(opt.AppName).AppName()
 		if routers != nil {
@@ -118,6 +127,9 @@ func addInstance(ctx context.Context, name string, conf *Conf, opt *config.InitO
 		panic(errors.Errorf("unknown message queue type: %+v", conf.Type))
 	}
 
+	health.Register(config.ComponentMessageQueue, name, newHealthChecker(opt.AppName, conf),
+		health.AppName(opt.AppName))
+
 	locker.Lock()
 	defer locker.Unlock()
 	if suber != nil {
@@ -0,0 +1,61 @@
+package mq
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+
+	"github.com/wfusion/gofusion/db"
+	"github.com/wfusion/gofusion/health"
+	"github.com/wfusion/gofusion/redis"
+)
+
+// newHealthChecker checks the instance which the message queue based on, or dials the broker addresses
+func newHealthChecker(appName string, conf *Conf) health.Checker {
+	return func(ctx context.Context) (err error) {
+		switch conf.Type {
+		case mqTypeGoChannel:
+			return
+		case mqTypeRedis:
+			return redis.Use(ctx, conf.Endpoint.Instance, redis.AppName(appName)).Ping(ctx).Err()
+		case mqTypeMysql, mqTypePostgres:
+			sqlDB, err := db.Use(ctx, conf.Endpoint.Instance, db.AppName(appName)).GetProxy().DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		default:
+			return dialBrokers(ctx, conf.Endpoint.Addresses)
+		}
+	}
+}
+
+// dialBrokers succeeds if any broker is reachable
+func dialBrokers(ctx context.Context, addresses []string) (err error) {
+	if len(addresses) == 0 {
+		return errors.New("no broker address")
+	}
+	dialer := new(net.Dialer)
+	for _, addr := range addresses {
+		if strings.Contains(addr, "://") {
+			u, parseErr := url.Parse(addr)
+			if parseErr != nil {
+				err = multierr.Append(err, parseErr)
+				continue
+			}
+			addr = u.Host
+		}
+		conn, dialErr := dialer.DialContext(ctx, "tcp", addr)
+		if dialErr != nil {
+			err = multierr.Append(err, dialErr)
+			continue
+		}
+		_ = conn.Close()
+		return nil
+	}
+	return
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/wfusion/gofusion/common/utils"
 	"github.com/wfusion/gofusion/common/utils/inspect"
 	"github.com/wfusion/gofusion/config"
+	"github.com/wfusion/gofusion/health"
 
 	rdsDrv "github.com/redis/go-redis/v9"
 
@@ -37,6 +38,7 @@ func Construct(ctx context.Context, confs map[string]*Conf, opts ...utils.Option
 		app := config.Use(opt.AppName).AppName()
 		if appInstances != nil {
 			for name, instance := range appInstances[opt.AppName] {
+				health.Unregister(config.ComponentRedis, name, health.AppName(opt.AppName))
 				if err := instance.GetProxy().Close(); err != nil {
 					log.Printf("%v [Gofusion] %s %s %s close error: %s",
 						pid, app, config.ComponentRedis, name, err)
@@ -79,6 +81,7 @@ func addInstance(ctx context.Context, name string, conf *Conf, opt *config.InitO
 		panic(ErrDuplicatedName)
 	}
 	appInstances[opt.AppName][name] = &instance{name: name, redis: rdsCli}
+	health.Register(config.ComponentRedis, name, appInstances[opt.AppName][name].ping, health.AppName(opt.AppName))
 
 	if opt.DI != nil {
 		opt.DI.MustProvide(func() rdsDrv.UniversalClient { return Use(ctx, name, AppName(opt.AppName)) }, di.Name(name))
@@ -26,6 +26,10 @@ func (i *instance) GetProxy() rdsDrv.UniversalClient {
 	return i.redis.GetProxy()
 }
 
+func (i *instance) ping(ctx context.Context) error {
+	return i.redis.GetProxy().Ping(ctx).Err()
+}
+
 type Redis struct {
 	rdsDrv.UniversalClient
 	Name string
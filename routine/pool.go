@@ -2,6 +2,7 @@ package routine
 
 import (
 	"math"
+	"sort"
 	"sync"
 	"time"
 
@@ -170,6 +171,26 @@ func addPool(appName, name string, pool Pool) {
 	pools[appName][name] = pool
 }
 
+// Pools returns the status of goroutine pools sorted by the name
+func Pools(opts ...utils.OptionExtender) (r []*PoolStatus) {
+	opt := utils.ApplyOptions[candyOption](opts...)
+	rwlock.RLock()
+	defer rwlock.RUnlock()
+	r = make([]*PoolStatus, 0, len(pools[opt.appName]))
+	for name, p := range pools[opt.appName] {
+		r = append(r, &PoolStatus{
+			Name:    name,
+			Cap:     p.Cap(),
+			Running: p.Running(),
+			Free:    p.Free(),
+			Waiting: p.Waiting(),
+			Closed:  p.IsClosed(),
+		})
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	return
+}
+
 func validate(appName, name string) {
 	rwlock.RLock()
 	defer rwlock.RUnlock()
@@ -70,7 +70,7 @@ func delRoutine(appName, name string) {
 	}
 
 	if routines[appName][name]--; routines[appName][name] <= 0 {
-		delete(routines, name)
+		delete(routines[appName], name)
 	}
 }
 
@@ -84,6 +84,28 @@ func showRoutine(appName string) (r []string) {
 	return
 }
 
+// Routines returns the number of running goroutines started by Go, Loop, Promise, etc. grouped by the name
+func Routines(opts ...utils.OptionExtender) (r map[string]int) {
+	opt := utils.ApplyOptions[candyOption](opts...)
+	locker.RLock()
+	defer locker.RUnlock()
+	r = make(map[string]int, len(routines[opt.appName]))
+	for n, c := range routines[opt.appName] {
+		r[n] = c
+	}
+	return
+}
+
+// PoolStatus is the snapshot of a goroutine pool
+type PoolStatus struct {
+	Name    string `json:"name"`
+	Cap     int    `json:"cap"`
+	Running int    `json:"running"`
+	Free    int    `json:"free"`
+	Waiting int    `json:"waiting"`
+	Closed  bool   `json:"closed"`
+}
+
 type customLogger interface {
 	Init(log log.Loggable, appName string)
 }
@@ -0,0 +1,93 @@
+package cases
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/wfusion/gofusion/db"
+	"github.com/wfusion/gofusion/db/plugins"
+	"github.com/wfusion/gofusion/log"
+
+	fusCtx "github.com/wfusion/gofusion/context"
+	testDB "github.com/wfusion/gofusion/test/db"
+)
+
+func TestAudit(t *testing.T) {
+	testingSuite := &Audit{Test: new(testDB.Test)}
+	testingSuite.Init(testingSuite)
+	suite.Run(t, testingSuite)
+}
+
+type Audit struct {
+	*testDB.Test
+}
+
+func (t *Audit) BeforeTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right before %s %s", suiteName, testName)
+	})
+}
+
+func (t *Audit) AfterTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right after %s %s", suiteName, testName)
+	})
+}
+
+func (t *Audit) TestMysql() {
+	t.testDefault(nameMysqlRead, nameMysqlWrite)
+}
+
+func (t *Audit) TestPostgres() {
+	t.testDefault(namePostgres, namePostgres)
+}
+
+func (t *Audit) testDefault(read, write string) {
+	t.Run("RowChanges", func() { t.testRowChanges(read, write) })
+}
+
+func (t *Audit) testRowChanges(read, write string) {
+	t.Catch(func() {
+		// Given
+		ctx := fusCtx.SetTraceID(fusCtx.SetUserID(context.Background(), "auditor"), "audit-trace-id")
+		orm := db.Use(ctx, write, db.AppName(t.AppName())).WithContext(ctx)
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithAudit)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithAudit)))
+		}()
+		auditTable := orm.Table("gofusion_audit_logs")
+		t.Require().NoError(auditTable.Where("table_name = ?", new(modelWithAudit).TableName()).
+			Delete(new(plugins.AuditRecord)).Error)
+
+		// When
+		mwa := &modelWithAudit{Name: "origin", Phone: "13812345678", Password: "secret"}
+		t.Require().NoError(orm.Create(mwa).Error)
+		t.Require().NoError(orm.Model(mwa).Update("name", "changed").Error)
+		t.Require().NoError(orm.Delete(mwa).Error)
+
+		// Then
+		var records []*plugins.AuditRecord
+		t.Require().NoError(orm.Table("gofusion_audit_logs").
+			Where("table_name = ?", mwa.TableName()).
+			Order("id").
+			Find(&records).Error)
+		t.Require().Len(records, 3)
+		t.Require().Equal(plugins.AuditActionCreate, records[0].Action)
+		t.Require().Equal(plugins.AuditActionUpdate, records[1].Action)
+		t.Require().Equal(plugins.AuditActionDelete, records[2].Action)
+		t.Require().Equal("changed", records[1].After["name"])
+		for _, r := range records {
+			t.Require().Equal("auditor", r.Actor)
+			t.Require().Equal("audit-trace-id", r.TraceID)
+			t.Require().Equal(write, r.Database)
+			image := r.After
+			if image == nil {
+				image = r.Before
+			}
+			t.Require().NotContains(image, "password")
+			t.Require().NotEqual(mwa.Phone, image["phone"])
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package cases
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/wfusion/gofusion/common/utils/cipher"
+	"github.com/wfusion/gofusion/common/utils/encode"
+	"github.com/wfusion/gofusion/db"
+	"github.com/wfusion/gofusion/log"
+
+	testDB "github.com/wfusion/gofusion/test/db"
+)
+
+func TestCrypto(t *testing.T) {
+	testingSuite := &Crypto{Test: new(testDB.Test)}
+	testingSuite.Init(testingSuite)
+	suite.Run(t, testingSuite)
+}
+
+type Crypto struct {
+	*testDB.Test
+}
+
+func (t *Crypto) BeforeTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right before %s %s", suiteName, testName)
+	})
+}
+
+func (t *Crypto) AfterTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right after %s %s", suiteName, testName)
+	})
+}
+
+func (t *Crypto) TestMysql() {
+	t.testDefault(nameMysqlWrite)
+}
+
+func (t *Crypto) TestPostgres() {
+	t.testDefault(namePostgres)
+}
+
+func (t *Crypto) TestSqlite() {
+	t.testDefault(nameSqlite)
+}
+
+func (t *Crypto) testDefault(write string) {
+	t.Run("EncryptedFields", func() { t.testEncryptedFields(write) })
+	t.Run("RotatedKeys", func() { t.testRotatedKeys(write) })
+	t.Run("ReusedMap", func() { t.testReusedMap(write) })
+}
+
+func (t *Crypto) testEncryptedFields(write string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithCrypto)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithCrypto)))
+		}()
+
+		// When
+		mwc := &modelWithCrypto{Name: "crypto", Phone: "13812345678", Profile: map[string]string{"city": "beijing"}}
+		t.Require().NoError(orm.WithContext(ctx).Create(mwc).Error)
+
+		// Then
+		var raw map[string]any
+		t.Require().NoError(orm.WithContext(ctx).Table(mwc.TableName()).Where("id = ?", mwc.ID).Take(&raw).Error)
+		t.Require().True(strings.HasPrefix(string(toBytes(raw["phone"])), "k2$"))
+		t.Require().NotContains(string(toBytes(raw["profile"])), "beijing")
+
+		index, err := db.BlindIndex("pii", mwc.Phone, db.AppName(t.AppName()))
+		t.Require().NoError(err)
+		t.Require().Equal(index, mwc.PhoneIndex)
+		found := new(modelWithCrypto)
+		t.Require().NoError(orm.WithContext(ctx).Where("phone_index = ?", index).Take(found).Error)
+		t.Require().Equal(mwc.Phone, found.Phone)
+		t.Require().Equal(mwc.Profile, found.Profile)
+
+		// When
+		t.Require().NoError(orm.WithContext(ctx).Model(found).Updates(map[string]any{"phone": "13887654321"}).Error)
+
+		// Then
+		index, err = db.BlindIndex("pii", "13887654321", db.AppName(t.AppName()))
+		t.Require().NoError(err)
+		updated := new(modelWithCrypto)
+		t.Require().NoError(orm.WithContext(ctx).Where("phone_index = ?", index).Take(updated).Error)
+		t.Require().Equal("13887654321", updated.Phone)
+	})
+}
+
+func (t *Crypto) testRotatedKeys(write string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithCrypto)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithCrypto)))
+		}()
+		phone := "13812345678"
+		ciphertext, err := encode.From(phone).Encode(
+			encode.Cipher(cipher.AlgorithmAES, cipher.ModeGCM, []byte(cryptoRotatedKey), nil),
+			encode.Encode(encode.AlgorithmBase64Std),
+		).ToString()
+		t.Require().NoError(err)
+		t.Require().NoError(orm.WithContext(ctx).
+			Exec("INSERT INTO model_with_crypto (name, phone) VALUES (?, ?)", "rotated", "k1$"+ciphertext).Error)
+
+		// When
+		found := new(modelWithCrypto)
+		t.Require().NoError(orm.WithContext(ctx).Where("name = ?", "rotated").Take(found).Error)
+
+		// Then
+		t.Require().Equal(phone, found.Phone)
+
+		// When
+		t.Require().NoError(orm.WithContext(ctx).Model(found).Updates(map[string]any{"phone": phone}).Error)
+
+		// Then
+		var raw map[string]any
+		t.Require().NoError(orm.WithContext(ctx).Table(found.TableName()).Where("id = ?", found.ID).Take(&raw).Error)
+		t.Require().True(strings.HasPrefix(string(toBytes(raw["phone"])), "k2$"))
+	})
+}
+
+func (t *Crypto) testReusedMap(write string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithCrypto)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithCrypto)))
+		}()
+		mwc := &modelWithCrypto{Name: "reused", Phone: "13812345678"}
+		t.Require().NoError(orm.WithContext(ctx).Create(mwc).Error)
+		values := map[string]any{"phone": "13887654321"}
+
+		// When
+		t.Require().NoError(orm.WithContext(ctx).Model(&modelWithCrypto{Data: mwc.Data}).Updates(values).Error)
+		t.Require().NoError(orm.WithContext(ctx).Model(&modelWithCrypto{Data: mwc.Data}).Updates(values).Error)
+
+		// Then
+		t.Require().Equal(map[string]any{"phone": "13887654321"}, values)
+		found := new(modelWithCrypto)
+		t.Require().NoError(orm.WithContext(ctx).Where("id = ?", mwc.ID).Take(found).Error)
+		t.Require().Equal("13887654321", found.Phone)
+	})
+}
+
+func toBytes(v any) []byte {
+	switch b := v.(type) {
+	case []byte:
+		return b
+	case string:
+		return []byte(b)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,161 @@
+package cases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm/idgen"
+	"github.com/wfusion/gofusion/db"
+	"github.com/wfusion/gofusion/log"
+
+	testDB "github.com/wfusion/gofusion/test/db"
+)
+
+func TestIDGen(t *testing.T) {
+	testingSuite := &IDGen{Test: new(testDB.Test)}
+	testingSuite.Init(testingSuite)
+	suite.Run(t, testingSuite)
+}
+
+type IDGen struct {
+	*testDB.Test
+}
+
+func (t *IDGen) BeforeTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right before %s %s", suiteName, testName)
+	})
+}
+
+func (t *IDGen) AfterTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right after %s %s", suiteName, testName)
+	})
+}
+
+func (t *IDGen) TestMysql() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, nameMysqlWrite, db.AppName(t.AppName()))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithLeasedID)))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithSegmentID)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithLeasedID)))
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithSegmentID)))
+			t.Require().NoError(orm.Migrator().DropTable(idgen.DefaultSegmentTable))
+		}()
+
+		// When
+		leased := make([]*modelWithLeasedID, 0, 10)
+		segment := make([]*modelWithSegmentID, 0, 10)
+		for i := 0; i < 10; i++ {
+			leased = append(leased, &modelWithLeasedID{Name: "leased"})
+			segment = append(segment, &modelWithSegmentID{Name: "segment"})
+		}
+		t.Require().NoError(orm.Create(leased).Error)
+		t.Require().NoError(orm.Create(segment).Error)
+
+		// Then
+		var workers []*idgen.Worker
+		t.Require().NoError(orm.Table(idgen.DefaultGormWorkerTable).Find(&workers).Error)
+		t.Require().NotEmpty(workers)
+
+		ids := make(map[uint64]bool, len(leased))
+		for _, m := range leased {
+			t.Require().NotZero(m.ID)
+			ids[m.ID] = true
+		}
+		t.Require().Len(ids, len(leased))
+		for i := 1; i < len(segment); i++ {
+			t.Require().Equal(segment[i-1].ID+1, segment[i].ID)
+		}
+	})
+}
+
+func (t *IDGen) TestSqlite() {
+	t.Run("Exhausted", func() { t.testExhausted(nameSqlite) })
+	t.Run("Lost", func() { t.testLost(nameSqlite) })
+	t.Run("Prefetch", func() { t.testPrefetch(nameSqlite) })
+}
+
+func (t *IDGen) testPrefetch(name string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, name, db.AppName(t.AppName()))
+		defer func() { t.Require().NoError(orm.Migrator().DropTable(testIDGenSegmentTable)) }()
+		generator := idgen.NewSegment(orm.GetProxy(), "prefetch",
+			idgen.SegmentTable(testIDGenSegmentTable), idgen.SegmentStep(4))
+
+		// When
+		for i := uint64(1); i <= 8; i++ {
+			id, err := generator.Next()
+			t.Require().NoError(err)
+			t.Require().Equal(i, id)
+		}
+
+		// Then
+		t.Require().Eventually(func() bool {
+			seg := new(idgen.Segment)
+			err := orm.Table(testIDGenSegmentTable).Where("biz_key = ?", "prefetch").Take(seg).Error
+			return err == nil && seg.MaxID == 12
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func (t *IDGen) testExhausted(name string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, name, db.AppName(t.AppName()))
+		defer func() { t.Require().NoError(orm.Migrator().DropTable(testIDGenWorkerTable)) }()
+		leaser := idgen.NewGormWorkerLeaser(orm.GetProxy(), testIDGenWorkerTable)
+		held, err := idgen.NewLeasedSnowflake(ctx, leaser, idgen.WorkerPoolSize(1))
+		t.Require().NoError(err)
+		defer func() { t.Require().NoError(held.Close()) }()
+
+		// When
+		_, err = idgen.NewLeasedSnowflake(ctx, leaser, idgen.WorkerPoolSize(1))
+
+		// Then
+		t.Require().ErrorIs(err, idgen.ErrWorkerIDExhausted)
+	})
+}
+
+func (t *IDGen) testLost(name string) {
+	t.Catch(func() {
+		// Given
+		ttl := 300 * time.Millisecond
+		ctx := context.Background()
+		orm := db.Use(ctx, name, db.AppName(t.AppName()))
+		defer func() { t.Require().NoError(orm.Migrator().DropTable(testIDGenWorkerTable)) }()
+		leaser := idgen.NewGormWorkerLeaser(orm.GetProxy(), testIDGenWorkerTable)
+		lost, err := idgen.NewLeasedSnowflake(ctx, leaser,
+			idgen.WorkerPoolSize(1), idgen.WorkerTTL(ttl), idgen.WorkerOwner("lost"))
+		t.Require().NoError(err)
+		defer func() { t.Require().NoError(lost.Close()) }()
+		_, err = lost.Next()
+		t.Require().NoError(err)
+
+		// When
+		t.Require().NoError(leaser.Release(ctx, "lost", lost.WorkerID()))
+		taker, err := idgen.NewLeasedSnowflake(ctx, leaser,
+			idgen.WorkerPoolSize(1), idgen.WorkerTTL(ttl), idgen.WorkerOwner("taker"))
+		t.Require().NoError(err)
+		defer func() { t.Require().NoError(taker.Close()) }()
+
+		// Then
+		t.Require().Equal(lost.WorkerID(), taker.WorkerID())
+		t.Require().Eventually(func() bool {
+			_, err := lost.Next()
+			return errors.Is(err, idgen.ErrWorkerIDLost)
+		}, ttl, ttl/10)
+		_, err = taker.Next()
+		t.Require().NoError(err)
+	})
+}
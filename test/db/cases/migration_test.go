@@ -0,0 +1,154 @@
+package cases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/atomic"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm/migrate"
+	"github.com/wfusion/gofusion/db"
+	"github.com/wfusion/gofusion/log"
+
+	testDB "github.com/wfusion/gofusion/test/db"
+)
+
+func TestMigration(t *testing.T) {
+	testingSuite := &Migration{Test: new(testDB.Test)}
+	testingSuite.Init(testingSuite)
+	suite.Run(t, testingSuite)
+}
+
+type Migration struct {
+	*testDB.Test
+}
+
+func (t *Migration) BeforeTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right before %s %s", suiteName, testName)
+	})
+}
+
+func (t *Migration) AfterTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right after %s %s", suiteName, testName)
+	})
+}
+
+func (t *Migration) TestMysql() {
+	t.testDefault(nameMysqlRead, nameMysqlWrite)
+}
+
+func (t *Migration) TestPostgres() {
+	t.testDefault(namePostgres, namePostgres)
+}
+
+func (t *Migration) TestSqlite() {
+	t.Run("Guarded", func() { t.testGuarded(nameSqliteMigrate) })
+}
+
+func (t *Migration) testDefault(read, write string) {
+	t.Run("UpAndDown", func() { t.testUpAndDown(read, write) })
+}
+
+func (t *Migration) testUpAndDown(read, write string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		shardingTables := 0
+		db.AddMigration(write, 1, "create_migration_probe",
+			func(ctx context.Context, s *migrate.Scope) (err error) {
+				tables, err := s.Tables(new(modelWithShardingPtr).TableName())
+				if err != nil {
+					return
+				}
+				shardingTables = len(tables)
+				return s.Exec("CREATE TABLE migration_probe (id bigint)").Error
+			},
+			func(ctx context.Context, s *migrate.Scope) error {
+				return s.Exec("DROP TABLE migration_probe").Error
+			},
+			db.AppName(t.AppName()),
+		)
+
+		// When
+		applied, err := db.Migrate(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(err)
+
+		// Then
+		t.Require().Len(applied, 1)
+		t.Require().Greater(shardingTables, 0)
+		orm := db.Use(ctx, write, db.AppName(t.AppName()))
+		t.Require().True(orm.Migrator().HasTable("migration_probe"))
+
+		status, err := db.MigrationStatus(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(err)
+		t.Require().NotEmpty(status)
+		t.Require().True(status[0].Applied)
+
+		applied, err = db.Migrate(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(err)
+		t.Require().Empty(applied)
+
+		rolledBack, err := db.Rollback(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(err)
+		t.Require().Len(rolledBack, 1)
+		t.Require().False(orm.Migrator().HasTable("migration_probe"))
+	})
+}
+
+func (t *Migration) testGuarded(name string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		guarded := atomic.NewInt32(0)
+		// the lock component is not imported here, so the guard it would set is faked
+		db.SetMigrationGuard(func(appName string) db.MigrationGuard {
+			return func(ctx context.Context, lockInstance, key string,
+				expired, timeout time.Duration, cb func() error) error {
+				t.Require().Equal("default", lockInstance)
+				guarded.Inc()
+				return cb()
+			}
+		})
+		defer db.SetMigrationGuard(nil)
+		orm := db.Use(ctx, name, db.AppName(t.AppName()))
+		defer func() { t.Require().NoError(orm.Migrator().DropTable("gofusion_migrations")) }()
+		db.AddMigration(name, 1, "create_guarded_probe",
+			func(ctx context.Context, s *migrate.Scope) error {
+				return s.Exec("CREATE TABLE guarded_probe (id bigint)").Error
+			},
+			func(ctx context.Context, s *migrate.Scope) error {
+				return s.Exec("DROP TABLE guarded_probe").Error
+			},
+			db.AppName(t.AppName()),
+		)
+
+		// When
+		applied, err := db.Migrate(ctx, name, db.AppName(t.AppName()))
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().Len(applied, 1)
+		t.Require().EqualValues(1, guarded.Load())
+
+		// When
+		status, err := db.MigrationStatus(ctx, name, db.AppName(t.AppName()))
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().Len(status, 1)
+		t.Require().EqualValues(1, guarded.Load())
+
+		// When
+		rolledBack, err := db.Rollback(ctx, name, db.AppName(t.AppName()))
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().Len(rolledBack, 1)
+		t.Require().EqualValues(2, guarded.Load())
+		t.Require().False(orm.Migrator().HasTable("guarded_probe"))
+	})
+}
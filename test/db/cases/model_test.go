@@ -6,10 +6,12 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
 
 	"github.com/wfusion/gofusion/db"
 	"github.com/wfusion/gofusion/log"
 
+	fusCtx "github.com/wfusion/gofusion/context"
 	testDB "github.com/wfusion/gofusion/test/db"
 )
 
@@ -57,6 +59,8 @@ func (t *Model) testDefault(read, write string) {
 	t.Run("SoftDelete", func() { t.testSoftDelete(read, write) })
 	t.Run("BusinessSoftDelete", func() { t.testBusinessSoftDelete(read, write) })
 	t.Run("SoftDeleteUnscoped", func() { t.testSoftDeleteUnscoped(read, write) })
+	t.Run("OptimisticLock", func() { t.testOptimisticLock(read, write) })
+	t.Run("Tenant", func() { t.testTenant(read, write) })
 }
 
 func (t *Model) testDataModel(read, write string) {
@@ -220,3 +224,115 @@ func (t *Model) testSoftDeleteUnscoped(read, write string) {
 		t.Require().Equal(mwb.Name, found.Name)
 	})
 }
+
+func (t *Model) testOptimisticLock(read, write string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, write, db.AppName(t.AppName())).WithContext(ctx)
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithVersion)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithVersion)))
+		}()
+
+		dal := modelWithVersionDAL(read, write, t.AppName())
+		mwv := &modelWithVersion{Name: "origin"}
+		t.Require().NoError(dal.InsertOne(ctx, mwv))
+		t.Require().EqualValues(1, mwv.Version)
+		stale, err := dal.QueryFirst(ctx, "id = ?", mwv.ID, db.WriteDB())
+		t.Require().NoError(err)
+
+		// When
+		mwv.Name = "first"
+		t.Require().NoError(dal.Save(ctx, mwv))
+		stale.Name = "second"
+		err = dal.Save(ctx, stale)
+
+		// Then
+		t.Require().ErrorIs(err, db.ErrStaleObject)
+		t.Require().EqualValues(2, mwv.Version)
+
+		called := 0
+		updated, err := dal.UpdateWithRetry(ctx, mwv.ID, func(mod *modelWithVersion) (err error) {
+			if called++; called == 1 {
+				_, err = dal.Updates(ctx, map[string]any{"name": "concurrent"}, "id = ?", mwv.ID)
+			}
+			mod.Name = "retried"
+			return
+		})
+		t.Require().NoError(err)
+		t.Require().Equal(2, called)
+		t.Require().Equal("retried", updated.Name)
+		t.Require().EqualValues(4, updated.Version)
+
+		// When
+		_, err = dal.Updates(ctx, &modelWithVersion{Name: "struct"}, "id = ?", mwv.ID)
+		t.Require().NoError(err)
+		found, err := dal.QueryFirst(ctx, "id = ?", mwv.ID, db.WriteDB())
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().Equal("struct", found.Name)
+		t.Require().EqualValues(5, found.Version)
+
+		_, err = dal.Delete(ctx, "id = ?", mwv.ID)
+		t.Require().NoError(err)
+		_, err = dal.UpdateWithRetry(ctx, mwv.ID, func(mod *modelWithVersion) error { return nil })
+		t.Require().ErrorIs(err, gorm.ErrRecordNotFound)
+	})
+}
+
+func (t *Model) testTenant(read, write string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, write, db.AppName(t.AppName())).WithContext(ctx)
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithTenant)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithTenant)))
+		}()
+
+		dal := modelWithTenantDAL(read, write, t.AppName())
+		ctxA := fusCtx.SetTenantID(ctx, "tenant_a")
+		ctxB := fusCtx.SetTenantID(ctx, "tenant_b")
+		mwtA := &modelWithTenant{Name: "a"}
+		t.Require().NoError(dal.InsertOne(ctxA, mwtA))
+		t.Require().EqualValues("tenant_a", mwtA.TenantID)
+		t.Require().NoError(dal.Save(ctxB, []*modelWithTenant{{Name: "b1"}, {Name: "b2"}}))
+
+		// When
+		rowsA, err := dal.Query(ctxA, "1 = 1", db.WriteDB())
+		t.Require().NoError(err)
+		crossUpdated, err := dal.Update(ctxB, "name", "leaked", "id = ?", mwtA.ID)
+		t.Require().NoError(err)
+		crossDeleted, err := dal.Delete(ctxB, "id = ?", mwtA.ID)
+		t.Require().NoError(err)
+		crossSaved := &modelWithTenant{Name: "overwritten"}
+		crossSaved.ID = mwtA.ID
+		crossSavedErr := dal.Save(ctxB, crossSaved)
+		saved := &modelWithTenant{Name: "a2"}
+		saved.ID = mwtA.ID
+		t.Require().NoError(dal.Save(ctxA, saved))
+		foundA, err := dal.QueryFirst(ctxA, "id = ?", mwtA.ID, db.WriteDB())
+		t.Require().NoError(err)
+
+		// Then
+		t.Require().Len(rowsA, 1)
+		t.Require().EqualValues(0, crossUpdated)
+		t.Require().EqualValues(0, crossDeleted)
+		t.Require().ErrorIs(crossSavedErr, db.ErrTenantMismatch)
+		t.Require().Equal("a2", foundA.Name)
+		t.Require().EqualValues("tenant_a", foundA.TenantID)
+		_, err = dal.Query(ctx, "1 = 1", db.WriteDB())
+		t.Require().ErrorIs(err, db.ErrTenantRequired)
+		t.Require().ErrorIs(dal.InsertOne(ctxA, &modelWithTenant{Tenant: db.Tenant{TenantID: "tenant_b"}}),
+			db.ErrTenantMismatch)
+
+		all, err := dal.Query(ctx, "1 = 1", db.WriteDB(), db.BypassTenant())
+		t.Require().NoError(err)
+		t.Require().Len(all, 3)
+		var count int64
+		t.Require().NoError(orm.Model(new(modelWithTenant)).Scopes(db.WithoutTenant).Count(&count).Error)
+		t.Require().EqualValues(3, count)
+	})
+}
@@ -0,0 +1,209 @@
+package cases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	ormDrv "github.com/wfusion/gofusion/common/infra/drivers/orm"
+	"github.com/wfusion/gofusion/db"
+	"github.com/wfusion/gofusion/log"
+
+	testDB "github.com/wfusion/gofusion/test/db"
+)
+
+func TestQueryCache(t *testing.T) {
+	testingSuite := &QueryCache{Test: new(testDB.Test)}
+	testingSuite.Init(testingSuite)
+	suite.Run(t, testingSuite)
+}
+
+type QueryCache struct {
+	*testDB.Test
+}
+
+func (t *QueryCache) BeforeTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right before %s %s", suiteName, testName)
+	})
+}
+
+func (t *QueryCache) AfterTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right after %s %s", suiteName, testName)
+	})
+}
+
+func (t *QueryCache) TestMysql() {
+	t.testDefault(nameMysqlRead, nameMysqlWrite)
+}
+
+func (t *QueryCache) TestPostgres() {
+	t.testDefault(namePostgres, namePostgres)
+}
+
+func (t *QueryCache) TestSqlite() {
+	t.testDefault(nameSqlite, nameSqlite)
+}
+
+func (t *QueryCache) testDefault(read, write string) {
+	t.Run("Invalidation", func() { t.testInvalidation(read, write) })
+	t.Run("Transaction", func() { t.testTransaction(read, write) })
+	t.Run("GormTransaction", func() { t.testGormTransaction(read, write) })
+	t.Run("Unsupported", func() { t.testUnsupported(read, write) })
+}
+
+func (t *QueryCache) testInvalidation(read, write string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithQueryCache)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithQueryCache)))
+		}()
+		dal := db.NewDAL[modelWithQueryCache, []*modelWithQueryCache](read, write, db.AppName(t.AppName()))
+		cached := db.Cached("db_query", time.Minute)
+		t.Require().NoError(dal.InsertOne(ctx, &modelWithQueryCache{Name: "cached"}))
+		found, err := dal.Query(ctx, "name = ?", "cached", cached)
+		t.Require().NoError(err)
+		t.Require().Len(found, 1)
+
+		// When
+		t.Require().NoError(orm.WithContext(ctx).
+			Exec("INSERT INTO model_with_query_cache (name) VALUES (?)", "cached").Error)
+
+		// Then
+		found, err = dal.Query(ctx, "name = ?", "cached", cached)
+		t.Require().NoError(err)
+		t.Require().Len(found, 2)
+
+		// When
+		t.Require().NoError(dal.InsertOne(ctx, &modelWithQueryCache{Name: "cached"}))
+
+		// Then
+		found, err = dal.Query(ctx, "name = ?", "cached", cached)
+		t.Require().NoError(err)
+		t.Require().Len(found, 3)
+		count, err := dal.Count(ctx, "name = ?", "cached", cached)
+		t.Require().NoError(err)
+		t.Require().EqualValues(3, count)
+
+		// When
+		t.Require().NoError(orm.WithContext(ctx).
+			Raw("UPDATE model_with_query_cache SET name = ? WHERE name = ?", "renamed", "cached").
+			Scan(&[]*modelWithQueryCache{}).Error)
+
+		// Then
+		count, err = dal.Count(ctx, "name = ?", "cached", cached)
+		t.Require().NoError(err)
+		t.Require().Zero(count)
+	})
+}
+
+func (t *QueryCache) testTransaction(read, write string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithQueryCache)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithQueryCache)))
+		}()
+		dal := db.NewDAL[modelWithQueryCache, []*modelWithQueryCache](read, write, db.AppName(t.AppName()))
+		cached := db.Cached("db_query", time.Minute)
+		t.Require().NoError(dal.InsertOne(ctx, &modelWithQueryCache{Name: "cached"}))
+		count, err := dal.Count(ctx, "name = ?", "cached", cached)
+		t.Require().NoError(err)
+		t.Require().EqualValues(1, count)
+
+		// When
+		err = dal.Transaction(ctx, func(ctx context.Context) error {
+			if _, err := dal.Delete(ctx, "name = ?", "cached"); err != nil {
+				return err
+			}
+			count, err := dal.Count(ctx, "name = ?", "cached", cached, db.WriteDB())
+			t.Require().NoError(err)
+			t.Require().Zero(count)
+			return nil
+		}, db.WriteDB())
+
+		// Then
+		t.Require().NoError(err)
+		count, err = dal.Count(ctx, "name = ?", "cached", cached)
+		t.Require().NoError(err)
+		t.Require().Zero(count)
+	})
+}
+
+func (t *QueryCache) testGormTransaction(read, write string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithQueryCache)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithQueryCache)))
+		}()
+		dal := db.NewDAL[modelWithQueryCache, []*modelWithQueryCache](read, write, db.AppName(t.AppName()))
+		cached := db.Cached("db_query", time.Minute)
+		t.Require().NoError(dal.InsertOne(ctx, &modelWithQueryCache{Name: "cached"}))
+		count, err := dal.Count(ctx, "name = ?", "cached", cached)
+		t.Require().NoError(err)
+		t.Require().EqualValues(1, count)
+
+		// When
+		err = orm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			ctx := db.SetCtxGormDB(ctx, &db.DB{DB: &ormDrv.DB{DB: tx}, Name: write})
+			t.Require().NoError(tx.Exec("INSERT INTO model_with_query_cache (name) VALUES (?)", "cached").Error)
+			count, err := dal.Count(ctx, "name = ?", "cached", cached, db.WriteDB())
+			t.Require().NoError(err)
+			t.Require().EqualValues(2, count)
+			return gorm.ErrInvalidTransaction
+		})
+
+		// Then
+		t.Require().ErrorIs(err, gorm.ErrInvalidTransaction)
+		count, err = dal.Count(ctx, "name = ?", "cached", cached)
+		t.Require().NoError(err)
+		t.Require().EqualValues(1, count)
+	})
+}
+
+func (t *QueryCache) testUnsupported(read, write string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithQueryCache)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithQueryCache)))
+		}()
+		dal := db.NewDAL[modelWithQueryCache, []*modelWithQueryCache](read, write, db.AppName(t.AppName()))
+		cached := db.Cached("db_query", time.Minute)
+		joined := db.Clauses(clause.From{Joins: []clause.Join{{
+			Type:  clause.LeftJoin,
+			Table: clause.Table{Name: "model_with_query_cache", Alias: "other"},
+			ON: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{SQL: "other.name = model_with_query_cache.name"},
+			}},
+		}}})
+
+		// When
+		_, err := dal.Query(ctx, "model_with_query_cache.name = ?", "cached", cached, joined)
+
+		// Then
+		t.Require().ErrorIs(err, db.ErrQueryCacheNotSupport)
+
+		// When
+		preloaded := db.SetCtxGormDB(ctx, &db.DB{DB: &ormDrv.DB{DB: orm.GetProxy().Preload("Others")}, Name: read})
+		_, err = dal.Query(preloaded, "name = ?", "cached", cached)
+
+		// Then
+		t.Require().ErrorIs(err, db.ErrQueryCacheNotSupport)
+	})
+}
@@ -0,0 +1,134 @@
+package cases
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/atomic"
+	"gorm.io/gorm"
+
+	"github.com/wfusion/gofusion/db"
+	"github.com/wfusion/gofusion/db/plugins"
+	"github.com/wfusion/gofusion/log"
+
+	testDB "github.com/wfusion/gofusion/test/db"
+)
+
+func TestReplica(t *testing.T) {
+	testingSuite := &Replica{Test: new(testDB.Test)}
+	testingSuite.Init(testingSuite)
+	suite.Run(t, testingSuite)
+}
+
+type Replica struct {
+	*testDB.Test
+}
+
+func (t *Replica) BeforeTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right before %s %s", suiteName, testName)
+	})
+}
+
+func (t *Replica) AfterTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right after %s %s", suiteName, testName)
+	})
+}
+
+func (t *Replica) TestSqlite() {
+	t.testDefault(nameSqliteReplicas, nameSqliteReplicas)
+}
+
+func (t *Replica) testDefault(read, write string) {
+	t.Run("Routing", func() { t.testRouting(read, write) })
+	t.Run("ReadYourWrites", func() { t.testReadYourWrites(read, write) })
+}
+
+func (t *Replica) testRouting(read, write string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithData)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithData)))
+		}()
+		t.Require().NoError(orm.WithContext(ctx).Create(&modelWithData{Name: "replica"}).Error)
+		routed := t.watchRouting(orm.GetProxy())
+
+		// When
+		var found []*modelWithData
+		t.Require().NoError(db.Use(ctx, read, db.AppName(t.AppName())).WithContext(ctx).
+			Where("name = ?", "replica").Find(&found).Error)
+
+		// Then
+		t.Require().Len(found, 1)
+		t.Require().True(routed.Load())
+
+		// When
+		var count int64
+		t.Require().NoError(orm.WithContext(ctx).
+			Raw("SELECT COUNT(*) FROM model_with_data WHERE name = ?", "replica").Scan(&count).Error)
+
+		// Then
+		t.Require().EqualValues(1, count)
+		t.Require().False(routed.Load())
+
+		// When
+		t.Require().NoError(orm.WithContext(ctx).Set(plugins.SettingReadOnly, true).
+			Raw("SELECT COUNT(*) FROM model_with_data WHERE name = ?", "replica").Scan(&count).Error)
+
+		// Then
+		t.Require().EqualValues(1, count)
+		t.Require().True(routed.Load())
+
+		// When
+		row := orm.WithContext(ctx).Set(plugins.SettingReadOnly, false).
+			Raw("UPDATE model_with_data SET name = ? WHERE name = ?", "updated", "replica").Row()
+
+		// Then
+		t.Require().NoError(row.Err())
+		t.Require().False(routed.Load())
+	})
+}
+
+func (t *Replica) testReadYourWrites(read, write string) {
+	t.Catch(func() {
+		// Given
+		ctx := db.ReadYourWrites(context.Background())
+		orm := db.Use(ctx, write, db.AppName(t.AppName()))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithData)))
+		defer func() {
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithData)))
+		}()
+		routed := t.watchRouting(orm.GetProxy())
+
+		// When
+		row := orm.WithContext(ctx).Raw("UPDATE model_with_data SET name = ? WHERE name = ?", "a", "b").Row()
+		t.Require().NoError(row.Err())
+		var found []*modelWithData
+		t.Require().NoError(db.Use(ctx, read, db.AppName(t.AppName())).WithContext(ctx).Find(&found).Error)
+
+		// Then
+		t.Require().False(routed.Load())
+	})
+}
+
+// watchRouting records whether the last query or row statement is routed to a replica
+func (t *Replica) watchRouting(orm *gorm.DB) (routed *atomic.Bool) {
+	// removed callback names could not be registered again
+	name := "test:replica:" + t.T().Name()
+	routed = atomic.NewBool(false)
+	watch := func(tx *gorm.DB) { routed.Store(tx.Statement.ConnPool != tx.ConnPool) }
+	t.Require().NoError(orm.Callback().Query().After("gofusion:replica").Before("gorm:query").
+		Register(name, watch))
+	t.Require().NoError(orm.Callback().Row().After("gofusion:replica").Before("gorm:row").
+		Register(name, watch))
+	t.T().Cleanup(func() {
+		t.Require().NoError(orm.Callback().Query().Remove(name))
+		t.Require().NoError(orm.Callback().Row().Remove(name))
+	})
+	return
+}
@@ -0,0 +1,169 @@
+package cases
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/atomic"
+	"gorm.io/gorm"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm/reshard"
+	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/db"
+	"github.com/wfusion/gofusion/log"
+
+	testDB "github.com/wfusion/gofusion/test/db"
+)
+
+func TestReshard(t *testing.T) {
+	testingSuite := &Reshard{Test: new(testDB.Test)}
+	testingSuite.Init(testingSuite)
+	suite.Run(t, testingSuite)
+}
+
+type Reshard struct {
+	*testDB.Test
+}
+
+func (t *Reshard) BeforeTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right before %s %s", suiteName, testName)
+	})
+}
+
+func (t *Reshard) AfterTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right after %s %s", suiteName, testName)
+	})
+}
+
+func (t *Reshard) TestMysql() {
+	t.testDefault(nameMysqlWrite)
+}
+
+func (t *Reshard) TestSqlite() {
+	t.testDefault(nameSqlite)
+}
+
+func (t *Reshard) testDefault(name string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		orm := db.Use(ctx, name, db.AppName(t.AppName()))
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithResharding)))
+		defer func() {
+			for _, table := range []string{
+				"model_with_resharding_user_id_0", "model_with_resharding_user_id_1",
+				"model_with_resharding_v2_00", "model_with_resharding_v2_01",
+				"model_with_resharding_v2_02", "model_with_resharding_v2_03",
+				reshard.DefaultTable,
+			} {
+				t.Require().NoError(orm.Migrator().DropTable(table))
+			}
+		}()
+		dal := db.NewDAL[modelWithResharding, []*modelWithResharding](name, name, db.AppName(t.AppName()))
+		for i := 1; i <= 10; i++ {
+			t.Require().NoError(dal.InsertOne(ctx, &modelWithResharding{UserID: int64(i), Name: "origin"}))
+		}
+		opts := []utils.OptionExtender{
+			db.AppName(t.AppName()), db.ReshardSettle(0), db.ReshardSuffix("v2_%02d"), db.ReshardBatch(3),
+		}
+
+		// When
+		_, conflictErr := db.Reshard[modelWithResharding, []*modelWithResharding](ctx, name, 4,
+			db.AppName(t.AppName()), db.ReshardSettle(0))
+		defer t.crashAfterFirstBatch(orm.GetProxy())()
+		_, crashErr := db.Reshard[modelWithResharding, []*modelWithResharding](ctx, name, 4, opts...)
+		jobs, err := reshard.New(orm.GetProxy()).Latest(ctx, new(modelWithResharding).TableName())
+		t.Require().NoError(err)
+		crashed := jobs[new(modelWithResharding).TableName()]
+
+		// Then
+		t.Require().Error(conflictErr)
+		t.Require().ErrorIs(crashErr, errReshardCrash)
+		t.Require().NotNil(crashed)
+		t.Require().Equal(reshard.PhaseCopying, crashed.Phase)
+		t.Require().EqualValues(3, crashed.Copied)
+
+		// When dual written while copying
+		t.Require().NoError(dal.InsertOne(ctx, &modelWithResharding{UserID: 11, Name: "dual"}))
+		_, err = dal.Update(ctx, "name", "dual", "user_id = ?", 1)
+		t.Require().NoError(err)
+		_, err = dal.Delete(ctx, "user_id = ?", 2)
+		t.Require().NoError(err)
+
+		// Then
+		t.Require().Equal([]string{"dual"}, t.reshardedNames(orm.GetProxy(), 11))
+		t.Require().Equal([]string{"dual"}, t.reshardedNames(orm.GetProxy(), 1))
+		t.Require().Empty(t.reshardedNames(orm.GetProxy(), 2))
+
+		// When resumed
+		job, err := db.Reshard[modelWithResharding, []*modelWithResharding](ctx, name, 4, opts...)
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().Equal(crashed.ID, job.ID)
+		t.Require().Equal(reshard.PhaseDone, job.Phase)
+		t.Require().Greater(job.Copied, crashed.Copied)
+
+		var total int64
+		for _, table := range []string{
+			"model_with_resharding_v2_00", "model_with_resharding_v2_01",
+			"model_with_resharding_v2_02", "model_with_resharding_v2_03",
+		} {
+			var count int64
+			t.Require().NoError(orm.Table(table).Count(&count).Error)
+			total += count
+		}
+		t.Require().EqualValues(10, total)
+
+		found, err := dal.QueryFirst(ctx, "user_id = ?", 1)
+		t.Require().NoError(err)
+		t.Require().Equal("dual", found.Name)
+		t.Require().NoError(dal.InsertOne(ctx, &modelWithResharding{UserID: 12, Name: "cutover"}))
+		var oldCount int64
+		t.Require().NoError(orm.Table("model_with_resharding_user_id_0").Count(&oldCount).Error)
+		var oldCount1 int64
+		t.Require().NoError(orm.Table("model_with_resharding_user_id_1").Count(&oldCount1).Error)
+		t.Require().EqualValues(10, oldCount+oldCount1)
+	})
+}
+
+var errReshardCrash = errors.New("resharding crashed")
+
+// crashAfterFirstBatch fails the scan of the next batch once the first batch is copied as if crashed,
+// the returned remove should be called before the app exits since removing logs through the app logger
+func (t *Reshard) crashAfterFirstBatch(orm *gorm.DB) (remove func()) {
+	// removed callback names could not be registered again
+	name := "test:reshard:crash:" + t.T().Name()
+	copied, crashed := atomic.NewBool(false), atomic.NewBool(false)
+	t.Require().NoError(orm.Callback().Update().After("gorm:update").Register(name, func(tx *gorm.DB) {
+		if job, ok := tx.Statement.Dest.(*reshard.Job); ok && job.Phase == reshard.PhaseCopying && job.Copied > 0 {
+			copied.Store(true)
+		}
+	}))
+	t.Require().NoError(orm.Callback().Query().Before("gorm:query").Register(name, func(tx *gorm.DB) {
+		if tx.Statement.Table != reshard.DefaultTable && copied.Load() && crashed.CompareAndSwap(false, true) {
+			_ = tx.AddError(errReshardCrash)
+		}
+	}))
+	return func() {
+		t.Require().NoError(orm.Callback().Update().Remove(name))
+		t.Require().NoError(orm.Callback().Query().Remove(name))
+	}
+}
+
+// reshardedNames returns names of the user in new shard tables
+func (t *Reshard) reshardedNames(orm *gorm.DB, userID int64) (names []string) {
+	for _, table := range []string{
+		"model_with_resharding_v2_00", "model_with_resharding_v2_01",
+		"model_with_resharding_v2_02", "model_with_resharding_v2_03",
+	} {
+		var found []string
+		t.Require().NoError(orm.Table(table).Where("user_id = ?", userID).Pluck("name", &found).Error)
+		names = append(names, found...)
+	}
+	return
+}
@@ -0,0 +1,141 @@
+package cases
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm/clause"
+
+	"github.com/wfusion/gofusion/db"
+	"github.com/wfusion/gofusion/db/plugins"
+	"github.com/wfusion/gofusion/log"
+
+	testDB "github.com/wfusion/gofusion/test/db"
+)
+
+func TestShardGroup(t *testing.T) {
+	testingSuite := &ShardGroup{Test: new(testDB.Test)}
+	testingSuite.Init(testingSuite)
+	suite.Run(t, testingSuite)
+}
+
+type ShardGroup struct {
+	*testDB.Test
+}
+
+func (t *ShardGroup) BeforeTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right before %s %s", suiteName, testName)
+	})
+}
+
+func (t *ShardGroup) AfterTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right after %s %s", suiteName, testName)
+	})
+}
+
+func (t *ShardGroup) TestDefault() {
+	t.Run("Route", func() { t.testRoute() })
+	t.Run("Transaction", func() { t.testTransaction() })
+}
+
+func (t *ShardGroup) migrate(ctx context.Context) func() {
+	for _, name := range []string{nameMysqlWrite, namePostgres} {
+		orm := db.Use(ctx, name, db.AppName(t.AppName())).WithContext(ctx)
+		t.Require().NoError(orm.Migrator().AutoMigrate(new(modelWithShardGroup)))
+	}
+	return func() {
+		for _, name := range []string{nameMysqlWrite, namePostgres} {
+			orm := db.Use(ctx, name, db.AppName(t.AppName())).WithContext(ctx)
+			t.Require().NoError(orm.Migrator().DropTable(new(modelWithShardGroup)))
+		}
+	}
+}
+
+func (t *ShardGroup) testRoute() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		defer t.migrate(ctx)()
+		dal := modelWithShardGroupDAL(t.AppName())
+		mList := make([]*modelWithShardGroup, 0, 10)
+		for i := 1; i <= 10; i++ {
+			mList = append(mList, &modelWithShardGroup{UserID: int64(i), Name: "origin"})
+		}
+		t.Require().NoError(dal.Save(ctx, mList))
+
+		// When
+		single, err := dal.Query(ctx, "user_id = ?", 3)
+		t.Require().NoError(err)
+		limit := 3
+		merged, err := dal.Query(ctx, "user_id > ?", 2,
+			clause.OrderBy{Columns: []clause.OrderByColumn{{Column: clause.Column{Name: "user_id"}, Desc: true}}},
+			clause.Limit{Limit: &limit, Offset: 1})
+		t.Require().NoError(err)
+		either, err := dal.Query(ctx, "user_id = ? OR user_id = ?", 4, 5)
+		t.Require().NoError(err)
+		count, err := dal.Count(ctx, "1 = 1")
+		t.Require().NoError(err)
+		_, keylessErr := dal.Update(ctx, "name", "updated", "user_id IN ?", []int64{1, 2})
+		_, keylessDeleteErr := dal.Delete(ctx, "name = ?", "origin")
+		updated, err := dal.Update(ctx, "name", "updated", "user_id IN ?", []int64{1, 2}, db.AllowCrossShard())
+		t.Require().NoError(err)
+
+		// Then
+		t.Require().Len(single, 1)
+		t.Require().EqualValues(3, single[0].UserID)
+		t.Require().Len(merged, 3)
+		t.Require().EqualValues(9, merged[0].UserID)
+		t.Require().EqualValues(7, merged[2].UserID)
+		t.Require().Len(either, 2)
+		t.Require().EqualValues(10, count)
+		t.Require().ErrorIs(keylessErr, plugins.ErrMissingShardingKey)
+		t.Require().ErrorIs(keylessDeleteErr, plugins.ErrMissingShardingKey)
+		t.Require().EqualValues(2, updated)
+
+		var total int64
+		for _, name := range []string{nameMysqlWrite, namePostgres} {
+			var shardCount int64
+			orm := db.Use(ctx, name, db.AppName(t.AppName())).WithContext(ctx)
+			t.Require().NoError(orm.Model(new(modelWithShardGroup)).Count(&shardCount).Error)
+			t.Require().Less(shardCount, int64(10))
+			total += shardCount
+		}
+		t.Require().EqualValues(10, total)
+	})
+}
+
+func (t *ShardGroup) testTransaction() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		defer t.migrate(ctx)()
+		dal := modelWithShardGroupDAL(t.AppName())
+		t.Require().NoError(dal.Save(ctx, []*modelWithShardGroup{{UserID: 1}, {UserID: 2}, {UserID: 3}}))
+
+		// When
+		crossErr := dal.Transaction(ctx, func(tx context.Context) error { return nil })
+		err := dal.Transaction(ctx, func(tx context.Context) (err error) {
+			if _, err = dal.Update(tx, "name", "in_tx", "user_id = ?", 1); err != nil {
+				return
+			}
+			_, crossErr := dal.Count(tx, "1 = 1")
+			t.Require().ErrorIs(crossErr, db.ErrCrossShardTx)
+			return
+		}, db.ShardingKey(1))
+
+		// Then
+		t.Require().ErrorIs(crossErr, db.ErrCrossShardTx)
+		t.Require().NoError(err)
+		found, err := dal.QueryFirst(ctx, "user_id = ?", 1)
+		t.Require().NoError(err)
+		t.Require().Equal("in_tx", found.Name)
+		t.Require().NoError(dal.Transaction(ctx, func(tx context.Context) error {
+			count, err := dal.Count(tx, "1 = 1")
+			t.Require().EqualValues(3, count)
+			return err
+		}, db.AllowCrossShard()))
+	})
+}
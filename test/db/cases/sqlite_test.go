@@ -53,3 +53,11 @@ func (t *Sqlite) TestTableSharding() {
 func (t *Sqlite) TestTransaction() {
 	(&Transaction{Test: t.Test}).testDefault(nameSqlite, nameSqlite)
 }
+
+func (t *Sqlite) TestAudit() {
+	(&Audit{Test: t.Test}).testDefault(nameSqlite, nameSqlite)
+}
+
+func (t *Sqlite) TestQueryCache() {
+	(&QueryCache{Test: t.Test}).testDefault(nameSqlite, nameSqlite)
+}
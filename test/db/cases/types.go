@@ -7,12 +7,21 @@ import (
 )
 
 const (
-	nameMysqlWrite = "write"
-	nameMysqlRead  = "read"
-	namePostgres   = "postgres"
-	nameOpenGauss  = "opengauss"
-	nameSqlserver  = "sqlserver"
-	nameSqlite     = "sqlite"
+	nameMysqlWrite     = "write"
+	nameMysqlRead      = "read"
+	namePostgres       = "postgres"
+	nameOpenGauss      = "opengauss"
+	nameSqlserver      = "sqlserver"
+	nameSqlite         = "sqlite"
+	nameSqliteReplicas = "sqlite_replicas"
+	nameSqliteMigrate  = "sqlite_migration"
+	nameShardGroup     = "shard_group"
+
+	// testIDGenWorkerTable is apart from the worker table leased by sharding configs
+	testIDGenWorkerTable  = "test_idgen_workers"
+	testIDGenSegmentTable = "test_idgen_segments"
+	// cryptoRotatedKey is the key of the rotated key k1 of the pii crypto config
+	cryptoRotatedKey = "12345678abcdefgh12345678abcdefgh"
 )
 
 type modelWithData struct {
@@ -66,6 +75,110 @@ func (*modelBizWithSoftDeleted) TableName() string {
 	return "model_biz_with_soft_deleted"
 }
 
+type modelWithVersion struct {
+	db.DataSoftDeleted
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at"`
+	Version   db.Version     `gorm:"column:version"`
+	Name      string         `gorm:"column:name"`
+}
+
+func (*modelWithVersion) TableName() string {
+	return "model_with_version"
+}
+
+func modelWithVersionDAL(read, write, appName string) db.DalInterface[modelWithVersion, []*modelWithVersion] {
+	return db.NewDAL[modelWithVersion, []*modelWithVersion](read, write, db.AppName(appName))
+}
+
+type modelWithTenant struct {
+	db.DataSoftDeleted
+	db.Tenant
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at"`
+	Name      string         `gorm:"column:name"`
+}
+
+func (*modelWithTenant) TableName() string {
+	return "model_with_tenant"
+}
+
+func modelWithTenantDAL(read, write, appName string) db.DalInterface[modelWithTenant, []*modelWithTenant] {
+	return db.NewDAL[modelWithTenant, []*modelWithTenant](read, write, db.AppName(appName))
+}
+
+type modelWithShardGroup struct {
+	db.Data
+	UserID int64  `gorm:"column:user_id"`
+	Name   string `gorm:"column:name"`
+}
+
+func (*modelWithShardGroup) TableName() string {
+	return "model_with_shard_group"
+}
+
+func modelWithShardGroupDAL(appName string) db.DalInterface[modelWithShardGroup, []*modelWithShardGroup] {
+	return db.NewShardedDAL[modelWithShardGroup, []*modelWithShardGroup](nameShardGroup, db.AppName(appName))
+}
+
+type modelWithResharding struct {
+	db.Data
+	UserID int64  `gorm:"column:user_id"`
+	Name   string `gorm:"column:name"`
+}
+
+func (*modelWithResharding) TableName() string {
+	return "model_with_resharding"
+}
+
+type modelWithLeasedID struct {
+	db.Data
+	Name string `gorm:"column:name"`
+}
+
+func (*modelWithLeasedID) TableName() string {
+	return "model_with_leased_id"
+}
+
+type modelWithSegmentID struct {
+	db.Data
+	Name string `gorm:"column:name"`
+}
+
+func (*modelWithSegmentID) TableName() string {
+	return "model_with_segment_id"
+}
+
+type modelWithAudit struct {
+	db.Data
+	Name     string `gorm:"column:name"`
+	Phone    string `gorm:"column:phone" audit:"mask"`
+	Password string `gorm:"column:password" audit:"-"`
+}
+
+func (*modelWithAudit) TableName() string {
+	return "model_with_audit"
+}
+
+type modelWithQueryCache struct {
+	db.Data
+	Name string `gorm:"column:name"`
+}
+
+func (*modelWithQueryCache) TableName() string {
+	return "model_with_query_cache"
+}
+
+type modelWithCrypto struct {
+	db.Data
+	Name       string            `gorm:"column:name"`
+	Phone      string            `gorm:"column:phone;type:varchar(255);serializer:fus_crypto;crypto:pii"`
+	PhoneIndex string            `gorm:"column:phone_index;type:varchar(64);index;blind_index:Phone"`
+	Profile    map[string]string `gorm:"column:profile;type:text;serializer:fus_crypto;crypto:pii"`
+}
+
+func (*modelWithCrypto) TableName() string {
+	return "model_with_crypto"
+}
+
 type modelWithBusinessAndUser struct {
 	db.Business
 	UserBase
@@ -3,7 +3,10 @@ package cases
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/suite"
@@ -64,3 +67,104 @@ func (t *Client) TestMock() {
 		t.Require().EqualValues(expected.Data, actual.Data)
 	})
 }
+
+func (t *Client) TestConfigWithoutMock() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(2 * time.Second):
+			case <-r.Context().Done():
+			}
+		}))
+		defer srv.Close()
+		cli := fusHtp.New(fusHtp.AppName(t.AppName()), fusHtp.CName(clientTimeoutName))
+
+		// When
+		begin := time.Now()
+		_, err := cli.R().SetContext(ctx).Get(srv.URL)
+
+		// Then
+		t.Require().Error(err)
+		t.Require().Less(time.Since(begin), time.Second)
+		t.Require().EqualValues(200*time.Millisecond, cli.GetClient().Timeout)
+		transport, ok := cli.GetClient().Transport.(*http.Transport)
+		t.Require().True(ok)
+		t.Require().EqualValues(1, transport.MaxConnsPerHost)
+
+		local := fusHtp.New(fusHtp.AppName(t.AppName()), fusHtp.CName(clientLocalName))
+		t.Require().EqualValues(2, local.RetryCount)
+	})
+}
+
+func (t *Client) TestCircuitBreaker() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		var (
+			calls     atomic.Int64
+			recovered atomic.Bool
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			if !recovered.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+		defer srv.Close()
+		cli := fusHtp.New(fusHtp.AppName(t.AppName()), fusHtp.CName(clientResilientName))
+
+		// When
+		for i := 0; i < 2; i++ {
+			rsp, err := cli.R().SetContext(ctx).Post(srv.URL)
+			t.Require().NoError(err)
+			t.Require().EqualValues(http.StatusInternalServerError, rsp.StatusCode())
+		}
+		_, err := cli.R().SetContext(ctx).Post(srv.URL)
+
+		// Then
+		t.Require().ErrorIs(err, fusHtp.ErrClientCircuitOpen)
+		t.Require().EqualValues(2, calls.Load())
+
+		// When
+		recovered.Store(true)
+		time.Sleep(1100 * time.Millisecond)
+		rsp, err := cli.R().SetContext(ctx).Post(srv.URL)
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+		t.Require().EqualValues(3, calls.Load())
+	})
+}
+
+func (t *Client) TestHedging() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		var calls atomic.Int64
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				select {
+				case <-time.After(2 * time.Second):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			_, _ = w.Write([]byte("hedged"))
+		}))
+		defer srv.Close()
+		cli := fusHtp.New(fusHtp.AppName(t.AppName()), fusHtp.CName(clientResilientName))
+
+		// When
+		begin := time.Now()
+		rsp, err := cli.R().SetContext(ctx).Get(srv.URL)
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().EqualValues("hedged", rsp.String())
+		t.Require().Less(time.Since(begin), time.Second)
+		t.Require().EqualValues(2, calls.Load())
+	})
+}
@@ -145,3 +145,32 @@ func (t *Group) TestUseDispatch() {
 		t.Require().Contains(w.Body.String(), io.ErrUnexpectedEOF.Error())
 	})
 }
+
+func (t *Group) TestOpenAPI() {
+	t.Catch(func() {
+		// Given
+		type reqStruct struct {
+			ID   string `uri:"id" binding:"required"`
+			Name string `json:"name" binding:"required"`
+		}
+		path := "/items/:id"
+		group := "/TestOpenAPI"
+		hd := func(c *gin.Context, req *reqStruct) (data map[string]any, err error) {
+			return
+		}
+		groupRouter := fusHtp.Use(fusHtp.AppName(t.AppName())).Group(group)
+		groupRouter.POST(path, hd, fusHtp.APISummary("TestOpenAPI"))
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+		t.Require().NoError(err)
+
+		// When
+		fusHtp.Use(fusHtp.AppName(t.AppName())).ServeHTTP(w, req)
+
+		// Then
+		t.Require().Equal(http.StatusOK, w.Code)
+		t.Require().Contains(w.Body.String(), `"/TestOpenAPI/items/{id}"`)
+		t.Require().Contains(w.Body.String(), `"summary":"TestOpenAPI"`)
+	})
+}
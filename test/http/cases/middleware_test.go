@@ -5,14 +5,19 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/suite"
+	"go.uber.org/atomic"
 
 	"github.com/wfusion/gofusion/common/utils"
 	"github.com/wfusion/gofusion/log"
 
+	fusCtx "github.com/wfusion/gofusion/context"
 	fusHtp "github.com/wfusion/gofusion/http"
 	testHtp "github.com/wfusion/gofusion/test/http"
 )
@@ -58,6 +63,332 @@ func (t *Middleware) TestRecover() {
 	})
 }
 
+func (t *Middleware) TestTracing() {
+	t.Catch(func() {
+		// Given
+		path := "/TestTracing/:id"
+		traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+		ctx := context.Background()
+		router := fusHtp.Use(fusHtp.AppName(t.AppName()))
+		router.GET(path, func(c *gin.Context) error {
+			return nil
+		})
+		router.Start()
+		<-router.Running()
+
+		// When
+		req := fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName()))
+		req.SetHeader("Origin", "localhost")
+		req.SetHeader("traceparent", fmt.Sprintf("00-%s-00f067aa0ba902b7-01", traceID))
+		rsp, err := req.Get(t.addr() + "/TestTracing/1")
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+		t.Require().EqualValues(traceID, rsp.Header().Get("traceid"))
+	})
+}
+
+func (t *Middleware) TestRateLimit() {
+	t.Catch(func() {
+		// Given
+		path := "/TestRateLimit"
+		ctx := context.Background()
+		router := fusHtp.Use(fusHtp.AppName(t.AppName()))
+		router.GET(path, func(c *gin.Context) error {
+			return nil
+		}, fusHtp.RateLimit(1, time.Minute, fusHtp.LimitAlgorithm(fusHtp.RateLimitSlidingWindow)))
+		router.Start()
+		<-router.Running()
+
+		// When
+		req := fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName()))
+		req.SetHeader("Origin", "localhost")
+		rsp, err := req.Get(t.addr() + path)
+		t.Require().NoError(err)
+		t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+		t.Require().EqualValues("1", rsp.Header().Get("RateLimit-Limit"))
+		t.Require().EqualValues("0", rsp.Header().Get("RateLimit-Remaining"))
+
+		req = fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName()))
+		req.SetHeader("Origin", "localhost")
+		rsp, err = req.Get(t.addr() + path)
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().EqualValues(http.StatusTooManyRequests, rsp.StatusCode())
+		t.Require().NotEmpty(rsp.Header().Get("Retry-After"))
+	})
+}
+
+func (t *Middleware) TestAuth() {
+	t.Catch(func() {
+		// Given
+		path := "/TestAuth"
+		ctx := context.Background()
+		router := fusHtp.Use(fusHtp.AppName(t.AppName()))
+		router.
+			Group(path, fusHtp.Authenticate(fusHtp.AppName(t.AppName()))).
+			Use(fusHtp.RequireClaim("scope", []string{"read"}, fusHtp.AppName(t.AppName()))).
+			GET("", func(c *gin.Context) error {
+				t.Require().EqualValues("jwt-user", fusCtx.GetUserID(fusCtx.New(fusCtx.Gin(c))))
+				return nil
+			})
+		router.Start()
+		<-router.Running()
+
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":   "jwt-user",
+			"scope": "read write",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}).SignedString([]byte("gofusion-test-secret"))
+		t.Require().NoError(err)
+
+		// When
+		req := fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName()))
+		rsp, err := req.Get(t.addr() + path)
+		t.Require().NoError(err)
+		t.Require().EqualValues(http.StatusUnauthorized, rsp.StatusCode())
+
+		req = fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName()))
+		req.SetHeader("X-API-Key", "gofusion-test-key")
+		rsp, err = req.Get(t.addr() + path)
+		t.Require().NoError(err)
+		t.Require().EqualValues(http.StatusForbidden, rsp.StatusCode())
+
+		req = fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName()))
+		req.SetHeader("Authorization", "Bearer "+token)
+		rsp, err = req.Get(t.addr() + path)
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+	})
+}
+
+func (t *Middleware) TestIdempotency() {
+	t.Catch(func() {
+		// Given
+		path := "/TestIdempotency"
+		ctx := context.Background()
+		executed := atomic.NewInt32(0)
+		router := fusHtp.Use(fusHtp.AppName(t.AppName()))
+		router.POST(path, func(c *gin.Context) error {
+			executed.Inc()
+			return nil
+		}, fusHtp.Idempotent(fusHtp.IdempotencyTTL(time.Minute)))
+		router.Start()
+		<-router.Running()
+
+		// When
+		req := fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName()))
+		req.SetHeader("Idempotency-Key", utils.UUID())
+		req.SetBody(map[string]string{"name": "gofusion"})
+		rsp, err := req.Post(t.addr() + path)
+		t.Require().NoError(err)
+		t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+		t.Require().Empty(rsp.Header().Get(fusHtp.HeaderIdempotentReplayed))
+
+		replayed, err := req.Post(t.addr() + path)
+		t.Require().NoError(err)
+
+		req.SetBody(map[string]string{"name": "another"})
+		mismatched, err := req.Post(t.addr() + path)
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().EqualValues(1, executed.Load())
+		t.Require().EqualValues(http.StatusOK, replayed.StatusCode())
+		t.Require().EqualValues("true", replayed.Header().Get(fusHtp.HeaderIdempotentReplayed))
+		t.Require().EqualValues(rsp.Body(), replayed.Body())
+		t.Require().EqualValues(http.StatusUnprocessableEntity, mismatched.StatusCode())
+	})
+}
+
+func (t *Middleware) TestResponseCache() {
+	t.Catch(func() {
+		// Given
+		path := "/TestResponseCache"
+		ctx := context.Background()
+		executed := atomic.NewInt32(0)
+		router := fusHtp.Use(fusHtp.AppName(t.AppName()))
+		router.GET(path, func(c *gin.Context) (map[string]int32, error) {
+			fusHtp.AddCacheTags(c, "user:"+c.Query("user"))
+			return map[string]int32{"executed": executed.Inc()}, nil
+		}, fusHtp.Cached(fusHtp.CacheTTL(time.Minute), fusHtp.CacheTags("TestResponseCache")))
+		router.Start()
+		<-router.Running()
+
+		// When
+		req := fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName()))
+		rsp, err := req.Get(t.addr() + path + "?user=1")
+		t.Require().NoError(err)
+		t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+		t.Require().EqualValues("MISS", rsp.Header().Get(fusHtp.HeaderCacheStatus))
+		etag := rsp.Header().Get("ETag")
+		t.Require().NotEmpty(etag)
+
+		cached, err := req.Get(t.addr() + path + "?user=1")
+		t.Require().NoError(err)
+
+		notModified, err := fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName())).
+			SetHeader("If-None-Match", etag).
+			Get(t.addr() + path + "?user=1")
+		t.Require().NoError(err)
+
+		t.Require().NoError(fusHtp.InvalidateCache(ctx, []string{"user:1"}, fusHtp.AppName(t.AppName())))
+		invalidated, err := req.Get(t.addr() + path + "?user=1")
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().EqualValues("HIT", cached.Header().Get(fusHtp.HeaderCacheStatus))
+		t.Require().EqualValues(rsp.Body(), cached.Body())
+		t.Require().EqualValues(http.StatusNotModified, notModified.StatusCode())
+		t.Require().EqualValues("MISS", invalidated.Header().Get(fusHtp.HeaderCacheStatus))
+		t.Require().NotEqual(rsp.Body(), invalidated.Body())
+		t.Require().EqualValues(2, executed.Load())
+	})
+}
+
+func (t *Middleware) TestResponseCacheWithPrincipal() {
+	t.Catch(func() {
+		// Given
+		path := "/TestResponseCacheWithPrincipal"
+		ctx := context.Background()
+		before, executed := atomic.NewInt32(0), atomic.NewInt32(0)
+		router := fusHtp.Use(fusHtp.AppName(t.AppName()))
+		router.
+			Group(path, fusHtp.Authenticate(fusHtp.AppName(t.AppName()))).
+			GET("", func(c *gin.Context) (map[string]any, error) {
+				return map[string]any{"user": fusHtp.GetPrincipal(c).UserID, "executed": executed.Inc()}, nil
+			}, fusHtp.Cached(fusHtp.CacheTTL(time.Minute)), fusHtp.HandleBefore(func(c *gin.Context) {
+				before.Inc()
+			}))
+		router.GET(path+"/anonymous", func(c *gin.Context) (map[string]int32, error) {
+			return map[string]int32{"executed": executed.Inc()}, nil
+		}, fusHtp.Cached(fusHtp.CacheTTL(time.Minute)))
+		router.Start()
+		<-router.Running()
+
+		get := func(uri, header, value string) *resty.Response {
+			rsp, err := fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName())).
+				SetHeader(header, value).
+				Get(t.addr() + uri)
+			t.Require().NoError(err)
+			t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+			return rsp
+		}
+
+		// When
+		user1 := get(path, "X-API-Key", "gofusion-test-key")
+		user1Cached := get(path, "X-API-Key", "gofusion-test-key")
+		user2 := get(path, "X-API-Key", "gofusion-test-key-2")
+		anonymous := get(path+"/anonymous", "Authorization", "Bearer unknown")
+		anonymousAgain := get(path+"/anonymous", "Authorization", "Bearer unknown")
+
+		// Then
+		t.Require().EqualValues("MISS", user1.Header().Get(fusHtp.HeaderCacheStatus))
+		t.Require().EqualValues("HIT", user1Cached.Header().Get(fusHtp.HeaderCacheStatus))
+		t.Require().EqualValues(user1.Body(), user1Cached.Body())
+		t.Require().EqualValues("MISS", user2.Header().Get(fusHtp.HeaderCacheStatus))
+		t.Require().Contains(string(user2.Body()), "api-key-user-2")
+		t.Require().EqualValues(3, before.Load())
+		t.Require().Empty(anonymous.Header().Get(fusHtp.HeaderCacheStatus))
+		t.Require().NotEqual(anonymous.Body(), anonymousAgain.Body())
+		t.Require().EqualValues(4, executed.Load())
+	})
+}
+
+func (t *Middleware) TestResponseCacheWithTenant() {
+	t.Catch(func() {
+		// Given
+		path := "/TestResponseCacheWithTenant"
+		ctx := context.Background()
+		router := fusHtp.Use(fusHtp.AppName(t.AppName()))
+		router.
+			Group(path, fusHtp.Tenant(fusHtp.AppName(t.AppName()), fusHtp.TenantFromHeader())).
+			GET("", func(c *gin.Context) (map[string]string, error) {
+				return map[string]string{"tenant": fusCtx.GetTenantID(fusCtx.New(fusCtx.Gin(c)))}, nil
+			}, fusHtp.Cached(fusHtp.CacheTTL(time.Minute)))
+		router.Start()
+		<-router.Running()
+
+		get := func(tenant string) *resty.Response {
+			rsp, err := fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName())).
+				SetHeader("X-Tenant-ID", tenant).
+				Get(t.addr() + path)
+			t.Require().NoError(err)
+			t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+			return rsp
+		}
+
+		// When
+		tenant1 := get("tenant-1")
+		tenant2 := get("tenant-2")
+		tenant1Cached := get("tenant-1")
+
+		// Then
+		t.Require().EqualValues("MISS", tenant1.Header().Get(fusHtp.HeaderCacheStatus))
+		t.Require().EqualValues("MISS", tenant2.Header().Get(fusHtp.HeaderCacheStatus))
+		t.Require().Contains(string(tenant2.Body()), "tenant-2")
+		t.Require().EqualValues("HIT", tenant1Cached.Header().Get(fusHtp.HeaderCacheStatus))
+		t.Require().Contains(string(tenant1Cached.Body()), "tenant-1")
+	})
+}
+
+func (t *Middleware) TestTenant() {
+	t.Catch(func() {
+		// Given
+		path := "/TestTenant"
+		ctx := context.Background()
+		router := fusHtp.Use(fusHtp.AppName(t.AppName()))
+		handler := func(c *gin.Context) (map[string]string, error) {
+			return map[string]string{"tenant": fusCtx.GetTenantID(fusCtx.New(fusCtx.Gin(c)))}, nil
+		}
+		router.Group(path+"/anonymous", fusHtp.Tenant(fusHtp.AppName(t.AppName()))).GET("", handler)
+		router.Group(path+"/gateway",
+			fusHtp.Tenant(fusHtp.AppName(t.AppName()), fusHtp.TenantFromHeader())).GET("", handler)
+		router.Group(path+"/authenticated", fusHtp.Authenticate(fusHtp.AppName(t.AppName())),
+			fusHtp.Tenant(fusHtp.AppName(t.AppName()))).GET("", handler)
+		router.Group(path+"/trusted", fusHtp.Authenticate(fusHtp.AppName(t.AppName())),
+			fusHtp.Tenant(fusHtp.AppName(t.AppName()), fusHtp.TenantFromHeader())).GET("", handler)
+		router.Start()
+		<-router.Running()
+
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":       "jwt-user",
+			"tenant_id": "claimed",
+			"exp":       time.Now().Add(time.Minute).Unix(),
+		}).SignedString([]byte("gofusion-test-secret"))
+		t.Require().NoError(err)
+		get := func(uri string, headers map[string]string) *resty.Response {
+			rsp, err := fusHtp.NewRequest(ctx, fusHtp.CName(clientLocalName), fusHtp.AppName(t.AppName())).
+				SetHeader("X-Tenant-ID", "forged").
+				SetHeaders(headers).
+				Get(t.addr() + uri)
+			t.Require().NoError(err)
+			return rsp
+		}
+
+		// When
+		anonymous := get(path+"/anonymous", nil)
+		gateway := get(path+"/gateway", nil)
+		claimed := get(path+"/authenticated", map[string]string{"Authorization": "Bearer " + token})
+		forged := get(path+"/authenticated", map[string]string{"X-API-Key": "gofusion-test-key"})
+		trusted := get(path+"/trusted", map[string]string{"X-API-Key": "gofusion-test-key"})
+
+		// Then
+		t.Require().EqualValues(http.StatusForbidden, anonymous.StatusCode())
+		t.Require().EqualValues(http.StatusOK, gateway.StatusCode())
+		t.Require().Contains(string(gateway.Body()), "forged")
+		t.Require().EqualValues(http.StatusOK, claimed.StatusCode())
+		t.Require().Contains(string(claimed.Body()), "claimed")
+		t.Require().EqualValues(http.StatusForbidden, forged.StatusCode())
+		t.Require().EqualValues(http.StatusOK, trusted.StatusCode())
+		t.Require().Contains(string(trusted.Body()), "forged")
+	})
+}
+
 func (t *Middleware) addr() string {
 	conf := fusHtp.Use(fusHtp.AppName(t.AppName())).Config()
 	if conf.TLS {
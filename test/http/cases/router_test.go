@@ -12,12 +12,18 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/suite"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	"github.com/wfusion/gofusion/common/env"
 	"github.com/wfusion/gofusion/common/utils"
+	"github.com/wfusion/gofusion/common/utils/serialize/json"
 	"github.com/wfusion/gofusion/log"
 
 	fusHtp "github.com/wfusion/gofusion/http"
@@ -1731,6 +1737,348 @@ func (t *Router) TestExample35() {
 	})
 }
 
+// case: func(c *gin.Context, req *Struct FromQuery, w SSEWriter) error
+func (t *Router) TestExample36() {
+	t.Catch(func() {
+		// Given
+		type reqStruct struct {
+			Num int `json:"num"`
+		}
+
+		method := http.MethodGet
+		path := "/test"
+		hd := func(c *gin.Context, req *reqStruct, w fusHtp.SSEWriter) error {
+			for i := 0; i < req.Num; i++ {
+				if err := w.Send(fusHtp.SSEEvent{ID: fmt.Sprintf("%v", i), Event: "tick", Data: map[string]int{"i": i}}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path+"?num=3", nil)
+		t.Require().NoError(err)
+		engine := t.ServerGiven(method, path, hd)
+
+		// When
+		engine.ServeHTTP(w, req)
+
+		// Then
+		t.Require().Equal(http.StatusOK, w.Code)
+		t.Require().Equal("text/event-stream", w.Header().Get("Content-Type"))
+		t.Require().Equal(3, strings.Count(w.Body.String(), "event: tick\n"))
+		t.Require().Contains(w.Body.String(), "id: 2\nevent: tick\ndata: {\"i\":2}\n\n")
+	})
+}
+
+// case: func(c *gin.Context) (<-chan T, error)
+func (t *Router) TestExample37() {
+	t.Catch(func() {
+		// Given
+		method := http.MethodGet
+		path := "/test"
+		hd := func(c *gin.Context) (<-chan string, error) {
+			ch := make(chan string)
+			go func() {
+				defer close(ch)
+				for _, s := range []string{"a", "b", "c"} {
+					select {
+					case ch <- s:
+					case <-fusHtp.StreamContext(c).Done():
+						return
+					}
+				}
+			}()
+			return ch, nil
+		}
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path, nil)
+		t.Require().NoError(err)
+		engine := t.ServerGiven(method, path, hd)
+
+		// When
+		engine.ServeHTTP(w, req)
+
+		// Then
+		t.Require().Equal(http.StatusOK, w.Code)
+		t.Require().Equal("data: a\n\ndata: b\n\ndata: c\n\n", w.Body.String())
+	})
+}
+
+// case: func(c *gin.Context) (<-chan T, error) with the client disconnected
+func (t *Router) TestExample37WithDisconnect() {
+	t.Catch(func() {
+		// Given
+		method := http.MethodGet
+		path := "/test"
+		exited := make(chan struct{})
+		hd := func(c *gin.Context) (<-chan int, error) {
+			ch := make(chan int)
+			go func() {
+				defer close(exited)
+				for i := 0; ; i++ {
+					select {
+					case ch <- i:
+					case <-fusHtp.StreamContext(c).Done():
+						return
+					}
+				}
+			}()
+			return ch, nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		w := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(ctx, method, path, nil)
+		t.Require().NoError(err)
+		engine := t.ServerGiven(method, path, hd)
+
+		// When
+		time.AfterFunc(50*time.Millisecond, cancel)
+		engine.ServeHTTP(w, req)
+
+		// Then
+		select {
+		case <-exited:
+		case <-time.After(time.Second):
+			t.FailNow("stream producer is still running after the client disconnected")
+		}
+		t.Require().Equal(http.StatusOK, w.Code)
+		t.Require().Contains(w.Body.String(), "data: 0\n\n")
+	})
+}
+
+// case: func(c *gin.Context, w SSEWriter) error with error before streaming
+func (t *Router) TestExample38() {
+	t.Catch(func() {
+		// Given
+		method := http.MethodGet
+		path := "/test"
+		hd := func(c *gin.Context, w fusHtp.SSEWriter) error {
+			return io.ErrUnexpectedEOF
+		}
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path, nil)
+		t.Require().NoError(err)
+		engine := t.ServerGiven(method, path, hd)
+
+		// When
+		engine.ServeHTTP(w, req)
+
+		// Then
+		t.Require().Equal(http.StatusOK, w.Code)
+		t.Require().Contains(w.Body.String(), io.ErrUnexpectedEOF.Error())
+	})
+}
+
+// case: websocket func(c *gin.Context, conn WSConn, msg *Struct) (rsp any, err error)
+func (t *Router) TestExample39() {
+	t.Catch(func() {
+		// Given
+		type reqStruct struct {
+			Name string `json:"name"`
+		}
+
+		path := "/test"
+		hd := func(c *gin.Context, conn fusHtp.WSConn, msg *reqStruct) (map[string]string, error) {
+			return map[string]string{"hello": msg.Name}, nil
+		}
+		srv := httptest.NewServer(t.ServerGiven("WS", path, hd))
+		defer srv.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, nil)
+		t.Require().NoError(err)
+		defer func() { _ = conn.Close() }()
+
+		// When
+		t.Require().NoError(conn.WriteMessage(websocket.TextMessage, []byte(`{"name":"gofusion"}`)))
+		_, payload, err := conn.ReadMessage()
+
+		// Then
+		t.Require().NoError(err)
+		rsp := new(fusHtp.Response)
+		t.Require().NoError(json.Unmarshal(payload, rsp))
+		t.Require().Equal(0, rsp.Code)
+		t.Require().EqualValues(map[string]any{"hello": "gofusion"}, rsp.Data)
+	})
+}
+
+// case: func(c *gin.Context, req *Struct FromXMLBody) (data Struct, err error) with xml accepted
+func (t *Router) TestExample40() {
+	t.Catch(func() {
+		// Given
+		type reqStruct struct {
+			Name string `json:"name" xml:"name"`
+			Age  int    `json:"age" xml:"age"`
+		}
+		type rspStruct struct {
+			Hello string `json:"hello" xml:"hello"`
+		}
+
+		method := http.MethodPost
+		path := "/test"
+		hd := func(c *gin.Context, req *reqStruct) (data *rspStruct, err error) {
+			t.Require().Equal("gofusion", req.Name)
+			t.Require().Equal(3, req.Age)
+			return &rspStruct{Hello: req.Name}, nil
+		}
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path,
+			strings.NewReader(`<reqStruct><name>gofusion</name><age>3</age></reqStruct>`))
+		t.Require().NoError(err)
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Accept", "application/xml")
+		engine := t.ServerGiven(method, path, hd)
+
+		// When
+		engine.ServeHTTP(w, req)
+
+		// Then
+		t.Require().Equal(http.StatusOK, w.Code)
+		t.Require().Contains(w.Header().Get("Content-Type"), "application/xml")
+		t.Require().Contains(w.Body.String(), "<response>")
+		t.Require().Contains(w.Body.String(), "<hello>gofusion</hello>")
+	})
+}
+
+// case: func(c *gin.Context, req *Struct FromMsgpackBody) (data Struct, err error) with msgpack accepted
+func (t *Router) TestExample41() {
+	t.Catch(func() {
+		// Given
+		type reqStruct struct {
+			Name string   `json:"name" binding:"required"`
+			Tags []string `json:"tags"`
+		}
+
+		method := http.MethodPost
+		path := "/test"
+		hd := func(c *gin.Context, req *reqStruct) (data map[string]any, err error) {
+			t.Require().Equal("gofusion", req.Name)
+			t.Require().Equal([]string{"a", "b"}, req.Tags)
+			return map[string]any{"hello": req.Name}, nil
+		}
+		body, err := msgpack.Marshal(map[string]any{"name": "gofusion", "tags": []string{"a", "b"}})
+		t.Require().NoError(err)
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path, bytes.NewReader(body))
+		t.Require().NoError(err)
+		req.Header.Set("Content-Type", "application/msgpack")
+		req.Header.Set("Accept", "application/x-msgpack")
+		engine := t.ServerGiven(method, path, hd)
+
+		// When
+		engine.ServeHTTP(w, req)
+
+		// Then
+		t.Require().Equal(http.StatusOK, w.Code)
+		t.Require().Equal("application/x-msgpack", w.Header().Get("Content-Type"))
+		rsp := make(map[string]any)
+		t.Require().NoError(msgpack.Unmarshal(w.Body.Bytes(), &rsp))
+		t.Require().EqualValues(map[string]any{"hello": "gofusion"}, rsp["data"])
+	})
+}
+
+// case: func(c *gin.Context, req *Struct FromOctetStreamBody) error
+func (t *Router) TestExample42() {
+	t.Catch(func() {
+		// Given
+		type reqStruct struct {
+			Body io.Reader
+		}
+
+		method := http.MethodPost
+		path := "/test"
+		expect := []byte("this is a raw stream")
+		hd := func(c *gin.Context, req *reqStruct) error {
+			t.Require().NotNil(req.Body)
+			actual, err := io.ReadAll(req.Body)
+			t.Require().NoError(err)
+			t.Require().Equal(expect, actual)
+			return nil
+		}
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path, bytes.NewReader(expect))
+		t.Require().NoError(err)
+		req.Header.Set("Content-Type", "application/octet-stream")
+		engine := t.ServerGiven(method, path, hd)
+
+		// When
+		engine.ServeHTTP(w, req)
+
+		// Then
+		t.Require().Equal(http.StatusOK, w.Code)
+		t.Require().Contains(w.Header().Get("Content-Type"), "application/json")
+	})
+}
+
+// case: func(c *gin.Context) (data Struct, err error) with a browser accept header
+func (t *Router) TestExample43() {
+	t.Catch(func() {
+		// Given
+		type rspStruct struct {
+			Hello string `json:"hello" xml:"hello"`
+		}
+
+		method := http.MethodGet
+		path := "/test"
+		hd := func(c *gin.Context) (data *rspStruct, err error) {
+			return &rspStruct{Hello: "gofusion"}, nil
+		}
+		engine := t.ServerGiven(method, path, hd)
+		accepts := map[string]string{
+			"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": "application/json",
+			"application/xml;q=0.9, application/json;q=0.5":                   "application/xml",
+			"application/xml, application/json":                               "application/json",
+			"*/*":                                                             "application/json",
+		}
+
+		for accept, expected := range accepts {
+			w := httptest.NewRecorder()
+			req, err := http.NewRequest(method, path, nil)
+			t.Require().NoError(err)
+			req.Header.Set("Accept", accept)
+
+			// When
+			engine.ServeHTTP(w, req)
+
+			// Then
+			t.Require().Equal(http.StatusOK, w.Code)
+			t.Require().Contains(w.Header().Get("Content-Type"), expected, accept)
+		}
+	})
+}
+
+// case: func(c *gin.Context) (data proto.Message, err error) with protobuf accepted
+func (t *Router) TestExample44() {
+	t.Catch(func() {
+		// Given
+		method := http.MethodGet
+		path := "/test"
+		hd := func(c *gin.Context) (data *wrapperspb.StringValue, err error) {
+			return wrapperspb.String("gofusion"), nil
+		}
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path, nil)
+		t.Require().NoError(err)
+		req.Header.Set("Accept", "application/x-protobuf")
+		engine := t.ServerGiven(method, path, hd)
+
+		// When
+		engine.ServeHTTP(w, req)
+
+		// Then
+		t.Require().Equal(http.StatusOK, w.Code)
+		t.Require().Equal("application/x-protobuf", w.Header().Get("Content-Type"))
+		t.Require().NotEmpty(w.Header().Get(fusHtp.HeaderResponseCode))
+		actual := new(wrapperspb.StringValue)
+		t.Require().NoError(proto.Unmarshal(w.Body.Bytes(), actual))
+		t.Require().Equal("gofusion", actual.GetValue())
+	})
+}
+
 type routerReqStruct struct {
 	ID      *string `json:"id"`
 	NumList []int   `json:"num_list"`
@@ -2,16 +2,25 @@ package cases
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/suite"
 	"github.com/wfusion/gofusion/log"
 
+	"github.com/wfusion/gofusion/common/utils/serialize/json"
+	"github.com/wfusion/gofusion/health"
+
+	fusHtp "github.com/wfusion/gofusion/http"
 	testHtp "github.com/wfusion/gofusion/test/http"
 )
 
@@ -59,3 +68,196 @@ func (t *Server) TestStartAndStop() {
 		wg.Wait()
 	})
 }
+
+func (t *Server) TestNamedServers() {
+	t.Catch(func() {
+		// Given
+		path := "/TestNamedServers"
+		admin := fusHtp.Use(fusHtp.Name(nameAdmin), fusHtp.AppName(t.AppName()))
+		admin.GET(path, func(c *gin.Context) error {
+			return nil
+		})
+
+		// When
+		adminRsp := httptest.NewRecorder()
+		admin.ServeHTTP(adminRsp, httptest.NewRequest(http.MethodGet, path, nil))
+		defaultRsp := httptest.NewRecorder()
+		fusHtp.Use(fusHtp.AppName(t.AppName())).
+			ServeHTTP(defaultRsp, httptest.NewRequest(http.MethodGet, path, nil))
+
+		// Then
+		t.Require().EqualValues(http.StatusOK, adminRsp.Code)
+		t.Require().EqualValues(http.StatusNotFound, defaultRsp.Code)
+		t.Require().EqualValues(9002, admin.Config().Port)
+		t.Require().EqualValues(9001, fusHtp.Use(fusHtp.AppName(t.AppName())).Config().Port)
+	})
+}
+
+func (t *Server) TestAdmin() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		appName := t.AppName()
+		admin := fusHtp.Use(fusHtp.Name(nameAdmin), fusHtp.AppName(appName))
+		call := func(method, path, body string, authorized bool) (code int, rsp *fusHtp.Response) {
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if authorized {
+				req.Header.Set("X-API-Key", "gofusion-admin-key")
+			}
+			w := httptest.NewRecorder()
+			admin.ServeHTTP(w, req)
+			rsp = new(fusHtp.Response)
+			t.Require().NoError(json.Unmarshal(w.Body.Bytes(), rsp))
+			return w.Code, rsp
+		}
+
+		// When
+		code, _ := call(http.MethodGet, "/admin/logs", "", false)
+
+		// Then
+		t.Require().EqualValues(http.StatusUnauthorized, code)
+
+		// When
+		code, rsp := call(http.MethodGet, "/admin/logs", "", true)
+
+		// Then
+		t.Require().EqualValues(http.StatusOK, code)
+		t.Require().EqualValues(map[string]any{"default": "debug"}, rsp.Data)
+
+		// When
+		code, _ = call(http.MethodPut, "/admin/logs/default", `{"level": "warn"}`, true)
+		defer call(http.MethodPut, "/admin/logs/default", `{"level": "debug"}`, true)
+
+		// Then
+		t.Require().EqualValues(http.StatusOK, code)
+		t.Require().EqualValues(log.WarnLevel, log.Use("default", log.AppName(appName)).Level(ctx))
+
+		// When
+		unknownCode, _ := call(http.MethodPut, "/admin/logs/default", `{"level": "verbose"}`, true)
+		missingCode, _ := call(http.MethodPut, "/admin/logs/missing", `{"level": "info"}`, true)
+
+		// Then
+		t.Require().EqualValues(http.StatusBadRequest, unknownCode)
+		t.Require().EqualValues(http.StatusNotFound, missingCode)
+
+		// When
+		code, _ = call(http.MethodPut, "/admin/loggers/metrics/prometheus-push", `{"enable": false}`, true)
+		defer call(http.MethodPut, "/admin/loggers/metrics/prometheus-push", `{"enable": true}`, true)
+		_, rsp = call(http.MethodGet, "/admin/loggers", "", true)
+
+		// Then
+		t.Require().EqualValues(http.StatusOK, code)
+		t.Require().EqualValues(false, rsp.Data.(map[string]any)["metrics"].(map[string]any)["prometheus-push"])
+		t.Require().Contains(rsp.Data.(map[string]any)["http"], nameAdmin)
+
+		// When
+		code, _ = call(http.MethodPut, "/admin/loggers/http/"+nameAdmin, `{"enable": true}`, true)
+		defer call(http.MethodPut, "/admin/loggers/http/"+nameAdmin, `{"enable": false}`, true)
+		_, rsp = call(http.MethodGet, "/admin/loggers", "", true)
+
+		// Then
+		t.Require().EqualValues(http.StatusOK, code)
+		t.Require().EqualValues(true, rsp.Data.(map[string]any)["http"].(map[string]any)[nameAdmin])
+
+		// When
+		configCode, rsp := call(http.MethodGet, "/admin/configs", "", true)
+		routinesCode, _ := call(http.MethodGet, "/admin/routines", "", true)
+
+		// Then
+		t.Require().EqualValues(http.StatusOK, configCode)
+		t.Require().NotEmpty(rsp.Data.(map[string]any)["base"])
+		dumped, err := json.Marshal(rsp.Data)
+		t.Require().NoError(err)
+		t.Require().NotContains(string(dumped), "gofusion-admin-key")
+		t.Require().NotContains(string(dumped), "gofusion-test-key")
+		t.Require().NotContains(string(dumped), "gofusion-test-secret")
+		t.Require().EqualValues(http.StatusOK, routinesCode)
+	})
+}
+
+func (t *Server) TestMutualTLS() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		path := "/TestMutualTLS"
+		secure := fusHtp.Use(fusHtp.Name(nameSecure), fusHtp.AppName(t.AppName()))
+		secure.GET(path, func(c *gin.Context) error {
+			return nil
+		})
+		secure.Start()
+		<-secure.Running()
+		time.Sleep(time.Second)
+
+		// When
+		rsp, err := fusHtp.NewRequest(ctx, fusHtp.AppName(t.AppName()), fusHtp.CName(clientMTLSName)).
+			Get("https://localhost:9003" + path)
+
+		// Then
+		t.Require().NoError(err)
+		t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+
+		// When
+		ca, err := os.ReadFile("../configs/certs/ca.pem")
+		t.Require().NoError(err)
+		pool := x509.NewCertPool()
+		t.Require().True(pool.AppendCertsFromPEM(ca))
+		cli := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+		_, err = cli.Get("https://localhost:9003" + path)
+
+		// Then
+		t.Require().Error(err)
+	})
+}
+
+func (t *Server) TestHealth() {
+	t.Catch(func() {
+		// Given
+		appName := t.AppName()
+		r := fusHtp.Use(fusHtp.AppName(appName))
+		probe := func(path string) (code int, report *health.Report) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			report = new(health.Report)
+			t.Require().NoError(json.Unmarshal(w.Body.Bytes(), report))
+			return w.Code, report
+		}
+		failed := errors.New("unreachable")
+		health.Register("custom", "required", func(ctx context.Context) error { return nil },
+			health.AppName(appName))
+		health.Register("custom", "optional", func(ctx context.Context) error { return failed },
+			health.AppName(appName))
+		defer health.Unregister("custom", "required", health.AppName(appName))
+		defer health.Unregister("custom", "optional", health.AppName(appName))
+
+		// When
+		code, report := probe("/healthz")
+
+		// Then
+		t.Require().EqualValues(http.StatusOK, code)
+		t.Require().EqualValues(health.StatusDegraded, report.Status)
+
+		// When
+		health.Register("custom", "required", func(ctx context.Context) error { return failed },
+			health.AppName(appName))
+		code, report = probe("/readyz")
+
+		// Then
+		t.Require().EqualValues(http.StatusServiceUnavailable, code)
+		t.Require().EqualValues(health.StatusDown, report.Status)
+
+		// When
+		health.Register("custom", "required", func(ctx context.Context) error { return nil },
+			health.AppName(appName))
+		health.Drain(health.AppName(appName))
+		defer health.Resume(health.AppName(appName))
+		readyCode, readyReport := probe("/readyz")
+		liveCode, liveReport := probe("/livez")
+
+		// Then
+		t.Require().EqualValues(http.StatusServiceUnavailable, readyCode)
+		t.Require().True(readyReport.Draining)
+		t.Require().EqualValues(http.StatusOK, liveCode)
+		t.Require().EqualValues(health.StatusUp, liveReport.Status)
+	})
+}
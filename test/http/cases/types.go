@@ -1,6 +1,12 @@
 package cases
 
 const (
-	clientDefaultName = "default"
-	clientLocalName   = "local"
+	nameAdmin  = "admin"
+	nameSecure = "secure"
+
+	clientDefaultName   = "default"
+	clientLocalName     = "local"
+	clientMTLSName      = "mtls"
+	clientResilientName = "resilient"
+	clientTimeoutName   = "timeout"
 )
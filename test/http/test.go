@@ -98,6 +98,8 @@ func (t *Test) ServerGiven(method, path string, hd any) (r fusHtp.IRouter) {
 		r.Any(path, hd)
 	case "Handle":
 		r.Handle(path, hd)
+	case "WS":
+		r.WS(path, hd)
 	case "File":
 		r.StaticFile(path, hd.(string))
 	}
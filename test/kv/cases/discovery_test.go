@@ -0,0 +1,253 @@
+package cases
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/wfusion/gofusion/kv"
+	"github.com/wfusion/gofusion/log"
+
+	fusHtp "github.com/wfusion/gofusion/http"
+	testKV "github.com/wfusion/gofusion/test/kv"
+)
+
+func TestDiscovery(t *testing.T) {
+	testingSuite := &Discovery{Test: new(testKV.Test)}
+	testingSuite.Init(testingSuite)
+	suite.Run(t, testingSuite)
+}
+
+type Discovery struct {
+	*testKV.Test
+}
+
+func (t *Discovery) BeforeTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right before %s %s", suiteName, testName)
+	})
+}
+
+func (t *Discovery) AfterTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right after %s %s", suiteName, testName)
+	})
+}
+
+func (t *Discovery) TestRedis() {
+	t.defaultTest(nameRedis, time.Second)
+}
+
+func (t *Discovery) TestEtcd() {
+	t.defaultTest(nameEtcd, time.Second)
+}
+
+func (t *Discovery) TestConsul() {
+	t.defaultTest(nameConsul, time.Second)
+}
+
+func (t *Discovery) TestBalancers() {
+	t.Run("RoundRobin", t.testRoundRobin)
+	t.Run("LeastInFlight", t.testLeastInFlight)
+	t.Run("ConsistentHash", t.testConsistentHash)
+	t.Run("Ejection", t.testEjection)
+}
+
+func (t *Discovery) defaultTest(name string, wait time.Duration) {
+	t.Run(name+"_RegisterAndResolve", func() { t.testRegisterAndResolve(name, wait) })
+}
+
+func (t *Discovery) testRegisterAndResolve(name string, wait time.Duration) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		service := "gofusion-discovery-" + name
+		instances := []*kv.ServiceInstance{
+			{Service: service, Address: "127.0.0.1", Port: 8001, Meta: map[string]string{"zone": "a"}},
+			{Service: service, Address: "127.0.0.1", Port: 8002, Meta: map[string]string{"zone": "b"}},
+		}
+
+		// When
+		deregisters := make([]func(), 0, len(instances))
+		for _, ins := range instances {
+			deregister, err := kv.RegisterService(ctx, name, ins, kv.AppName(t.AppName()), kv.ServiceTTL(10*time.Second))
+			t.Require().NoError(err)
+			deregisters = append(deregisters, deregister)
+		}
+		time.Sleep(wait)
+
+		// Then
+		found, err := kv.ResolveService(ctx, name, service, kv.AppName(t.AppName()))
+		t.Require().NoError(err)
+		t.Require().Len(found, len(instances))
+		t.Require().Equal(instances[0].Host(), found[0].Host())
+		t.Require().Equal("a", found[0].Meta["zone"])
+		t.Require().Equal(instances[1].Host(), found[1].Host())
+
+		deregisters[0]()
+		time.Sleep(wait)
+		found, err = kv.ResolveService(ctx, name, service, kv.AppName(t.AppName()))
+		t.Require().NoError(err)
+		t.Require().Len(found, 1)
+		t.Require().Equal(instances[1].ID, found[0].ID)
+
+		deregisters[1]()
+		time.Sleep(wait)
+		found, err = kv.ResolveService(ctx, name, service, kv.AppName(t.AppName()))
+		t.Require().NoError(err)
+		t.Require().Empty(found)
+	})
+}
+
+func (t *Discovery) testRoundRobin() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		hits, cleanup := t.startInstances(ctx, "gofusion-balancer-round-robin", 2, nil)
+		defer cleanup()
+		cli := fusHtp.New(fusHtp.AppName(t.AppName()), fusHtp.CName(clientRoundRobin))
+
+		// When
+		for i := 0; i < 4; i++ {
+			rsp, err := cli.R().SetContext(ctx).Get("/")
+			t.Require().NoError(err)
+			t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+		}
+
+		// Then
+		t.Require().EqualValues(2, hits[0].Load())
+		t.Require().EqualValues(2, hits[1].Load())
+	})
+}
+
+func (t *Discovery) testLeastInFlight() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		blocked, release := make(chan int, 1), make(chan struct{})
+		hits, cleanup := t.startInstances(ctx, "gofusion-balancer-least-in-flight", 2,
+			func(idx int, w http.ResponseWriter, r *http.Request) bool {
+				if r.URL.Path != "/block" {
+					return false
+				}
+				blocked <- idx
+				<-release
+				return true
+			})
+		defer cleanup()
+		cli := fusHtp.New(fusHtp.AppName(t.AppName()), fusHtp.CName(clientLeastInFlight))
+		done := make(chan error, 1)
+		go func() { _, err := cli.R().SetContext(ctx).Get("/block"); done <- err }()
+		busy := <-blocked
+
+		// When
+		for i := 0; i < 4; i++ {
+			rsp, err := cli.R().SetContext(ctx).Get("/")
+			t.Require().NoError(err)
+			t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+		}
+		close(release)
+
+		// Then
+		t.Require().NoError(<-done)
+		t.Require().EqualValues(0, hits[busy].Load())
+		t.Require().EqualValues(4, hits[1-busy].Load())
+	})
+}
+
+func (t *Discovery) testConsistentHash() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		hits, cleanup := t.startInstances(ctx, "gofusion-balancer-consistent-hash", 3, nil)
+		defer cleanup()
+		cli := fusHtp.New(fusHtp.AppName(t.AppName()), fusHtp.CName(clientConsistentHash))
+
+		// When
+		for i := 0; i < 6; i++ {
+			rsp, err := cli.R().SetContext(ctx).SetHeader("X-Hash-Key", "user-1").Get("/" + strconv.Itoa(i))
+			t.Require().NoError(err)
+			t.Require().EqualValues(http.StatusOK, rsp.StatusCode())
+		}
+
+		// Then
+		total, most := int64(0), int64(0)
+		for _, hit := range hits {
+			total += hit.Load()
+			if hit.Load() > most {
+				most = hit.Load()
+			}
+		}
+		t.Require().EqualValues(6, total)
+		t.Require().EqualValues(6, most)
+	})
+}
+
+func (t *Discovery) testEjection() {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		hits, cleanup := t.startInstances(ctx, "gofusion-balancer-ejection", 2,
+			func(idx int, w http.ResponseWriter, r *http.Request) bool {
+				if idx != 0 {
+					return false
+				}
+				w.WriteHeader(http.StatusInternalServerError)
+				return true
+			})
+		defer cleanup()
+		cli := fusHtp.New(fusHtp.AppName(t.AppName()), fusHtp.CName(clientEjection))
+
+		// When
+		for i := 0; i < 6; i++ {
+			_, err := cli.R().SetContext(ctx).Get("/")
+			t.Require().NoError(err)
+		}
+
+		// Then
+		t.Require().EqualValues(2, hits[0].Load())
+		t.Require().EqualValues(4, hits[1].Load())
+	})
+}
+
+// startInstances starts servers registered as instances of the service through redis, requests not handled by
+// handle are responded with 200 and counted in hits
+func (t *Discovery) startInstances(ctx context.Context, service string, n int,
+	handle func(idx int, w http.ResponseWriter, r *http.Request) bool) (hits []*atomic.Int64, cleanup func()) {
+	hits = make([]*atomic.Int64, n)
+	cleanups := make([]func(), 0, 2*n)
+	for i := 0; i < n; i++ {
+		idx := i
+		hits[idx] = new(atomic.Int64)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if handle != nil && handle(idx, w, r) {
+				if r.URL.Path == "/" {
+					hits[idx].Add(1)
+				}
+				return
+			}
+			hits[idx].Add(1)
+		}))
+		u, err := url.Parse(srv.URL)
+		t.Require().NoError(err)
+		port, err := strconv.Atoi(u.Port())
+		t.Require().NoError(err)
+		deregister, err := kv.RegisterService(ctx, nameRedis,
+			&kv.ServiceInstance{Service: service, Address: u.Hostname(), Port: port},
+			kv.AppName(t.AppName()), kv.ServiceTTL(10*time.Second))
+		t.Require().NoError(err)
+		cleanups = append(cleanups, srv.Close, deregister)
+	}
+	return hits, func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+}
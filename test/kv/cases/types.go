@@ -5,4 +5,9 @@ const (
 	nameEtcd   = "etcd"
 	nameConsul = "consul"
 	nameZK     = "zookeeper"
+
+	clientRoundRobin     = "round_robin"
+	clientLeastInFlight  = "least_in_flight"
+	clientConsistentHash = "consistent_hash"
+	clientEjection       = "ejection"
 )
@@ -0,0 +1,104 @@
+package cases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm/idgen"
+	"github.com/wfusion/gofusion/kv"
+	"github.com/wfusion/gofusion/log"
+
+	testKV "github.com/wfusion/gofusion/test/kv"
+)
+
+func TestWorker(t *testing.T) {
+	testingSuite := &Worker{Test: new(testKV.Test)}
+	testingSuite.Init(testingSuite)
+	suite.Run(t, testingSuite)
+}
+
+type Worker struct {
+	*testKV.Test
+}
+
+func (t *Worker) BeforeTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right before %s %s", suiteName, testName)
+	})
+}
+
+func (t *Worker) AfterTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right after %s %s", suiteName, testName)
+	})
+}
+
+func (t *Worker) TestRedis() {
+	t.defaultTest(nameRedis, time.Second)
+}
+
+func (t *Worker) TestEtcd() {
+	t.defaultTest(nameEtcd, 2*time.Second)
+}
+
+func (t *Worker) TestConsul() {
+	// consul sessions live for 10s at least
+	t.defaultTest(nameConsul, 10*time.Second)
+}
+
+func (t *Worker) defaultTest(name string, ttl time.Duration) {
+	t.Run(name+"_Exhausted", func() { t.testExhausted(name) })
+	t.Run(name+"_Lost", func() { t.testLost(name, ttl) })
+}
+
+func (t *Worker) testExhausted(name string) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		leaser := kv.WorkerLeaser(ctx, name, kv.AppName(t.AppName()),
+			kv.WorkerPrefix("/gofusion/test/idgen/exhausted/"))
+		held, err := idgen.NewLeasedSnowflake(ctx, leaser, idgen.WorkerPoolSize(1))
+		t.Require().NoError(err)
+		defer func() { t.Require().NoError(held.Close()) }()
+
+		// When
+		_, err = idgen.NewLeasedSnowflake(ctx, leaser, idgen.WorkerPoolSize(1))
+
+		// Then
+		t.Require().ErrorIs(err, idgen.ErrWorkerIDExhausted)
+	})
+}
+
+func (t *Worker) testLost(name string, ttl time.Duration) {
+	t.Catch(func() {
+		// Given
+		ctx := context.Background()
+		leaser := kv.WorkerLeaser(ctx, name, kv.AppName(t.AppName()), kv.WorkerPrefix("/gofusion/test/idgen/lost/"))
+		lost, err := idgen.NewLeasedSnowflake(ctx, leaser,
+			idgen.WorkerPoolSize(1), idgen.WorkerTTL(ttl), idgen.WorkerOwner("lost"))
+		t.Require().NoError(err)
+		defer func() { t.Require().NoError(lost.Close()) }()
+		_, err = lost.Next()
+		t.Require().NoError(err)
+
+		// When
+		t.Require().NoError(leaser.Release(ctx, "lost", lost.WorkerID()))
+		taker, err := idgen.NewLeasedSnowflake(ctx, leaser,
+			idgen.WorkerPoolSize(1), idgen.WorkerTTL(ttl), idgen.WorkerOwner("taker"))
+		t.Require().NoError(err)
+		defer func() { t.Require().NoError(taker.Close()) }()
+
+		// Then
+		t.Require().Equal(lost.WorkerID(), taker.WorkerID())
+		t.Require().Eventually(func() bool {
+			_, err := lost.Next()
+			return errors.Is(err, idgen.ErrWorkerIDLost)
+		}, ttl, ttl/10)
+		_, err = taker.Next()
+		t.Require().NoError(err)
+	})
+}
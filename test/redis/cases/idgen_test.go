@@ -0,0 +1,92 @@
+package cases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/wfusion/gofusion/common/infra/drivers/orm/idgen"
+	"github.com/wfusion/gofusion/log"
+	"github.com/wfusion/gofusion/redis"
+
+	testRedis "github.com/wfusion/gofusion/test/redis"
+)
+
+func TestIDGen(t *testing.T) {
+	testingSuite := &IDGen{Test: new(testRedis.Test)}
+	testingSuite.Init(testingSuite)
+	suite.Run(t, testingSuite)
+}
+
+type IDGen struct {
+	*testRedis.Test
+}
+
+func (t *IDGen) BeforeTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right before %s %s", suiteName, testName)
+	})
+}
+
+func (t *IDGen) AfterTest(suiteName, testName string) {
+	t.Catch(func() {
+		log.Info(context.Background(), "right after %s %s", suiteName, testName)
+	})
+}
+
+func (t *IDGen) TestExhausted() {
+	t.Catch(func() {
+		// Given
+		key := "{gofusion:test:idgen:exhausted}"
+		ctx := context.Background()
+		rdsCli := redis.Use(ctx, nameDefault, redis.AppName(t.AppName()))
+		defer rdsCli.Del(ctx, key+":owners", key+":expires")
+		leaser := idgen.NewRedisWorkerLeaser(rdsCli, key)
+		held, err := idgen.NewLeasedSnowflake(ctx, leaser, idgen.WorkerPoolSize(1))
+		t.Require().NoError(err)
+		defer func() { t.Require().NoError(held.Close()) }()
+
+		// When
+		_, err = idgen.NewLeasedSnowflake(ctx, leaser, idgen.WorkerPoolSize(1))
+
+		// Then
+		t.Require().ErrorIs(err, idgen.ErrWorkerIDExhausted)
+	})
+}
+
+func (t *IDGen) TestLost() {
+	t.Catch(func() {
+		// Given
+		ttl := time.Second
+		key := "{gofusion:test:idgen:lost}"
+		ctx := context.Background()
+		rdsCli := redis.Use(ctx, nameDefault, redis.AppName(t.AppName()))
+		defer rdsCli.Del(ctx, key+":owners", key+":expires")
+		leaser := idgen.NewRedisWorkerLeaser(rdsCli, key)
+		lost, err := idgen.NewLeasedSnowflake(ctx, leaser,
+			idgen.WorkerPoolSize(1), idgen.WorkerTTL(ttl), idgen.WorkerOwner("lost"))
+		t.Require().NoError(err)
+		defer func() { t.Require().NoError(lost.Close()) }()
+		_, err = lost.Next()
+		t.Require().NoError(err)
+
+		// When
+		t.Require().NoError(leaser.Release(ctx, "lost", lost.WorkerID()))
+		taker, err := idgen.NewLeasedSnowflake(ctx, leaser,
+			idgen.WorkerPoolSize(1), idgen.WorkerTTL(ttl), idgen.WorkerOwner("taker"))
+		t.Require().NoError(err)
+		defer func() { t.Require().NoError(taker.Close()) }()
+
+		// Then
+		t.Require().Equal(lost.WorkerID(), taker.WorkerID())
+		t.Require().Eventually(func() bool {
+			_, err := lost.Next()
+			return errors.Is(err, idgen.ErrWorkerIDLost)
+		}, ttl, ttl/10)
+		_, err = taker.Next()
+		t.Require().NoError(err)
+	})
+}